@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/syself/hetzner-cloud-controller-manager/hcloud"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// newDescribeServiceCommand returns the describe-service command, which prints
+// the Load Balancer configuration resolved from the annotations of a Service
+// manifest without any request to the Hetzner Cloud API.
+func newDescribeServiceCommand() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "describe-service",
+		Short: "Print the Load Balancer configuration resolved from the annotations of a Service",
+		Long: `Parses the annotations of a Service manifest (YAML or JSON) and prints the
+resolved Load Balancer configuration, without any request to the Hetzner Cloud
+API. The Load Balancer defaults are read from the environment.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var (
+				data []byte
+				err  error
+			)
+			if file == "-" {
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return err
+			}
+
+			var svc corev1.Service
+			if err := yaml.UnmarshalStrict(data, &svc); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			cfg, err := hcloud.DescribeService(&svc)
+			if err != nil {
+				return err
+			}
+			for _, k := range cfg.UnknownAnnotations {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: unknown annotation %s is ignored\n", k)
+			}
+
+			out, err := yaml.Marshal(cfg)
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(out)
+			return err
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "-", "Service manifest to describe, - for stdin")
+	return cmd
+}
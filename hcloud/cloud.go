@@ -18,24 +18,38 @@ package hcloud
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/metadata"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/credentials"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
 	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/robot/client/cache"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/tracing"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/util"
+	"github.com/syself/hrobot-go/models"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
@@ -50,6 +64,63 @@ const (
 	robotDebugENVVar     = "ROBOT_DEBUG"
 	robotEndpointENVVar  = "ROBOT_ENDPOINT"
 
+	// Verify the robot credentials on startup. "warn" logs a failure, "fail"
+	// aborts the start. Disabled if unset.
+	robotStartupCheckENVVar = "ROBOT_STARTUP_CHECK"
+
+	// Skip the TLS verification for a custom HCLOUD_ENDPOINT, e.g. a mock
+	// or proxy. Rejected for the default endpoint.
+	hcloudEndpointInsecureENVVar = "HCLOUD_ENDPOINT_INSECURE"
+
+	// Send the requests for some resource types to other endpoints, e.g.
+	// "servers=https://proxy.example.com/v1".
+	hcloudEndpointOverridesENVVar = "HCLOUD_ENDPOINT_OVERRIDES"
+
+	// Export OpenTelemetry traces of reconciliations and API calls. The
+	// exporter is configured with the standard OTEL_* variables.
+	hcloudTracingEnabledENVVar = "HCLOUD_TRACING_ENABLED"
+
+	// Obtain the token by running a command instead of reading it from the
+	// credentials directory or HCLOUD_TOKEN. The command is run again before
+	// the token expires, or in HCLOUD_TOKEN_COMMAND_INTERVAL.
+	hcloudTokenCommandENVVar         = "HCLOUD_TOKEN_COMMAND"
+	hcloudTokenCommandIntervalENVVar = "HCLOUD_TOKEN_COMMAND_INTERVAL"
+
+	// Select the IP of the nodes in the network used as gateway of the
+	// routes to their pod CIDRs: "primary" (default) or "alias".
+	hcloudNetworkRoutesGatewayENVVar = "HCLOUD_NETWORK_ROUTES_GATEWAY"
+
+	// Pause all changes of Load Balancers and routes, e.g. during a planned
+	// maintenance of the cluster. Instances are still looked up.
+	hcloudMaintenanceModeENVVar = "HCLOUD_MAINTENANCE_MODE"
+
+	// Select the provider ID of new robot nodes: "hcloud" (default) for
+	// "hcloud://bm-<server number>" or "hrobot" for "hrobot://<server number>".
+	hcloudRobotProviderIDFormatENVVar = "HCLOUD_ROBOT_PROVIDER_ID_FORMAT"
+
+	// Restrict the gateways of the routes to IPs of the nodes in these
+	// subnets of the network, separated by commas, in order of preference.
+	hcloudNetworkRoutesSubnetsENVVar = "HCLOUD_NETWORK_ROUTES_SUBNETS"
+
+	// Delete the routes of the cluster whose node no longer exists once on
+	// startup. The routes are owned by the cluster HCLOUD_CLUSTER_NAME if
+	// set, otherwise by "kubernetes", the default --cluster-name.
+	hcloudNetworkRoutesCleanupOrphanedENVVar = "HCLOUD_NETWORK_ROUTES_CLEANUP_ORPHANED"
+
+	// Enable the delete protection of the network of the routes.
+	hcloudNetworkRoutesProtectNetworkENVVar = "HCLOUD_NETWORK_ROUTES_PROTECT_NETWORK"
+
+	// Tune the exponential backoff of retried Hetzner Cloud API requests,
+	// e.g. after rate limiting. The delays are jittered between the base and
+	// base * multiplier^retries, capped at the maximum.
+	hcloudAPIBackoffBaseENVVar       = "HCLOUD_API_BACKOFF_BASE"
+	hcloudAPIBackoffMaxENVVar        = "HCLOUD_API_BACKOFF_MAX"
+	hcloudAPIBackoffMultiplierENVVar = "HCLOUD_API_BACKOFF_MULTIPLIER"
+
+	// Interval between the polls of running Hetzner Cloud actions, e.g. while
+	// waiting for a Load Balancer to be created. Default is 500ms.
+	hcloudActionPollIntervalENVVar = "HCLOUD_ACTION_POLL_INTERVAL"
+
 	// Only as reference - is used in hcops package.
 	// Default is 5 minutes.
 	RateLimitWaitTimeRobot = "RATE_LIMIT_WAIT_TIME_ROBOT"
@@ -58,20 +129,66 @@ const (
 	hcloudNetworkDisableAttachedCheckENVVar  = "HCLOUD_NETWORK_DISABLE_ATTACHED_CHECK"
 	hcloudNetworkRoutesEnabledENVVar         = "HCLOUD_NETWORK_ROUTES_ENABLED"
 	hcloudInstancesAddressFamily             = "HCLOUD_INSTANCES_ADDRESS_FAMILY"
+	hcloudProviderIDAdditionalPrefix         = "HCLOUD_PROVIDER_ID_ADDITIONAL_PREFIX"
+	hcloudDiscoverProviderID                 = "HCLOUD_DISCOVER_PROVIDER_ID"
+	hcloudMatchNodeNameLabel                 = "HCLOUD_MATCH_NODE_NAME_LABEL"
+	hcloudPreloadInstances                   = "HCLOUD_PRELOAD_INSTANCES"
+	hcloudPreloadInstancesStatuses           = "HCLOUD_PRELOAD_INSTANCES_STATUSES"
+	hcloudPreloadInstancesExcludeStatuses    = "HCLOUD_PRELOAD_INSTANCES_EXCLUDE_STATUSES"
+	hcloudNodeAddressOrder                   = "HCLOUD_NODE_ADDRESS_ORDER"
+	hcloudTopologyUseDatacenter              = "HCLOUD_TOPOLOGY_USE_DATACENTER"
+	hcloudInstancesMetadataFallbackTTL       = "HCLOUD_INSTANCES_METADATA_FALLBACK_TTL"
+	hcloudInstancesMetadataCacheTTL          = "HCLOUD_INSTANCES_METADATA_CACHE_TTL"
+	hcloudInstanceNotFoundGrace              = "HCLOUD_INSTANCE_NOT_FOUND_GRACE"
+	hcloudInstancesLookupCondition           = "HCLOUD_INSTANCES_LOOKUP_CONDITION"
+	hcloudInstancesServerIDLabel             = "HCLOUD_INSTANCES_SERVER_ID_LABEL"
 	hcloudLoadBalancersEnabledENVVar         = "HCLOUD_LOAD_BALANCERS_ENABLED"
 	hcloudLoadBalancersLocation              = "HCLOUD_LOAD_BALANCERS_LOCATION"
 	hcloudLoadBalancersNetworkZone           = "HCLOUD_LOAD_BALANCERS_NETWORK_ZONE"
+	hcloudLoadBalancersDefaultLocation       = "HCLOUD_LOAD_BALANCERS_DEFAULT_LOCATION"
 	hcloudLoadBalancersDisablePrivateIngress = "HCLOUD_LOAD_BALANCERS_DISABLE_PRIVATE_INGRESS"
 	hcloudLoadBalancersUsePrivateIP          = "HCLOUD_LOAD_BALANCERS_USE_PRIVATE_IP"
 	hcloudLoadBalancersDisableIPv6           = "HCLOUD_LOAD_BALANCERS_DISABLE_IPV6"
+	hcloudLoadBalancersAlgorithm             = "HCLOUD_LOAD_BALANCERS_ALGORITHM"
+	hcloudLoadBalancersHealthCheckInterval   = "HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_INTERVAL"
+	hcloudLoadBalancersHealthCheckTimeout    = "HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_TIMEOUT"
+	hcloudLoadBalancersHealthCheckRetries    = "HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_RETRIES"
+	hcloudLoadBalancersReportTargetHealth    = "HCLOUD_LOAD_BALANCERS_REPORT_TARGET_HEALTH"
+	hcloudLoadBalancersSkipWithoutPorts      = "HCLOUD_LOAD_BALANCERS_SKIP_SERVICES_WITHOUT_PORTS"
+	hcloudLoadBalancersNodeDrainEnabled      = "HCLOUD_LOAD_BALANCERS_NODE_DRAIN_ENABLED"
+	hcloudLoadBalancersNodeDrainTimeout      = "HCLOUD_LOAD_BALANCERS_NODE_DRAIN_TIMEOUT"
+	hcloudLoadBalancersAnnotateNodes         = "HCLOUD_LOAD_BALANCERS_ANNOTATE_NODES"
+	hcloudLoadBalancersProfilesConfigMap     = "HCLOUD_LOAD_BALANCERS_PROFILES_CONFIGMAP"
+	hcloudLoadBalancersDeleteRetries         = "HCLOUD_LOAD_BALANCERS_DELETE_RETRIES"
+	hcloudLoadBalancersDeleteRetryDelay      = "HCLOUD_LOAD_BALANCERS_DELETE_RETRY_DELAY"
+	hcloudLoadBalancersUpdateDedupWindow     = "HCLOUD_LOAD_BALANCERS_UPDATE_DEDUP_WINDOW"
+	hcloudLoadBalancersNameMaxLength         = "HCLOUD_LOAD_BALANCERS_NAME_MAX_LENGTH"
+	hcloudLoadBalancerDriftInterval          = "HCLOUD_LOAD_BALANCER_DRIFT_INTERVAL"
+	hcloudLBManagedLabelPrefix               = "HCLOUD_LB_MANAGED_LABEL_PREFIX"
+	hcloudLBRemoveCordonedAfter              = "HCLOUD_LB_REMOVE_CORDONED_AFTER"
+	hcloudInstanceTypeMapping                = "HCLOUD_INSTANCE_TYPE_MAPPING"
+	hcloudInstanceTypeMappingFile            = "HCLOUD_INSTANCE_TYPE_MAPPING_FILE"
+	hcloudClusterName                        = "HCLOUD_CLUSTER_NAME"
+	hcloudLoadBalancerClass                  = "HCLOUD_LOAD_BALANCER_CLASS"
+	hcloudLoadBalancerNamespaces             = "HCLOUD_LOAD_BALANCER_NAMESPACES"
+	hcloudCredentialsReloadJitter            = "HCLOUD_CREDENTIALS_RELOAD_JITTER"
 	hcloudMetricsEnabledENVVar               = "HCLOUD_METRICS_ENABLED"
 	hcloudMetricsAddress                     = ":8233"
 	providerName                             = "hcloud"
 	hostNamePrefixRobot                      = "bm-"
 )
 
+const (
+	// Disabled by default. Fetches the metrics of the managed Load Balancers
+	// from the Hetzner Cloud API and exposes them on the metrics endpoint.
+	hcloudLoadBalancerMetrics         = "HCLOUD_LOAD_BALANCER_METRICS"
+	hcloudLoadBalancerMetricsInterval = "HCLOUD_LOAD_BALANCER_METRICS_INTERVAL"
+)
+
 var errMissingRobotCredentials = errors.New("missing robot credentials - cannot connect to robot API")
 
+var registerReloadHandler sync.Once
+
 // providerVersion is set by the build process using -ldflags -X.
 var providerVersion = "unknown"
 
@@ -81,7 +198,64 @@ type cloud struct {
 	instances    *instances
 	routes       *routes
 	loadBalancer *loadBalancers
-	networkID    int64
+	network      *hcops.NetworkRef
+	networkName  string
+	routeGateway routeGateway
+	routeSubnets []*net.IPNet
+	maintenance  bool
+
+	// apiRetry configures the retries of mutating API calls after transient
+	// errors which the hcloud client does not retry itself.
+	apiRetry hcops.RetryOpts
+
+	// routesNodeClient is used by the routes to look up the annotations of
+	// nodes. Set by Initialize.
+	routesNodeClient kubernetes.Interface
+
+	// routesCleanupOrphaned is set if orphaned routes of routesClusterName
+	// are deleted when the routes are created first.
+	routesCleanupOrphaned bool
+	routesClusterName     string
+	routesCleanupOnce     sync.Once
+
+	// routesProtectNetwork is set if the delete protection of the network
+	// of the routes is enabled.
+	routesProtectNetwork bool
+
+	// nodeDrainer is set if nodes should be drained from all Load Balancers
+	// before they are deleted.
+	nodeDrainer      nodeDrainer
+	nodeDrainTimeout time.Duration
+
+	// lbProfiles is set if Load Balancer profiles are read from a ConfigMap.
+	lbProfiles *configMapLBProfiles
+
+	// lbDriftInterval is the interval in which all Load Balancers are
+	// reconciled to correct out-of-band changes. Zero disables it.
+	lbDriftInterval time.Duration
+
+	// lbMetrics is set if the metrics of the Load Balancers are exported.
+	lbMetrics *lbMetricsExporter
+
+	// nodeMembership is set if nodes are annotated with the Load Balancers
+	// they are a target of.
+	nodeMembership *nodeLBMembership
+
+	// eventBroadcaster sends the Events of the Load Balancers to the API
+	// server, once Initialize provides a client.
+	eventBroadcaster record.EventBroadcaster
+
+	// lbProvisioning reports Load Balancer provisioning errors on the
+	// Services.
+	lbProvisioning *lbProvisioningStatus
+
+	// lbTargetHealth is set if the target health of the Load Balancers is
+	// written to the Services.
+	lbTargetHealth *lbTargetHealth
+
+	// refreshToken is set if the hcloud token is obtained from a command. It
+	// is started by Initialize and refreshes the token until stop is closed.
+	refreshToken func(ctx context.Context)
 }
 
 type LoggingTransport struct {
@@ -103,41 +277,172 @@ func (lt *LoggingTransport) RoundTrip(req *http.Request) (resp *http.Response, e
 	return resp, nil
 }
 
-func newHcloudClient(rootDir string) (*hcloud.Client, error) {
+// newHcloudClient returns the hcloud client. If the token is obtained from a
+// command, refreshToken is returned as well, which refreshes the token of the
+// client until its context is done.
+func newHcloudClient(rootDir string) (*hcloud.Client, func(ctx context.Context), error) {
 	credentialsDir := credentials.GetDirectory(rootDir)
-	token, err := credentials.GetInitialHcloudCredentialsFromDirectory(credentialsDir)
-	if err != nil {
-		klog.V(1).Infof("reading Hetzner Cloud token from directory failed. Will try env var: %s", err.Error())
-		token = os.Getenv(hcloudTokenENVVar)
-		if token == "" {
-			return nil, fmt.Errorf("Either token from directory %q or environment variable %q is required", credentialsDir, hcloudTokenENVVar)
+
+	var (
+		token        string
+		tokenCommand *credentials.TokenCommand
+		execToken    credentials.ExecToken
+		err          error
+	)
+	if command := os.Getenv(hcloudTokenCommandENVVar); command != "" {
+		interval, err := util.GetEnvDuration(hcloudTokenCommandIntervalENVVar)
+		if err != nil {
+			return nil, nil, err
 		}
+		tokenCommand, err = credentials.NewTokenCommand(command, interval)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", hcloudTokenCommandENVVar, err)
+		}
+		execToken, err = tokenCommand.Token(context.Background())
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", hcloudTokenCommandENVVar, err)
+		}
+		token = execToken.Token
+		klog.V(1).Infof("reading Hetzner Cloud token from command %q. The controller will refresh the token before it expires", tokenCommand.Command[0])
 	} else {
-		klog.V(1).Infof("reading Hetzner Cloud token from %q. The controller will reload the credentials, when the file changes", credentialsDir)
+		token, err = credentials.GetInitialHcloudCredentialsFromDirectory(credentialsDir)
+		if err != nil {
+			klog.V(1).Infof("reading Hetzner Cloud token from directory failed. Will try env var: %s", err.Error())
+			token = os.Getenv(hcloudTokenENVVar)
+			if token == "" {
+				return nil, nil, fmt.Errorf("Either token from directory %q or environment variable %q is required", credentialsDir, hcloudTokenENVVar)
+			}
+		} else {
+			klog.V(1).Infof("reading Hetzner Cloud token from %q. The controller will reload the credentials, when the file changes", credentialsDir)
+		}
 	}
 	if len(token) != 64 {
-		return nil, fmt.Errorf("entered token is invalid (must be exactly 64 characters long)")
+		return nil, nil, fmt.Errorf("entered token is invalid (must be exactly 64 characters long)")
 	}
 	opts := []hcloud.ClientOption{
 		hcloud.WithToken(token),
 		hcloud.WithApplication("hetzner-cloud-controller", providerVersion),
 	}
 
+	backoff, ok, err := apiBackoffFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		opts = append(opts, hcloud.WithBackoffFunc(hcloud.ExponentialBackoffWithOpts(backoff)))
+	}
+
+	pollInterval, err := actionPollIntervalFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	if pollInterval > 0 {
+		opts = append(opts, hcloud.WithPollOpts(hcloud.PollOpts{BackoffFunc: hcloud.ConstantBackoff(pollInterval)}))
+	}
+
 	// start metrics server if enabled (enabled by default)
 	if os.Getenv(hcloudMetricsEnabledENVVar) != "false" {
 		go metrics.Serve(hcloudMetricsAddress)
+	}
 
-		opts = append(opts, hcloud.WithInstrumentation(metrics.GetRegistry()))
+	tracingEnabled, err := getEnvBool(hcloudTracingEnabledENVVar)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tracingEnabled {
+		// The tracer provider is flushed periodically. Spans of the last
+		// seconds before the process exits are lost.
+		if _, err := tracing.Setup(context.Background()); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", hcloudTracingEnabledENVVar, err)
+		}
 	}
 
 	if os.Getenv(hcloudDebugENVVar) == "true" {
 		opts = append(opts, hcloud.WithDebugWriter(os.Stderr))
 	}
-	if endpoint := os.Getenv(hcloudEndpointENVVar); endpoint != "" {
+	endpoint := os.Getenv(hcloudEndpointENVVar)
+	if endpoint != "" {
 		opts = append(opts, hcloud.WithEndpoint(endpoint))
 	}
+
+	insecure, err := getEnvBool(hcloudEndpointInsecureENVVar)
+	if err != nil {
+		return nil, nil, err
+	}
+	metricsEnabled := os.Getenv(hcloudMetricsEnabledENVVar) != "false"
+	httpClient := &http.Client{}
+	if insecure {
+		if isDefaultHcloudEndpoint(endpoint) {
+			return nil, nil, fmt.Errorf("%s: not allowed for the default endpoint %s", hcloudEndpointInsecureENVVar, hcloud.Endpoint)
+		}
+		klog.Warningf("TLS verification is disabled for the Hetzner Cloud API endpoint %s", endpoint)
+		httpClient = newInsecureHTTPClient(metricsEnabled)
+	} else if metricsEnabled {
+		opts = append(opts, hcloud.WithInstrumentation(metrics.GetRegistry()))
+	}
+	opts = append(opts, hcloud.WithHTTPClient(httpClient))
+
+	overrides, err := parseEndpointOverrides(os.Getenv(hcloudEndpointOverridesENVVar))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", hcloudEndpointOverridesENVVar, err)
+	}
+
 	client := hcloud.NewClient(opts...)
-	return client, nil
+	var refreshToken func(ctx context.Context)
+	if tokenCommand != nil {
+		refreshToken = func(ctx context.Context) {
+			tokenCommand.Refresh(ctx, client, execToken)
+		}
+	}
+
+	if tracingEnabled {
+		httpClient.Transport = otelhttp.NewTransport(httpClient.Transport)
+	}
+	if len(overrides) > 0 {
+		if endpoint == "" {
+			endpoint = hcloud.Endpoint
+		}
+		// Wrap the transport after creating the client, which sets the
+		// transport of the instrumentation.
+		router, err := newEndpointRouter(endpoint, overrides, httpClient.Transport)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", hcloudEndpointOverridesENVVar, err)
+		}
+		httpClient.Transport = router
+		for resource, u := range overrides {
+			klog.Infof("sending Hetzner Cloud API requests for %s to %s", resource, u)
+		}
+	}
+	return client, refreshToken, nil
+}
+
+// isDefaultHcloudEndpoint reports whether endpoint is the production
+// Hetzner Cloud API.
+func isDefaultHcloudEndpoint(endpoint string) bool {
+	if endpoint == "" {
+		return true
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		// Better safe than sorry.
+		return true
+	}
+	defaultURL, _ := url.Parse(hcloud.Endpoint)
+	return strings.EqualFold(u.Hostname(), defaultURL.Hostname())
+}
+
+// newInsecureHTTPClient returns an HTTP client which does not verify TLS
+// certificates. The requests are recorded in the Hetzner Cloud API metrics if
+// instrument is set.
+func newInsecureHTTPClient(instrument bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec // Explicitly requested for custom endpoints only.
+	if !instrument {
+		return &http.Client{Transport: transport}
+	}
+	// The instrumentation of hcloud-go replaces the transport of the HTTP
+	// client, which would enable the TLS verification again.
+	return &http.Client{Transport: metrics.InstrumentHCloudAPI(transport)}
 }
 
 func newCloud(_ io.Reader) (cloudprovider.Interface, error) {
@@ -148,7 +453,7 @@ func newCloud(_ io.Reader) (cloudprovider.Interface, error) {
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	hcloudClient, err := newHcloudClient(rootDir)
+	hcloudClient, refreshToken, err := newHcloudClient(rootDir)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -172,10 +477,19 @@ func newCloud(_ io.Reader) (cloudprovider.Interface, error) {
 
 	if robotClient == nil {
 		klog.Info("Robot client is nil, will not be able to manage bare metal servers.")
+	} else if err := checkRobotConnectivity(robotClient, os.Getenv(robotStartupCheckENVVar)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	var networkID int64
+	var (
+		network     *hcloud.Network
+		networkID   int64
+		networkName string
+	)
 	if v, ok := os.LookupEnv(hcloudNetworkENVVar); ok {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			networkName = v
+		}
 		n, _, err := hcloudClient.Network.Get(context.Background(), v)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
@@ -183,6 +497,7 @@ func newCloud(_ io.Reader) (cloudprovider.Interface, error) {
 		if n == nil {
 			return nil, fmt.Errorf("%s: Network %s not found", op, v)
 		}
+		network = n
 		networkID = n.ID
 
 		networkDisableAttachedCheck, err := getEnvBool(hcloudNetworkDisableAttachedCheckENVVar)
@@ -221,47 +536,408 @@ func newCloud(_ io.Reader) (cloudprovider.Interface, error) {
 	eventBroadcaster := record.NewBroadcaster()
 	lbRecorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "hetzner-ccm-loadbalancer"})
 
+	lbLabelPrefix := os.Getenv(hcloudLBManagedLabelPrefix)
+	if lbLabelPrefix != "" {
+		if errs := validation.IsDNS1123Subdomain(lbLabelPrefix); len(errs) > 0 {
+			return nil, fmt.Errorf("%s: %s: invalid label prefix %q: %s",
+				op, hcloudLBManagedLabelPrefix, lbLabelPrefix, strings.Join(errs, ", "))
+		}
+	}
+
+	clusterName := os.Getenv(hcloudClusterName)
+	if clusterName != "" {
+		if errs := validation.IsDNS1123Label(clusterName); len(errs) > 0 {
+			return nil, fmt.Errorf("%s: %s: invalid cluster name %q: %s",
+				op, hcloudClusterName, clusterName, strings.Join(errs, ", "))
+		}
+	}
+
+	additionalProviderIDPrefix, err := additionalProviderIDPrefixFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Retry with the same backoff as the hcloud client, see newHcloudClient.
+	apiRetry := hcops.DefaultRetryOpts
+	backoff, ok, err := apiBackoffFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if ok {
+		apiRetry.BackoffFunc = hcloud.ExponentialBackoffWithOpts(backoff)
+	}
+
+	// The network is shared, so that routes, Load Balancers and instances use
+	// the same network if it was created again, see routes.reloadNetwork.
+	networkRef := hcops.NewNetworkRef(networkID)
+
 	lbOps := &hcops.LoadBalancerOps{
-		LBClient:      &hcloudClient.LoadBalancer,
-		CertOps:       &hcops.CertificateOps{CertClient: &hcloudClient.Certificate},
-		ActionClient:  &hcloudClient.Action,
-		NetworkClient: &hcloudClient.Network,
-		RobotClient:   robotClient,
-		NetworkID:     networkID,
-		Recorder:      lbRecorder,
-		Defaults:      lbOpsDefaults,
+		LBClient:                   hcops.NewRetryingLoadBalancerClient(&hcloudClient.LoadBalancer, apiRetry),
+		CertOps:                    &hcops.CertificateOps{CertClient: &hcloudClient.Certificate},
+		ActionClient:               &hcloudClient.Action,
+		NetworkClient:              &hcloudClient.Network,
+		RobotClient:                robotClient,
+		Network:                    networkRef,
+		Recorder:                   lbRecorder,
+		Defaults:                   lbOpsDefaults,
+		LabelPrefix:                lbLabelPrefix,
+		ClusterName:                clusterName,
+		ProviderIDAdditionalPrefix: additionalProviderIDPrefix,
 	}
 
 	loadBalancers := newLoadBalancers(lbOps, &hcloudClient.Action, lbDisablePrivateIngress, lbDisableIPv6)
+	loadBalancers.recorder = lbRecorder
+	loadBalancers.provisioning = newLBProvisioningStatus(lbRecorder)
+	loadBalancers.clusterName = clusterName
+	loadBalancers.logDiff = os.Getenv(hcloudDebugENVVar) == "true"
+	loadBalancers.loadBalancerClass = os.Getenv(hcloudLoadBalancerClass)
+	loadBalancers.namespaces = loadBalancerNamespacesFromEnv()
+	reportTargetHealth, err := getEnvBool(hcloudLoadBalancersReportTargetHealth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if reportTargetHealth {
+		loadBalancers.targetHealth = newLBTargetHealth()
+	}
+	loadBalancers.skipServicesWithoutPorts, err = getEnvBool(hcloudLoadBalancersSkipWithoutPorts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if v, ok := os.LookupEnv(hcloudLoadBalancersDeleteRetries); ok {
+		loadBalancers.deleteRetries, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", op, hcloudLoadBalancersDeleteRetries, err)
+		}
+		if loadBalancers.deleteRetries < 0 {
+			return nil, fmt.Errorf("%s: %s: must not be negative", op, hcloudLoadBalancersDeleteRetries)
+		}
+	}
+	if v, ok := os.LookupEnv(hcloudLoadBalancersNameMaxLength); ok {
+		loadBalancers.maxNameLength, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", op, hcloudLoadBalancersNameMaxLength, err)
+		}
+		if loadBalancers.maxNameLength < hcops.MinLBNameLength || loadBalancers.maxNameLength > hcops.DefaultMaxLBNameLength {
+			return nil, fmt.Errorf("%s: %s: must be between %d and %d",
+				op, hcloudLoadBalancersNameMaxLength, hcops.MinLBNameLength, hcops.DefaultMaxLBNameLength)
+		}
+	}
+	deleteRetryDelay, err := util.GetEnvDuration(hcloudLoadBalancersDeleteRetryDelay)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if deleteRetryDelay > 0 {
+		loadBalancers.deleteRetryDelay = deleteRetryDelay
+	}
+	if _, ok := os.LookupEnv(hcloudLoadBalancersUpdateDedupWindow); ok {
+		// A window of 0 disables the deduplication.
+		window, err := util.GetEnvDuration(hcloudLoadBalancersUpdateDedupWindow)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		loadBalancers.updates = newLBUpdateDeduplicator(window)
+	}
+	removeCordonedAfter, err := util.GetEnvDuration(hcloudLBRemoveCordonedAfter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if removeCordonedAfter > 0 {
+		loadBalancers.cordoned = newCordonedNodes(removeCordonedAfter)
+	}
+	annotateNodes, err := getEnvBool(hcloudLoadBalancersAnnotateNodes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var nodeMembership *nodeLBMembership
+	if annotateNodes {
+		nodeMembership = newNodeLBMembership()
+		loadBalancers.nodeMembership = nodeMembership
+	}
+	var drainer nodeDrainer
+	nodeDrainEnabled, err := getEnvBool(hcloudLoadBalancersNodeDrainEnabled)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if nodeDrainEnabled {
+		drainer = lbOps
+	}
+	nodeDrainTimeout, err := util.GetEnvDuration(hcloudLoadBalancersNodeDrainTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var lbProfiles *configMapLBProfiles
+	if v, ok := os.LookupEnv(hcloudLoadBalancersProfilesConfigMap); ok && v != "" {
+		namespace, name, err := parseLBProfilesConfigMap(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		lbProfiles = &configMapLBProfiles{namespace: namespace, name: name}
+		loadBalancers.profiles = lbProfiles
+	}
+	lbDriftInterval, err := util.GetEnvDuration(hcloudLoadBalancerDriftInterval)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var lbMetrics *lbMetricsExporter
+	lbMetricsEnabled, err := getEnvBool(hcloudLoadBalancerMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if lbMetricsEnabled {
+		interval, err := util.GetEnvDuration(hcloudLoadBalancerMetricsInterval)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if interval <= 0 {
+			interval = defaultLBMetricsInterval
+		}
+		lbMetrics = newLBMetricsExporter(&hcloudClient.LoadBalancer, lbLabelPrefix, interval)
+	}
+	lbProvisioning := loadBalancers.provisioning
+	lbTargetHealth := loadBalancers.targetHealth
 	if os.Getenv(hcloudLoadBalancersEnabledENVVar) == "false" {
 		loadBalancers = nil
+		lbProvisioning = nil
+		lbTargetHealth = nil
+		drainer = nil
+		lbProfiles = nil
+		lbDriftInterval = 0
+		lbMetrics = nil
+		nodeMembership = nil
+	}
+	maintenance, err := getEnvBool(hcloudMaintenanceModeENVVar)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if maintenance {
+		klog.Warning("maintenance mode enabled, Load Balancers and routes are not changed until it is disabled")
+		if loadBalancers != nil {
+			loadBalancers.maintenance = true
+		}
+		lbDriftInterval = 0
 	}
 	instancesAddressFamily, err := addressFamilyFromEnv()
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	routeGateway, err := routeGatewayFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	routeSubnets, err := routeSubnetsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if network != nil {
+		if err := validateRouteSubnets(network, routeSubnets); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", op, hcloudNetworkRoutesSubnetsENVVar, err)
+		}
+	}
+	routesCleanupOrphaned, err := getEnvBool(hcloudNetworkRoutesCleanupOrphanedENVVar)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	routesProtectNetwork, err := getEnvBool(hcloudNetworkRoutesProtectNetworkENVVar)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	routesClusterName := clusterName
+	if routesClusterName == "" {
+		routesClusterName = "kubernetes"
+	}
+	robotProviderIDFormat, err := robotProviderIDFormatFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	discoverProviderID, err := getEnvBool(hcloudDiscoverProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	matchNodeNameLabel, err := getEnvBool(hcloudMatchNodeNameLabel)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
 	credentialsDir := credentials.GetDirectory(rootDir)
 	_, err = os.Stat(credentialsDir)
-	if err == nil {
+	if err == nil || (robotClient != nil && credentials.RobotCredentialFilesConfigured()) {
+		reloadJitter, err := util.GetEnvDuration(hcloudCredentialsReloadJitter)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		// A token obtained by the token command is refreshed by it, the
+		// token file must not replace it.
+		watchedHcloudClient := hcloudClient
+		if os.Getenv(hcloudTokenCommandENVVar) != "" {
+			watchedHcloudClient = nil
+		}
 		// Watch for changes in the secrets directory
-		err := credentials.Watch(credentialsDir, hcloudClient, robotClient)
+		err = credentials.Watch(credentialsDir, watchedHcloudClient, robotClient, reloadJitter)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
+		// The reload endpoint is served by the metrics server. Register it
+		// only once, the default mux panics on duplicate patterns.
+		registerReloadHandler.Do(func() {
+			http.Handle(credentials.ReloadPath, credentials.ReloadHandler(credentialsDir, watchedHcloudClient, robotClient))
+		})
+	}
+
+	instances := newInstances(hcloudClient, robotClient, instancesAddressFamily, networkID)
+	instances.network = networkRef
+	instances.additionalProviderIDPrefix = additionalProviderIDPrefix
+	instances.robotProviderIDFormat = robotProviderIDFormat
+	instances.discoverProviderID = discoverProviderID
+	instances.matchNodeNameLabel = matchNodeNameLabel
+	instances.addressOrder = nodeAddressOrderFromEnv()
+	instances.instanceType, err = instanceTypeMapperFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	metadataFallbackTTL, err := util.GetEnvDuration(hcloudInstancesMetadataFallbackTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if metadataFallbackTTL > 0 {
+		instances.metadataFallback = newMetadataFallback(metadataFallbackTTL)
+	}
+	metadataCacheTTL, err := util.GetEnvDuration(hcloudInstancesMetadataCacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if metadataCacheTTL > 0 {
+		instances.metadataCache = newMetadataCache(metadataCacheTTL)
+	}
+	notFoundGrace, err := util.GetEnvDuration(hcloudInstanceNotFoundGrace)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if notFoundGrace > 0 {
+		instances.notFoundGrace = newNotFoundGrace(notFoundGrace)
+	}
+	lookupCondition, err := getEnvBool(hcloudInstancesLookupCondition)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if lookupCondition {
+		instances.lookupCondition = &nodeLookupCondition{}
+	}
+	instances.serverIDLabel, err = getEnvBool(hcloudInstancesServerIDLabel)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, ok := os.LookupEnv(hcloudTopologyUseDatacenter); ok {
+		instances.topologyUseDatacenter, err = getEnvBool(hcloudTopologyUseDatacenter)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	preloadInstances, err := getEnvBool(hcloudPreloadInstances)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if preloadInstances {
+		instances.preloadStatuses, err = serverStatusesFromEnv(hcloudPreloadInstancesStatuses)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		instances.preloadExcludeStatuses, err = serverStatusesFromEnv(hcloudPreloadInstancesExcludeStatuses)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		// Preloading only speeds up the first lookups, continue without it.
+		if err := instances.preload(context.Background()); err != nil {
+			klog.ErrorS(err, "preload instances")
+		}
 	}
 
 	return &cloud{
 		hcloudClient: hcloudClient,
 		robotClient:  robotClient,
-		instances:    newInstances(hcloudClient, robotClient, instancesAddressFamily, networkID),
+		instances:    instances,
 		loadBalancer: loadBalancers,
 		routes:       nil,
-		networkID:    networkID,
+		network:      networkRef,
+		networkName:  networkName,
+		routeGateway: routeGateway,
+		routeSubnets: routeSubnets,
+		maintenance:  maintenance,
+		apiRetry:     apiRetry,
+
+		routesCleanupOrphaned: routesCleanupOrphaned,
+		routesClusterName:     routesClusterName,
+		routesProtectNetwork:  routesProtectNetwork,
+
+		nodeDrainer:      drainer,
+		nodeDrainTimeout: nodeDrainTimeout,
+		lbProfiles:       lbProfiles,
+		lbDriftInterval:  lbDriftInterval,
+		lbMetrics:        lbMetrics,
+		nodeMembership:   nodeMembership,
+		eventBroadcaster: eventBroadcaster,
+		lbProvisioning:   lbProvisioning,
+		lbTargetHealth:   lbTargetHealth,
+		refreshToken:     refreshToken,
 	}, nil
 }
 
-func (c *cloud) Initialize(_ cloudprovider.ControllerClientBuilder, _ <-chan struct{}) {
+func (c *cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	if c.refreshToken != nil {
+		go c.refreshToken(ctx)
+	}
+	if c.eventBroadcaster != nil || c.lbProvisioning != nil || c.lbTargetHealth != nil {
+		client := clientBuilder.ClientOrDie("hcloud-lb-status")
+		if c.eventBroadcaster != nil {
+			c.eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+		}
+		if c.lbProvisioning != nil {
+			c.lbProvisioning.setClient(client)
+		}
+		if c.lbTargetHealth != nil {
+			c.lbTargetHealth.setClient(client)
+		}
+	}
+	if c.instances != nil && c.instances.lookupCondition != nil {
+		c.instances.lookupCondition.setClient(clientBuilder.ClientOrDie("hcloud-node-lookup"))
+	}
+	if c.network.ID() > 0 {
+		c.routesNodeClient = clientBuilder.ClientOrDie("hcloud-routes")
+	}
+	if c.nodeDrainer == nil && c.lbProfiles == nil && c.lbDriftInterval == 0 && c.lbMetrics == nil && c.nodeMembership == nil &&
+		(c.loadBalancer == nil || c.loadBalancer.cordoned == nil) {
+		return
+	}
+	if c.lbProfiles != nil {
+		c.lbProfiles.run(ctx, clientBuilder.ClientOrDie("hcloud-lb-profiles"))
+	}
+	if c.nodeDrainer != nil {
+		client := clientBuilder.ClientOrDie("hcloud-node-drain-controller")
+		drainController := newNodeDrainController(client, c.nodeDrainer, c.nodeDrainTimeout)
+		// Finalizers added before maintenance are still removed, otherwise
+		// node deletions would be blocked until it ends.
+		drainController.maintenance = c.maintenance
+		go drainController.Run(ctx)
+	}
+	if c.lbDriftInterval > 0 {
+		client := clientBuilder.ClientOrDie("hcloud-lb-drift-controller")
+		go newLBDriftController(client, c.loadBalancer, c.lbDriftInterval).Run(ctx)
+	}
+	if c.loadBalancer != nil && c.loadBalancer.cordoned != nil {
+		client := clientBuilder.ClientOrDie("hcloud-lb-cordon-controller")
+		go newCordonController(client, c.loadBalancer, c.loadBalancer.cordoned).Run(ctx)
+	}
+	if c.lbMetrics != nil {
+		go c.lbMetrics.Run(ctx)
+	}
+	if c.nodeMembership != nil {
+		c.nodeMembership.setClient(clientBuilder.ClientOrDie("hcloud-lb-node-membership"))
+	}
 }
 
 func (c *cloud) Instances() (cloudprovider.Instances, bool) {
@@ -290,12 +966,35 @@ func (c *cloud) Clusters() (cloudprovider.Clusters, bool) {
 }
 
 func (c *cloud) Routes() (cloudprovider.Routes, bool) {
-	if c.networkID > 0 && os.Getenv(hcloudNetworkRoutesEnabledENVVar) != "false" {
-		r, err := newRoutes(c.hcloudClient, c.networkID)
+	networkID := c.network.ID()
+	if networkID > 0 && os.Getenv(hcloudNetworkRoutesEnabledENVVar) != "false" {
+		r, err := newRoutes(c.hcloudClient, networkID)
 		if err != nil {
-			klog.ErrorS(err, "create routes provider", "networkID", c.networkID)
+			klog.ErrorS(err, "create routes provider", "networkID", networkID)
 			return nil, false
 		}
+		r.networkName = c.networkName
+		r.networkRef = c.network
+		r.gateway = c.routeGateway
+		r.subnets = c.routeSubnets
+		r.maintenance = c.maintenance
+		r.retry = c.apiRetry
+		r.nodeClient = c.routesNodeClient
+		r.protectNetwork = c.routesProtectNetwork
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := r.ensureNetworkProtection(ctx); err != nil {
+			klog.ErrorS(err, "enable delete protection of network", "networkID", networkID)
+		}
+		if c.routesCleanupOrphaned {
+			c.routesCleanupOnce.Do(func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				defer cancel()
+				if err := r.cleanupOrphanedRoutes(ctx, c.routesClusterName); err != nil {
+					klog.ErrorS(err, "clean up orphaned routes", "networkID", networkID)
+				}
+			})
+		}
 		return r, true
 	}
 	return nil, false // If no network is configured, disable the routes part
@@ -311,8 +1010,9 @@ func (c *cloud) HasClusterID() bool {
 
 func loadBalancerDefaultsFromEnv() (hcops.LoadBalancerDefaults, bool, bool, error) {
 	defaults := hcops.LoadBalancerDefaults{
-		Location:    os.Getenv(hcloudLoadBalancersLocation),
-		NetworkZone: os.Getenv(hcloudLoadBalancersNetworkZone),
+		Location:         os.Getenv(hcloudLoadBalancersLocation),
+		NetworkZone:      os.Getenv(hcloudLoadBalancersNetworkZone),
+		FallbackLocation: os.Getenv(hcloudLoadBalancersDefaultLocation),
 	}
 
 	if defaults.Location != "" && defaults.NetworkZone != "" {
@@ -335,6 +1035,36 @@ func loadBalancerDefaultsFromEnv() (hcops.LoadBalancerDefaults, bool, bool, erro
 		return defaults, false, false, err
 	}
 
+	if v, ok := os.LookupEnv(hcloudLoadBalancersAlgorithm); ok {
+		switch at := hcloud.LoadBalancerAlgorithmType(strings.ToLower(v)); at {
+		case hcloud.LoadBalancerAlgorithmTypeRoundRobin, hcloud.LoadBalancerAlgorithmTypeLeastConnections:
+			defaults.Algorithm = at
+		default:
+			return defaults, false, false, fmt.Errorf("%s: invalid algorithm: %s", hcloudLoadBalancersAlgorithm, v)
+		}
+	}
+
+	defaults.HealthCheckInterval, err = util.GetEnvDuration(hcloudLoadBalancersHealthCheckInterval)
+	if err != nil {
+		return defaults, false, false, err
+	}
+
+	defaults.HealthCheckTimeout, err = util.GetEnvDuration(hcloudLoadBalancersHealthCheckTimeout)
+	if err != nil {
+		return defaults, false, false, err
+	}
+
+	if v, ok := os.LookupEnv(hcloudLoadBalancersHealthCheckRetries); ok {
+		defaults.HealthCheckRetries, err = strconv.Atoi(v)
+		if err != nil {
+			return defaults, false, false, fmt.Errorf("%s: %v", hcloudLoadBalancersHealthCheckRetries, err)
+		}
+		if defaults.HealthCheckRetries < 0 || defaults.HealthCheckRetries > annotation.MaxHealthCheckRetries {
+			return defaults, false, false, fmt.Errorf("%s: must be between 0 and %d",
+				hcloudLoadBalancersHealthCheckRetries, annotation.MaxHealthCheckRetries)
+		}
+	}
+
 	return defaults, disablePrivateIngress, disableIPv6, nil
 }
 
@@ -367,10 +1097,195 @@ func addressFamilyFromEnv() (addressFamily, error) {
 		return AddressFamilyIPv4, nil
 	case "dualstack":
 		return AddressFamilyDualStack, nil
+	case "auto":
+		return AddressFamilyAuto, nil
 	default:
 		return -1, fmt.Errorf(
-			"%v: Invalid value, expected one of: ipv4,ipv6,dualstack", hcloudInstancesAddressFamily)
+			"%v: Invalid value, expected one of: ipv4,ipv6,dualstack,auto", hcloudInstancesAddressFamily)
+	}
+}
+
+// loadBalancerNamespacesFromEnv returns the namespaces of the Services whose
+// Load Balancers are managed, nil for all namespaces.
+func loadBalancerNamespacesFromEnv() map[string]bool {
+	var namespaces map[string]bool
+	for _, ns := range strings.Split(os.Getenv(hcloudLoadBalancerNamespaces), ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" {
+			continue
+		}
+		if namespaces == nil {
+			namespaces = make(map[string]bool)
+		}
+		namespaces[ns] = true
+	}
+	return namespaces
+}
+
+// routeGatewayFromEnv returns the gateway selection of the routes from the
+// environment variable. Returns routeGatewayPrimary if unset.
+func routeGatewayFromEnv() (routeGateway, error) {
+	v, ok := os.LookupEnv(hcloudNetworkRoutesGatewayENVVar)
+	if !ok {
+		return routeGatewayPrimary, nil
+	}
+
+	switch gateway := routeGateway(strings.ToLower(v)); gateway {
+	case routeGatewayPrimary, routeGatewayAlias:
+		return gateway, nil
+	default:
+		return "", fmt.Errorf(
+			"%v: Invalid value, expected one of: primary,alias", hcloudNetworkRoutesGatewayENVVar)
+	}
+}
+
+// robotProviderIDFormatFromEnv returns the provider ID format of robot nodes
+// from the environment variable. Returns robotProviderIDFormatHCloud if unset.
+func robotProviderIDFormatFromEnv() (robotProviderIDFormat, error) {
+	v, ok := os.LookupEnv(hcloudRobotProviderIDFormatENVVar)
+	if !ok {
+		return robotProviderIDFormatHCloud, nil
+	}
+
+	switch format := robotProviderIDFormat(strings.ToLower(v)); format {
+	case robotProviderIDFormatHCloud, robotProviderIDFormatHRobot:
+		return format, nil
+	default:
+		return "", fmt.Errorf(
+			"%v: Invalid value, expected one of: hcloud,hrobot", hcloudRobotProviderIDFormatENVVar)
+	}
+}
+
+// routeSubnetsFromEnv returns the route subnets from the environment
+// variable. Returns nil if unset.
+func routeSubnetsFromEnv() ([]*net.IPNet, error) {
+	v := os.Getenv(hcloudNetworkRoutesSubnetsENVVar)
+	if v == "" {
+		return nil, nil
+	}
+
+	var subnets []*net.IPNet
+	for _, s := range strings.Split(v, ",") {
+		_, subnet, err := net.ParseCIDR(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hcloudNetworkRoutesSubnetsENVVar, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// serverStatuses are the statuses of hcloud servers accepted by
+// serverStatusesFromEnv.
+var serverStatuses = []hcloud.ServerStatus{
+	hcloud.ServerStatusInitializing,
+	hcloud.ServerStatusStarting,
+	hcloud.ServerStatusRunning,
+	hcloud.ServerStatusStopping,
+	hcloud.ServerStatusOff,
+	hcloud.ServerStatusDeleting,
+	hcloud.ServerStatusMigrating,
+	hcloud.ServerStatusRebuilding,
+	hcloud.ServerStatusUnknown,
+}
+
+// serverStatusesFromEnv returns the comma separated server statuses of the
+// environment variable name. Returns nil if unset.
+func serverStatusesFromEnv(name string) ([]hcloud.ServerStatus, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	var statuses []hcloud.ServerStatus
+	for _, s := range strings.Split(v, ",") {
+		status := hcloud.ServerStatus(strings.ToLower(strings.TrimSpace(s)))
+		if !slices.Contains(serverStatuses, status) {
+			return nil, fmt.Errorf("%s: unknown server status %q", name, s)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+var providerIDPrefixRegex = regexp.MustCompile(`^[a-z][a-z0-9+.-]*://$`)
+
+// additionalProviderIDPrefixFromEnv returns the additional provider ID prefix
+// accepted besides "hcloud://". Returns an empty string if the env var is
+// unset.
+func additionalProviderIDPrefixFromEnv() (string, error) {
+	prefix, ok := os.LookupEnv(hcloudProviderIDAdditionalPrefix)
+	if !ok || prefix == "" {
+		return "", nil
+	}
+	if !providerIDPrefixRegex.MatchString(prefix) {
+		return "", fmt.Errorf("%s: invalid prefix %q, expected a scheme like \"mycluster://\"",
+			hcloudProviderIDAdditionalPrefix, prefix)
 	}
+	if prefix == providerName+"://" || prefix == providerPrefixHRobot {
+		return "", fmt.Errorf("%s: prefix %q is already accepted", hcloudProviderIDAdditionalPrefix, prefix)
+	}
+	return prefix, nil
+}
+
+// nodeAddressTypesByName maps the entries of HCLOUD_NODE_ADDRESS_ORDER to node
+// address types.
+var nodeAddressTypesByName = map[string]corev1.NodeAddressType{
+	"hostname":       corev1.NodeHostName,
+	"privatenetwork": corev1.NodeInternalIP,
+	"public":         corev1.NodeExternalIP,
+}
+
+// nodeAddressOrderFromEnv returns the precedence of node address types from
+// the comma separated list in HCLOUD_NODE_ADDRESS_ORDER, e.g.
+// "privateNetwork,public". Unknown entries are ignored. Returns nil if the env
+// var is unset.
+func nodeAddressOrderFromEnv() []corev1.NodeAddressType {
+	v := os.Getenv(hcloudNodeAddressOrder)
+	if v == "" {
+		return nil
+	}
+
+	var order []corev1.NodeAddressType
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		t, ok := nodeAddressTypesByName[strings.ToLower(name)]
+		if !ok {
+			klog.Warningf("%s: ignoring unknown address type %q", hcloudNodeAddressOrder, name)
+			continue
+		}
+		order = append(order, t)
+	}
+	return order
+}
+
+// checkRobotConnectivity lists the robot servers once to verify the robot
+// credentials. The result is cached by the robot client, so the check does
+// not cost an additional request against the rate limit of the Robot API.
+// mode is one of "", "warn" and "fail".
+func checkRobotConnectivity(robotClient robotclient.Client, mode string) error {
+	const op = "hcloud/checkRobotConnectivity"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	switch mode {
+	case "":
+		return nil
+	case "warn", "fail":
+	default:
+		return fmt.Errorf("%s: %s: invalid value %q, must be one of warn, fail", op, robotStartupCheckENVVar, mode)
+	}
+
+	_, err := robotClient.ServerGetList()
+	if err == nil {
+		klog.Info("Hetzner Robot API is reachable")
+		return nil
+	}
+	if mode == "warn" || hcops.IsRobotError(err, models.ErrorCodeRateLimitExceeded) {
+		// Exceeding the rate limit does not indicate a misconfiguration.
+		klog.Warningf("%s: Hetzner Robot API is not usable: %v", op, err)
+		return nil
+	}
+	return fmt.Errorf("%s: %w", op, err)
 }
 
 // getEnvBool returns the boolean parsed from the environment variable with the given key and a potential error
@@ -389,6 +1304,74 @@ func getEnvBool(key string) (bool, error) {
 	return b, nil
 }
 
+// apiBackoffFromEnv returns the backoff of retried Hetzner Cloud API
+// requests. It reports false if none of the variables is set, the default
+// backoff of the client is used then. Unset variables default to the values
+// of the default backoff.
+func apiBackoffFromEnv() (hcloud.ExponentialBackoffOpts, bool, error) {
+	opts := hcloud.ExponentialBackoffOpts{
+		Base:       time.Second,
+		Multiplier: 2,
+		Cap:        time.Minute,
+		Jitter:     true,
+	}
+	baseSet := os.Getenv(hcloudAPIBackoffBaseENVVar) != ""
+	maxSet := os.Getenv(hcloudAPIBackoffMaxENVVar) != ""
+	multiplier := os.Getenv(hcloudAPIBackoffMultiplierENVVar)
+	multiplierSet := multiplier != ""
+	if !baseSet && !maxSet && !multiplierSet {
+		return opts, false, nil
+	}
+
+	if baseSet {
+		base, err := util.GetEnvDuration(hcloudAPIBackoffBaseENVVar)
+		if err != nil {
+			return opts, false, err
+		}
+		if base <= 0 {
+			return opts, false, fmt.Errorf("%s: must be positive", hcloudAPIBackoffBaseENVVar)
+		}
+		opts.Base = base
+	}
+	if maxSet {
+		maxBackoff, err := util.GetEnvDuration(hcloudAPIBackoffMaxENVVar)
+		if err != nil {
+			return opts, false, err
+		}
+		opts.Cap = maxBackoff
+	}
+	if opts.Cap < opts.Base {
+		return opts, false, fmt.Errorf("%s: must not be less than %s (%s)", hcloudAPIBackoffMaxENVVar, hcloudAPIBackoffBaseENVVar, opts.Base)
+	}
+	if multiplierSet {
+		m, err := strconv.ParseFloat(multiplier, 64)
+		if err != nil {
+			return opts, false, fmt.Errorf("%s: %v", hcloudAPIBackoffMultiplierENVVar, err)
+		}
+		if m < 1 {
+			return opts, false, fmt.Errorf("%s: must be at least 1", hcloudAPIBackoffMultiplierENVVar)
+		}
+		opts.Multiplier = m
+	}
+	return opts, true, nil
+}
+
+// actionPollIntervalFromEnv returns the interval between the polls of running
+// actions, or 0 to keep the default of the hcloud client.
+func actionPollIntervalFromEnv() (time.Duration, error) {
+	if os.Getenv(hcloudActionPollIntervalENVVar) == "" {
+		return 0, nil
+	}
+	interval, err := util.GetEnvDuration(hcloudActionPollIntervalENVVar)
+	if err != nil {
+		return 0, err
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("%s: must be positive", hcloudActionPollIntervalENVVar)
+	}
+	return interval, nil
+}
+
 func init() {
 	cloudprovider.RegisterCloudProvider(providerName, newCloud)
 }
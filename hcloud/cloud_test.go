@@ -29,11 +29,13 @@ import (
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/credentials"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
 	hrobot "github.com/syself/hrobot-go"
 	"github.com/syself/hrobot-go/models"
 	corev1 "k8s.io/api/core/v1"
@@ -98,6 +100,37 @@ func TestNewCloud(t *testing.T) {
 	}
 }
 
+func TestNewCloudLoadBalancersDisabled(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	resetEnv := Setenv(t,
+		"HCLOUD_ENDPOINT", env.Server.URL,
+		"HCLOUD_TOKEN", "jr5g7ZHpPptyhJzZyHw2Pqu4g9gTqDvEceYpngPf79jN_NOT_VALID_dzhepnahq",
+		"HCLOUD_METRICS_ENABLED", "false",
+		"HCLOUD_LOAD_BALANCERS_ENABLED", "false",
+	)
+	defer resetEnv()
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(
+			schema.ServerListResponse{
+				Servers: []schema.Server{},
+			},
+		)
+	})
+	var config bytes.Buffer
+	c, err := newCloud(&config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, supported := c.LoadBalancer(); supported {
+		t.Error("Expected Load Balancers to be disabled")
+	}
+	if c.(*cloud).lbProvisioning != nil {
+		t.Error("Expected no provisioning status of disabled Load Balancers")
+	}
+}
+
 func TestNewCloudWrongTokenSize(t *testing.T) {
 	resetEnv := Setenv(t,
 		"HCLOUD_TOKEN", "0123456789abcdef",
@@ -125,6 +158,179 @@ func TestNewCloudConnectionNotPossible(t *testing.T) {
 		`hcloud/newCloud: Get "http://127.0.0.1:4711/v1/servers?": dial tcp 127.0.0.1:4711: connect: connection refused`)
 }
 
+func TestNewHcloudClientInsecureEndpoint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{Server: schema.Server{ID: 1, Name: "foobar"}})
+	}))
+	defer server.Close()
+
+	t.Setenv("HCLOUD_TOKEN", "jr5g7ZHpPptyhJzZyHw2Pqu4g9gTqDvEceYpngPf79jN_NOT_VALID_dzhepnahq")
+	t.Setenv("HCLOUD_METRICS_ENABLED", "false")
+
+	t.Setenv("HCLOUD_ENDPOINT", server.URL)
+	client, _, err := newHcloudClient(t.TempDir())
+	require.NoError(t, err)
+	_, _, err = client.Server.GetByID(context.TODO(), 1)
+	assert.ErrorContains(t, err, "certificate")
+
+	t.Setenv("HCLOUD_ENDPOINT_INSECURE", "true")
+	client, _, err = newHcloudClient(t.TempDir())
+	require.NoError(t, err)
+	srv, _, err := client.Server.GetByID(context.TODO(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", srv.Name)
+
+	// The API requests are still instrumented.
+	requests := testutil.ToFloat64(metrics.HCloudAPIRequests.WithLabelValues("200", "get", "/servers/"))
+	client = hcloud.NewClient(hcloud.WithEndpoint(server.URL), hcloud.WithHTTPClient(newInsecureHTTPClient(true)))
+	_, _, err = client.Server.GetByID(context.TODO(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, requests+1, testutil.ToFloat64(metrics.HCloudAPIRequests.WithLabelValues("200", "get", "/servers/")))
+
+	for _, endpoint := range []string{"", hcloud.Endpoint, "https://API.hetzner.cloud/v1/"} {
+		t.Setenv("HCLOUD_ENDPOINT", endpoint)
+		_, _, err = newHcloudClient(t.TempDir())
+		assert.EqualError(t, err, "HCLOUD_ENDPOINT_INSECURE: not allowed for the default endpoint https://api.hetzner.cloud/v1", endpoint)
+	}
+}
+
+func TestNewHcloudClientTokenCommand(t *testing.T) {
+	const token = "cmdToken7ZHpPptyhJzZyHw2Pqu4g9gTqDvEceYpngPf79jN_NOT_VALID_dzhep"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer "+token, r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(schema.ServerListResponse{Servers: []schema.Server{{ID: 1, Name: "foobar"}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	command := filepath.Join(dir, "token-command")
+	require.NoError(t, os.WriteFile(command, []byte("#!/bin/sh\necho "+token+"\n"), 0o700))
+	failing := filepath.Join(dir, "failing-token-command")
+	require.NoError(t, os.WriteFile(failing, []byte("#!/bin/sh\nexit 1\n"), 0o700))
+
+	t.Setenv("HCLOUD_TOKEN", "")
+	t.Setenv("HCLOUD_METRICS_ENABLED", "false")
+	t.Setenv("HCLOUD_ENDPOINT", server.URL)
+	t.Setenv("HCLOUD_TOKEN_COMMAND", command)
+
+	client, refreshToken, err := newHcloudClient(t.TempDir())
+	require.NoError(t, err)
+	assert.NotNil(t, refreshToken)
+
+	servers, err := client.Server.All(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, servers, 1)
+
+	t.Setenv("HCLOUD_TOKEN_COMMAND", failing)
+	_, _, err = newHcloudClient(t.TempDir())
+	assert.ErrorContains(t, err, "HCLOUD_TOKEN_COMMAND: running token command")
+}
+
+func TestCloudInitializeStopsTokenRefresh(t *testing.T) {
+	done := make(chan struct{})
+	c := &cloud{refreshToken: func(ctx context.Context) {
+		<-ctx.Done()
+		close(done)
+	}}
+
+	stop := make(chan struct{})
+	c.Initialize(nil, stop)
+	select {
+	case <-done:
+		t.Fatal("token refresh stopped before the stop channel was closed")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("token refresh was not stopped")
+	}
+}
+
+func TestNewHcloudClientActionPollInterval(t *testing.T) {
+	var polls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/actions", r.URL.Path)
+		polls++
+		status := "running"
+		if polls == 3 {
+			status = "success"
+		}
+		json.NewEncoder(w).Encode(schema.ActionListResponse{Actions: []schema.Action{{ID: 1, Status: status}}})
+	}))
+	defer server.Close()
+
+	t.Setenv("HCLOUD_TOKEN", "jr5g7ZHpPptyhJzZyHw2Pqu4g9gTqDvEceYpngPf79jN_NOT_VALID_dzhepnahq")
+	t.Setenv("HCLOUD_METRICS_ENABLED", "false")
+	t.Setenv("HCLOUD_ENDPOINT", server.URL)
+	t.Setenv("HCLOUD_ACTION_POLL_INTERVAL", "10ms")
+
+	client, _, err := newHcloudClient(t.TempDir())
+	require.NoError(t, err)
+
+	// With the default interval of 500ms the polls would take 1.5s.
+	start := time.Now()
+	err = client.Action.WaitFor(context.TODO(), &hcloud.Action{ID: 1, Status: hcloud.ActionStatusRunning})
+	require.NoError(t, err)
+	assert.Equal(t, 3, polls)
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	for value, expErr := range map[string]string{
+		"0s":  "HCLOUD_ACTION_POLL_INTERVAL: must be positive",
+		"-1s": "HCLOUD_ACTION_POLL_INTERVAL: must be positive",
+		"1":   `HCLOUD_ACTION_POLL_INTERVAL: time: missing unit in duration "1"`,
+	} {
+		t.Setenv("HCLOUD_ACTION_POLL_INTERVAL", value)
+		_, _, err = newHcloudClient(t.TempDir())
+		assert.EqualError(t, err, expErr, value)
+	}
+}
+
+func TestNewHcloudClientEndpointOverrides(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/load_balancers/1" {
+			t.Errorf("unexpected request to main endpoint: %s", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(schema.LoadBalancerGetResponse{LoadBalancer: schema.LoadBalancer{ID: 1, Name: "lb"}})
+	}))
+	defer primary.Close()
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/replica/v1/servers" {
+			t.Errorf("unexpected request to replica endpoint: %s", r.URL.Path)
+		}
+		assert.Equal(t, "Bearer jr5g7ZHpPptyhJzZyHw2Pqu4g9gTqDvEceYpngPf79jN_NOT_VALID_dzhepnahq", r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(schema.ServerListResponse{Servers: []schema.Server{{ID: 1, Name: "foobar"}}})
+	}))
+	defer replica.Close()
+
+	t.Setenv("HCLOUD_TOKEN", "jr5g7ZHpPptyhJzZyHw2Pqu4g9gTqDvEceYpngPf79jN_NOT_VALID_dzhepnahq")
+	t.Setenv("HCLOUD_METRICS_ENABLED", "false")
+	t.Setenv("HCLOUD_ENDPOINT", primary.URL+"/v1")
+	t.Setenv("HCLOUD_ENDPOINT_OVERRIDES", "servers="+replica.URL+"/replica/v1/")
+
+	client, _, err := newHcloudClient(t.TempDir())
+	require.NoError(t, err)
+
+	servers, err := client.Server.All(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, servers, 1)
+	assert.Equal(t, "foobar", servers[0].Name)
+
+	lb, _, err := client.LoadBalancer.GetByID(context.TODO(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "lb", lb.Name)
+
+	for _, overrides := range []string{"servers", "servers=", "=https://example.com", "servers=example.com/v1", "servers=https://a,servers=https://b"} {
+		t.Setenv("HCLOUD_ENDPOINT_OVERRIDES", overrides)
+		_, _, err = newHcloudClient(t.TempDir())
+		assert.ErrorContains(t, err, "HCLOUD_ENDPOINT_OVERRIDES: ", overrides)
+	}
+}
+
 func TestNewCloudInvalidToken(t *testing.T) {
 	env := newTestEnv()
 	defer env.Teardown()
@@ -276,6 +482,20 @@ func TestCloud(t *testing.T) {
 		}
 	})
 
+	t.Run("RoutesSubnetsNotInNetwork", func(t *testing.T) {
+		resetEnv := Setenv(t,
+			"HCLOUD_NETWORK", "1",
+			"HCLOUD_NETWORK_DISABLE_ATTACHED_CHECK", "true",
+			"HCLOUD_NETWORK_ROUTES_SUBNETS", "10.0.2.0/24",
+			"HCLOUD_METRICS_ENABLED", "false",
+		)
+		defer resetEnv()
+
+		_, err := newCloud(&bytes.Buffer{})
+		assert.EqualError(t, err,
+			"hcloud/newCloud: HCLOUD_NETWORK_ROUTES_SUBNETS: route subnet 10.0.2.0/24 is no subnet of network 1")
+	})
+
 	t.Run("HasClusterID", func(t *testing.T) {
 		if cloud.HasClusterID() {
 			t.Error("HasClusterID should be false")
@@ -289,6 +509,163 @@ func TestCloud(t *testing.T) {
 	})
 }
 
+func TestNodeAddressOrderFromEnv(t *testing.T) {
+	resetEnv := Setenv(t, "HCLOUD_NODE_ADDRESS_ORDER", "privateNetwork, unknown,public")
+	defer resetEnv()
+
+	assert.Equal(t,
+		[]corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeExternalIP},
+		nodeAddressOrderFromEnv())
+
+	os.Unsetenv("HCLOUD_NODE_ADDRESS_ORDER")
+	assert.Nil(t, nodeAddressOrderFromEnv())
+}
+
+func TestLoadBalancerNamespacesFromEnv(t *testing.T) {
+	assert.Nil(t, loadBalancerNamespacesFromEnv())
+
+	resetEnv := Setenv(t, "HCLOUD_LOAD_BALANCER_NAMESPACES", "team-a, team-b,,")
+	defer resetEnv()
+	assert.Equal(t, map[string]bool{"team-a": true, "team-b": true}, loadBalancerNamespacesFromEnv())
+}
+
+func TestRouteGatewayFromEnv(t *testing.T) {
+	gateway, err := routeGatewayFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, routeGatewayPrimary, gateway)
+
+	resetEnv := Setenv(t, "HCLOUD_NETWORK_ROUTES_GATEWAY", "Alias")
+	defer resetEnv()
+	gateway, err = routeGatewayFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, routeGatewayAlias, gateway)
+
+	os.Setenv("HCLOUD_NETWORK_ROUTES_GATEWAY", "public")
+	_, err = routeGatewayFromEnv()
+	assert.EqualError(t, err, "HCLOUD_NETWORK_ROUTES_GATEWAY: Invalid value, expected one of: primary,alias")
+}
+
+func TestRobotProviderIDFormatFromEnv(t *testing.T) {
+	format, err := robotProviderIDFormatFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, robotProviderIDFormatHCloud, format)
+
+	resetEnv := Setenv(t, "HCLOUD_ROBOT_PROVIDER_ID_FORMAT", "HRobot")
+	defer resetEnv()
+	format, err = robotProviderIDFormatFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, robotProviderIDFormatHRobot, format)
+
+	os.Setenv("HCLOUD_ROBOT_PROVIDER_ID_FORMAT", "bm")
+	_, err = robotProviderIDFormatFromEnv()
+	assert.EqualError(t, err, "HCLOUD_ROBOT_PROVIDER_ID_FORMAT: Invalid value, expected one of: hcloud,hrobot")
+}
+
+func TestRouteSubnetsFromEnv(t *testing.T) {
+	subnets, err := routeSubnetsFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, subnets)
+
+	resetEnv := Setenv(t, "HCLOUD_NETWORK_ROUTES_SUBNETS", "10.0.1.0/24, 10.0.0.0/24")
+	defer resetEnv()
+	subnets, err = routeSubnetsFromEnv()
+	assert.NoError(t, err)
+	if assert.Len(t, subnets, 2) {
+		assert.Equal(t, "10.0.1.0/24", subnets[0].String())
+		assert.Equal(t, "10.0.0.0/24", subnets[1].String())
+	}
+
+	os.Setenv("HCLOUD_NETWORK_ROUTES_SUBNETS", "10.0.1.0")
+	_, err = routeSubnetsFromEnv()
+	assert.EqualError(t, err, "HCLOUD_NETWORK_ROUTES_SUBNETS: invalid CIDR address: 10.0.1.0")
+}
+
+func TestAddressFamilyFromEnv(t *testing.T) {
+	family, err := addressFamilyFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, AddressFamilyIPv4, family)
+
+	t.Setenv("HCLOUD_INSTANCES_ADDRESS_FAMILY", "Auto")
+	family, err = addressFamilyFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, AddressFamilyAuto, family)
+
+	t.Setenv("HCLOUD_INSTANCES_ADDRESS_FAMILY", "ipv5")
+	_, err = addressFamilyFromEnv()
+	assert.EqualError(t, err, "HCLOUD_INSTANCES_ADDRESS_FAMILY: Invalid value, expected one of: ipv4,ipv6,dualstack,auto")
+}
+
+func TestAPIBackoffFromEnv(t *testing.T) {
+	_, ok, err := apiBackoffFromEnv()
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	cases := []struct {
+		name   string
+		env    []string
+		delays []time.Duration // upper bounds of the first retries
+		expErr string
+	}{
+		{
+			name:   "base only",
+			env:    []string{"HCLOUD_API_BACKOFF_BASE", "500ms"},
+			delays: []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name: "all set",
+			env: []string{
+				"HCLOUD_API_BACKOFF_BASE", "2s",
+				"HCLOUD_API_BACKOFF_MAX", "10s",
+				"HCLOUD_API_BACKOFF_MULTIPLIER", "3",
+			},
+			delays: []time.Duration{2 * time.Second, 6 * time.Second, 10 * time.Second, 10 * time.Second},
+		},
+		{
+			name:   "constant",
+			env:    []string{"HCLOUD_API_BACKOFF_MULTIPLIER", "1"},
+			delays: []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name:   "invalid base",
+			env:    []string{"HCLOUD_API_BACKOFF_BASE", "-1s"},
+			expErr: "HCLOUD_API_BACKOFF_BASE: must be positive",
+		},
+		{
+			name:   "max less than base",
+			env:    []string{"HCLOUD_API_BACKOFF_BASE", "2s", "HCLOUD_API_BACKOFF_MAX", "1s"},
+			expErr: "HCLOUD_API_BACKOFF_MAX: must not be less than HCLOUD_API_BACKOFF_BASE (2s)",
+		},
+		{
+			name:   "invalid multiplier",
+			env:    []string{"HCLOUD_API_BACKOFF_MULTIPLIER", "0.5"},
+			expErr: "HCLOUD_API_BACKOFF_MULTIPLIER: must be at least 1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resetEnv := Setenv(t, c.env...)
+			defer resetEnv()
+
+			opts, ok, err := apiBackoffFromEnv()
+			if c.expErr != "" {
+				assert.EqualError(t, err, c.expErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			backoff := hcloud.ExponentialBackoffWithOpts(opts)
+			for retries, upper := range c.delays {
+				for i := 0; i < 10; i++ {
+					delay := backoff(retries)
+					assert.GreaterOrEqual(t, delay, opts.Base, "retry %d", retries)
+					assert.LessOrEqual(t, delay, upper, "retry %d", retries)
+				}
+			}
+		})
+	}
+}
+
 func TestLoadBalancerDefaultsFromEnv(t *testing.T) {
 	cases := []struct {
 		name                     string
@@ -330,6 +707,17 @@ func TestLoadBalancerDefaultsFromEnv(t *testing.T) {
 				NetworkZone: "eu-central",
 			},
 		},
+		{
+			name: "Default location set",
+			env: map[string]string{
+				"HCLOUD_LOAD_BALANCERS_NETWORK_ZONE":     "eu-central",
+				"HCLOUD_LOAD_BALANCERS_DEFAULT_LOCATION": "nbg1",
+			},
+			expDefaults: hcops.LoadBalancerDefaults{
+				NetworkZone:      "eu-central",
+				FallbackLocation: "nbg1",
+			},
+		},
 		{
 			name: "Both location and network zone set (error)",
 			env: map[string]string{
@@ -352,6 +740,63 @@ func TestLoadBalancerDefaultsFromEnv(t *testing.T) {
 			},
 			expErr: `HCLOUD_LOAD_BALANCERS_DISABLE_IPV6: strconv.ParseBool: parsing "invalid": invalid syntax`,
 		},
+		{
+			name: "Algorithm and health check defaults set",
+			env: map[string]string{
+				"HCLOUD_LOAD_BALANCERS_ALGORITHM":             "least_connections",
+				"HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_INTERVAL": "5s",
+				"HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_TIMEOUT":  "3s",
+				"HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_RETRIES":  "2",
+			},
+			expDefaults: hcops.LoadBalancerDefaults{
+				Algorithm:           hcloud.LoadBalancerAlgorithmTypeLeastConnections,
+				HealthCheckInterval: 5 * time.Second,
+				HealthCheckTimeout:  3 * time.Second,
+				HealthCheckRetries:  2,
+			},
+		},
+		{
+			name: "Invalid ALGORITHM",
+			env: map[string]string{
+				"HCLOUD_LOAD_BALANCERS_ALGORITHM": "random",
+			},
+			expErr: "HCLOUD_LOAD_BALANCERS_ALGORITHM: invalid algorithm: random",
+		},
+		{
+			name: "Invalid HEALTH_CHECK_INTERVAL",
+			env: map[string]string{
+				"HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_INTERVAL": "invalid",
+			},
+			expErr: `HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_INTERVAL: time: invalid duration "invalid"`,
+		},
+		{
+			name: "Invalid HEALTH_CHECK_TIMEOUT",
+			env: map[string]string{
+				"HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_TIMEOUT": "invalid",
+			},
+			expErr: `HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_TIMEOUT: time: invalid duration "invalid"`,
+		},
+		{
+			name: "Invalid HEALTH_CHECK_RETRIES",
+			env: map[string]string{
+				"HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_RETRIES": "invalid",
+			},
+			expErr: `HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_RETRIES: strconv.Atoi: parsing "invalid": invalid syntax`,
+		},
+		{
+			name: "Negative HEALTH_CHECK_RETRIES",
+			env: map[string]string{
+				"HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_RETRIES": "-1",
+			},
+			expErr: "HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_RETRIES: must be between 0 and 5",
+		},
+		{
+			name: "Too many HEALTH_CHECK_RETRIES",
+			env: map[string]string{
+				"HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_RETRIES": "6",
+			},
+			expErr: "HCLOUD_LOAD_BALANCERS_HEALTH_CHECK_RETRIES: must be between 0 and 5",
+		},
 		{
 			name: "Invalid USE_PRIVATE_IP",
 			env: map[string]string{
@@ -420,10 +865,10 @@ func Test_updateHcloudCredentials(t *testing.T) {
 	token := "jr5g7ZHpPptyhJzZyHw2Pqu4g9gTqDvEceYpngPf79jNZXCeTYQ4uArypFM3nh75"
 	err = writeCredentials(credentialsDir, token)
 	require.NoError(t, err)
-	hcloudClient, err := newHcloudClient(rootDir)
+	hcloudClient, _, err := newHcloudClient(rootDir)
 	require.NoError(t, err)
 
-	err = credentials.Watch(credentialsDir, hcloudClient, nil)
+	err = credentials.Watch(credentialsDir, hcloudClient, nil, 0)
 	require.NoError(t, err)
 
 	hcloud.WithEndpoint(server.URL)(hcloudClient)
@@ -503,6 +948,19 @@ func Test_EnsureLoadBalancer(t *testing.T) {
 			},
 		)
 	})
+	mux.HandleFunc("/load_balancers/0", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.LoadBalancerGetResponse{LoadBalancer: schemaLB})
+	})
+	mux.HandleFunc("/load_balancers/0/actions/add_service", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.LoadBalancerActionAddServiceResponse{
+			Action: schema.Action{ID: 1, Status: string(hcloud.ActionStatusSuccess), Progress: 100},
+		})
+	})
+	mux.HandleFunc("/actions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ActionListResponse{
+			Actions: []schema.Action{{ID: 1, Status: string(hcloud.ActionStatusSuccess), Progress: 100}},
+		})
+	})
 	mux.HandleFunc("/robot/server", func(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode([]models.ServerResponse{
 			{
@@ -534,6 +992,72 @@ func Test_EnsureLoadBalancer(t *testing.T) {
 				string(annotation.LBLocation): "hel1",
 			},
 		},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80, NodePort: 8080}}},
 	}, nil)
 	require.NoError(t, err)
 }
+
+func TestNewCloudRobotStartupCheck(t *testing.T) {
+	tests := []struct {
+		mode        string
+		robotStatus int
+		expectedErr string
+	}{
+		{mode: "", robotStatus: http.StatusUnauthorized},
+		{mode: "warn", robotStatus: http.StatusUnauthorized},
+		{mode: "fail", robotStatus: http.StatusOK},
+		{
+			mode:        "fail",
+			robotStatus: http.StatusUnauthorized,
+			expectedErr: "hcloud/newCloud: hcloud/checkRobotConnectivity: invalid credentials (UNAUTHORIZED)",
+		},
+		{
+			mode:        "always",
+			robotStatus: http.StatusOK,
+			expectedErr: `hcloud/newCloud: hcloud/checkRobotConnectivity: ROBOT_STARTUP_CHECK: invalid value "always", must be one of warn, fail`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+http.StatusText(tt.robotStatus), func(t *testing.T) {
+			env := newTestEnv()
+			defer env.Teardown()
+
+			env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(schema.ServerListResponse{Servers: []schema.Server{}})
+			})
+			robotCalls := 0
+			env.Mux.HandleFunc("/robot/server", func(w http.ResponseWriter, r *http.Request) {
+				robotCalls++
+				w.WriteHeader(tt.robotStatus)
+				if tt.robotStatus != http.StatusOK {
+					json.NewEncoder(w).Encode(models.ErrorResponse{
+						Error: models.Error{Code: models.ErrorCodeUnauthorized, Message: "invalid credentials"},
+					})
+					return
+				}
+				json.NewEncoder(w).Encode([]models.ServerResponse{})
+			})
+
+			t.Setenv("HCLOUD_ENDPOINT", env.Server.URL)
+			t.Setenv("HCLOUD_TOKEN", "jr5g7ZHpPptyhJzZyHw2Pqu4g9gTqDvEceYpngPf79jN_NOT_VALID_dzhepnahq")
+			t.Setenv("HCLOUD_METRICS_ENABLED", "false")
+			t.Setenv("ROBOT_USER_NAME", "user")
+			t.Setenv("ROBOT_PASSWORD", "pass123")
+			t.Setenv("ROBOT_ENDPOINT", env.Server.URL+"/robot")
+			t.Setenv("ROBOT_STARTUP_CHECK", tt.mode)
+
+			_, err := newCloud(&bytes.Buffer{})
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			expectedCalls := 1
+			if tt.mode == "" {
+				expectedCalls = 0
+			}
+			assert.Equal(t, expectedCalls, robotCalls)
+		})
+	}
+}
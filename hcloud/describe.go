@@ -0,0 +1,38 @@
+package hcloud
+
+import (
+	"fmt"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DescribeService resolves the Load Balancer configuration of svc from its
+// annotations and the Load Balancer defaults configured in the environment,
+// without any request to the Hetzner Cloud API.
+//
+// Load Balancer profiles are stored in the cluster and are not expanded.
+func DescribeService(svc *corev1.Service) (*hcops.ServiceConfig, error) {
+	const op = "hcloud/DescribeService"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	defaults, _, _, err := loadBalancerDefaultsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	svc = svc.DeepCopy()
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	svc, err = applyLBSessionMode(svc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	cfg, err := hcops.DescribeService(svc, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return cfg, nil
+}
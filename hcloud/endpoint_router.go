@@ -0,0 +1,79 @@
+package hcloud
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// endpointRouter sends requests for some resource types of the Hetzner Cloud
+// API to other endpoints than the configured one, e.g. to a caching proxy
+// for listing servers. The resource type is the first path segment after the
+// endpoint, e.g. "servers" or "load_balancers". Requests for all other
+// resource types are sent to the configured endpoint.
+type endpointRouter struct {
+	endpoint  *url.URL
+	overrides map[string]*url.URL
+	next      http.RoundTripper
+}
+
+func newEndpointRouter(endpoint string, overrides map[string]*url.URL, next http.RoundTripper) (*endpointRouter, error) {
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &endpointRouter{endpoint: u, overrides: overrides, next: next}, nil
+}
+
+func (r *endpointRouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.EqualFold(req.URL.Host, r.endpoint.Host) || !strings.HasPrefix(req.URL.Path, r.endpoint.Path+"/") {
+		return r.next.RoundTrip(req)
+	}
+	rest := strings.TrimPrefix(req.URL.Path, r.endpoint.Path)
+	resource, _, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+	override, ok := r.overrides[resource]
+	if !ok {
+		return r.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme = override.Scheme
+	req.URL.Host = override.Host
+	req.URL.Path = override.Path + rest
+	req.URL.RawPath = ""
+	req.Host = ""
+	return r.next.RoundTrip(req)
+}
+
+// parseEndpointOverrides parses overrides of the form
+// "servers=https://proxy.example.com/v1,load_balancers=https://...".
+func parseEndpointOverrides(s string) (map[string]*url.URL, error) {
+	overrides := make(map[string]*url.URL)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		resource, endpoint, ok := strings.Cut(pair, "=")
+		resource, endpoint = strings.TrimSpace(resource), strings.TrimSpace(endpoint)
+		if !ok || resource == "" || strings.Contains(resource, "/") {
+			return nil, fmt.Errorf("invalid endpoint override %q, expected <resource type>=<endpoint>", pair)
+		}
+		u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint for %s: %w", resource, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint for %s: %q is not an absolute http or https URL", resource, endpoint)
+		}
+		if _, ok := overrides[resource]; ok {
+			return nil, fmt.Errorf("duplicate endpoint override for %s", resource)
+		}
+		overrides[resource] = u
+	}
+	return overrides, nil
+}
@@ -0,0 +1,89 @@
+package hcloud
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// instanceTypeMapper derives the instance type of a node, which is set as
+// label node.kubernetes.io/instance-type, from the type of its server. For
+// hcloud servers the type is the name of the server type (e.g. "cx22"), for
+// robot servers the product (e.g. "EX44").
+type instanceTypeMapper interface {
+	InstanceType(serverType string) string
+}
+
+// rawInstanceType reports the type of the server as instance type.
+type rawInstanceType struct{}
+
+func (rawInstanceType) InstanceType(serverType string) string {
+	return serverType
+}
+
+// instanceTypeMapping maps server types to instance types. Server types
+// without a mapping are reported as they are.
+type instanceTypeMapping map[string]string
+
+func (m instanceTypeMapping) InstanceType(serverType string) string {
+	if instanceType, ok := m[serverType]; ok {
+		return instanceType
+	}
+	return serverType
+}
+
+// parseInstanceTypeMapping parses a mapping of the form
+// "cx22=standard-2,cx32=standard-4". Pairs can be separated by commas or
+// newlines, empty lines and lines starting with "#" are ignored.
+func parseInstanceTypeMapping(s string) (instanceTypeMapping, error) {
+	m := make(instanceTypeMapping)
+	for _, pair := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		pair = strings.TrimSpace(pair)
+		if pair == "" || strings.HasPrefix(pair, "#") {
+			continue
+		}
+		serverType, instanceType, ok := strings.Cut(pair, "=")
+		serverType, instanceType = strings.TrimSpace(serverType), strings.TrimSpace(instanceType)
+		if !ok || serverType == "" || instanceType == "" {
+			return nil, fmt.Errorf("invalid instance type mapping %q, expected <server type>=<instance type>", pair)
+		}
+		if errs := validation.IsValidLabelValue(instanceType); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid instance type %q: %s", instanceType, strings.Join(errs, ", "))
+		}
+		if _, ok := m[serverType]; ok {
+			return nil, fmt.Errorf("duplicate instance type mapping for server type %q", serverType)
+		}
+		m[serverType] = instanceType
+	}
+	return m, nil
+}
+
+// instanceTypeMapperFromEnv returns the instance type mapping configured in
+// hcloudInstanceTypeMapping or in the file hcloudInstanceTypeMappingFile.
+// Without configuration the server type is reported as it is.
+func instanceTypeMapperFromEnv() (instanceTypeMapper, error) {
+	key := hcloudInstanceTypeMapping
+	mapping := os.Getenv(hcloudInstanceTypeMapping)
+	path := os.Getenv(hcloudInstanceTypeMappingFile)
+	switch {
+	case mapping != "" && path != "":
+		return nil, fmt.Errorf("only one of %s and %s can be set", hcloudInstanceTypeMapping, hcloudInstanceTypeMappingFile)
+	case path != "":
+		key = hcloudInstanceTypeMappingFile
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		mapping = string(data)
+	case mapping == "":
+		return rawInstanceType{}, nil
+	}
+
+	m, err := parseInstanceTypeMapping(mapping)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return m, nil
+}
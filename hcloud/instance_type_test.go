@@ -0,0 +1,115 @@
+package hcloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseInstanceTypeMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  string
+		expected instanceTypeMapping
+		err      string
+	}{
+		{
+			name:     "comma separated",
+			mapping:  "cx22=standard-2, cx32=standard-4",
+			expected: instanceTypeMapping{"cx22": "standard-2", "cx32": "standard-4"},
+		},
+		{
+			name:     "file with comments",
+			mapping:  "# shared vCPU\ncx22=standard-2\n\nEX44 = dedicated-20\n",
+			expected: instanceTypeMapping{"cx22": "standard-2", "EX44": "dedicated-20"},
+		},
+		{
+			name:    "missing instance type",
+			mapping: "cx22=",
+			err:     `invalid instance type mapping "cx22=", expected <server type>=<instance type>`,
+		},
+		{
+			name:    "invalid label value",
+			mapping: "cx22=standard 2",
+			err:     `invalid instance type "standard 2"`,
+		},
+		{
+			name:    "duplicate server type",
+			mapping: "cx22=a,cx22=b",
+			err:     `duplicate instance type mapping for server type "cx22"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := parseInstanceTypeMapping(tt.mapping)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, m)
+		})
+	}
+}
+
+func TestInstanceTypeMapperFromEnv(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		m, err := instanceTypeMapperFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, "cx22", m.InstanceType("cx22"))
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "instance-types")
+		require.NoError(t, os.WriteFile(path, []byte("cx22=standard-2\n"), 0o600))
+		resetEnv := Setenv(t, "HCLOUD_INSTANCE_TYPE_MAPPING_FILE", path)
+		defer resetEnv()
+
+		m, err := instanceTypeMapperFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, "standard-2", m.InstanceType("cx22"))
+		// Server types without mapping are kept.
+		assert.Equal(t, "cpx11", m.InstanceType("cpx11"))
+	})
+
+	t.Run("both set", func(t *testing.T) {
+		resetEnv := Setenv(t,
+			"HCLOUD_INSTANCE_TYPE_MAPPING", "cx22=standard-2",
+			"HCLOUD_INSTANCE_TYPE_MAPPING_FILE", "/some/file",
+		)
+		defer resetEnv()
+
+		_, err := instanceTypeMapperFromEnv()
+		assert.EqualError(t, err, "only one of HCLOUD_INSTANCE_TYPE_MAPPING and HCLOUD_INSTANCE_TYPE_MAPPING_FILE can be set")
+	})
+}
+
+func TestInstances_InstanceMetadataInstanceType(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+	env.Mux.HandleFunc("/servers/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{
+			Server: schema.Server{ID: 1, Name: "foobar", ServerType: schema.ServerType{Name: "cx22"}},
+		})
+	})
+	node := &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}}
+
+	instances := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+	metadata, err := instances.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	assert.Equal(t, "cx22", metadata.InstanceType)
+
+	instances = newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+	instances.instanceType = instanceTypeMapping{"cx22": "standard-2"}
+	metadata, err = instances.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	assert.Equal(t, "standard-2", metadata.InstanceType)
+}
@@ -19,13 +19,24 @@ package hcloud
 import (
 	"context"
 	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/providerid"
 	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/tracing"
 	"github.com/syself/hrobot-go/models"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
 )
 
 type addressFamily int
@@ -34,19 +45,267 @@ const (
 	AddressFamilyDualStack addressFamily = iota
 	AddressFamilyIPv6
 	AddressFamilyIPv4
+
+	// AddressFamilyAuto reports the public addresses of all families each
+	// server has, IPv4 first. It supports mixed fleets, in which some
+	// servers have no IPv4 address.
+	AddressFamilyAuto
 )
 
+// uses reports whether addresses of the families IPv4 and IPv6 are reported
+// for a server which has addresses of the families hasIPv4 and hasIPv6.
+func (f addressFamily) uses(hasIPv4, hasIPv6 bool) (ipv4, ipv6 bool) {
+	switch f {
+	case AddressFamilyAuto:
+		return hasIPv4, hasIPv6
+	case AddressFamilyIPv4:
+		return true, false
+	case AddressFamilyIPv6:
+		return false, true
+	default:
+		return true, true
+	}
+}
+
 type instances struct {
 	client        *hcloud.Client
 	robotClient   robotclient.Client
 	addressFamily addressFamily
-	networkID     int64
+	network       *hcops.NetworkRef
+	serverCache   *serverCache
+
+	// additionalProviderIDPrefix is accepted in addition to "hcloud://" when
+	// parsing provider IDs, e.g. for nodes migrated from other tooling. New
+	// nodes always get the canonical "hcloud://" prefix.
+	additionalProviderIDPrefix string
+
+	// robotProviderIDFormat selects the provider ID of new robot nodes.
+	robotProviderIDFormat robotProviderIDFormat
+
+	// discoverProviderID enables the lookup of nodes without provider ID in
+	// both the Hetzner Cloud and the Robot API, independent of the name
+	// prefix of the node.
+	discoverProviderID bool
+
+	// matchNodeNameLabel enables the lookup of hcloud servers by the
+	// nodeNameLabel for nodes without provider ID whose server could not be
+	// found by name.
+	matchNodeNameLabel bool
+
+	// topologyUseDatacenter reports the datacenter of hcloud servers as zone
+	// and their location as region. Otherwise the location is reported as
+	// zone and the network zone as region, like for robot servers.
+	topologyUseDatacenter bool
+
+	// metadataFallback answers metadata lookups failing with a transient
+	// error with the last known metadata of the node. Disabled if nil.
+	metadataFallback *metadataFallback
+
+	// metadataCache answers metadata lookups of unchanged nodes without
+	// looking up their server. Disabled if nil.
+	metadataCache *metadataCache
+
+	// notFoundGrace delays reporting nodes whose server was not found as
+	// not existing. Disabled if nil.
+	notFoundGrace *notFoundGrace
+
+	// lookupCondition reports nodes which could not be resolved to a server
+	// as node condition. Disabled if nil.
+	lookupCondition *nodeLookupCondition
+
+	// preloadStatuses restricts the servers added to the server cache by
+	// preload to these statuses. All statuses if empty.
+	preloadStatuses []hcloud.ServerStatus
+
+	// preloadExcludeStatuses are the statuses of servers preload does not
+	// add to the server cache, e.g. servers which are being deleted.
+	preloadExcludeStatuses []hcloud.ServerStatus
+
+	// addressOrder is the precedence of the node address types. Addresses of
+	// types not listed keep their order after the listed ones.
+	addressOrder []corev1.NodeAddressType
+
+	// instanceType derives the instance type of nodes from the type of their
+	// server.
+	instanceType instanceTypeMapper
+
+	// serverIDLabel adds the serverIDNodeLabel to the metadata of the nodes.
+	serverIDLabel bool
+}
+
+var (
+	errServerNotFound      = fmt.Errorf("server not found")
+	errAmbiguousServerName = fmt.Errorf("more than one server matches the node name")
+)
+
+// ambiguousServerName returns errAmbiguousServerName for the node nodeName
+// matching more than one server and counts it. Picking one of the servers
+// could mix up the metadata of different machines.
+func ambiguousServerName(nodeName string, matches int) error {
+	metrics.AmbiguousServerNames.Inc()
+	return fmt.Errorf("%w: node %q matches %d servers", errAmbiguousServerName, nodeName, matches)
 }
 
-var errServerNotFound = fmt.Errorf("server not found")
+// robotVSwitchIPAnnotation is set on robot nodes to the private IP of the
+// server in a vSwitch. The Robot API does not report these addresses, so they
+// have to be provided by the cluster operator. The IP is reported as
+// InternalIP of the node.
+const robotVSwitchIPAnnotation = "robot.hetzner.cloud/vswitch-ip"
+
+// nodeNameLabel can be set on hcloud servers to the name of their node, if the
+// name of the server differs from the name of the node.
+const nodeNameLabel = "hcloud-ccm/node-name"
+
+// serverIDNodeLabel is set on nodes to the ID of their hcloud server, or the
+// server number of robot servers, e.g. to correlate nodes with Hetzner
+// resources in dashboards.
+const serverIDNodeLabel = "hcloud.syself.com/server-id"
+
+// serverCacheTTL is the time a hcloud server is served from the cache before
+// it is requested from the API again.
+const serverCacheTTL = 10 * time.Second
 
 func newInstances(client *hcloud.Client, robotClient robotclient.Client, addressFamily addressFamily, networkID int64) *instances {
-	return &instances{client, robotClient, addressFamily, networkID}
+	return &instances{
+		client:        client,
+		robotClient:   robotClient,
+		addressFamily: addressFamily,
+		network:       hcops.NewNetworkRef(networkID),
+		serverCache:   newServerCache(serverCacheTTL),
+
+		topologyUseDatacenter: true,
+		instanceType:          rawInstanceType{},
+	}
+}
+
+// preload lists all hcloud servers once and adds them to the server cache,
+// so that the lookups of all nodes after a restart do not request every
+// server separately. The servers can be filtered by their status. The robot
+// server list is requested as well, which fills the cache of the robot
+// client.
+func (i *instances) preload(ctx context.Context) error {
+	const op = "hcloud/instances.preload"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	servers, err := i.client.Server.AllWithOpts(ctx, hcloud.ServerListOpts{Status: i.preloadStatuses})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, server := range servers {
+		// Excluded servers are still looked up on demand.
+		if slices.Contains(i.preloadExcludeStatuses, server.Status) {
+			continue
+		}
+		i.serverCache.set(server)
+	}
+
+	if i.robotClient != nil {
+		if _, err := i.robotClient.ServerGetList(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// serverCache caches hcloud servers keyed by their ID.
+//
+// Server names are not unique over time: when a node is recreated (e.g. by the
+// cluster-autoscaler) the new server usually gets the same name but a new ID.
+// A cached server is therefore only served if its name still matches the
+// name of the node, and storing a server evicts all other servers with the
+// same name.
+type serverCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	servers map[int64]cachedServer
+}
+
+type cachedServer struct {
+	server    *hcloud.Server
+	fetchedAt time.Time
+}
+
+func newServerCache(ttl time.Duration) *serverCache {
+	return &serverCache{ttl: ttl, servers: make(map[int64]cachedServer)}
+}
+
+// get returns the cached server with the given ID, if it is not expired and
+// its name matches nodeName. Stale entries are evicted.
+func (c *serverCache) get(id int64, nodeName string) *hcloud.Server {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.servers[id]
+	if !ok {
+		return nil
+	}
+	if time.Since(entry.fetchedAt) > c.ttl || entry.server.Name != nodeName {
+		delete(c.servers, id)
+		return nil
+	}
+	return entry.server
+}
+
+// set stores server in the cache and evicts all servers with the same name
+// but a different ID.
+func (c *serverCache) set(server *hcloud.Server) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, entry := range c.servers {
+		if id != server.ID && entry.server.Name == server.Name {
+			delete(c.servers, id)
+		}
+	}
+	c.servers[server.ID] = cachedServer{server: server, fetchedAt: time.Now()}
+}
+
+// remove evicts the server with the given ID from the cache.
+func (c *serverCache) remove(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.servers, id)
+}
+
+// getHCloudServerByID returns the hcloud server with the given ID, preferring
+// the cache if the cached server still belongs to the node.
+func (i *instances) getHCloudServerByID(ctx context.Context, id int64, node *corev1.Node) (*hcloud.Server, error) {
+	if server := i.serverCache.get(id, node.Name); server != nil {
+		return server, nil
+	}
+
+	server, err := getHCloudServerByID(ctx, i.client, id)
+	if err != nil {
+		return nil, err
+	}
+	if server == nil {
+		i.serverCache.remove(id)
+		return nil, nil
+	}
+	i.serverCache.set(server)
+	i.metadataCache.observe(server)
+	return server, nil
+}
+
+// getHCloudServerByName always requests the server from the API, as the name
+// of a node may refer to a recreated server with a new ID.
+func (i *instances) getHCloudServerByName(ctx context.Context, name string) (*hcloud.Server, error) {
+	server, err := getHCloudServerByName(ctx, i.client, name)
+	if err != nil {
+		return nil, err
+	}
+	if server != nil {
+		i.serverCache.set(server)
+		i.metadataCache.observe(server)
+	}
+	return server, nil
+}
+
+// providerIDToServerID parses providerID, accepting the additional provider ID
+// prefix if configured.
+func (i *instances) providerIDToServerID(providerID string) (int64, bool, error) {
+	return providerid.ToServerID(providerID, i.additionalProviderIDPrefix)
 }
 
 // lookupServer attempts to locate the corresponding hcloud.Server or models.Server (robot server) for a given v1.Node.
@@ -58,13 +317,13 @@ func (i *instances) lookupServer(
 ) (hcloudServer *hcloud.Server, bmServer *models.Server, isHCloudServer bool, err error) {
 	if node.Spec.ProviderID != "" {
 		var serverID int64
-		serverID, isHCloudServer, err = providerIDToServerID(node.Spec.ProviderID)
+		serverID, isHCloudServer, err = i.providerIDToServerID(node.Spec.ProviderID)
 		if err != nil {
 			return nil, nil, false, fmt.Errorf("failed to convert provider id to server id: %w", err)
 		}
 
 		if isHCloudServer {
-			hcloudServer, err = getHCloudServerByID(ctx, i.client, serverID)
+			hcloudServer, err = i.getHCloudServerByID(ctx, serverID, node)
 			if err != nil {
 				return nil, nil, false, fmt.Errorf("failed to get hcloud server \"%d\": %w", serverID, err)
 			}
@@ -77,10 +336,15 @@ func (i *instances) lookupServer(
 				return nil, nil, false, fmt.Errorf("failed to get robot server \"%d\": %w", serverID, err)
 			}
 		}
+	} else if i.discoverProviderID {
+		hcloudServer, bmServer, isHCloudServer, err = i.discoverServer(ctx, node)
+		if err != nil {
+			return nil, nil, false, err
+		}
 	} else {
 		if isHCloudServerByName(string(node.Name)) {
 			isHCloudServer = true
-			hcloudServer, err = getHCloudServerByName(ctx, i.client, string(node.Name))
+			hcloudServer, err = i.getHCloudServerByName(ctx, string(node.Name))
 			if err != nil {
 				return nil, nil, false, fmt.Errorf("failed to get hcloud server %q: %w", string(node.Name), err)
 			}
@@ -94,19 +358,105 @@ func (i *instances) lookupServer(
 			}
 		}
 	}
+
+	if node.Spec.ProviderID == "" && hcloudServer == nil && bmServer == nil && i.matchNodeNameLabel {
+		server, err := i.getHCloudServerByNodeNameLabel(ctx, node.Name)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to get hcloud server labeled %s=%s: %w", nodeNameLabel, node.Name, err)
+		}
+		if server != nil {
+			return server, nil, true, nil
+		}
+	}
 	return hcloudServer, bmServer, isHCloudServer, nil
 }
 
+// getHCloudServerByNodeNameLabel returns the hcloud server whose nodeNameLabel
+// equals name. It returns nil if no server has the label, and
+// errAmbiguousServerName if more than one server has it.
+func (i *instances) getHCloudServerByNodeNameLabel(ctx context.Context, name string) (*hcloud.Server, error) {
+	const op = "hcloud/instances.getHCloudServerByNodeNameLabel"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	// Node names which are no valid label values can not be matched.
+	if errs := validation.IsValidLabelValue(name); len(errs) > 0 {
+		return nil, nil
+	}
+
+	servers, err := i.client.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: nodeNameLabel + "=" + name},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, hcops.NewAPIError("list", "servers", err))
+	}
+	switch len(servers) {
+	case 0:
+		return nil, nil
+	case 1:
+		i.serverCache.set(servers[0])
+		i.metadataCache.observe(servers[0])
+		return servers[0], nil
+	default:
+		return nil, fmt.Errorf("%s: %w", op, ambiguousServerName(name, len(servers)))
+	}
+}
+
+// discoverServer looks up the server of a node without provider ID by its
+// name in the Hetzner Cloud and, if configured, in the Robot API. If more than
+// one server matches, errAmbiguousServerName is returned instead of guessing.
+func (i *instances) discoverServer(
+	ctx context.Context,
+	node *corev1.Node,
+) (hcloudServer *hcloud.Server, bmServer *models.Server, isHCloudServer bool, err error) {
+	hcloudServer, err = i.getHCloudServerByName(ctx, node.Name)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to get hcloud server %q: %w", node.Name, err)
+	}
+
+	var bmServers []models.Server
+	if i.robotClient != nil {
+		bmServers, err = getRobotServersByName(i.robotClient, node)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to get robot server %q: %w", node.Name, err)
+		}
+	}
+
+	matches := len(bmServers)
+	if hcloudServer != nil {
+		matches++
+	}
+	switch {
+	case matches > 1:
+		return nil, nil, false, fmt.Errorf("failed to discover server %q: %w", node.Name, ambiguousServerName(node.Name, matches))
+	case hcloudServer != nil:
+		return hcloudServer, nil, true, nil
+	case len(bmServers) == 1:
+		return nil, &bmServers[0], false, nil
+	default:
+		// Keep the error messages for missing servers consistent with nodes
+		// which are not discovered.
+		return nil, nil, isHCloudServerByName(node.Name), nil
+	}
+}
+
 func (i *instances) InstanceExists(ctx context.Context, node *corev1.Node) (bool, error) {
 	const op = "hcloud/instancesv2.InstanceExists"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
 	hcloudServer, bmServer, _, err := i.lookupServer(ctx, node)
 	if err != nil {
+		i.lookupCondition.report(ctx, node, err)
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
+	if hcloudServer == nil && bmServer == nil {
+		i.lookupCondition.report(ctx, node, fmt.Errorf("no matching server found for node '%s': %w", node.Name, errServerNotFound))
+		i.metadataCache.invalidate(node.Name)
+		return !i.notFoundGrace.confirmGone(node.Name), nil
+	}
+	i.notFoundGrace.found(node.Name)
+	i.lookupCondition.report(ctx, node, nil)
 
-	return hcloudServer != nil || bmServer != nil, nil
+	return true, nil
 }
 
 func (i *instances) InstanceShutdown(ctx context.Context, node *corev1.Node) (bool, error) {
@@ -133,35 +483,107 @@ func (i *instances) InstanceMetadata(ctx context.Context, node *corev1.Node) (*c
 	const op = "hcloud/instancesv2.InstanceMetadata"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
-	hcloudServer, bmServer, isHCloudServer, err := i.lookupServer(ctx, node)
+	if cached, ok := i.metadataCache.get(node); ok {
+		return cached, nil
+	}
+
+	ctx, span := tracing.Start(ctx, op, tracing.Node(node)...)
+	metadata, hcloudServer, err := i.instanceMetadata(ctx, node)
+	tracing.End(span, err)
+	i.lookupCondition.report(ctx, node, err)
 	if err != nil {
+		if fallback, ok := i.metadataFallback.get(node.Name, err); ok {
+			klog.Warningf("%s: lookup of node %s failed, using last known metadata marked with %s: %v",
+				op, node.Name, staleMetadataLabel, err)
+			return fallback, nil
+		}
 		return nil, err
 	}
+	i.metadataFallback.store(node.Name, metadata)
+	i.metadataCache.store(node, hcloudServer, metadata)
+	return metadata, nil
+}
+
+// instanceMetadata looks up the metadata of node. It returns the hcloud
+// server of the node as well, nil for robot servers.
+func (i *instances) instanceMetadata(ctx context.Context, node *corev1.Node) (*cloudprovider.InstanceMetadata, *hcloud.Server, error) {
+	hcloudServer, bmServer, isHCloudServer, err := i.lookupServer(ctx, node)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if isHCloudServer {
 		if hcloudServer == nil {
-			return nil, fmt.Errorf("failed to get instance metadata: no matching hcloud server found for node '%s': %w",
+			return nil, nil, fmt.Errorf("failed to get instance metadata: no matching hcloud server found for node '%s': %w",
 				node.Name, errServerNotFound)
 		}
+		zone, region := i.hcloudTopology(hcloudServer)
 		return &cloudprovider.InstanceMetadata{
-			ProviderID:    serverIDToProviderIDHCloud(hcloudServer.ID),
-			InstanceType:  hcloudServer.ServerType.Name,
-			NodeAddresses: hcloudNodeAddresses(i.addressFamily, i.networkID, hcloudServer),
-			Zone:          hcloudServer.Datacenter.Name,
-			Region:        hcloudServer.Datacenter.Location.Name,
-		}, nil
+			ProviderID:       serverIDToProviderIDHCloud(hcloudServer.ID),
+			InstanceType:     i.instanceType.InstanceType(hcloudServer.ServerType.Name),
+			NodeAddresses:    sortNodeAddresses(hcloudNodeAddresses(i.addressFamily, i.network.ID(), hcloudServer), i.addressOrder),
+			Zone:             zone,
+			Region:           region,
+			AdditionalLabels: i.additionalLabels(hcloudServer.ID),
+		}, hcloudServer, nil
 	}
 	if bmServer == nil {
-		return nil, fmt.Errorf("failed to get instance metadata: no matching bare metal server found for node '%s': %w",
+		return nil, nil, fmt.Errorf("failed to get instance metadata: no matching bare metal server found for node '%s': %w",
 			node.Name, errServerNotFound)
 	}
+	addresses := robotNodeAddresses(i.addressFamily, bmServer)
+	vSwitchIP, err := robotVSwitchIP(node)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get instance metadata: %w", err)
+	}
+	if vSwitchIP != nil {
+		addresses = append(addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: vSwitchIP.String()})
+	}
 	return &cloudprovider.InstanceMetadata{
-		ProviderID:    serverIDToProviderIDRobot(bmServer.ServerNumber),
-		InstanceType:  getInstanceTypeOfRobotServer(bmServer),
-		NodeAddresses: robotNodeAddresses(i.addressFamily, bmServer),
-		Zone:          getZoneOfRobotServer(bmServer),
-		Region:        getRegionOfRobotServer(bmServer),
-	}, nil
+		ProviderID:       serverIDToProviderIDRobot(i.robotProviderIDFormat, bmServer.ServerNumber),
+		InstanceType:     i.instanceType.InstanceType(getInstanceTypeOfRobotServer(bmServer)),
+		NodeAddresses:    sortNodeAddresses(addresses, i.addressOrder),
+		Zone:             getZoneOfRobotServer(bmServer),
+		Region:           getRegionOfRobotServer(bmServer),
+		AdditionalLabels: i.additionalLabels(int64(bmServer.ServerNumber)),
+	}, nil, nil
+}
+
+// additionalLabels returns the labels of the node of the server with the ID
+// or server number id, nil if no labels are enabled.
+func (i *instances) additionalLabels(id int64) map[string]string {
+	if !i.serverIDLabel {
+		return nil
+	}
+	return map[string]string{serverIDNodeLabel: strconv.FormatInt(id, 10)}
+}
+
+// hcloudTopology returns the zone and the region of server.
+func (i *instances) hcloudTopology(server *hcloud.Server) (zone, region string) {
+	if i.topologyUseDatacenter {
+		return server.Datacenter.Name, server.Datacenter.Location.Name
+	}
+	return server.Datacenter.Location.Name, string(server.Datacenter.Location.NetworkZone)
+}
+
+// sortNodeAddresses orders addresses by the precedence of their type in
+// order. The relative order of addresses with the same precedence is kept.
+func sortNodeAddresses(addresses []corev1.NodeAddress, order []corev1.NodeAddressType) []corev1.NodeAddress {
+	if len(order) == 0 {
+		return addresses
+	}
+	rank := func(t corev1.NodeAddressType) int {
+		for i, o := range order {
+			if o == t {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(addresses, func(a, b int) bool {
+		return rank(addresses[a].Type) < rank(addresses[b].Type)
+	})
+	return addresses
 }
 
 func hcloudNodeAddresses(addressFamily addressFamily, networkID int64, server *hcloud.Server) []corev1.NodeAddress {
@@ -171,7 +593,8 @@ func hcloudNodeAddresses(addressFamily addressFamily, networkID int64, server *h
 		corev1.NodeAddress{Type: corev1.NodeHostName, Address: server.Name},
 	)
 
-	if addressFamily == AddressFamilyIPv4 || addressFamily == AddressFamilyDualStack {
+	useIPv4, useIPv6 := addressFamily.uses(!server.PublicNet.IPv4.IsUnspecified(), !server.PublicNet.IPv6.IsUnspecified())
+	if useIPv4 {
 		if !server.PublicNet.IPv4.IsUnspecified() {
 			addresses = append(
 				addresses,
@@ -180,10 +603,11 @@ func hcloudNodeAddresses(addressFamily addressFamily, networkID int64, server *h
 		}
 	}
 
-	if addressFamily == AddressFamilyIPv6 || addressFamily == AddressFamilyDualStack {
+	if useIPv6 {
 		if !server.PublicNet.IPv6.IsUnspecified() {
 			// For a given IPv6 network of 2001:db8:1234::/64, the instance address is 2001:db8:1234::1
-			hostAddress := server.PublicNet.IPv6.IP
+			// Copy the IP, it belongs to the server, which might be cached.
+			hostAddress := slices.Clone(server.PublicNet.IPv6.IP)
 			hostAddress[len(hostAddress)-1] |= 0x01
 
 			addresses = append(
@@ -196,7 +620,8 @@ func hcloudNodeAddresses(addressFamily addressFamily, networkID int64, server *h
 	// Add private IP from network if network is specified
 	if networkID > 0 {
 		for _, privateNet := range server.PrivateNet {
-			if privateNet.Network.ID == networkID {
+			// The IP is missing while the server is being attached.
+			if privateNet.Network.ID == networkID && privateNet.IP != nil && !privateNet.IP.IsUnspecified() {
 				addresses = append(
 					addresses,
 					corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: privateNet.IP.String()},
@@ -207,6 +632,21 @@ func hcloudNodeAddresses(addressFamily addressFamily, networkID int64, server *h
 	return addresses
 }
 
+// robotVSwitchIP returns the vSwitch IP configured with
+// robotVSwitchIPAnnotation, or nil if the annotation is not set. Robot nodes
+// without the annotation only have their public addresses.
+func robotVSwitchIP(node *corev1.Node) (net.IP, error) {
+	v, ok := node.Annotations[robotVSwitchIPAnnotation]
+	if !ok || v == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return nil, fmt.Errorf("node %s: invalid IP %q in annotation %s", node.Name, v, robotVSwitchIPAnnotation)
+	}
+	return ip, nil
+}
+
 func robotNodeAddresses(addressFamily addressFamily, server *models.Server) []corev1.NodeAddress {
 	var addresses []corev1.NodeAddress
 	addresses = append(
@@ -214,23 +654,31 @@ func robotNodeAddresses(addressFamily addressFamily, server *models.Server) []co
 		corev1.NodeAddress{Type: corev1.NodeHostName, Address: server.Name},
 	)
 
-	if addressFamily == AddressFamilyIPv6 || addressFamily == AddressFamilyDualStack {
-		// For a given IPv6 network of 2a01:f48:111:4221::, the instance address is 2a01:f48:111:4221::1
-		hostAddress := server.ServerIPv6Net
-		hostAddress += "1"
-
-		addresses = append(
-			addresses,
-			corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: hostAddress},
-		)
+	// For a given IPv6 network of 2a01:f48:111:4221::, the instance address is 2a01:f48:111:4221::1
+	ipv6, err := hcops.RobotServerIPv6(server)
+	if err != nil {
+		klog.Warningf("skipping IPv6 address of node %s: %s", server.Name, err)
 	}
-
-	if addressFamily == AddressFamilyIPv4 || addressFamily == AddressFamilyDualStack {
-		addresses = append(
-			addresses,
-			corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: server.ServerIP},
-		)
+	useIPv4, useIPv6 := addressFamily.uses(server.ServerIP != "", ipv6 != "")
+	ipv4Address := corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: server.ServerIP}
+	ipv6Address := corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: ipv6}
+
+	// Dedicated servers report their IPv6 address first, unless the family
+	// is detected automatically, which reports IPv4 first for all servers.
+	if addressFamily == AddressFamilyAuto {
+		if useIPv4 {
+			addresses = append(addresses, ipv4Address)
+		}
+		if useIPv6 {
+			addresses = append(addresses, ipv6Address)
+		}
+		return addresses
+	}
+	if useIPv6 && ipv6 != "" {
+		addresses = append(addresses, ipv6Address)
+	}
+	if useIPv4 {
+		addresses = append(addresses, ipv4Address)
 	}
-
 	return addresses
 }
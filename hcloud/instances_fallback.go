@@ -0,0 +1,92 @@
+package hcloud
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// metadataFallback keeps the last instance metadata successfully looked up
+// for every node. If a lookup fails with a transient error, e.g. during a
+// brief outage of the API, the last known metadata is returned instead of an
+// error for up to ttl after it was looked up. The returned metadata is marked
+// with staleMetadataLabel.
+type metadataFallback struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	metadata map[string]cachedMetadata
+}
+
+// staleMetadataLabel is added to the additional labels of metadata returned
+// by the fallback, as it may be outdated.
+const staleMetadataLabel = "hcloud.syself.com/metadata-stale"
+
+type cachedMetadata struct {
+	metadata cloudprovider.InstanceMetadata
+	storedAt time.Time
+}
+
+func newMetadataFallback(ttl time.Duration) *metadataFallback {
+	return &metadataFallback{ttl: ttl, metadata: make(map[string]cachedMetadata)}
+}
+
+// store remembers metadata as the last known metadata of nodeName.
+func (f *metadataFallback) store(nodeName string, metadata *cloudprovider.InstanceMetadata) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := *metadata
+	m.NodeAddresses = append(m.NodeAddresses[:0:0], metadata.NodeAddresses...)
+	f.metadata[nodeName] = cachedMetadata{metadata: m, storedAt: time.Now()}
+}
+
+// get returns the last known metadata of nodeName, marked with
+// staleMetadataLabel, if err is transient and the metadata is not older than
+// ttl.
+func (f *metadataFallback) get(nodeName string, err error) (*cloudprovider.InstanceMetadata, bool) {
+	if f == nil || !isTransientLookupError(err) {
+		return nil, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.metadata[nodeName]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.storedAt) > f.ttl {
+		delete(f.metadata, nodeName)
+		return nil, false
+	}
+	metrics.InstanceMetadataFallbacks.Inc()
+	m := entry.metadata
+	m.NodeAddresses = append(m.NodeAddresses[:0:0], entry.metadata.NodeAddresses...)
+	m.AdditionalLabels = make(map[string]string, len(entry.metadata.AdditionalLabels)+1)
+	for k, v := range entry.metadata.AdditionalLabels {
+		m.AdditionalLabels[k] = v
+	}
+	m.AdditionalLabels[staleMetadataLabel] = "true"
+	return &m, true
+}
+
+// isTransientLookupError reports whether err may be caused by a temporary
+// problem of the API or the network, rather than by the server.
+func isTransientLookupError(err error) bool {
+	if errors.Is(err, errServerNotFound) || errors.Is(err, errAmbiguousServerName) {
+		return false
+	}
+	// Responses without an API error, e.g. from a proxy in front of the API,
+	// are reported as ErrStatusCode.
+	var netErr net.Error
+	return hcops.IsRetriable(err) || errors.As(err, &netErr) || errors.Is(err, hcloud.ErrStatusCode)
+}
@@ -0,0 +1,112 @@
+package hcloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstances_InstanceMetadataFallback(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	var response func(w http.ResponseWriter)
+	env.Mux.HandleFunc("/servers/1", func(w http.ResponseWriter, r *http.Request) {
+		response(w)
+	})
+	ok := func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{
+			Server: schema.Server{
+				ID:         1,
+				Name:       "foobar",
+				ServerType: schema.ServerType{Name: "cx22"},
+				Datacenter: schema.Datacenter{Name: "fsn1-dc14", Location: schema.Location{Name: "fsn1"}},
+				PublicNet: schema.ServerPublicNet{
+					IPv4: schema.ServerPublicNetIPv4{IP: "203.0.113.7"},
+				},
+			},
+		})
+	}
+	apiError := func(status int, code hcloud.ErrorCode) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(schema.ErrorResponse{Error: schema.Error{Code: string(code)}})
+		}
+	}
+	unavailable := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "foobar"},
+		Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+	}
+	newTestInstances := func(fallbackTTL time.Duration) *instances {
+		i := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+		i.serverCache = newServerCache(0)
+		if fallbackTTL > 0 {
+			i.metadataFallback = newMetadataFallback(fallbackTTL)
+		}
+		return i
+	}
+
+	i := newTestInstances(time.Minute)
+	response = ok
+	expected, err := i.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+
+	// Transient errors are answered with the last known metadata.
+	for _, r := range []func(w http.ResponseWriter){unavailable, apiError(http.StatusServiceUnavailable, hcloud.ErrorCodeMaintenance)} {
+		response = r
+		metadata, err := i.InstanceMetadata(context.TODO(), node)
+		require.NoError(t, err)
+		assert.Equal(t, "true", metadata.AdditionalLabels[staleMetadataLabel])
+		delete(metadata.AdditionalLabels, staleMetadataLabel)
+		assert.Empty(t, metadata.AdditionalLabels)
+		metadata.AdditionalLabels = expected.AdditionalLabels
+		assert.Equal(t, expected, metadata)
+	}
+
+	// Fresh metadata is not marked as stale.
+	response = ok
+	metadata, err := i.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	assert.NotContains(t, metadata.AdditionalLabels, staleMetadataLabel)
+
+	// Other errors are returned.
+	response = apiError(http.StatusUnauthorized, hcloud.ErrorCodeUnauthorized)
+	_, err = i.InstanceMetadata(context.TODO(), node)
+	assert.Error(t, err)
+
+	// Nodes without known metadata can not fall back.
+	response = unavailable
+	_, err = i.InstanceMetadata(context.TODO(), &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "other"},
+		Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+	})
+	assert.Error(t, err)
+
+	// Expired metadata is not used.
+	i.metadataFallback.ttl = time.Nanosecond
+	_, err = i.InstanceMetadata(context.TODO(), node)
+	assert.Error(t, err)
+
+	// Without fallback transient errors are returned.
+	i = newTestInstances(0)
+	response = ok
+	_, err = i.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	response = unavailable
+	_, err = i.InstanceMetadata(context.TODO(), node)
+	assert.Error(t, err)
+}
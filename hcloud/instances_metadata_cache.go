@@ -0,0 +1,161 @@
+package hcloud
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// metadataCache caches the instance metadata of nodes, so that the frequent
+// resyncs of the node controllers do not look up the server of every node
+// again.
+//
+// An entry is only served while the fields of the node the lookup depends on
+// are unchanged, and for at most ttl. It remembers the version of the hcloud
+// server it was derived from, see serverVersion. Whenever a different version
+// of the server is looked up, e.g. by InstanceExists, the entry is
+// invalidated, as the server was e.g. recreated, relabeled, rescaled or got
+// another address.
+type metadataCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]metadataCacheEntry
+}
+
+type metadataCacheEntry struct {
+	nodeVersion   uint64
+	serverID      int64
+	serverVersion uint64
+	metadata      cloudprovider.InstanceMetadata
+	storedAt      time.Time
+}
+
+func newMetadataCache(ttl time.Duration) *metadataCache {
+	return &metadataCache{ttl: ttl, now: time.Now, entries: make(map[string]metadataCacheEntry)}
+}
+
+// nodeVersion hashes the fields of node the metadata lookup depends on.
+func nodeVersion(node *corev1.Node) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", node.Name, node.Spec.ProviderID, node.Annotations[robotVSwitchIPAnnotation])
+	return h.Sum64()
+}
+
+// serverVersion hashes the fields of server the metadata is derived from:
+// its ID, creation time, labels, server type, datacenter and addresses.
+func serverVersion(server *hcloud.Server) uint64 {
+	keys := make([]string, 0, len(server.Labels))
+	for k := range server.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00%d\x00%s", server.ID, server.Created.UnixNano(), server.Name)
+	for _, k := range keys {
+		fmt.Fprintf(h, "\x00%s=%s", k, server.Labels[k])
+	}
+	if server.ServerType != nil {
+		fmt.Fprintf(h, "\x00type=%s", server.ServerType.Name)
+	}
+	if dc := server.Datacenter; dc != nil {
+		fmt.Fprintf(h, "\x00dc=%s", dc.Name)
+		if dc.Location != nil {
+			fmt.Fprintf(h, "\x00location=%s/%s", dc.Location.Name, dc.Location.NetworkZone)
+		}
+	}
+	fmt.Fprintf(h, "\x00ipv4=%s\x00ipv6=%s", server.PublicNet.IPv4.IP, server.PublicNet.IPv6.IP)
+	for _, privateNet := range server.PrivateNet {
+		var networkID int64
+		if privateNet.Network != nil {
+			networkID = privateNet.Network.ID
+		}
+		fmt.Fprintf(h, "\x00private=%d/%s", networkID, privateNet.IP)
+	}
+	return h.Sum64()
+}
+
+// get returns the cached metadata of node, if the node did not change and
+// the entry is not older than ttl.
+func (c *metadataCache) get(node *corev1.Node) (*cloudprovider.InstanceMetadata, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[node.Name]
+	if !ok {
+		return nil, false
+	}
+	if entry.nodeVersion != nodeVersion(node) || c.now().Sub(entry.storedAt) > c.ttl {
+		delete(c.entries, node.Name)
+		return nil, false
+	}
+	metrics.InstanceMetadataCacheHits.Inc()
+	m := entry.metadata
+	m.NodeAddresses = append(m.NodeAddresses[:0:0], entry.metadata.NodeAddresses...)
+	return &m, true
+}
+
+// store caches metadata of node. server is the hcloud server the metadata was
+// derived from, nil for robot servers.
+func (c *metadataCache) store(node *corev1.Node, server *hcloud.Server, metadata *cloudprovider.InstanceMetadata) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := metadataCacheEntry{
+		nodeVersion: nodeVersion(node),
+		metadata:    *metadata,
+		storedAt:    c.now(),
+	}
+	entry.metadata.NodeAddresses = append(metadata.NodeAddresses[:0:0], metadata.NodeAddresses...)
+	if server != nil {
+		entry.serverID = server.ID
+		entry.serverVersion = serverVersion(server)
+	}
+	c.entries[node.Name] = entry
+}
+
+// observe invalidates the entries derived from another version of server, or
+// from another server with the same name.
+func (c *metadataCache) observe(server *hcloud.Server) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	version := serverVersion(server)
+	for name, entry := range c.entries {
+		switch {
+		case entry.serverID == server.ID && entry.serverVersion != version:
+			delete(c.entries, name)
+		case entry.serverID != 0 && entry.serverID != server.ID && name == server.Name:
+			delete(c.entries, name)
+		}
+	}
+}
+
+// invalidate removes the entry of nodeName.
+func (c *metadataCache) invalidate(nodeName string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, nodeName)
+}
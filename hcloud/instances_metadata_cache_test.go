@@ -0,0 +1,115 @@
+package hcloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstances_InstanceMetadataCache(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	var requests int
+	server := schema.Server{
+		ID:         1,
+		Name:       "foobar",
+		Created:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Labels:     map[string]string{"role": "worker"},
+		ServerType: schema.ServerType{Name: "cx22"},
+		Datacenter: schema.Datacenter{Name: "fsn1-dc14", Location: schema.Location{Name: "fsn1"}},
+		PublicNet: schema.ServerPublicNet{
+			IPv4: schema.ServerPublicNetIPv4{IP: "203.0.113.7"},
+		},
+	}
+	env.Mux.HandleFunc("/servers/1", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{Server: server})
+	})
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	i := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+	i.serverCache = newServerCache(0)
+	i.metadataCache = newMetadataCache(time.Minute)
+	i.metadataCache.now = func() time.Time { return now }
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "foobar", ResourceVersion: "1"},
+		Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+	}
+
+	expected, err := i.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	// A second lookup of the unchanged node is answered from the cache, even
+	// if unrelated fields of the node changed.
+	node.ResourceVersion = "2"
+	metadata, err := i.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	assert.Equal(t, expected, metadata)
+	assert.Equal(t, 1, requests)
+
+	// Changes of the node the lookup depends on skip the cache.
+	vSwitchNode := node.DeepCopy()
+	vSwitchNode.Annotations = map[string]string{robotVSwitchIPAnnotation: "10.0.0.2"}
+	_, err = i.InstanceMetadata(context.TODO(), vSwitchNode)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	// Looking up a relabeled server invalidates the cached metadata.
+	_, err = i.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	assert.Equal(t, 3, requests)
+	server.Labels = map[string]string{"role": "control-plane"}
+	exists, err := i.InstanceExists(context.TODO(), node)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, 4, requests)
+	_, err = i.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	assert.Equal(t, 5, requests)
+
+	// Rescaling the server or changing its addresses invalidates the cached
+	// metadata as well.
+	for _, change := range []func(){
+		func() { server.ServerType = schema.ServerType{Name: "cx32"} },
+		func() { server.PublicNet.IPv4.IP = "203.0.113.8" },
+	} {
+		change()
+		exists, err = i.InstanceExists(context.TODO(), node)
+		require.NoError(t, err)
+		assert.True(t, exists)
+		before := requests
+		metadata, err = i.InstanceMetadata(context.TODO(), node)
+		require.NoError(t, err)
+		assert.Equal(t, before+1, requests)
+	}
+	assert.Equal(t, "cx32", metadata.InstanceType)
+	assert.Contains(t, metadata.NodeAddresses, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.8"})
+
+	// Expired entries are not used.
+	now = now.Add(2 * time.Minute)
+	before := requests
+	_, err = i.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	assert.Equal(t, before+1, requests)
+}
+
+func TestMetadataCache_Disabled(t *testing.T) {
+	var c *metadataCache
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "foobar"}}
+	c.store(node, nil, nil)
+	_, ok := c.get(node)
+	assert.False(t, ok)
+	c.invalidate(node.Name)
+}
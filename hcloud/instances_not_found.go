@@ -0,0 +1,69 @@
+package hcloud
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// notFoundGrace delays reporting nodes as not existing until their server
+// has been missing for longer than grace. The node lifecycle controller
+// deletes nodes whose instance does not exist, a single lookup which does not
+// find the server, e.g. due to a brief inconsistency of the API, must not
+// delete a healthy node.
+//
+// The time a server went missing is tracked from the first lookup which did
+// not find it, and lost on restarts, which restarts the grace period.
+type notFoundGrace struct {
+	grace time.Duration
+	now   func() time.Time
+
+	mu      sync.Mutex
+	missing map[string]time.Time
+}
+
+func newNotFoundGrace(grace time.Duration) *notFoundGrace {
+	return &notFoundGrace{
+		grace:   grace,
+		now:     time.Now,
+		missing: make(map[string]time.Time),
+	}
+}
+
+// confirmGone records that the server of nodeName was not found and reports
+// whether it has been missing for longer than grace.
+func (g *notFoundGrace) confirmGone(nodeName string) bool {
+	const op = "hcloud/notFoundGrace.confirmGone"
+
+	if g == nil {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	since, ok := g.missing[nodeName]
+	if !ok {
+		since = now
+		g.missing[nodeName] = since
+	}
+	if now.Sub(since) < g.grace {
+		klog.InfoS("server of node not found, still reporting it as existing", "op", op, "node", nodeName, "missingSince", since)
+		return false
+	}
+	// Keep the entry, the node stays reported as missing until its server is
+	// found again.
+	return true
+}
+
+// found forgets that the server of nodeName was missing.
+func (g *notFoundGrace) found(nodeName string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.missing, nodeName)
+}
@@ -0,0 +1,74 @@
+package hcloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstances_InstanceExistsNotFoundGrace(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	found := false
+	env.Mux.HandleFunc("/servers/1", func(w http.ResponseWriter, r *http.Request) {
+		if !found {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(schema.ErrorResponse{Error: schema.Error{Code: string(hcloud.ErrorCodeNotFound)}})
+			return
+		}
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{Server: schema.Server{ID: 1, Name: "foobar"}})
+	})
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	i := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+	i.serverCache = newServerCache(0)
+	i.notFoundGrace = newNotFoundGrace(5 * time.Minute)
+	i.notFoundGrace.now = func() time.Time { return now }
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "foobar"},
+		Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+	}
+	exists := func() bool {
+		t.Helper()
+		exists, err := i.InstanceExists(context.TODO(), node)
+		require.NoError(t, err)
+		return exists
+	}
+
+	// A single 404 followed by a 200 within the grace period keeps the node.
+	assert.True(t, exists())
+	now = now.Add(4 * time.Minute)
+	found = true
+	assert.True(t, exists())
+
+	// The grace period starts again with the next 404.
+	found = false
+	now = now.Add(4 * time.Minute)
+	assert.True(t, exists())
+	now = now.Add(4 * time.Minute)
+	assert.True(t, exists())
+
+	// Servers missing for longer than the grace period are reported as gone.
+	now = now.Add(time.Minute)
+	assert.False(t, exists())
+	assert.False(t, exists())
+}
+
+func TestNotFoundGrace_Disabled(t *testing.T) {
+	var g *notFoundGrace
+
+	assert.True(t, g.confirmGone("foobar"))
+	g.found("foobar")
+}
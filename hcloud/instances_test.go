@@ -19,6 +19,7 @@ package hcloud
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
 	"reflect"
@@ -26,6 +27,8 @@ import (
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
 	"github.com/syself/hrobot-go/models"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -173,6 +176,105 @@ func TestInstances_InstanceExists(t *testing.T) {
 	}
 }
 
+func TestInstances_providerIDToServerID(t *testing.T) {
+	instances := newInstances(nil, nil, AddressFamilyIPv4, 0)
+	instances.additionalProviderIDPrefix = "mycluster://"
+
+	tests := []struct {
+		providerID     string
+		expectedID     int64
+		expectedHCloud bool
+		expectedErr    bool
+	}{
+		{providerID: "hcloud://1", expectedID: 1, expectedHCloud: true},
+		{providerID: "hcloud://bm-321", expectedID: 321},
+		{providerID: "mycluster://2", expectedID: 2, expectedHCloud: true},
+		{providerID: "mycluster://bm-322", expectedID: 322},
+		{providerID: "hrobot://323", expectedID: 323},
+		{providerID: "hrobot://", expectedErr: true},
+		{providerID: "hrobot://bm-324", expectedErr: true},
+		{providerID: "othercluster://3", expectedErr: true},
+		{providerID: "mycluster://", expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.providerID, func(t *testing.T) {
+			id, isHCloudServer, err := instances.providerIDToServerID(test.providerID)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("Expected error for %s", test.providerID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if id != test.expectedID || isHCloudServer != test.expectedHCloud {
+				t.Fatalf("Expected %d/%t but got %d/%t", test.expectedID, test.expectedHCloud, id, isHCloudServer)
+			}
+		})
+	}
+}
+
+func TestInstances_robotProviderIDRoundTrip(t *testing.T) {
+	instances := newInstances(nil, nil, AddressFamilyIPv4, 0)
+
+	tests := []struct {
+		format             robotProviderIDFormat
+		expectedProviderID string
+	}{
+		{format: "", expectedProviderID: "hcloud://bm-321"},
+		{format: robotProviderIDFormatHCloud, expectedProviderID: "hcloud://bm-321"},
+		{format: robotProviderIDFormatHRobot, expectedProviderID: "hrobot://321"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			providerID := serverIDToProviderIDRobot(test.format, 321)
+			if providerID != test.expectedProviderID {
+				t.Fatalf("Expected %s but got %s", test.expectedProviderID, providerID)
+			}
+			id, isHCloudServer, err := instances.providerIDToServerID(providerID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if id != 321 || isHCloudServer {
+				t.Fatalf("Expected 321/false but got %d/%t", id, isHCloudServer)
+			}
+		})
+	}
+}
+
+func TestAdditionalProviderIDPrefixFromEnv(t *testing.T) {
+	tests := []struct {
+		value       string
+		expectedErr bool
+	}{
+		{value: ""},
+		{value: "mycluster://"},
+		{value: "hcloud://", expectedErr: true},
+		{value: "hrobot://", expectedErr: true},
+		{value: "mycluster", expectedErr: true},
+		{value: "My Cluster://", expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv(hcloudProviderIDAdditionalPrefix, test.value)
+			prefix, err := additionalProviderIDPrefixFromEnv()
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("Expected error for %q", test.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if prefix != test.value {
+				t.Fatalf("Expected %q but got %q", test.value, prefix)
+			}
+		})
+	}
+}
+
 func TestInstances_InstanceShutdown(t *testing.T) {
 	env := newTestEnv()
 	defer env.Teardown()
@@ -297,6 +399,190 @@ func TestInstances_InstanceMetadata(t *testing.T) {
 	}
 }
 
+func TestInstances_InstanceMetadataTopology(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+	env.Mux.HandleFunc("/servers/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{
+			Server: schema.Server{
+				ID:         1,
+				Name:       "foobar",
+				ServerType: schema.ServerType{Name: "cx22"},
+				Datacenter: schema.Datacenter{
+					Name:     "fsn1-dc14",
+					Location: schema.Location{Name: "fsn1", NetworkZone: "eu-central"},
+				},
+			},
+		})
+	})
+	node := &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}}
+
+	tests := []struct {
+		useDatacenter  bool
+		expectedZone   string
+		expectedRegion string
+	}{
+		{useDatacenter: true, expectedZone: "fsn1-dc14", expectedRegion: "fsn1"},
+		{useDatacenter: false, expectedZone: "fsn1", expectedRegion: "eu-central"},
+	}
+	for _, tt := range tests {
+		instances := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+		instances.topologyUseDatacenter = tt.useDatacenter
+
+		metadata, err := instances.InstanceMetadata(context.TODO(), node)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if metadata.Zone != tt.expectedZone || metadata.Region != tt.expectedRegion {
+			t.Errorf("useDatacenter=%t: expected zone %q and region %q, got %q and %q",
+				tt.useDatacenter, tt.expectedZone, tt.expectedRegion, metadata.Zone, metadata.Region)
+		}
+	}
+}
+
+func TestInstances_InstanceMetadataServerIDLabel(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+	env.Mux.HandleFunc("/servers/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{
+			Server: schema.Server{ID: 1, Name: "foobar", ServerType: schema.ServerType{Name: "cx22"}},
+		})
+	})
+	env.Mux.HandleFunc("/robot/server/321", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.ServerResponse{
+			Server: models.Server{ServerIP: "123.123.123.123", ServerNumber: 321, Name: "bm-server1", Dc: "NBG1-DC1"},
+		})
+	})
+
+	tests := []struct {
+		node     *corev1.Node
+		expected string
+	}{
+		{
+			node:     &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+			expected: "1",
+		},
+		{
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "bm-server1"},
+				Spec:       corev1.NodeSpec{ProviderID: "hcloud://bm-321"},
+			},
+			expected: "321",
+		},
+	}
+	for _, tt := range tests {
+		instances := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+		metadata, err := instances.InstanceMetadata(context.TODO(), tt.node)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if metadata.AdditionalLabels != nil {
+			t.Errorf("%s: expected no labels by default, got %v", tt.node.Spec.ProviderID, metadata.AdditionalLabels)
+		}
+
+		instances.serverIDLabel = true
+		metadata, err = instances.InstanceMetadata(context.TODO(), tt.node)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := map[string]string{"hcloud.syself.com/server-id": tt.expected}
+		if !reflect.DeepEqual(metadata.AdditionalLabels, expected) {
+			t.Errorf("%s: expected labels %v, got %v", tt.node.Spec.ProviderID, expected, metadata.AdditionalLabels)
+		}
+	}
+}
+
+func TestInstances_InstanceMetadataRecreatedServer(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	// The server "foobar" with ID 1 is replaced by a new server with the same
+	// name but ID 2 once recreated is set.
+	recreated := false
+	notFound := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(schema.ErrorResponse{Error: schema.Error{Code: string(hcloud.ErrorCodeNotFound)}})
+	}
+	oldServer := schema.Server{
+		ID:        1,
+		Name:      "foobar",
+		PublicNet: schema.ServerPublicNet{IPv4: schema.ServerPublicNetIPv4{IP: "203.0.113.7"}},
+	}
+	newServer := schema.Server{
+		ID:        2,
+		Name:      "foobar",
+		PublicNet: schema.ServerPublicNet{IPv4: schema.ServerPublicNetIPv4{IP: "203.0.113.8"}},
+	}
+	env.Mux.HandleFunc("/servers/1", func(w http.ResponseWriter, r *http.Request) {
+		if recreated {
+			notFound(w)
+			return
+		}
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{Server: oldServer})
+	})
+	env.Mux.HandleFunc("/servers/2", func(w http.ResponseWriter, r *http.Request) {
+		if !recreated {
+			notFound(w)
+			return
+		}
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{Server: newServer})
+	})
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		server := oldServer
+		if recreated {
+			server = newServer
+		}
+		json.NewEncoder(w).Encode(schema.ServerListResponse{Servers: []schema.Server{server}})
+	})
+
+	instances := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+
+	metadata, err := instances.InstanceMetadata(context.TODO(), &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "foobar"},
+		Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata.ProviderID != "hcloud://1" {
+		t.Fatalf("Expected provider id hcloud://1 but got %s", metadata.ProviderID)
+	}
+
+	recreated = true
+
+	// The recreated node registers without a provider ID and must resolve to
+	// the new server.
+	metadata, err = instances.InstanceMetadata(context.TODO(), &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "foobar"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedMetadata := &cloudprovider.InstanceMetadata{
+		ProviderID: "hcloud://2",
+		NodeAddresses: []corev1.NodeAddress{
+			{Type: corev1.NodeHostName, Address: "foobar"},
+			{Type: corev1.NodeExternalIP, Address: "203.0.113.8"},
+		},
+	}
+	if !reflect.DeepEqual(metadata, expectedMetadata) {
+		t.Fatalf("Expected metadata %+v but got %+v", *expectedMetadata, *metadata)
+	}
+
+	// The stale provider ID of the old node must not be served from the cache.
+	exists, err := instances.InstanceExists(context.TODO(), &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "foobar"},
+		Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exists {
+		t.Fatalf("Expected old server to not exist anymore")
+	}
+}
+
 func TestInstances_InstanceMetadataRobotServer(t *testing.T) {
 	env := newTestEnv()
 	defer env.Teardown()
@@ -341,6 +627,445 @@ func TestInstances_InstanceMetadataRobotServer(t *testing.T) {
 	}
 }
 
+// rateLimitedRobotClient fails every request with an exceeded rate limit of
+// the Robot API, but serves its cached servers.
+type rateLimitedRobotClient struct {
+	cached []models.Server
+}
+
+func (c *rateLimitedRobotClient) ServerGet(int) (*models.Server, error) {
+	return nil, models.Error{Code: models.ErrorCodeRateLimitExceeded, Message: "rate limit exceeded"}
+}
+
+func (c *rateLimitedRobotClient) ServerGetList() ([]models.Server, error) {
+	return nil, models.Error{Code: models.ErrorCodeRateLimitExceeded, Message: "rate limit exceeded"}
+}
+
+func (c *rateLimitedRobotClient) SetCredentials(string, string) error { return nil }
+
+func (c *rateLimitedRobotClient) CachedServerGetList() ([]models.Server, bool) {
+	return c.cached, c.cached != nil
+}
+
+func TestStaleRobotServers(t *testing.T) {
+	robotClient := &rateLimitedRobotClient{cached: []models.Server{
+		{ServerNumber: 321, Name: "bm-server1", ServerIP: "123.123.123.123", Product: "bm-product 1", Dc: "NBG1-DC1"},
+	}}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "bm-server1"}}
+	rateLimitErr := errors.New("rate limit exceeded")
+	stale := testutil.ToFloat64(metrics.RobotCacheRequests.WithLabelValues("stale"))
+
+	server, err := staleRobotServerByID(robotClient, 321, node, rateLimitErr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if server.ServerNumber != 321 {
+		t.Fatalf("Unexpected server %+v", *server)
+	}
+	servers, err := staleRobotServersByName(robotClient, node, rateLimitErr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(servers) != 1 || servers[0].ServerNumber != 321 {
+		t.Fatalf("Unexpected servers %+v", servers)
+	}
+	if got := testutil.ToFloat64(metrics.RobotCacheRequests.WithLabelValues("stale")) - stale; got != 2 {
+		t.Fatalf("Expected two stale cache requests but got %v", got)
+	}
+
+	// Servers missing from the cache are not reported as not found.
+	if _, err := staleRobotServerByID(robotClient, 322, node, rateLimitErr); !errors.Is(err, rateLimitErr) {
+		t.Fatalf("Expected the rate limit error for a server missing from the cache but got %v", err)
+	}
+	other := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "bm-server2"}}
+	if _, err := staleRobotServersByName(robotClient, other, rateLimitErr); !errors.Is(err, rateLimitErr) {
+		t.Fatalf("Expected the rate limit error for a server missing from the cache but got %v", err)
+	}
+
+	// Nothing is served without cache.
+	if _, err := staleRobotServerByID(&rateLimitedRobotClient{}, 321, node, rateLimitErr); !errors.Is(err, rateLimitErr) {
+		t.Fatalf("Expected the rate limit error without cache but got %v", err)
+	}
+}
+
+func TestInstances_InstanceMetadataRobotServerVSwitchIP(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+	env.Mux.HandleFunc("/robot/server/321", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.ServerResponse{
+			Server: models.Server{
+				ServerIP:      "123.123.123.123",
+				ServerIPv6Net: "2a01:f48:111:4221::",
+				ServerNumber:  321,
+				Product:       "bm-product 1",
+				Name:          "bm-server1",
+				Dc:            "NBG1-DC1",
+			},
+		})
+	})
+
+	instances := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "bm-server1",
+			Annotations: map[string]string{robotVSwitchIPAnnotation: "10.0.1.2"},
+		},
+		Spec: corev1.NodeSpec{ProviderID: "hcloud://bm-321"},
+	}
+	metadata, err := instances.InstanceMetadata(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedAddresses := []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "bm-server1"},
+		{Type: corev1.NodeExternalIP, Address: "123.123.123.123"},
+		{Type: corev1.NodeInternalIP, Address: "10.0.1.2"},
+	}
+	if !reflect.DeepEqual(metadata.NodeAddresses, expectedAddresses) {
+		t.Fatalf("Expected addresses %+v but got %+v", expectedAddresses, metadata.NodeAddresses)
+	}
+
+	node.Annotations[robotVSwitchIPAnnotation] = "10.0.1"
+	_, err = instances.InstanceMetadata(context.TODO(), node)
+	if err == nil {
+		t.Fatal("Expected error for invalid vSwitch IP")
+	}
+}
+
+func TestInstances_InstanceMetadataDiscoverProviderID(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		var servers []schema.Server
+		switch r.URL.Query().Get("name") {
+		case "worker":
+			servers = append(servers, schema.Server{
+				ID:         1,
+				Name:       "worker",
+				ServerType: schema.ServerType{Name: "cx22"},
+				Datacenter: schema.Datacenter{Name: "fsn1-dc14", Location: schema.Location{Name: "fsn1"}},
+			})
+		case "shared":
+			servers = append(servers, schema.Server{ID: 2, Name: "shared"})
+		}
+		json.NewEncoder(w).Encode(schema.ServerListResponse{Servers: servers})
+	})
+	env.Mux.HandleFunc("/robot/server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]models.ServerResponse{
+			{Server: models.Server{ServerNumber: 321, Name: "storage", ServerIP: "123.123.123.123", Product: "AX41", Dc: "FSN1-DC1"}},
+			{Server: models.Server{ServerNumber: 322, Name: "shared"}},
+			{Server: models.Server{ServerNumber: 323, Name: "duplicate"}},
+			{Server: models.Server{ServerNumber: 324, Name: "duplicate"}},
+		})
+	})
+
+	instances := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+	instances.discoverProviderID = true
+
+	tests := []struct {
+		nodeName           string
+		expectedProviderID string
+		expectedErr        error
+	}{
+		{nodeName: "worker", expectedProviderID: "hcloud://1"},
+		// Robot servers are discovered even without the "bm-" prefix.
+		{nodeName: "storage", expectedProviderID: "hcloud://bm-321"},
+		{nodeName: "shared", expectedErr: errAmbiguousServerName},
+		{nodeName: "duplicate", expectedErr: errAmbiguousServerName},
+		{nodeName: "missing", expectedErr: errServerNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.nodeName, func(t *testing.T) {
+			metadata, err := instances.InstanceMetadata(context.TODO(), &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: tt.nodeName},
+			})
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v but got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if metadata.ProviderID != tt.expectedProviderID {
+				t.Fatalf("Expected provider ID %q but got %q", tt.expectedProviderID, metadata.ProviderID)
+			}
+		})
+	}
+}
+
+func TestInstances_DuplicateRobotServerNames(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+	env.Mux.HandleFunc("/robot/server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]models.ServerResponse{
+			{Server: models.Server{ServerNumber: 321, Name: "bm-duplicate", ServerIP: "123.123.123.123", Dc: "FSN1-DC1"}},
+			{Server: models.Server{ServerNumber: 322, Name: "bm-duplicate", ServerIP: "123.123.123.124", Dc: "FSN1-DC1"}},
+			{Server: models.Server{ServerNumber: 323, Name: "bm-unique", ServerIP: "123.123.123.125", Dc: "FSN1-DC1"}},
+		})
+	})
+
+	instances := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+	before := testutil.ToFloat64(metrics.AmbiguousServerNames)
+
+	_, err := instances.InstanceExists(context.TODO(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "bm-duplicate"}})
+	if !errors.Is(err, errAmbiguousServerName) {
+		t.Fatalf("Expected error %v but got %v", errAmbiguousServerName, err)
+	}
+	if got := testutil.ToFloat64(metrics.AmbiguousServerNames) - before; got != 1 {
+		t.Fatalf("Expected one ambiguous server name but got %v", got)
+	}
+
+	exists, err := instances.InstanceExists(context.TODO(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "bm-unique"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !exists {
+		t.Fatal("Expected server with a unique name to exist")
+	}
+}
+
+func TestInstances_InstanceExistsNodeNameLabel(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		var servers []schema.Server
+		switch r.URL.Query().Get("label_selector") {
+		case nodeNameLabel + "=worker":
+			servers = append(servers, schema.Server{
+				ID:     1,
+				Name:   "worker-7f3a",
+				Labels: map[string]string{nodeNameLabel: "worker"},
+			})
+		case nodeNameLabel + "=duplicate":
+			servers = append(servers,
+				schema.Server{ID: 2, Name: "duplicate-1"},
+				schema.Server{ID: 3, Name: "duplicate-2"},
+			)
+		}
+		// Lookups by name never match, the server names differ from the
+		// node names.
+		json.NewEncoder(w).Encode(schema.ServerListResponse{Servers: servers})
+	})
+
+	instances := newInstances(env.Client, env.RobotClient, AddressFamilyIPv4, 0)
+
+	node := func(name string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+
+	exists, err := instances.InstanceExists(context.TODO(), node("worker"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exists {
+		t.Fatal("Expected label matching to be disabled by default")
+	}
+
+	instances.matchNodeNameLabel = true
+
+	tests := []struct {
+		nodeName    string
+		exists      bool
+		expectedErr error
+	}{
+		{nodeName: "worker", exists: true},
+		{nodeName: "missing", exists: false},
+		{nodeName: "duplicate", expectedErr: errAmbiguousServerName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nodeName, func(t *testing.T) {
+			exists, err := instances.InstanceExists(context.TODO(), node(tt.nodeName))
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v but got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if exists != tt.exists {
+				t.Fatalf("Expected exists %t but got %t", tt.exists, exists)
+			}
+		})
+	}
+}
+
+func TestInstances_Preload(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	var listCalls, getCalls int
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		listCalls++
+		json.NewEncoder(w).Encode(schema.ServerListResponse{
+			Servers: []schema.Server{
+				{
+					ID:         1,
+					Name:       "node1",
+					ServerType: schema.ServerType{Name: "cx22"},
+					Datacenter: schema.Datacenter{Name: "fsn1-dc14", Location: schema.Location{Name: "fsn1"}},
+				},
+				{
+					ID:         2,
+					Name:       "node2",
+					ServerType: schema.ServerType{Name: "cx22"},
+					Datacenter: schema.Datacenter{Name: "fsn1-dc14", Location: schema.Location{Name: "fsn1"}},
+				},
+			},
+		})
+	})
+	env.Mux.HandleFunc("/servers/", func(w http.ResponseWriter, r *http.Request) {
+		getCalls++
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	instances := newInstances(env.Client, nil, AddressFamilyIPv4, 0)
+	if err := instances.preload(context.TODO()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, node := range []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://2"}},
+	} {
+		exists, err := instances.InstanceExists(context.TODO(), node)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !exists {
+			t.Fatalf("Expected node %s to exist", node.Name)
+		}
+		if _, err := instances.InstanceMetadata(context.TODO(), node); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if listCalls != 1 || getCalls != 0 {
+		t.Fatalf("Expected 1 list and 0 get calls, got %d list and %d get calls", listCalls, getCalls)
+	}
+}
+
+func TestInstances_PreloadStatusFilter(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	var statusFilter []string
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		statusFilter = r.URL.Query()["status"]
+		json.NewEncoder(w).Encode(schema.ServerListResponse{
+			Servers: []schema.Server{
+				{ID: 1, Name: "node1", Status: string(hcloud.ServerStatusRunning)},
+				{ID: 2, Name: "node2", Status: string(hcloud.ServerStatusDeleting)},
+			},
+		})
+	})
+
+	instances := newInstances(env.Client, nil, AddressFamilyIPv4, 0)
+	instances.preloadStatuses = []hcloud.ServerStatus{hcloud.ServerStatusRunning, hcloud.ServerStatusDeleting}
+	instances.preloadExcludeStatuses = []hcloud.ServerStatus{hcloud.ServerStatusDeleting}
+	if err := instances.preload(context.TODO()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(statusFilter, []string{"running", "deleting"}) {
+		t.Fatalf("Unexpected status filter %v", statusFilter)
+	}
+	if instances.serverCache.get(1, "node1") == nil {
+		t.Fatal("Expected the running server to be preloaded")
+	}
+	if instances.serverCache.get(2, "node2") != nil {
+		t.Fatal("Expected the deleting server not to be preloaded")
+	}
+}
+
+func TestServerStatusesFromEnv(t *testing.T) {
+	t.Setenv("HCLOUD_PRELOAD_INSTANCES_EXCLUDE_STATUSES", "")
+	statuses, err := serverStatusesFromEnv("HCLOUD_PRELOAD_INSTANCES_EXCLUDE_STATUSES")
+	if err != nil || statuses != nil {
+		t.Fatalf("Expected no statuses but got %v, %v", statuses, err)
+	}
+
+	t.Setenv("HCLOUD_PRELOAD_INSTANCES_EXCLUDE_STATUSES", "deleting, Off")
+	statuses, err = serverStatusesFromEnv("HCLOUD_PRELOAD_INSTANCES_EXCLUDE_STATUSES")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(statuses, []hcloud.ServerStatus{hcloud.ServerStatusDeleting, hcloud.ServerStatusOff}) {
+		t.Fatalf("Unexpected statuses %v", statuses)
+	}
+
+	t.Setenv("HCLOUD_PRELOAD_INSTANCES_EXCLUDE_STATUSES", "deleted")
+	if _, err = serverStatusesFromEnv("HCLOUD_PRELOAD_INSTANCES_EXCLUDE_STATUSES"); err == nil {
+		t.Fatal("Expected error for an unknown status")
+	}
+}
+
+func TestSortNodeAddresses(t *testing.T) {
+	addresses := []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "foobar"},
+		{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
+		{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+	}
+
+	tests := []struct {
+		name     string
+		order    []corev1.NodeAddressType
+		expected []corev1.NodeAddress
+	}{
+		{
+			name:     "no order",
+			expected: addresses,
+		},
+		{
+			name:  "private network first",
+			order: []corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeExternalIP},
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
+				{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
+				{Type: corev1.NodeHostName, Address: "foobar"},
+			},
+		},
+		{
+			name:  "public first, unlisted types keep their order",
+			order: []corev1.NodeAddressType{corev1.NodeExternalIP},
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
+				{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+			},
+		},
+		{
+			name:  "hostname last",
+			order: []corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeExternalIP, corev1.NodeHostName},
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
+				{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
+				{Type: corev1.NodeHostName, Address: "foobar"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := append([]corev1.NodeAddress(nil), addresses...)
+			sorted := sortNodeAddresses(input, test.order)
+			if !reflect.DeepEqual(sorted, test.expected) {
+				t.Fatalf("Expected addresses %+v but got %+v", test.expected, sorted)
+			}
+		})
+	}
+}
+
 func TestNodeAddresses(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -447,7 +1172,81 @@ func TestNodeAddresses(t *testing.T) {
 				{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
 			},
 		},
+		{
+			name:           "no primary ipv4 in dual stack",
+			addressFamily:  AddressFamilyDualStack,
+			privateNetwork: 1,
+			server: hcloud.ServerFromSchema(schema.Server{
+				Name: "foobar",
+				PublicNet: schema.ServerPublicNet{
+					IPv6: schema.ServerPublicNetIPv6{IP: "2001:db8:1234::/64"},
+				},
+				PrivateNet: []schema.ServerPrivateNet{{Network: 1, IP: "10.0.0.2"}},
+			}),
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+			},
+		},
+		{
+			name:           "no primary ips",
+			addressFamily:  AddressFamilyDualStack,
+			privateNetwork: 1,
+			server: hcloud.ServerFromSchema(schema.Server{
+				Name:       "foobar",
+				PrivateNet: []schema.ServerPrivateNet{{Network: 1, IP: "10.0.0.2"}},
+			}),
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+			},
+		},
 
+		{
+			name:          "auto ipv4 only",
+			addressFamily: AddressFamilyAuto,
+			server: hcloud.ServerFromSchema(schema.Server{
+				Name: "foobar",
+				PublicNet: schema.ServerPublicNet{
+					IPv4: schema.ServerPublicNetIPv4{IP: "203.0.113.7"},
+				},
+			}),
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
+			},
+		},
+		{
+			name:          "auto ipv6 only",
+			addressFamily: AddressFamilyAuto,
+			server: hcloud.ServerFromSchema(schema.Server{
+				Name: "foobar",
+				PublicNet: schema.ServerPublicNet{
+					IPv6: schema.ServerPublicNetIPv6{IP: "2001:db8:1234::/64"},
+				},
+			}),
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
+			},
+		},
+		{
+			name:          "auto dual stack",
+			addressFamily: AddressFamilyAuto,
+			server: hcloud.ServerFromSchema(schema.Server{
+				Name: "foobar",
+				PublicNet: schema.ServerPublicNet{
+					IPv4: schema.ServerPublicNetIPv4{IP: "203.0.113.7"},
+					IPv6: schema.ServerPublicNetIPv6{IP: "2001:db8:1234::/64"},
+				},
+			}),
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
+				{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
+			},
+		},
 		{
 			name:           "unknown private network",
 			addressFamily:  AddressFamilyIPv4,
@@ -480,6 +1279,20 @@ func TestNodeAddresses(t *testing.T) {
 				{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
 			},
 		},
+		{
+			name:           "private network without ip",
+			addressFamily:  AddressFamilyIPv4,
+			privateNetwork: 1,
+			server: &hcloud.Server{
+				Name: "foobar",
+				PrivateNet: []hcloud.ServerPrivateNet{
+					{Network: &hcloud.Network{ID: 1}},
+				},
+			},
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+			},
+		},
 		{
 			name:           "server not attached to private network",
 			addressFamily:  AddressFamilyIPv4,
@@ -561,6 +1374,68 @@ func TestNodeAddressesRobotServer(t *testing.T) {
 				{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
 			},
 		},
+		{
+			name:          "no ipv6 subnet",
+			addressFamily: AddressFamilyDualStack,
+			server: &models.Server{
+				Name:     "foobar",
+				ServerIP: "203.0.113.7",
+			},
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
+			},
+		},
+		{
+			name:          "auto ipv4 only",
+			addressFamily: AddressFamilyAuto,
+			server: &models.Server{
+				Name:     "foobar",
+				ServerIP: "203.0.113.7",
+			},
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
+			},
+		},
+		{
+			name:          "auto ipv6 only",
+			addressFamily: AddressFamilyAuto,
+			server: &models.Server{
+				Name:          "foobar",
+				ServerIPv6Net: "2001:db8:1234::",
+			},
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
+			},
+		},
+		{
+			name:          "auto dual stack",
+			addressFamily: AddressFamilyAuto,
+			server: &models.Server{
+				Name:          "foobar",
+				ServerIP:      "203.0.113.7",
+				ServerIPv6Net: "2001:db8:1234::",
+			},
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+				{Type: corev1.NodeExternalIP, Address: "203.0.113.7"},
+				{Type: corev1.NodeExternalIP, Address: "2001:db8:1234::1"},
+			},
+		},
+		{
+			name:          "malformed ipv6 subnet",
+			addressFamily: AddressFamilyIPv6,
+			server: &models.Server{
+				Name:          "foobar",
+				ServerIP:      "203.0.113.7",
+				ServerIPv6Net: "2001:db8:1234:::",
+			},
+			expected: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "foobar"},
+			},
+		},
 	}
 
 	for _, test := range tests {
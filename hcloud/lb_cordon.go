@@ -0,0 +1,211 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// cordonCheckInterval is the interval in which the cordoned nodes are checked
+// for an expired grace period.
+const cordonCheckInterval = 30 * time.Second
+
+// cordonedNodes removes nodes from the targets of all Load Balancers once they
+// have been cordoned for longer than grace. Kubernetes keeps cordoned nodes in
+// Load Balancers, so they still receive traffic until they are deleted.
+// Removing them beforehand lets their connections drain while the node is
+// still running.
+//
+// The time a node was cordoned is not recorded by Kubernetes. It is tracked
+// from the first check or Load Balancer update which sees the node cordoned,
+// and lost on restarts, which restarts the grace period.
+type cordonedNodes struct {
+	grace time.Duration
+	now   func() time.Time
+
+	mu    sync.Mutex
+	nodes map[string]*cordonedNode
+}
+
+type cordonedNode struct {
+	since   time.Time
+	removed bool
+}
+
+func newCordonedNodes(grace time.Duration) *cordonedNodes {
+	return &cordonedNodes{
+		grace: grace,
+		now:   time.Now,
+		nodes: make(map[string]*cordonedNode),
+	}
+}
+
+// filter returns nodes without the nodes cordoned for longer than grace.
+// Nodes no longer cordoned are forgotten, and thereby added again.
+func (c *cordonedNodes) filter(nodes []*corev1.Node) []*corev1.Node {
+	const op = "hcloud/cordonedNodes.filter"
+
+	if c == nil {
+		return nodes
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	seen := make(map[string]struct{}, len(nodes))
+	selected := make([]*corev1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		seen[node.Name] = struct{}{}
+
+		if !node.Spec.Unschedulable {
+			if tracked, ok := c.nodes[node.Name]; ok {
+				if tracked.removed {
+					klog.InfoS("add uncordoned node to Load Balancers again", "op", op, "node", node.Name)
+				}
+				delete(c.nodes, node.Name)
+			}
+			selected = append(selected, node)
+			continue
+		}
+
+		tracked, ok := c.nodes[node.Name]
+		if !ok {
+			tracked = &cordonedNode{since: now}
+			c.nodes[node.Name] = tracked
+		}
+		if now.Sub(tracked.since) < c.grace {
+			selected = append(selected, node)
+			continue
+		}
+		if !tracked.removed {
+			klog.InfoS("remove cordoned node from Load Balancers", "op", op, "node", node.Name, "cordonedSince", tracked.since)
+			tracked.removed = true
+		}
+	}
+
+	// Forget deleted nodes.
+	for name := range c.nodes {
+		if _, ok := seen[name]; !ok {
+			delete(c.nodes, name)
+		}
+	}
+	return selected
+}
+
+// due reports whether the Load Balancers have to be updated to remove nodes
+// whose grace period expired or to add uncordoned nodes again. It starts the
+// grace period of newly cordoned nodes.
+func (c *cordonedNodes) due(nodes []*corev1.Node) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	due := false
+	for _, node := range nodes {
+		tracked, ok := c.nodes[node.Name]
+		switch {
+		case !node.Spec.Unschedulable:
+			if ok && tracked.removed {
+				due = true
+			}
+		case !ok:
+			c.nodes[node.Name] = &cordonedNode{since: now}
+		case !tracked.removed && now.Sub(tracked.since) >= c.grace:
+			due = true
+		}
+	}
+	return due
+}
+
+// loadBalancerUpdater updates the targets of the Load Balancer of a Service.
+type loadBalancerUpdater interface {
+	UpdateLoadBalancer(ctx context.Context, clusterName string, svc *corev1.Service, nodes []*corev1.Node) error
+	isResponsible(svc *corev1.Service) bool
+}
+
+// cordonController updates all Load Balancers once the grace period of a
+// cordoned node expired or a removed node was uncordoned. The service
+// controller does not update Load Balancers on either, the cordoned nodes
+// would otherwise be removed only with the next unrelated update.
+type cordonController struct {
+	client   kubernetes.Interface
+	lb       loadBalancerUpdater
+	cordoned *cordonedNodes
+	interval time.Duration
+
+	services corelisters.ServiceLister
+	nodes    corelisters.NodeLister
+}
+
+func newCordonController(client kubernetes.Interface, lb loadBalancerUpdater, cordoned *cordonedNodes) *cordonController {
+	return &cordonController{
+		client:   client,
+		lb:       lb,
+		cordoned: cordoned,
+		interval: cordonCheckInterval,
+	}
+}
+
+// Run checks the cordoned nodes every interval until ctx is done.
+func (c *cordonController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+
+	factory := informers.NewSharedInformerFactory(c.client, 10*time.Minute)
+	services := factory.Core().V1().Services()
+	nodes := factory.Core().V1().Nodes()
+	c.services = services.Lister()
+	c.nodes = nodes.Lister()
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), services.Informer().HasSynced, nodes.Informer().HasSynced) {
+		klog.Error("failed to sync caches for cordoned nodes")
+		return
+	}
+
+	wait.UntilWithContext(ctx, c.check, c.interval)
+}
+
+// check updates the Load Balancers of all Services if the targets changed.
+func (c *cordonController) check(ctx context.Context) {
+	const op = "hcloud/cordonController.check"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	allNodes, err := c.nodes.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "list nodes", "op", op)
+		return
+	}
+	nodes := lbNodes(allNodes)
+	if !c.cordoned.due(nodes) {
+		return
+	}
+
+	svcs, err := c.services.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "list services", "op", op)
+		return
+	}
+	for _, svc := range svcs {
+		if !isManagedLoadBalancerService(svc) || !c.lb.isResponsible(svc) {
+			continue
+		}
+		err := c.lb.UpdateLoadBalancer(ctx, "", svc.DeepCopy(), nodes)
+		if err != nil && !errors.Is(err, cloudprovider.ImplementedElsewhere) {
+			klog.ErrorS(err, "update targets of cordoned nodes", "op", op, "service", klog.KObj(svc))
+		}
+	}
+}
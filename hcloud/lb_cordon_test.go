@@ -0,0 +1,161 @@
+package hcloud
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func cordonTestNode(name string, unschedulable bool) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+	}
+}
+
+func nodeNames(nodes []*corev1.Node) []string {
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = n.Name
+	}
+	return names
+}
+
+func TestCordonedNodes_RemoveAfterGrace(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newCordonedNodes(5 * time.Minute)
+	c.now = func() time.Time { return now }
+
+	nodes := []*corev1.Node{cordonTestNode("node-1", false), cordonTestNode("node-2", true)}
+
+	// Within the grace period the cordoned node is kept.
+	assert.Equal(t, []string{"node-1", "node-2"}, nodeNames(c.filter(nodes)))
+	now = now.Add(4 * time.Minute)
+	assert.Equal(t, []string{"node-1", "node-2"}, nodeNames(c.filter(nodes)))
+
+	// After the grace period it is removed.
+	now = now.Add(time.Minute)
+	assert.Equal(t, []string{"node-1"}, nodeNames(c.filter(nodes)))
+	now = now.Add(time.Hour)
+	assert.Equal(t, []string{"node-1"}, nodeNames(c.filter(nodes)))
+}
+
+func TestCordonedNodes_ReAddUncordoned(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newCordonedNodes(5 * time.Minute)
+	c.now = func() time.Time { return now }
+
+	cordoned := []*corev1.Node{cordonTestNode("node-1", true)}
+	c.filter(cordoned)
+	now = now.Add(10 * time.Minute)
+	assert.Empty(t, c.filter(cordoned))
+
+	// Uncordoning adds the node again.
+	uncordoned := []*corev1.Node{cordonTestNode("node-1", false)}
+	assert.Equal(t, []string{"node-1"}, nodeNames(c.filter(uncordoned)))
+
+	// Cordoning it again starts a new grace period.
+	assert.Equal(t, []string{"node-1"}, nodeNames(c.filter(cordoned)))
+	now = now.Add(5 * time.Minute)
+	assert.Empty(t, c.filter(cordoned))
+}
+
+func TestCordonedNodes_Disabled(t *testing.T) {
+	var c *cordonedNodes
+
+	nodes := []*corev1.Node{cordonTestNode("node-1", true)}
+	assert.Equal(t, nodes, c.filter(nodes))
+}
+
+// fakeLBUpdater filters the nodes like UpdateLoadBalancer and records the
+// sorted targets of the last update.
+type fakeLBUpdater struct {
+	cordoned *cordonedNodes
+
+	mu      sync.Mutex
+	targets []string
+}
+
+func (f *fakeLBUpdater) UpdateLoadBalancer(_ context.Context, _ string, _ *corev1.Service, nodes []*corev1.Node) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.targets = nodeNames(f.cordoned.filter(nodes))
+	sort.Strings(f.targets)
+	return nil
+}
+
+func (f *fakeLBUpdater) isResponsible(svc *corev1.Service) bool {
+	return svc.Spec.LoadBalancerClass == nil
+}
+
+func (f *fakeLBUpdater) lastTargets() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.targets
+}
+
+func TestCordonController_UpdatesLoadBalancers(t *testing.T) {
+	node1 := cordonTestNode("node-1", false)
+	node1.Spec.ProviderID = "hcloud://1"
+	node2 := cordonTestNode("node-2", true)
+	node2.Spec.ProviderID = "hcloud://2"
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "1.2.3.4"}},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(node1, node2, svc)
+
+	cordoned := newCordonedNodes(50 * time.Millisecond)
+	lb := &fakeLBUpdater{cordoned: cordoned}
+	c := newCordonController(client, lb, cordoned)
+	c.interval = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	// The cordoned node is removed without any update of the Service or
+	// the nodes once its grace period expired.
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"node-1"}, lb.lastTargets())
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// Uncordoning adds it again.
+	node2 = node2.DeepCopy()
+	node2.Spec.Unschedulable = false
+	_, err := client.CoreV1().Nodes().Update(ctx, node2, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"node-1", "node-2"}, lb.lastTargets())
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestCordonedNodes_Due(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newCordonedNodes(5 * time.Minute)
+	c.now = func() time.Time { return now }
+
+	cordoned := []*corev1.Node{cordonTestNode("node-1", true)}
+
+	// The first check starts the grace period.
+	assert.False(t, c.due(cordoned))
+	now = now.Add(5 * time.Minute)
+	assert.True(t, c.due(cordoned))
+
+	// Once removed no update is due until the node is uncordoned.
+	c.filter(cordoned)
+	assert.False(t, c.due(cordoned))
+	assert.True(t, c.due([]*corev1.Node{cordonTestNode("node-1", false)}))
+}
@@ -0,0 +1,130 @@
+package hcloud
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultLBUpdateDedupWindow is the default time in which UpdateLoadBalancer
+// calls with an unchanged desired state are skipped.
+const defaultLBUpdateDedupWindow = 5 * time.Second
+
+// lbUpdateDeduplicator remembers the desired state last applied to the Load
+// Balancer of each Service. The service controller calls UpdateLoadBalancer
+// for all Services on every relevant node change, often several times in a
+// row with the same set of nodes. Calls with a state equal to the one applied
+// less than window ago are skipped. Calls with a different state are always
+// applied, so the latest state is never dropped.
+type lbUpdateDeduplicator struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	applied map[types.UID]appliedLBState
+}
+
+type appliedLBState struct {
+	fingerprint string
+	appliedAt   time.Time
+}
+
+func newLBUpdateDeduplicator(window time.Duration) *lbUpdateDeduplicator {
+	return &lbUpdateDeduplicator{
+		window:  window,
+		applied: make(map[types.UID]appliedLBState),
+	}
+}
+
+// isApplied reports whether the desired state of svc and nodes was applied
+// less than window ago.
+func (d *lbUpdateDeduplicator) isApplied(svc *corev1.Service, nodes []*corev1.Node) bool {
+	if d == nil || d.window <= 0 {
+		return false
+	}
+	fingerprint, ok := lbStateFingerprint(svc, nodes)
+	if !ok {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.applied[svc.UID]
+	return ok && state.fingerprint == fingerprint && time.Since(state.appliedAt) < d.window
+}
+
+// record remembers that the desired state of svc and nodes was applied.
+func (d *lbUpdateDeduplicator) record(svc *corev1.Service, nodes []*corev1.Node) {
+	if d == nil || d.window <= 0 {
+		return
+	}
+	fingerprint, ok := lbStateFingerprint(svc, nodes)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Drop expired entries, so that Services deleted without a call to
+	// forget do not accumulate.
+	for uid, state := range d.applied {
+		if time.Since(state.appliedAt) >= d.window {
+			delete(d.applied, uid)
+		}
+	}
+	if !ok {
+		delete(d.applied, svc.UID)
+		return
+	}
+	d.applied[svc.UID] = appliedLBState{fingerprint: fingerprint, appliedAt: time.Now()}
+}
+
+// forget removes the state recorded for svc.
+func (d *lbUpdateDeduplicator) forget(svc *corev1.Service) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.applied, svc.UID)
+}
+
+// lbStateFingerprint returns a hash of everything in svc and nodes the Load
+// Balancer is configured from.
+func lbStateFingerprint(svc *corev1.Service, nodes []*corev1.Node) (string, bool) {
+	type nodeState struct {
+		Name       string
+		ProviderID string
+		Labels     map[string]string
+		Taints     []corev1.Taint
+	}
+	state := struct {
+		Annotations map[string]string
+		Spec        corev1.ServiceSpec
+		Nodes       []nodeState
+	}{
+		Annotations: svc.Annotations,
+		Spec:        svc.Spec,
+	}
+	for _, node := range nodes {
+		state.Nodes = append(state.Nodes, nodeState{
+			Name:       node.Name,
+			ProviderID: node.Spec.ProviderID,
+			Labels:     node.Labels,
+			Taints:     node.Spec.Taints,
+		})
+	}
+	sort.Slice(state.Nodes, func(i, j int) bool { return state.Nodes[i].Name < state.Nodes[j].Name })
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), true
+}
@@ -0,0 +1,142 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// toBeDeletedTaint is added by the cluster autoscaler to nodes it is about
+// to remove. The service controller excludes such nodes from Load Balancers.
+const toBeDeletedTaint = "ToBeDeletedByClusterAutoscaler"
+
+// loadBalancerEnsurer creates or updates the Load Balancer of a Service.
+type loadBalancerEnsurer interface {
+	EnsureLoadBalancer(ctx context.Context, clusterName string, svc *corev1.Service, nodes []*corev1.Node) (*corev1.LoadBalancerStatus, error)
+	isResponsible(svc *corev1.Service) bool
+}
+
+// lbDriftController periodically reconciles all Load Balancers managed by the
+// cloud controller manager. The service controller only reconciles Load
+// Balancers on changes of Services or nodes. Changes applied to the Load
+// Balancers out-of-band, e.g. in the Hetzner Cloud Console, are otherwise
+// not corrected.
+type lbDriftController struct {
+	client   kubernetes.Interface
+	lb       loadBalancerEnsurer
+	interval time.Duration
+
+	services corelisters.ServiceLister
+	nodes    corelisters.NodeLister
+}
+
+func newLBDriftController(client kubernetes.Interface, lb loadBalancerEnsurer, interval time.Duration) *lbDriftController {
+	return &lbDriftController{
+		client:   client,
+		lb:       lb,
+		interval: interval,
+	}
+}
+
+// Run reconciles all Load Balancers every interval until ctx is done.
+func (c *lbDriftController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+
+	factory := informers.NewSharedInformerFactory(c.client, 10*time.Minute)
+	services := factory.Core().V1().Services()
+	nodes := factory.Core().V1().Nodes()
+	c.services = services.Lister()
+	c.nodes = nodes.Lister()
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), services.Informer().HasSynced, nodes.Informer().HasSynced) {
+		klog.Error("failed to sync caches for load balancer drift detection")
+		return
+	}
+
+	// Skip the first pass, the service controller reconciles all Load
+	// Balancers on startup anyway.
+	wait.JitterUntilWithContext(ctx, c.reconcileAll, c.interval, 0.1, false)
+}
+
+// reconcileAll runs EnsureLoadBalancer for all Services which already have a
+// Load Balancer. Services without a Load Balancer are left to the service
+// controller.
+func (c *lbDriftController) reconcileAll(ctx context.Context) {
+	const op = "hcloud/lbDriftController.reconcileAll"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	svcs, err := c.services.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "list services", "op", op)
+		return
+	}
+	allNodes, err := c.nodes.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "list nodes", "op", op)
+		return
+	}
+	nodes := lbNodes(allNodes)
+
+	for _, svc := range svcs {
+		if !isManagedLoadBalancerService(svc) || !c.lb.isResponsible(svc) {
+			continue
+		}
+		// EnsureLoadBalancer updates the annotations of the Service, never
+		// modify the objects of the informer cache.
+		_, err := c.lb.EnsureLoadBalancer(ctx, "", svc.DeepCopy(), nodes)
+		if err != nil && !errors.Is(err, cloudprovider.ImplementedElsewhere) {
+			klog.ErrorS(err, "reconcile load balancer drift", "op", op, "service", klog.KObj(svc))
+		}
+	}
+}
+
+// isManagedLoadBalancerService reports whether svc is of type LoadBalancer,
+// is not being deleted and already has a Load Balancer assigned. Whether its
+// class is handled by this cloud controller manager is checked by
+// isResponsible.
+func isManagedLoadBalancerService(svc *corev1.Service) bool {
+	return svc.Spec.Type == corev1.ServiceTypeLoadBalancer &&
+		svc.DeletionTimestamp == nil &&
+		len(svc.Status.LoadBalancer.Ingress) > 0
+}
+
+// lbNodes returns the nodes which the service controller passes to
+// EnsureLoadBalancer.
+func lbNodes(nodes []*corev1.Node) []*corev1.Node {
+	var selected []*corev1.Node
+	for _, node := range nodes {
+		if _, ok := node.Labels[corev1.LabelNodeExcludeBalancers]; ok {
+			continue
+		}
+		if node.Spec.ProviderID == "" {
+			continue
+		}
+		if hasTaint(node, toBeDeletedTaint) {
+			continue
+		}
+		selected = append(selected, node)
+	}
+	return selected
+}
+
+func hasTaint(node *corev1.Node, key string) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package hcloud
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestLBDriftController(t *testing.T, lb loadBalancerEnsurer, svcs []*corev1.Service, nodes []*corev1.Node) *lbDriftController {
+	svcIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, svc := range svcs {
+		assert.NoError(t, svcIndexer.Add(svc))
+	}
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		assert.NoError(t, nodeIndexer.Add(node))
+	}
+	c := newLBDriftController(nil, lb, time.Minute)
+	c.services = corelisters.NewServiceLister(svcIndexer)
+	c.nodes = corelisters.NewNodeLister(nodeIndexer)
+	return c
+}
+
+func TestLBDriftController_CorrectsHealthCheck(t *testing.T) {
+	fx := hcops.NewLoadBalancerOpsFixture(t)
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "web",
+			UID:       types.UID("drift-uid"),
+			Annotations: map[string]string{
+				string(annotation.LBSvcHealthCheckInterval): "15s",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Port: 80, NodePort: 8080}},
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "1.2.3.4"}},
+			},
+		},
+	}
+	// The health check interval of the Load Balancer was changed in the
+	// Hetzner Cloud Console.
+	lb := &hcloud.LoadBalancer{
+		ID:               1,
+		Name:             "web",
+		LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+		Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+		Labels: map[string]string{
+			hcops.LabelServiceUID:       "drift-uid",
+			hcops.LabelServiceNamespace: "default",
+			hcops.LabelServiceName:      "web",
+		},
+		Services: []hcloud.LoadBalancerService{
+			{
+				Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+				ListenPort:      80,
+				DestinationPort: 8080,
+				HealthCheck: hcloud.LoadBalancerServiceHealthCheck{
+					Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+					Port:     8080,
+					Interval: 5 * time.Second,
+				},
+			},
+		},
+	}
+
+	fx.LBClient.
+		On("AllWithOpts", fx.Ctx, hcloud.LoadBalancerListOpts{
+			ListOpts: hcloud.ListOpts{LabelSelector: hcops.LabelServiceUID + "=drift-uid"},
+		}).
+		Return([]*hcloud.LoadBalancer{lb}, nil)
+	action := fx.MockUpdateService(hcloud.LoadBalancerUpdateServiceOpts{
+		Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+		DestinationPort: hcloud.Ptr(8080),
+		HealthCheck: &hcloud.LoadBalancerUpdateServiceOptsHealthCheck{
+			Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+			Port:     hcloud.Ptr(8080),
+			Interval: hcloud.Ptr(15 * time.Second),
+		},
+	}, lb, 80, nil)
+	fx.MockWatchProgress(action, nil)
+	fx.MockListRobotServers(nil, nil)
+	fx.MockGetByID(lb, nil)
+
+	lbs := newLoadBalancers(fx.LBOps, fx.ActionClient, false, false)
+	c := newTestLBDriftController(t, lbs, []*corev1.Service{svc}, nil)
+	c.reconcileAll(fx.Ctx)
+
+	fx.AssertExpectations()
+	// The Service in the informer cache must not be modified.
+	assert.NotContains(t, svc.Annotations, string(annotation.LBPublicIPv4))
+}
+
+// fakeLBEnsurer records the reconciled Services. It is responsible for
+// Services without class and of class.
+type fakeLBEnsurer struct {
+	class    string
+	services []string
+	nodes    [][]*corev1.Node
+}
+
+func (e *fakeLBEnsurer) isResponsible(svc *corev1.Service) bool {
+	return svc.Spec.LoadBalancerClass == nil || *svc.Spec.LoadBalancerClass == e.class
+}
+
+func (e *fakeLBEnsurer) EnsureLoadBalancer(_ context.Context, _ string, svc *corev1.Service, nodes []*corev1.Node) (*corev1.LoadBalancerStatus, error) {
+	e.services = append(e.services, svc.Name)
+	e.nodes = append(e.nodes, nodes)
+	return &corev1.LoadBalancerStatus{}, nil
+}
+
+func TestLBDriftController_reconcileAll(t *testing.T) {
+	ingress := corev1.ServiceStatus{
+		LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "1.2.3.4"}}},
+	}
+	class, otherClass := "hcloud", "other"
+	svcs := []*corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "managed"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status:     ingress,
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "not-provisioned"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster-ip"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "other-class"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerClass: &otherClass},
+			Status:     ingress,
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "configured-class"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerClass: &class},
+			Status:     ingress,
+		},
+	}
+	nodes := []*corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "excluded", Labels: map[string]string{corev1.LabelNodeExcludeBalancers: ""}},
+			Spec:       corev1.NodeSpec{ProviderID: "hcloud://2"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "uninitialized"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "scaled-down"},
+			Spec: corev1.NodeSpec{
+				ProviderID: "hcloud://3",
+				Taints:     []corev1.Taint{{Key: toBeDeletedTaint, Effect: corev1.TaintEffectNoSchedule}},
+			},
+		},
+	}
+
+	ensurer := &fakeLBEnsurer{class: class}
+	c := newTestLBDriftController(t, ensurer, svcs, nodes)
+	c.reconcileAll(context.Background())
+
+	assert.ElementsMatch(t, []string{"managed", "configured-class"}, ensurer.services)
+	assert.Equal(t, [][]*corev1.Node{nodes[:1], nodes[:1]}, ensurer.nodes)
+}
@@ -0,0 +1,172 @@
+package hcloud
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// defaultLBMetricsInterval is the default interval in which the metrics
+	// of the Load Balancers are fetched.
+	defaultLBMetricsInterval = time.Minute
+
+	// lbMetricsWindow is the time range the metrics are requested for. Only
+	// the latest value of each time series is exported.
+	lbMetricsWindow = 5 * time.Minute
+	lbMetricsStep   = 60
+)
+
+// lbMetricsClient is the part of hcloud.LoadBalancerClient used by the
+// lbMetricsExporter.
+type lbMetricsClient interface {
+	AllWithOpts(ctx context.Context, opts hcloud.LoadBalancerListOpts) ([]*hcloud.LoadBalancer, error)
+	GetMetrics(ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerGetMetricsOpts) (*hcloud.LoadBalancerMetrics, *hcloud.Response, error)
+}
+
+// lbMetricsExporter periodically fetches the metrics of all Load Balancers
+// managed by the cloud controller manager from the Hetzner Cloud API and
+// exposes them on the metrics endpoint.
+type lbMetricsExporter struct {
+	client      lbMetricsClient
+	labelPrefix string
+	interval    time.Duration
+
+	// exported contains the label values of all Load Balancers metrics are
+	// currently exported for.
+	exported map[lbMetricsLabels]struct{}
+}
+
+type lbMetricsLabels struct {
+	loadBalancer string
+	service      string
+}
+
+func newLBMetricsExporter(client lbMetricsClient, labelPrefix string, interval time.Duration) *lbMetricsExporter {
+	return &lbMetricsExporter{
+		client:      client,
+		labelPrefix: labelPrefix,
+		interval:    interval,
+		exported:    make(map[lbMetricsLabels]struct{}),
+	}
+}
+
+// Run fetches the metrics every interval until ctx is done.
+func (e *lbMetricsExporter) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+
+	wait.JitterUntilWithContext(ctx, e.export, e.interval, 0.1, true)
+}
+
+// export fetches the metrics of all managed Load Balancers. If they cannot be
+// listed, the metrics exported last are kept. The metrics of a Load Balancer
+// whose metrics cannot be fetched are removed until the next successful fetch.
+func (e *lbMetricsExporter) export(ctx context.Context) {
+	const op = "hcloud/lbMetricsExporter.export"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	lbs, err := e.client.AllWithOpts(ctx, hcloud.LoadBalancerListOpts{
+		ListOpts: hcloud.ListOpts{
+			LabelSelector: hcops.WithLabelPrefix(e.labelPrefix, hcops.LabelServiceUID),
+		},
+	})
+	if err != nil {
+		metrics.LoadBalancerMetricsScrapes.WithLabelValues("error").Inc()
+		klog.ErrorS(err, "list load balancers", "op", op)
+		return
+	}
+
+	end := time.Now()
+	exported := make(map[lbMetricsLabels]struct{}, len(lbs))
+	for _, lb := range lbs {
+		m, _, err := e.client.GetMetrics(ctx, lb, hcloud.LoadBalancerGetMetricsOpts{
+			Types: []hcloud.LoadBalancerMetricType{
+				hcloud.LoadBalancerMetricOpenConnections,
+				hcloud.LoadBalancerMetricConnectionsPerSecond,
+				hcloud.LoadBalancerMetricRequestsPerSecond,
+				hcloud.LoadBalancerMetricBandwidth,
+			},
+			Start: end.Add(-lbMetricsWindow),
+			End:   end,
+			Step:  lbMetricsStep,
+		})
+		if err != nil {
+			metrics.LoadBalancerMetricsScrapes.WithLabelValues("error").Inc()
+			klog.ErrorS(err, "get load balancer metrics", "op", op, "loadBalancer", lb.Name)
+			continue
+		}
+		metrics.LoadBalancerMetricsScrapes.WithLabelValues("success").Inc()
+
+		labels := lbMetricsLabels{loadBalancer: lb.Name, service: e.serviceName(lb)}
+		e.set(labels, m.TimeSeries)
+		exported[labels] = struct{}{}
+	}
+
+	for labels := range e.exported {
+		if _, ok := exported[labels]; !ok {
+			deleteLBMetrics(labels)
+		}
+	}
+	e.exported = exported
+}
+
+// serviceName returns the namespace and name of the Service lb belongs to,
+// or an empty string if lb is not labeled with them.
+func (e *lbMetricsExporter) serviceName(lb *hcloud.LoadBalancer) string {
+	namespace := lb.Labels[hcops.WithLabelPrefix(e.labelPrefix, hcops.LabelServiceNamespace)]
+	name := lb.Labels[hcops.WithLabelPrefix(e.labelPrefix, hcops.LabelServiceName)]
+	if namespace == "" || name == "" {
+		return ""
+	}
+	return namespace + "/" + name
+}
+
+func (e *lbMetricsExporter) set(labels lbMetricsLabels, series map[string][]hcloud.LoadBalancerMetricsValue) {
+	setGauge := func(vec *prometheus.GaugeVec, name string, lvs ...string) {
+		if v, ok := latestLBMetricsValue(series[name]); ok {
+			vec.WithLabelValues(lvs...).Set(v)
+		}
+	}
+
+	lb, svc := labels.loadBalancer, labels.service
+	setGauge(metrics.LoadBalancerOpenConnections, "open_connections", lb, svc)
+	setGauge(metrics.LoadBalancerConnectionsPerSecond, "connections_per_second", lb, svc)
+	setGauge(metrics.LoadBalancerRequestsPerSecond, "requests_per_second", lb, svc)
+	setGauge(metrics.LoadBalancerBandwidth, "bandwidth.in", lb, svc, "in")
+	setGauge(metrics.LoadBalancerBandwidth, "bandwidth.out", lb, svc, "out")
+}
+
+func deleteLBMetrics(labels lbMetricsLabels) {
+	metrics.LoadBalancerOpenConnections.DeleteLabelValues(labels.loadBalancer, labels.service)
+	metrics.LoadBalancerConnectionsPerSecond.DeleteLabelValues(labels.loadBalancer, labels.service)
+	metrics.LoadBalancerRequestsPerSecond.DeleteLabelValues(labels.loadBalancer, labels.service)
+	metrics.LoadBalancerBandwidth.DeleteLabelValues(labels.loadBalancer, labels.service, "in")
+	metrics.LoadBalancerBandwidth.DeleteLabelValues(labels.loadBalancer, labels.service, "out")
+}
+
+// latestLBMetricsValue returns the value with the latest timestamp in values.
+func latestLBMetricsValue(values []hcloud.LoadBalancerMetricsValue) (float64, bool) {
+	var (
+		latest float64
+		ts     float64
+		found  bool
+	)
+	for _, v := range values {
+		f, err := strconv.ParseFloat(v.Value, 64)
+		if err != nil {
+			continue
+		}
+		if !found || v.Timestamp >= ts {
+			latest, ts, found = f, v.Timestamp, true
+		}
+	}
+	return latest, found
+}
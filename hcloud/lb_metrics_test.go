@@ -0,0 +1,89 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+)
+
+type fakeLBMetricsClient struct {
+	selectors []string
+	lbs       []*hcloud.LoadBalancer
+	listErr   error
+	metrics   map[int64]*hcloud.LoadBalancerMetrics
+}
+
+func (c *fakeLBMetricsClient) AllWithOpts(_ context.Context, opts hcloud.LoadBalancerListOpts) ([]*hcloud.LoadBalancer, error) {
+	c.selectors = append(c.selectors, opts.LabelSelector)
+	return c.lbs, c.listErr
+}
+
+func (c *fakeLBMetricsClient) GetMetrics(
+	_ context.Context, lb *hcloud.LoadBalancer, _ hcloud.LoadBalancerGetMetricsOpts,
+) (*hcloud.LoadBalancerMetrics, *hcloud.Response, error) {
+	m, ok := c.metrics[lb.ID]
+	if !ok {
+		return nil, nil, errors.New("get metrics: service unavailable")
+	}
+	return m, nil, nil
+}
+
+func TestLBMetricsExporter(t *testing.T) {
+	client := &fakeLBMetricsClient{
+		lbs: []*hcloud.LoadBalancer{
+			{
+				ID:   1,
+				Name: "web-lb",
+				Labels: map[string]string{
+					"cluster-a/service-uid":       "uid-1",
+					"cluster-a/service-namespace": "default",
+					"cluster-a/service-name":      "web",
+				},
+			},
+			{ID: 2, Name: "broken-lb", Labels: map[string]string{"cluster-a/service-uid": "uid-2"}},
+		},
+		metrics: map[int64]*hcloud.LoadBalancerMetrics{
+			1: {
+				TimeSeries: map[string][]hcloud.LoadBalancerMetricsValue{
+					"open_connections":       {{Timestamp: 1, Value: "10"}, {Timestamp: 2, Value: "12"}},
+					"connections_per_second": {{Timestamp: 2, Value: "3.5"}},
+					"requests_per_second":    {{Timestamp: 2, Value: "7"}},
+					"bandwidth.in":           {{Timestamp: 2, Value: "1024"}},
+					"bandwidth.out":          {{Timestamp: 2, Value: "2048"}, {Timestamp: 3, Value: "invalid"}},
+				},
+			},
+		},
+	}
+	e := newLBMetricsExporter(client, "cluster-a", defaultLBMetricsInterval)
+
+	errorsBefore := testutil.ToFloat64(metrics.LoadBalancerMetricsScrapes.WithLabelValues("error"))
+	e.export(context.Background())
+
+	assert.Equal(t, []string{"cluster-a/service-uid"}, client.selectors)
+	assert.Equal(t, 12.0, testutil.ToFloat64(metrics.LoadBalancerOpenConnections.WithLabelValues("web-lb", "default/web")))
+	assert.Equal(t, 3.5, testutil.ToFloat64(metrics.LoadBalancerConnectionsPerSecond.WithLabelValues("web-lb", "default/web")))
+	assert.Equal(t, 7.0, testutil.ToFloat64(metrics.LoadBalancerRequestsPerSecond.WithLabelValues("web-lb", "default/web")))
+	assert.Equal(t, 1024.0, testutil.ToFloat64(metrics.LoadBalancerBandwidth.WithLabelValues("web-lb", "default/web", "in")))
+	assert.Equal(t, 2048.0, testutil.ToFloat64(metrics.LoadBalancerBandwidth.WithLabelValues("web-lb", "default/web", "out")))
+
+	// The failure of a single Load Balancer does not affect the others.
+	assert.Equal(t, errorsBefore+1, testutil.ToFloat64(metrics.LoadBalancerMetricsScrapes.WithLabelValues("error")))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.LoadBalancerOpenConnections))
+
+	// A failed listing keeps the metrics exported last.
+	client.listErr = errors.New("service unavailable")
+	e.export(context.Background())
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.LoadBalancerOpenConnections))
+
+	// The metrics of deleted Load Balancers are removed.
+	client.listErr = nil
+	client.lbs = nil
+	e.export(context.Background())
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.LoadBalancerOpenConnections))
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.LoadBalancerBandwidth))
+}
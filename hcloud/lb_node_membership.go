@@ -0,0 +1,195 @@
+package hcloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// nodeLBMembershipAnnotation lists the names of the Load Balancers a node is
+// a target of, separated by commas.
+const nodeLBMembershipAnnotation = "load-balancer.hetzner.cloud/load-balancers"
+
+// nodeLBMembership maintains nodeLBMembershipAnnotation on the nodes.
+//
+// The annotation of a node is only updated if the Load Balancers it is a
+// target of changed. The last written value of each node is remembered, as
+// the nodes passed by the service controller may not contain the updates of
+// previous reconciles yet.
+type nodeLBMembership struct {
+	client kubernetes.Interface
+
+	mu      sync.Mutex
+	written map[string]string
+}
+
+func newNodeLBMembership() *nodeLBMembership {
+	return &nodeLBMembership{written: make(map[string]string)}
+}
+
+// setClient sets the client used to update the nodes. Updates are skipped
+// until the client is set.
+func (m *nodeLBMembership) setClient(client kubernetes.Interface) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.client = client
+}
+
+// update records that the Load Balancer lbName targets the nodes in targets.
+// It is removed from all other nodes in nodes.
+func (m *nodeLBMembership) update(ctx context.Context, lbName string, nodes, targets []*corev1.Node) error {
+	const op = "hcloud/nodeLBMembership.update"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if m == nil {
+		return nil
+	}
+	isTarget := make(map[string]bool, len(targets))
+	for _, n := range targets {
+		isTarget[n.Name] = true
+	}
+
+	m.mu.Lock()
+	client := m.client
+	var changes []membershipChange
+	if client != nil {
+		for _, n := range nodes {
+			if c, ok := m.change(n, lbName, isTarget[n.Name]); ok {
+				changes = append(changes, c)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if err := m.patch(ctx, client, changes); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// remove removes the Load Balancer lbName from all nodes.
+func (m *nodeLBMembership) remove(ctx context.Context, lbName string) error {
+	const op = "hcloud/nodeLBMembership.remove"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	client := m.client
+	m.mu.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	var changes []membershipChange
+	for i := range nodes.Items {
+		if c, ok := m.change(&nodes.Items[i], lbName, false); ok {
+			changes = append(changes, c)
+		}
+	}
+	m.mu.Unlock()
+
+	if err := m.patch(ctx, client, changes); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// membershipChange is a new value of the annotation of a node.
+type membershipChange struct {
+	node  string
+	value string
+}
+
+// change adds lbName to or removes it from the annotation of node. The new
+// value is recorded as written, so that concurrent updates build on it. It
+// reports false if the annotation does not change. m.mu must be held.
+func (m *nodeLBMembership) change(node *corev1.Node, lbName string, member bool) (membershipChange, bool) {
+	current, ok := m.written[node.Name]
+	if !ok {
+		current = node.Annotations[nodeLBMembershipAnnotation]
+	}
+
+	names := make(map[string]bool)
+	for _, name := range strings.Split(current, ",") {
+		if name != "" {
+			names[name] = true
+		}
+	}
+	if names[lbName] == member {
+		return membershipChange{}, false
+	}
+	if member {
+		names[lbName] = true
+	} else {
+		delete(names, lbName)
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	value := strings.Join(sorted, ",")
+
+	m.written[node.Name] = value
+	return membershipChange{node: node.Name, value: value}, true
+}
+
+// patch writes changes to the nodes. m.mu must not be held, the nodes are
+// patched through the API. The values of the nodes which were not patched are
+// forgotten, so that the next update starts from the annotations of the nodes.
+func (m *nodeLBMembership) patch(ctx context.Context, client kubernetes.Interface, changes []membershipChange) error {
+	for i, c := range changes {
+		if err := patchLBMembership(ctx, client, c); err != nil {
+			m.mu.Lock()
+			for _, c := range changes[i:] {
+				if m.written[c.node] == c.value {
+					delete(m.written, c.node)
+				}
+			}
+			m.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// patchLBMembership sets the annotation of a node to the value of c.
+func patchLBMembership(ctx context.Context, client kubernetes.Interface, c membershipChange) error {
+	// A null value removes the annotation.
+	var annotations map[string]*string
+	if c.value == "" {
+		annotations = map[string]*string{nodeLBMembershipAnnotation: nil}
+	} else {
+		annotations = map[string]*string{nodeLBMembershipAnnotation: &c.value}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	klog.V(4).InfoS("update load balancer membership", "node", c.node, "loadBalancers", c.value)
+	if _, err := client.CoreV1().Nodes().Patch(ctx, c.node, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("node %s: %w", c.node, err)
+	}
+	return nil
+}
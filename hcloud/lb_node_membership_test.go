@@ -0,0 +1,103 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNodeLBMembership(t *testing.T) {
+	ctx := context.Background()
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+		{ObjectMeta: metav1.ObjectMeta{
+			Name:        "node3",
+			Annotations: map[string]string{nodeLBMembershipAnnotation: "other-lb"},
+		}},
+	}
+	client := fake.NewSimpleClientset(nodes[0], nodes[1], nodes[2])
+
+	annotations := func() map[string]string {
+		t.Helper()
+		result := make(map[string]string)
+		for _, n := range nodes {
+			node, err := client.CoreV1().Nodes().Get(ctx, n.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			if v, ok := node.Annotations[nodeLBMembershipAnnotation]; ok {
+				result[n.Name] = v
+			}
+		}
+		return result
+	}
+	patches := func() int {
+		n := 0
+		for _, a := range client.Actions() {
+			if a.GetVerb() == "patch" {
+				n++
+			}
+		}
+		return n
+	}
+
+	m := newNodeLBMembership()
+
+	// Without a client the nodes are not updated.
+	require.NoError(t, m.update(ctx, "lb-a", nodes, nodes))
+	assert.Equal(t, 0, patches())
+
+	m.setClient(client)
+	require.NoError(t, m.update(ctx, "lb-a", nodes, nodes[:2]))
+	assert.Equal(t, map[string]string{
+		"node1": "lb-a",
+		"node2": "lb-a",
+		"node3": "other-lb",
+	}, annotations())
+
+	// The passed nodes do not contain the previous update.
+	require.NoError(t, m.update(ctx, "lb-b", nodes, nodes[1:]))
+	assert.Equal(t, map[string]string{
+		"node1": "lb-a",
+		"node2": "lb-a,lb-b",
+		"node3": "lb-b,other-lb",
+	}, annotations())
+
+	// Unchanged memberships do not update the nodes.
+	n := patches()
+	require.NoError(t, m.update(ctx, "lb-b", nodes, nodes[1:]))
+	assert.Equal(t, n, patches())
+
+	require.NoError(t, m.update(ctx, "lb-a", nodes, nodes[1:2]))
+	assert.Equal(t, map[string]string{
+		"node2": "lb-a,lb-b",
+		"node3": "lb-b,other-lb",
+	}, annotations())
+
+	require.NoError(t, m.remove(ctx, "lb-b"))
+	assert.Equal(t, map[string]string{
+		"node2": "lb-a",
+		"node3": "other-lb",
+	}, annotations())
+
+	// A node which could not be patched is patched again by the next update.
+	failPatch := true
+	client.PrependReactor("patch", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return failPatch, nil, errors.New("patch failed")
+	})
+	require.Error(t, m.update(ctx, "lb-c", nodes, nodes[:1]))
+	failPatch = false
+	require.NoError(t, m.update(ctx, "lb-c", nodes, nodes[:1]))
+	assert.Equal(t, map[string]string{
+		"node1": "lb-c",
+		"node2": "lb-a",
+		"node3": "other-lb",
+	}, annotations())
+}
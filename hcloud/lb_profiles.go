@@ -0,0 +1,117 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+var errLBProfilesNotConfigured = errors.New("load balancer profiles are not configured")
+
+// lbProfileGetter returns the annotations of a named Load Balancer profile.
+type lbProfileGetter interface {
+	Profile(name string) (map[string]string, error)
+}
+
+// configMapLBProfiles reads Load Balancer profiles from a ConfigMap. Every
+// key of the ConfigMap is the name of a profile, its value is a YAML map of
+// annotations, e.g.:
+//
+//	standard-https: |
+//	  load-balancer.hetzner.cloud/protocol: https
+//	  load-balancer.hetzner.cloud/http-redirect-http: "true"
+type configMapLBProfiles struct {
+	namespace string
+	name      string
+	lister    corelisters.ConfigMapLister
+}
+
+// parseLBProfilesConfigMap parses the value of
+// HCLOUD_LOAD_BALANCERS_PROFILES_CONFIGMAP, which has the format
+// "<namespace>/<name>".
+func parseLBProfilesConfigMap(v string) (namespace, name string, err error) {
+	namespace, name, ok := strings.Cut(v, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("%s: invalid value %q, expected <namespace>/<name>", hcloudLoadBalancersProfilesConfigMap, v)
+	}
+	return namespace, name, nil
+}
+
+// run starts watching the profiles ConfigMap and blocks until the cache is
+// synced.
+func (p *configMapLBProfiles) run(ctx context.Context, client kubernetes.Interface) {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 10*time.Minute, informers.WithNamespace(p.namespace))
+	informer := factory.Core().V1().ConfigMaps()
+	p.lister = informer.Lister()
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		klog.Errorf("failed to sync load balancer profiles ConfigMap %s/%s", p.namespace, p.name)
+	}
+}
+
+func (p *configMapLBProfiles) Profile(name string) (map[string]string, error) {
+	const op = "hcloud/configMapLBProfiles.Profile"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if p.lister == nil {
+		return nil, fmt.Errorf("%s: %w", op, errLBProfilesNotConfigured)
+	}
+	cm, err := p.lister.ConfigMaps(p.namespace).Get(p.name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: get ConfigMap %s/%s: %w", op, p.namespace, p.name, err)
+	}
+	v, ok := cm.Data[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: profile %q not found in ConfigMap %s/%s", op, name, p.namespace, p.name)
+	}
+
+	var annotations map[string]string
+	if err := yaml.Unmarshal([]byte(v), &annotations); err != nil {
+		return nil, fmt.Errorf("%s: profile %q: %w", op, name, err)
+	}
+	return annotations, nil
+}
+
+// applyLBProfile returns svc with the annotations of the profile referenced
+// by svc added. Annotations set explicitly on svc take precedence. svc may be
+// an object of an informer cache, it is copied rather than modified.
+func applyLBProfile(profiles lbProfileGetter, svc *corev1.Service) (*corev1.Service, error) {
+	const op = "hcloud/applyLBProfile"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	name, ok := annotation.LBProfile.StringFromService(svc)
+	if !ok {
+		return svc, nil
+	}
+	if profiles == nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, annotation.LBProfile, errLBProfilesNotConfigured)
+	}
+
+	profile, err := profiles.Profile(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	svc = svc.DeepCopy()
+	for k, v := range profile {
+		if k == string(annotation.LBProfile) {
+			continue
+		}
+		if _, ok := svc.Annotations[k]; ok {
+			continue
+		}
+		svc.Annotations[k] = v
+	}
+	return svc, nil
+}
@@ -0,0 +1,103 @@
+package hcloud
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestLBProfiles(t *testing.T, data map[string]string) *configMapLBProfiles {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := indexer.Add(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "hcloud-lb-profiles"},
+		Data:       data,
+	})
+	assert.NoError(t, err)
+	return &configMapLBProfiles{
+		namespace: "kube-system",
+		name:      "hcloud-lb-profiles",
+		lister:    corelisters.NewConfigMapLister(indexer),
+	}
+}
+
+func TestConfigMapLBProfiles_Profile(t *testing.T) {
+	profiles := newTestLBProfiles(t, map[string]string{
+		"standard-https": "load-balancer.hetzner.cloud/protocol: https\n" +
+			"load-balancer.hetzner.cloud/http-redirect-http: \"true\"\n",
+		"invalid": "- not a map",
+	})
+
+	profile, err := profiles.Profile("standard-https")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"load-balancer.hetzner.cloud/protocol":           "https",
+		"load-balancer.hetzner.cloud/http-redirect-http": "true",
+	}, profile)
+
+	_, err = profiles.Profile("missing")
+	assert.EqualError(t, err,
+		`hcloud/configMapLBProfiles.Profile: profile "missing" not found in ConfigMap kube-system/hcloud-lb-profiles`)
+
+	_, err = profiles.Profile("invalid")
+	assert.Error(t, err)
+}
+
+func TestApplyLBProfile(t *testing.T) {
+	profiles := newTestLBProfiles(t, map[string]string{
+		"standard-https": "load-balancer.hetzner.cloud/protocol: https\n" +
+			"load-balancer.hetzner.cloud/location: fsn1\n",
+	})
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				string(annotation.LBProfile):  "standard-https",
+				string(annotation.LBLocation): "hel1",
+			},
+		},
+	}
+	applied, err := applyLBProfile(profiles, svc)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		string(annotation.LBProfile):     "standard-https",
+		string(annotation.LBLocation):    "hel1",
+		string(annotation.LBSvcProtocol): "https",
+	}, applied.Annotations)
+	// The Service may be an object of an informer cache, it is not modified.
+	assert.Equal(t, map[string]string{
+		string(annotation.LBProfile):  "standard-https",
+		string(annotation.LBLocation): "hel1",
+	}, svc.Annotations)
+
+	// Services without a profile are not changed, even if profiles are not
+	// configured.
+	svc = &corev1.Service{}
+	applied, err = applyLBProfile(nil, svc)
+	assert.NoError(t, err)
+	assert.Empty(t, applied.Annotations)
+
+	svc = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{string(annotation.LBProfile): "standard-https"},
+		},
+	}
+	_, err = applyLBProfile(nil, svc)
+	assert.ErrorIs(t, err, errLBProfilesNotConfigured)
+}
+
+func TestParseLBProfilesConfigMap(t *testing.T) {
+	namespace, name, err := parseLBProfilesConfigMap("kube-system/hcloud-lb-profiles")
+	assert.NoError(t, err)
+	assert.Equal(t, "kube-system", namespace)
+	assert.Equal(t, "hcloud-lb-profiles", name)
+
+	for _, v := range []string{"hcloud-lb-profiles", "/name", "namespace/", "a/b/c"} {
+		_, _, err := parseLBProfilesConfigMap(v)
+		assert.Error(t, err, v)
+	}
+}
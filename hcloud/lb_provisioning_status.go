@@ -0,0 +1,150 @@
+package hcloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// lbProvisionedCondition is the type of the Service condition which reports
+// whether the Load Balancer of the Service could be provisioned.
+const lbProvisionedCondition = "load-balancer.hetzner.cloud/Provisioned"
+
+// lbProvisioningActions suggests how to resolve the errors of the Hetzner
+// Cloud API which prevent Load Balancers from being provisioned.
+var lbProvisioningActions = map[hcloud.ErrorCode]string{
+	hcloud.ErrorCodeResourceLimitExceeded: "delete unused resources or request a limit increase for the project",
+	hcloud.ErrorCodeResourceUnavailable:   "choose another Load Balancer type or location, or retry later",
+	hcloud.ErrorCodePlacementError:        "choose another location or network zone, or retry later",
+}
+
+// lbProvisioningStatus reports errors which prevent the Load Balancer of a
+// Service from being provisioned, e.g. an exceeded quota, as Warning Events
+// and as the lbProvisionedCondition of the Service.
+//
+// A message is only reported again if it changed, as the service controller
+// retries failed Services frequently.
+type lbProvisioningStatus struct {
+	client   kubernetes.Interface
+	recorder record.EventRecorder
+
+	mu       sync.Mutex
+	reported map[types.UID]string
+}
+
+func newLBProvisioningStatus(recorder record.EventRecorder) *lbProvisioningStatus {
+	return &lbProvisioningStatus{recorder: recorder, reported: make(map[types.UID]string)}
+}
+
+// setClient sets the client used to update the Service conditions. Until the
+// client is set only Events are reported.
+func (s *lbProvisioningStatus) setClient(client kubernetes.Interface) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = client
+}
+
+// lbProvisioningMessage returns the message reported for err, and false if
+// err does not prevent Load Balancers from being provisioned.
+func lbProvisioningMessage(err error) (string, bool) {
+	var apiErr hcloud.Error
+	if !errors.As(err, &apiErr) {
+		return "", false
+	}
+	action, ok := lbProvisioningActions[apiErr.Code]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("Load Balancer could not be provisioned: %s (%s), %s", apiErr.Message, apiErr.Code, action), true
+}
+
+// report reports the outcome err of reconciling the Load Balancer of svc.
+// Errors which do not prevent provisioning are ignored. A nil err marks a
+// previously reported failure as resolved.
+func (s *lbProvisioningStatus) report(ctx context.Context, svc *corev1.Service, err error) {
+	const op = "hcloud/lbProvisioningStatus.report"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		msg, ok := lbProvisioningMessage(err)
+		if !ok || s.reported[svc.UID] == msg {
+			return
+		}
+		if s.recorder != nil {
+			s.recorder.Event(svc, corev1.EventTypeWarning, "ProvisioningFailed", msg)
+		}
+		if err := s.setCondition(ctx, svc, metav1.ConditionFalse, "ProvisioningFailed", msg); err != nil {
+			klog.ErrorS(err, "update service condition", "op", op, "service", klog.KObj(svc))
+			return
+		}
+		s.reported[svc.UID] = msg
+		return
+	}
+
+	_, reported := s.reported[svc.UID]
+	if !reported && !hasFailedCondition(svc) {
+		return
+	}
+	if err := s.setCondition(ctx, svc, metav1.ConditionTrue, "Provisioned", "Load Balancer provisioned"); err != nil {
+		klog.ErrorS(err, "update service condition", "op", op, "service", klog.KObj(svc))
+		return
+	}
+	delete(s.reported, svc.UID)
+}
+
+// hasFailedCondition reports whether svc has a lbProvisionedCondition which
+// is not true, e.g. one reported before a restart.
+func hasFailedCondition(svc *corev1.Service) bool {
+	for _, c := range svc.Status.Conditions {
+		if c.Type == lbProvisionedCondition {
+			return c.Status != metav1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// setCondition sets the lbProvisionedCondition of svc. The other conditions
+// are kept, as the strategic merge patch merges conditions by their type.
+func (s *lbProvisioningStatus) setCondition(
+	ctx context.Context, svc *corev1.Service, status metav1.ConditionStatus, reason, msg string,
+) error {
+	if s.client == nil {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []metav1.Condition{{
+				Type:               lbProvisionedCondition,
+				Status:             status,
+				ObservedGeneration: svc.Generation,
+				LastTransitionTime: metav1.Now(),
+				Reason:             reason,
+				Message:            msg,
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.client.CoreV1().Services(svc.Namespace).Patch(
+		ctx, svc.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
@@ -0,0 +1,77 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestLBProvisioningStatus(t *testing.T) {
+	ctx := context.Background()
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default", UID: "svc-uid"}}
+	client := fake.NewSimpleClientset(svc)
+	recorder := record.NewFakeRecorder(10)
+
+	condition := func() *metav1.Condition {
+		t.Helper()
+		s, err := client.CoreV1().Services(svc.Namespace).Get(ctx, svc.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		for _, c := range s.Status.Conditions {
+			if c.Type == lbProvisionedCondition {
+				return &c
+			}
+		}
+		return nil
+	}
+
+	s := newLBProvisioningStatus(recorder)
+	s.setClient(client)
+
+	quotaErr := fmt.Errorf("hcops/LoadBalancerOps.Create: %w", hcops.NewAPIError("create", "load balancer svc", hcloud.Error{
+		Code:    hcloud.ErrorCodeResourceLimitExceeded,
+		Message: "project limit exceeded",
+	}))
+	msg := "Load Balancer could not be provisioned: project limit exceeded (resource_limit_exceeded), " +
+		"delete unused resources or request a limit increase for the project"
+
+	s.report(ctx, svc, quotaErr)
+	assert.Equal(t, "Warning ProvisioningFailed "+msg, <-recorder.Events)
+	c := condition()
+	require.NotNil(t, c)
+	assert.Equal(t, metav1.ConditionFalse, c.Status)
+	assert.Equal(t, "ProvisioningFailed", c.Reason)
+	assert.Equal(t, msg, c.Message)
+
+	// Repeated messages are reported once.
+	n := len(client.Actions())
+	s.report(ctx, svc, quotaErr)
+	assert.Empty(t, recorder.Events)
+	assert.Equal(t, n, len(client.Actions()))
+
+	// Other errors do not change the condition.
+	s.report(ctx, svc, errors.New("connection refused"))
+	assert.Empty(t, recorder.Events)
+	assert.Equal(t, n, len(client.Actions()))
+
+	s.report(ctx, svc, nil)
+	c = condition()
+	require.NotNil(t, c)
+	assert.Equal(t, metav1.ConditionTrue, c.Status)
+	assert.Equal(t, "Provisioned", c.Reason)
+
+	// Without a reported failure successful reconciles do not update the
+	// Service.
+	n = len(client.Actions())
+	s.report(ctx, svc, nil)
+	assert.Equal(t, n, len(client.Actions()))
+}
@@ -0,0 +1,90 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultLBReadyTimeout      = 2 * time.Minute
+	defaultLBReadyPollInterval = 2 * time.Second
+)
+
+// isReady reports whether all addresses of lb which are reported in the
+// status of svc are assigned. If no addresses are reported, e.g. as the
+// status contains annotation.LBHostname instead, lb is ready right away.
+func (l *loadBalancers) isReady(lb *hcloud.LoadBalancer, svc *corev1.Service) (bool, error) {
+	if _, ok := annotation.LBHostname.StringFromService(svc); ok {
+		return true, nil
+	}
+	ips, err := l.ingressIPs(lb, svc)
+	if err != nil {
+		return false, err
+	}
+	for _, ip := range ips {
+		if ip == nil || ip.IsUnspecified() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// waitForReady waits until lb is ready if svc enables
+// annotation.LBWaitForReady, and returns the Load Balancer read last. Without
+// the annotation lb is returned right away.
+func (l *loadBalancers) waitForReady(ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service) (*hcloud.LoadBalancer, error) {
+	const op = "hcloud/loadBalancers.waitForReady"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	wait, err := annotation.LBWaitForReady.BoolFromService(svc)
+	if errors.Is(err, annotation.ErrNotSet) || (err == nil && !wait) {
+		return lb, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	timeout, err := annotation.LBWaitForReadyTimeout.DurationFromService(svc)
+	if errors.Is(err, annotation.ErrNotSet) {
+		timeout = defaultLBReadyTimeout
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(l.readyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ready, err := l.isReady(lb, svc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if ready {
+			return lb, nil
+		}
+
+		klog.InfoS("wait for Load Balancer to become ready", "op", op, "loadBalancerID", lb.ID)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s: %w", op, ctx.Err())
+		case <-deadline.C:
+			return nil, fmt.Errorf("%s: load balancer %d not ready after %s", op, lb.ID, timeout)
+		case <-ticker.C:
+		}
+
+		lb, err = l.lbOps.GetByID(ctx, lb.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package hcloud
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func readyTestService(t *testing.T, annotations map[annotation.Name]interface{}) *corev1.Service {
+	t.Helper()
+	svc := &corev1.Service{}
+	for k, v := range annotations {
+		require.NoError(t, k.AnnotateService(svc, v))
+	}
+	return svc
+}
+
+func TestLoadBalancers_WaitForReady(t *testing.T) {
+	pending := &hcloud.LoadBalancer{ID: 1}
+	ready := &hcloud.LoadBalancer{
+		ID: 1,
+		PublicNet: hcloud.LoadBalancerPublicNet{
+			IPv4: hcloud.LoadBalancerPublicNetIPv4{IP: net.ParseIP("1.2.3.4")},
+			IPv6: hcloud.LoadBalancerPublicNetIPv6{IP: net.ParseIP("2001:db8::1")},
+		},
+	}
+	ctx := context.Background()
+
+	t.Run("ready after polls", func(t *testing.T) {
+		lbOps := &hcops.MockLoadBalancerOps{}
+		lbOps.Test(t)
+		lbOps.On("GetByID", ctx, int64(1)).Return(pending, nil).Times(2)
+		lbOps.On("GetByID", ctx, int64(1)).Return(ready, nil).Once()
+
+		l := newLoadBalancers(lbOps, nil, false, false)
+		l.readyPollInterval = time.Millisecond
+		svc := readyTestService(t, map[annotation.Name]interface{}{annotation.LBWaitForReady: true})
+
+		lb, err := l.waitForReady(ctx, pending, svc)
+		require.NoError(t, err)
+		assert.Equal(t, ready, lb)
+		lbOps.AssertNumberOfCalls(t, "GetByID", 3)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		lbOps := &hcops.MockLoadBalancerOps{}
+		lbOps.Test(t)
+		lbOps.On("GetByID", ctx, int64(1)).Return(pending, nil)
+
+		l := newLoadBalancers(lbOps, nil, false, false)
+		l.readyPollInterval = time.Millisecond
+		svc := readyTestService(t, map[annotation.Name]interface{}{
+			annotation.LBWaitForReady:        true,
+			annotation.LBWaitForReadyTimeout: 20 * time.Millisecond,
+		})
+
+		_, err := l.waitForReady(ctx, pending, svc)
+		assert.EqualError(t, err, "hcloud/loadBalancers.waitForReady: load balancer 1 not ready after 20ms")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		lbOps := &hcops.MockLoadBalancerOps{}
+		lbOps.Test(t)
+
+		l := newLoadBalancers(lbOps, nil, false, false)
+		lb, err := l.waitForReady(ctx, pending, &corev1.Service{})
+		require.NoError(t, err)
+		assert.Equal(t, pending, lb)
+		lbOps.AssertNotCalled(t, "GetByID")
+	})
+
+	t.Run("only IPs reported in the status", func(t *testing.T) {
+		lbOps := &hcops.MockLoadBalancerOps{}
+		lbOps.Test(t)
+
+		ipv4Only := &hcloud.LoadBalancer{
+			ID: 1,
+			PublicNet: hcloud.LoadBalancerPublicNet{
+				IPv4: hcloud.LoadBalancerPublicNetIPv4{IP: net.ParseIP("1.2.3.4")},
+			},
+		}
+		l := newLoadBalancers(lbOps, nil, false, false)
+		svc := readyTestService(t, map[annotation.Name]interface{}{
+			annotation.LBWaitForReady: true,
+			annotation.LBIPv6Disabled: true,
+		})
+		lb, err := l.waitForReady(ctx, ipv4Only, svc)
+		require.NoError(t, err)
+		assert.Equal(t, ipv4Only, lb)
+	})
+	t.Run("no IPs reported in the status", func(t *testing.T) {
+		for name, annotations := range map[string]map[annotation.Name]interface{}{
+			"hostname": {annotation.LBHostname: "lb.example.com"},
+			"no public and private IPs": {
+				annotation.LBDisablePublicNetwork: true,
+				annotation.LBExposePrivateIP:      false,
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				lbOps := &hcops.MockLoadBalancerOps{}
+				lbOps.Test(t)
+
+				l := newLoadBalancers(lbOps, nil, false, false)
+				annotations[annotation.LBWaitForReady] = true
+				svc := readyTestService(t, annotations)
+				lb, err := l.waitForReady(ctx, pending, svc)
+				require.NoError(t, err)
+				assert.Equal(t, pending, lb)
+				lbOps.AssertNotCalled(t, "GetByID")
+			})
+		}
+	})
+}
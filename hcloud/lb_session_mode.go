@@ -0,0 +1,61 @@
+package hcloud
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// lbSessionModes maps the values of the session-mode annotation to the
+// annotations they expand to.
+var lbSessionModes = map[string]map[annotation.Name]string{
+	"sticky-http": {
+		annotation.LBSvcProtocol:           "http",
+		annotation.LBAlgorithmType:         "round_robin",
+		annotation.LBSvcHTTPStickySessions: "true",
+	},
+	"sticky-https": {
+		annotation.LBSvcProtocol:           "https",
+		annotation.LBAlgorithmType:         "round_robin",
+		annotation.LBSvcHTTPStickySessions: "true",
+	},
+	"least-connections": {
+		annotation.LBSvcProtocol:   "tcp",
+		annotation.LBAlgorithmType: "least_connections",
+	},
+}
+
+// applyLBSessionMode returns svc with its session-mode annotation expanded.
+// Annotations already set on svc, explicitly or by its profile, take
+// precedence. svc is copied rather than modified.
+func applyLBSessionMode(svc *corev1.Service) (*corev1.Service, error) {
+	const op = "hcloud/applyLBSessionMode"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	mode, ok := annotation.LBSessionMode.StringFromService(svc)
+	if !ok {
+		return svc, nil
+	}
+	expansion, ok := lbSessionModes[mode]
+	if !ok {
+		modes := make([]string, 0, len(lbSessionModes))
+		for m := range lbSessionModes {
+			modes = append(modes, m)
+		}
+		sort.Strings(modes)
+		return nil, fmt.Errorf("%s: %s: invalid value %q, must be one of %s",
+			op, annotation.LBSessionMode, mode, strings.Join(modes, ", "))
+	}
+	svc = svc.DeepCopy()
+	for k, v := range expansion {
+		if _, ok := svc.Annotations[string(k)]; ok {
+			continue
+		}
+		svc.Annotations[string(k)] = v
+	}
+	return svc, nil
+}
@@ -0,0 +1,90 @@
+package hcloud
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyLBSessionMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    map[string]string
+		expectedErr string
+	}{
+		{
+			name:        "no session mode",
+			annotations: map[string]string{string(annotation.LBSvcProtocol): "https"},
+			expected:    map[string]string{string(annotation.LBSvcProtocol): "https"},
+		},
+		{
+			name:        "sticky-http",
+			annotations: map[string]string{string(annotation.LBSessionMode): "sticky-http"},
+			expected: map[string]string{
+				string(annotation.LBSessionMode):           "sticky-http",
+				string(annotation.LBSvcProtocol):           "http",
+				string(annotation.LBAlgorithmType):         "round_robin",
+				string(annotation.LBSvcHTTPStickySessions): "true",
+			},
+		},
+		{
+			name: "explicit annotations take precedence",
+			annotations: map[string]string{
+				string(annotation.LBSessionMode):   "sticky-https",
+				string(annotation.LBAlgorithmType): "least_connections",
+			},
+			expected: map[string]string{
+				string(annotation.LBSessionMode):           "sticky-https",
+				string(annotation.LBSvcProtocol):           "https",
+				string(annotation.LBAlgorithmType):         "least_connections",
+				string(annotation.LBSvcHTTPStickySessions): "true",
+			},
+		},
+		{
+			name:        "invalid session mode",
+			annotations: map[string]string{string(annotation.LBSessionMode): "sticky"},
+			expectedErr: `hcloud/applyLBSessionMode: load-balancer.hetzner.cloud/session-mode: invalid value "sticky", ` +
+				"must be one of least-connections, sticky-http, sticky-https",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			original := svc.DeepCopy()
+			applied, err := applyLBSessionMode(svc)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, applied.Annotations)
+			assert.Equal(t, original, svc)
+		})
+	}
+}
+
+func TestApplyLBSessionModeWithProfile(t *testing.T) {
+	profiles := newTestLBProfiles(t, map[string]string{
+		"tcp": "load-balancer.hetzner.cloud/protocol: tcp\n",
+	})
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				string(annotation.LBProfile):     "tcp",
+				string(annotation.LBSessionMode): "sticky-http",
+			},
+		},
+	}
+
+	// The annotations of the profile take precedence over the shorthand.
+	svc, err := applyLBProfile(profiles, svc)
+	assert.NoError(t, err)
+	svc, err = applyLBSessionMode(svc)
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp", svc.Annotations[string(annotation.LBSvcProtocol)])
+	assert.Equal(t, "round_robin", svc.Annotations[string(annotation.LBAlgorithmType)])
+}
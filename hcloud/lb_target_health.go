@@ -0,0 +1,113 @@
+package hcloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// lbTargetHealth writes the number of healthy and unhealthy targets of the
+// Load Balancers to the annotations of their Services.
+//
+// The service controller only persists the status of Services, so the
+// annotations are patched through the API. A Service is only patched if its
+// numbers changed. The last written numbers of each Service are remembered,
+// as the Services passed by the service controller may not contain the
+// updates of previous reconciles yet.
+type lbTargetHealth struct {
+	client kubernetes.Interface
+
+	mu      sync.Mutex
+	written map[types.UID]string
+}
+
+func newLBTargetHealth() *lbTargetHealth {
+	return &lbTargetHealth{written: make(map[types.UID]string)}
+}
+
+// setClient sets the client used to update the Services. Updates are skipped
+// until the client is set.
+func (h *lbTargetHealth) setClient(client kubernetes.Interface) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.client = client
+}
+
+// report writes the target health of lb to the annotations of svc.
+func (h *lbTargetHealth) report(ctx context.Context, svc *corev1.Service, lb *hcloud.LoadBalancer) error {
+	const op = "hcloud/lbTargetHealth.report"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if h == nil {
+		return nil
+	}
+
+	// Only the annotations of the copy are used, svc is not changed.
+	desired := svc.DeepCopy()
+	if err := annotation.LBTargetHealthToService(desired, lb); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	healthy := desired.Annotations[string(annotation.LBTargetsHealthy)]
+	unhealthy := desired.Annotations[string(annotation.LBTargetsUnhealthy)]
+	value := healthy + "/" + unhealthy
+
+	h.mu.Lock()
+	client := h.client
+	current, ok := h.written[svc.UID]
+	h.mu.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	if !ok {
+		current = svc.Annotations[string(annotation.LBTargetsHealthy)] + "/" + svc.Annotations[string(annotation.LBTargetsUnhealthy)]
+	}
+	if current == value {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				string(annotation.LBTargetsHealthy):   healthy,
+				string(annotation.LBTargetsUnhealthy): unhealthy,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	klog.V(4).InfoS("update target health", "op", op, "service", klog.KObj(svc), "healthy", healthy, "unhealthy", unhealthy)
+	if _, err := client.CoreV1().Services(svc.Namespace).Patch(
+		ctx, svc.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	h.mu.Lock()
+	h.written[svc.UID] = value
+	h.mu.Unlock()
+	return nil
+}
+
+// forget removes the remembered numbers of svc, e.g. after its Load Balancer
+// was deleted.
+func (h *lbTargetHealth) forget(svc *corev1.Service) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.written, svc.UID)
+}
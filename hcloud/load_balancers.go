@@ -4,13 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/tracing"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 )
@@ -21,26 +29,110 @@ type LoadBalancerOps interface {
 	GetByName(ctx context.Context, name string) (*hcloud.LoadBalancer, error)
 	GetByID(ctx context.Context, id int64) (*hcloud.LoadBalancer, error)
 	GetByK8SServiceUID(ctx context.Context, svc *corev1.Service) (*hcloud.LoadBalancer, error)
+	GetForAdoption(ctx context.Context, id int64, svc *corev1.Service) (*hcloud.LoadBalancer, error)
 	Create(ctx context.Context, lbName string, service *corev1.Service) (*hcloud.LoadBalancer, error)
 	Delete(ctx context.Context, lb *hcloud.LoadBalancer) error
+	RestoreLabels(ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service) (bool, error)
 	ReconcileHCLB(ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service) (bool, error)
 	ReconcileHCLBTargets(ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service, nodes []*corev1.Node) (bool, error)
 	ReconcileHCLBServices(ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service) (bool, error)
 }
 
+// errServiceWithoutPorts is returned for Services without ports, their Load
+// Balancer would not receive any traffic.
+var errServiceWithoutPorts = errors.New("service has no ports")
+
+// errLBDeleteProtected is returned when the Load Balancer of a deleted
+// Service has delete protection enabled. The service controller keeps the
+// finalizer of the Service and retries until the protection is removed.
+var errLBDeleteProtected = errors.New("delete protection is enabled")
+
 type loadBalancers struct {
 	lbOps                        LoadBalancerOps
 	ac                           hcops.HCloudActionClient // Deprecated: should only be referenced by hcops types
 	disablePrivateIngressDefault bool
 	disableIPv6Default           bool
+	profiles                     lbProfileGetter
+
+	// targetHealth writes the target health of the Load Balancers to their
+	// Services. Nil disables it.
+	targetHealth *lbTargetHealth
+
+	// nodeMembership annotates the nodes with the Load Balancers they are a
+	// target of. Nil disables it.
+	nodeMembership *nodeLBMembership
+
+	// deleteRetries is the number of times deleting a Load Balancer is
+	// retried after a transient error. The delay before the first retry is
+	// deleteRetryDelay, it doubles with every further retry.
+	deleteRetries    int
+	deleteRetryDelay time.Duration
+
+	// updates skips UpdateLoadBalancer calls whose desired state was just
+	// applied.
+	updates *lbUpdateDeduplicator
+
+	// cordoned is set if cordoned nodes are removed from the Load Balancers
+	// after a grace period.
+	cordoned *cordonedNodes
+
+	// clusterName prefixes the generated names of Load Balancers. Optional.
+	clusterName string
+
+	// maxNameLength is the maximum length of generated Load Balancer names.
+	// Longer names are truncated with a hash suffix.
+	maxNameLength int
+
+	// logDiff logs the differences between the Load Balancers and the state
+	// desired by their Services before every reconcile.
+	logDiff bool
+
+	// loadBalancerClass is the spec.loadBalancerClass of the Services this
+	// cloud controller manager is responsible for, besides Services without
+	// a class. Optional.
+	loadBalancerClass string
+
+	// namespaces restricts the Services this cloud controller manager is
+	// responsible for to these namespaces. All namespaces if empty.
+	namespaces map[string]bool
+
+	// recorder reports problems with the configuration of Services, e.g.
+	// unknown annotations. Can be nil.
+	recorder record.EventRecorder
+
+	// provisioning reports errors which prevent the Load Balancer of a
+	// Service from being provisioned. Nil disables it.
+	provisioning *lbProvisioningStatus
+
+	// skipServicesWithoutPorts ignores Services without ports instead of
+	// failing them with errServiceWithoutPorts.
+	skipServicesWithoutPorts bool
+
+	// maintenance skips all changes of Load Balancers. EnsureLoadBalancer
+	// only reports the status of existing Load Balancers.
+	maintenance bool
+
+	// readyPollInterval is the interval in which EnsureLoadBalancer checks
+	// whether a Load Balancer is ready, if the Service waits for it.
+	readyPollInterval time.Duration
 }
 
+const (
+	defaultLBDeleteRetries    = 3
+	defaultLBDeleteRetryDelay = time.Second
+)
+
 func newLoadBalancers(lbOps LoadBalancerOps, ac hcops.HCloudActionClient, disablePrivateIngressDefault, disableIPv6Default bool) *loadBalancers {
 	return &loadBalancers{
 		lbOps:                        lbOps,
 		ac:                           ac,
 		disablePrivateIngressDefault: disablePrivateIngressDefault,
 		disableIPv6Default:           disableIPv6Default,
+		deleteRetries:                defaultLBDeleteRetries,
+		deleteRetryDelay:             defaultLBDeleteRetryDelay,
+		updates:                      newLBUpdateDeduplicator(defaultLBUpdateDedupWindow),
+		readyPollInterval:            defaultLBReadyPollInterval,
+		maxNameLength:                hcops.DefaultMaxLBNameLength,
 	}
 }
 
@@ -67,6 +159,117 @@ func matchNodeSelector(svc *corev1.Service, nodes []*corev1.Node) ([]*corev1.Nod
 	return selectedNodes, nil
 }
 
+// matchTargetZones returns the nodes in the zones of the target-zones
+// annotation of svc, or all nodes if the annotation is not set. It returns an
+// error if none of the nodes is in the zones, e.g. because of a typo, instead
+// of removing all targets of the Load Balancer.
+func matchTargetZones(svc *corev1.Service, nodes []*corev1.Node) ([]*corev1.Node, error) {
+	const op = "hcloud/matchTargetZones"
+
+	values, err := annotation.LBTargetZones.StringsFromService(svc)
+	if err != nil && !errors.Is(err, annotation.ErrNotSet) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var zones []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			zones = append(zones, v)
+		}
+	}
+	if len(zones) == 0 {
+		return nodes, nil
+	}
+
+	var selectedNodes []*corev1.Node
+	for _, n := range nodes {
+		zone := n.Labels[corev1.LabelTopologyZone]
+		if zone == "" {
+			continue
+		}
+		if slices.Contains(zones, zone) || slices.Contains(zones, hcops.NodeLocation(n)) {
+			selectedNodes = append(selectedNodes, n)
+		}
+	}
+	if len(selectedNodes) == 0 && len(nodes) > 0 {
+		return nil, fmt.Errorf("%s: no node is in the zones %s", op, strings.Join(zones, ", "))
+	}
+	if len(selectedNodes) < len(nodes) {
+		klog.InfoS("restrict targets to zones", "op", op, "service", svc.Name, "zones", zones,
+			"nodes", len(nodes), "selectedNodes", len(selectedNodes))
+	}
+	return selectedNodes, nil
+}
+
+// applyTargetWeights groups nodes by the value of the label referenced by the
+// target-weight-label annotation of svc. As Hetzner Cloud Load Balancers do
+// not support weighted targets, nodes with a weight of 0 are removed and the
+// intended distribution of the remaining nodes is logged.
+func applyTargetWeights(svc *corev1.Service, nodes []*corev1.Node) ([]*corev1.Node, error) {
+	const op = "hcloud/applyTargetWeights"
+
+	labelKey, ok := annotation.LBTargetWeightLabel.StringFromService(svc)
+	if !ok || labelKey == "" {
+		return nodes, nil
+	}
+
+	var (
+		weightedNodes []*corev1.Node
+		totalWeight   int
+		groups        = make(map[int][]string)
+	)
+	for _, n := range nodes {
+		weight := 1
+		if v, ok := n.GetLabels()[labelKey]; ok {
+			w, err := strconv.Atoi(v)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("%s: node %s: invalid weight %q in label %s", op, n.Name, v, labelKey)
+			}
+			weight = w
+		}
+		groups[weight] = append(groups[weight], n.Name)
+		if weight == 0 {
+			continue
+		}
+		totalWeight += weight
+		weightedNodes = append(weightedNodes, n)
+	}
+
+	weights := make([]int, 0, len(groups))
+	for weight := range groups {
+		weights = append(weights, weight)
+	}
+	sort.Ints(weights)
+
+	for _, weight := range weights {
+		nodeNames := groups[weight]
+		var share float64
+		if totalWeight > 0 {
+			share = float64(weight*len(nodeNames)) / float64(totalWeight) * 100
+		}
+		klog.V(4).InfoS("intended target weight distribution (weights are not supported by Hetzner Cloud, targets are weighted equally)",
+			"op", op, "service", klog.KObj(svc), "weight", weight, "intendedSharePercent", fmt.Sprintf("%.1f", share), "nodes", nodeNames)
+	}
+
+	return weightedNodes, nil
+}
+
+// validateAnnotations returns an error if an annotation of svc has an invalid
+// value. Unknown annotations with the prefix of the Load Balancer annotations
+// are probably typos, they are reported with a Warning Event.
+func (l *loadBalancers) validateAnnotations(svc *corev1.Service) error {
+	const op = "hcloud/loadBalancers.validateAnnotations"
+
+	unknown, err := annotation.ValidateService(svc)
+	for _, name := range unknown {
+		klog.InfoS("unknown annotation", "op", op, "service", klog.KObj(svc), "annotation", name)
+		if l.recorder != nil {
+			l.recorder.Eventf(svc, corev1.EventTypeWarning, "UnknownAnnotation",
+				"Unknown annotation %s is ignored, check it for typos", name)
+		}
+	}
+	return err
+}
+
 func (l *loadBalancers) GetLoadBalancer(
 	ctx context.Context, _ string, service *corev1.Service,
 ) (status *corev1.LoadBalancerStatus, exists bool, err error) {
@@ -81,44 +284,141 @@ func (l *loadBalancers) GetLoadBalancer(
 		return nil, false, fmt.Errorf("%s: %v", op, err)
 	}
 
-	if v, ok := annotation.LBHostname.StringFromService(service); ok {
-		return &corev1.LoadBalancerStatus{
-			Ingress: []corev1.LoadBalancerIngress{{Hostname: v}},
-		}, true, nil
+	status, err = l.loadBalancerStatus(lb, service)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %v", op, err)
 	}
+	return status, true, nil
+}
 
-	ingresses := []corev1.LoadBalancerIngress{
-		{
-			IP: lb.PublicNet.IPv4.IP.String(),
-		},
+func (l *loadBalancers) GetLoadBalancerName(_ context.Context, _ string, service *corev1.Service) string {
+	if v, ok := annotation.LBName.StringFromService(service); ok {
+		return v
 	}
+	if l.clusterName != "" {
+		return hcops.GenerateLBName(l.clusterName+"-"+cloudprovider.DefaultLoadBalancerName(service), l.maxNameLength)
+	}
+	return hcops.GenerateLBName(cloudprovider.DefaultLoadBalancerName(service), l.maxNameLength)
+}
 
-	disableIPV6, err := l.getDisableIPv6(service)
-	if err != nil {
-		return nil, false, fmt.Errorf("%s: %v", op, err)
+// inNamespaces reports whether svc is in one of the namespaces the cloud
+// controller manager is responsible for.
+func (l *loadBalancers) inNamespaces(svc *corev1.Service) bool {
+	return len(l.namespaces) == 0 || l.namespaces[svc.Namespace]
+}
+
+// isResponsible reports whether the Load Balancer of svc is managed by this
+// cloud controller manager, i.e. svc has no loadBalancerClass or the one
+// configured in loadBalancerClass.
+func (l *loadBalancers) isResponsible(svc *corev1.Service) bool {
+	class := svc.Spec.LoadBalancerClass
+	return class == nil || (l.loadBalancerClass != "" && *class == l.loadBalancerClass)
+}
+
+// getByName retrieves the Load Balancer of svc by its name. Load Balancers
+// created before the cluster name was configured have a generated name
+// without the cluster name and are found by this name as well.
+func (l *loadBalancers) getByName(ctx context.Context, clusterName string, svc *corev1.Service) (*hcloud.LoadBalancer, error) {
+	lb, err := l.lbOps.GetByName(ctx, l.GetLoadBalancerName(ctx, clusterName, svc))
+	if !errors.Is(err, hcops.ErrNotFound) || l.clusterName == "" {
+		return lb, err
 	}
-	if !disableIPV6 {
-		ingresses = append(ingresses, corev1.LoadBalancerIngress{
-			IP: lb.PublicNet.IPv6.IP.String(),
-		})
+	if _, ok := annotation.LBName.StringFromService(svc); ok {
+		return lb, err
 	}
+	return l.lbOps.GetByName(ctx, hcops.GenerateLBName(cloudprovider.DefaultLoadBalancerName(svc), l.maxNameLength))
+}
 
-	return &corev1.LoadBalancerStatus{Ingress: ingresses}, true, nil
+// pinnedLBID returns the ID of the Load Balancer svc pins by the id
+// annotation, or 0 if the annotation is not set.
+func pinnedLBID(svc *corev1.Service) (int64, error) {
+	id, err := annotation.LBID.IntFromService(svc)
+	if errors.Is(err, annotation.ErrNotSet) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(id), nil
 }
 
-func (l *loadBalancers) GetLoadBalancerName(_ context.Context, _ string, service *corev1.Service) string {
-	if v, ok := annotation.LBName.StringFromService(service); ok {
-		return v
+// getPinned returns the Load Balancer with id, which svc pins by the id
+// annotation. lb is the Load Balancer found by the Service UID, nil if there
+// is none. In this case the pinned Load Balancer is adopted by labeling it
+// for svc.
+func (l *loadBalancers) getPinned(
+	ctx context.Context, id int64, lb *hcloud.LoadBalancer, svc *corev1.Service,
+) (*hcloud.LoadBalancer, error) {
+	const op = "hcloud/loadBalancers.getPinned"
+
+	if lb != nil {
+		if lb.ID != id {
+			return nil, fmt.Errorf("%s: service is labeled on load balancer %d, but %s is %d: %w",
+				op, lb.ID, annotation.LBID, id, hcops.ErrOwnedByOtherService)
+		}
+		return lb, nil
 	}
-	return cloudprovider.DefaultLoadBalancerName(service)
+
+	lb, err := l.lbOps.GetForAdoption(ctx, id, svc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := l.lbOps.RestoreLabels(ctx, lb, svc); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	klog.InfoS("adopt Load Balancer", "op", op, "loadBalancerID", lb.ID, "service", klog.KObj(svc))
+	return lb, nil
 }
 
 func (l *loadBalancers) EnsureLoadBalancer(
 	ctx context.Context, clusterName string, svc *corev1.Service, nodes []*corev1.Node,
+) (*corev1.LoadBalancerStatus, error) {
+	ctx, span := tracing.Start(ctx, "hcloud/loadBalancers.EnsureLoadBalancer", tracing.Service(svc)...)
+	status, err := l.ensureLoadBalancer(ctx, clusterName, svc, nodes)
+	l.provisioning.report(ctx, svc, err)
+	tracing.End(span, err)
+	return status, err
+}
+
+func (l *loadBalancers) ensureLoadBalancer(
+	ctx context.Context, clusterName string, svc *corev1.Service, nodes []*corev1.Node,
 ) (*corev1.LoadBalancerStatus, error) {
 	const op = "hcloud/loadBalancers.EnsureLoadBalancer"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
+	if !l.isResponsible(svc) {
+		klog.V(4).InfoS("ignore service of other load balancer class", "op", op, "service", klog.KObj(svc), "class", *svc.Spec.LoadBalancerClass)
+		return nil, nil
+	}
+	// The service controller compares the error with ImplementedElsewhere
+	// to leave the Service alone instead of retrying, it must not be wrapped.
+	if !l.inNamespaces(svc) {
+		klog.V(4).InfoS("ignore service in other namespace", "op", op, "service", klog.KObj(svc))
+		return nil, cloudprovider.ImplementedElsewhere
+	}
+	if len(svc.Spec.Ports) == 0 {
+		if l.skipServicesWithoutPorts {
+			klog.InfoS("skip service without ports", "op", op, "service", klog.KObj(svc))
+			return nil, cloudprovider.ImplementedElsewhere
+		}
+		if l.recorder != nil {
+			l.recorder.Event(svc, corev1.EventTypeWarning, "ServiceWithoutPorts",
+				"Load Balancer not created: the Service has no ports")
+		}
+		return nil, fmt.Errorf("%s: %w", op, errServiceWithoutPorts)
+	}
+	if l.maintenance {
+		klog.InfoS("maintenance mode, skip ensuring Load Balancer", "op", op, "service", klog.KObj(svc))
+		status, exists, err := l.GetLoadBalancer(ctx, clusterName, svc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("%s: %w", op, errMaintenanceMode)
+		}
+		return status, nil
+	}
+
 	var (
 		reload        bool
 		lb            *hcloud.LoadBalancer
@@ -126,11 +426,57 @@ func (l *loadBalancers) EnsureLoadBalancer(
 		selectedNodes []*corev1.Node
 	)
 
+	svc, err = applyLBProfile(l.profiles, svc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	svc, err = applyLBSessionMode(svc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// EnsureLoadBalancer applies the complete state, the next update has to
+	// be applied even if it is equal to the last one.
+	l.updates.forget(svc)
+
+	if err := l.validateAnnotations(svc); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Validate the IP families before creating the Load Balancer, the status
+	// could not be reported afterwards.
+	if _, err := l.getDisableIPv4(svc); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := l.getExposePrivateIP(svc); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := hcops.SourceRanges(svc); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := hcops.ValidatePortProtocols(svc); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	pinnedID, err := pinnedLBID(svc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	nodes = l.cordoned.filter(nodes)
 	selectedNodes, err = matchNodeSelector(svc, nodes)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	selectedNodes, err = matchTargetZones(svc, selectedNodes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	selectedNodes, err = applyTargetWeights(svc, selectedNodes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	nodeNames := make([]string, len(selectedNodes))
 	for i, n := range selectedNodes {
 		nodeNames[i] = n.Name
@@ -142,6 +488,15 @@ func (l *loadBalancers) EnsureLoadBalancer(
 		return nil, fmt.Errorf("%s: %v", op, err)
 	}
 
+	// A Load Balancer pinned by the id annotation is never looked up by its
+	// name or created.
+	if pinnedID != 0 {
+		lb, err = l.getPinned(ctx, pinnedID, lb, svc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
 	// Try the load balancer's name if we were not able to find it using the
 	// service UID. This is required for two reasons:
 	//
@@ -152,10 +507,15 @@ func (l *loadBalancers) EnsureLoadBalancer(
 	// should be re-used by the cloud controller manager.
 	lbName := l.GetLoadBalancerName(ctx, clusterName, svc)
 	if errors.Is(err, hcops.ErrNotFound) {
-		lb, err = l.lbOps.GetByName(ctx, lbName)
+		lb, err = l.getByName(ctx, clusterName, svc)
 		if err != nil && !errors.Is(err, hcops.ErrNotFound) {
 			return nil, fmt.Errorf("%s: %v", op, err)
 		}
+		if err == nil {
+			if _, err := l.lbOps.RestoreLabels(ctx, lb, svc); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
 	}
 
 	// If we were still not able to find the load balancer we create it.
@@ -166,6 +526,7 @@ func (l *loadBalancers) EnsureLoadBalancer(
 		}
 	}
 
+	l.logLBDiff(lb, svc, selectedNodes)
 	lbChanged, err := l.lbOps.ReconcileHCLB(ctx, lb, svc)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -178,11 +539,16 @@ func (l *loadBalancers) EnsureLoadBalancer(
 	}
 	reload = reload || servicesChanged
 
-	targetsChanged, err := l.lbOps.ReconcileHCLBTargets(ctx, lb, svc, selectedNodes)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+	// Targets of locked servers are retried after the remaining Load
+	// Balancer was reconciled.
+	targetsChanged, targetsErr := l.lbOps.ReconcileHCLBTargets(ctx, lb, svc, selectedNodes)
+	if targetsErr != nil && !errors.Is(targetsErr, hcops.ErrTargetsLocked) {
+		return nil, fmt.Errorf("%s: %w", op, targetsErr)
 	}
 	reload = reload || targetsChanged
+	if targetsErr == nil {
+		l.updateNodeMembership(ctx, lb, nodes, selectedNodes)
+	}
 
 	if reload {
 		klog.InfoS("reload HC Load Balancer", "op", op, "loadBalancerID", lb.ID)
@@ -192,10 +558,43 @@ func (l *loadBalancers) EnsureLoadBalancer(
 		}
 	}
 
+	lb, err = l.waitForReady(ctx, lb, svc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	if err := annotation.LBToService(svc, lb); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	// The target health is only informational, errors do not fail the
+	// reconcile.
+	if err := l.targetHealth.report(ctx, svc, lb); err != nil {
+		klog.ErrorS(err, "failed to report target health", "op", op, "service", klog.KObj(svc))
+	}
+
+	if targetsErr != nil {
+		return nil, fmt.Errorf("%s: %w", op, targetsErr)
+	}
+
+	status, err := l.loadBalancerStatus(lb, svc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return status, nil
+}
+
+// updateNodeMembership annotates nodes with lb if they are in targets. The
+// annotations are only informational, errors are logged and do not fail the
+// reconcile.
+func (l *loadBalancers) updateNodeMembership(ctx context.Context, lb *hcloud.LoadBalancer, nodes, targets []*corev1.Node) {
+	if err := l.nodeMembership.update(ctx, lb.Name, nodes, targets); err != nil {
+		klog.ErrorS(err, "failed to update load balancer membership of nodes", "loadBalancerID", lb.ID)
+	}
+}
+
+// loadBalancerStatus returns the status of the Load Balancer lb for svc.
+func (l *loadBalancers) loadBalancerStatus(lb *hcloud.LoadBalancer, svc *corev1.Service) (*corev1.LoadBalancerStatus, error) {
 	// Either set the Hostname or the IPs (below).
 	// See: https://github.com/kubernetes/kubernetes/issues/66607
 	if v, ok := annotation.LBHostname.StringFromService(svc); ok {
@@ -204,36 +603,80 @@ func (l *loadBalancers) EnsureLoadBalancer(
 		}, nil
 	}
 
+	ips, err := l.ingressIPs(lb, svc)
+	if err != nil {
+		return nil, err
+	}
 	var ingress []corev1.LoadBalancerIngress
+	for _, ip := range ips {
+		ingress = append(ingress, corev1.LoadBalancerIngress{IP: ip.String()})
+	}
+
+	return &corev1.LoadBalancerStatus{Ingress: ingress}, nil
+}
+
+// ingressIPs returns the IPs of the Load Balancer lb which are reported in
+// the status of svc. IPs which are not assigned yet are nil.
+func (l *loadBalancers) ingressIPs(lb *hcloud.LoadBalancer, svc *corev1.Service) ([]net.IP, error) {
+	var ips []net.IP
 
 	disablePubNet, err := annotation.LBDisablePublicNetwork.BoolFromService(svc)
 	if err != nil && !errors.Is(err, annotation.ErrNotSet) {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
 	if !disablePubNet {
-		ingress = append(ingress, corev1.LoadBalancerIngress{IP: lb.PublicNet.IPv4.IP.String()})
+		disableIPv4, err := l.getDisableIPv4(svc)
+		if err != nil {
+			return nil, err
+		}
+		if !disableIPv4 {
+			ips = append(ips, lb.PublicNet.IPv4.IP)
+		}
 
 		disableIPV6, err := l.getDisableIPv6(svc)
 		if err != nil {
-			return nil, fmt.Errorf("%s: %w", op, err)
+			return nil, err
 		}
 		if !disableIPV6 {
-			ingress = append(ingress, corev1.LoadBalancerIngress{IP: lb.PublicNet.IPv6.IP.String()})
+			ips = append(ips, lb.PublicNet.IPv6.IP)
 		}
 	}
 
-	disablePrivIngress, err := l.getDisablePrivateIngress(svc)
+	exposePrivateIP, err := l.getExposePrivateIP(svc)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
-	if !disablePrivIngress {
+	if exposePrivateIP {
 		for _, nw := range lb.PrivateNet {
-			ingress = append(ingress, corev1.LoadBalancerIngress{IP: nw.IP.String()})
+			ips = append(ips, nw.IP)
 		}
 	}
 
-	return &corev1.LoadBalancerStatus{Ingress: ingress}, nil
+	return ips, nil
+}
+
+// getExposePrivateIP returns whether the private network IPs of the Load
+// Balancer should be reported in the status of svc.
+func (l *loadBalancers) getExposePrivateIP(svc *corev1.Service) (bool, error) {
+	expose, err := annotation.LBExposePrivateIP.BoolFromService(svc)
+	if errors.Is(err, annotation.ErrNotSet) {
+		disable, err := l.getDisablePrivateIngress(svc)
+		return !disable, err
+	}
+	if err != nil || !expose {
+		return false, err
+	}
+
+	disable, err := annotation.LBDisablePrivateIngress.BoolFromService(svc)
+	if err != nil && !errors.Is(err, annotation.ErrNotSet) {
+		return false, err
+	}
+	if disable {
+		return false, fmt.Errorf("%s can not be combined with %s",
+			annotation.LBExposePrivateIP, annotation.LBDisablePrivateIngress)
+	}
+	return true, nil
 }
 
 func (l *loadBalancers) getDisablePrivateIngress(svc *corev1.Service) (bool, error) {
@@ -247,6 +690,34 @@ func (l *loadBalancers) getDisablePrivateIngress(svc *corev1.Service) (bool, err
 	return false, err
 }
 
+// getDisableIPv4 returns whether the public IPv4 address of the Load Balancer
+// should not be reported. An error is returned if both IPv4 and IPv6 are
+// disabled while the public network is enabled, as the Load Balancer would not
+// have any public ingress.
+func (l *loadBalancers) getDisableIPv4(svc *corev1.Service) (bool, error) {
+	disable, err := annotation.LBIPv4Disabled.BoolFromService(svc)
+	if errors.Is(err, annotation.ErrNotSet) {
+		return false, nil
+	}
+	if err != nil || !disable {
+		return false, err
+	}
+
+	disablePubNet, err := annotation.LBDisablePublicNetwork.BoolFromService(svc)
+	if err != nil && !errors.Is(err, annotation.ErrNotSet) {
+		return false, err
+	}
+	disableIPv6, err := l.getDisableIPv6(svc)
+	if err != nil {
+		return false, err
+	}
+	if disableIPv6 && !disablePubNet {
+		return false, fmt.Errorf("%s can not be combined with disabled IPv6, use %s instead",
+			annotation.LBIPv4Disabled, annotation.LBDisablePublicNetwork)
+	}
+	return true, nil
+}
+
 func (l *loadBalancers) getDisableIPv6(svc *corev1.Service) (bool, error) {
 	disable, err := annotation.LBIPv6Disabled.BoolFromService(svc)
 	if err == nil {
@@ -260,51 +731,118 @@ func (l *loadBalancers) getDisableIPv6(svc *corev1.Service) (bool, error) {
 
 func (l *loadBalancers) UpdateLoadBalancer(
 	ctx context.Context, clusterName string, svc *corev1.Service, nodes []*corev1.Node,
+) error {
+	ctx, span := tracing.Start(ctx, "hcloud/loadBalancers.UpdateLoadBalancer", tracing.Service(svc)...)
+	err := l.updateLoadBalancer(ctx, clusterName, svc, nodes)
+	tracing.End(span, err)
+	return err
+}
+
+func (l *loadBalancers) updateLoadBalancer(
+	ctx context.Context, clusterName string, svc *corev1.Service, nodes []*corev1.Node,
 ) error {
 	const op = "hcloud/loadBalancers.UpdateLoadBalancer"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
+	if !l.isResponsible(svc) {
+		klog.V(4).InfoS("ignore service of other load balancer class", "op", op, "service", klog.KObj(svc), "class", *svc.Spec.LoadBalancerClass)
+		return nil
+	}
+	if !l.inNamespaces(svc) {
+		klog.V(4).InfoS("ignore service in other namespace", "op", op, "service", klog.KObj(svc))
+		return cloudprovider.ImplementedElsewhere
+	}
+	if l.maintenance {
+		klog.InfoS("maintenance mode, skip updating Load Balancer", "op", op, "service", klog.KObj(svc))
+		return nil
+	}
+
 	var (
 		lb            *hcloud.LoadBalancer
 		err           error
 		selectedNodes []*corev1.Node
 	)
 
+	svc, err = applyLBProfile(l.profiles, svc)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	svc, err = applyLBSessionMode(svc)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	nodes = l.cordoned.filter(nodes)
+	if l.updates.isApplied(svc, nodes) {
+		klog.InfoS("skip update of Load Balancer, desired state was just applied", "op", op, "service", svc.Name)
+		return nil
+	}
+
 	selectedNodes, err = matchNodeSelector(svc, nodes)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	selectedNodes, err = matchTargetZones(svc, selectedNodes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	selectedNodes, err = applyTargetWeights(svc, selectedNodes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	nodeNames := make([]string, len(selectedNodes))
 	for i, n := range selectedNodes {
 		nodeNames[i] = n.Name
 	}
 	klog.InfoS("update Load Balancer", "op", op, "service", svc.Name, "nodes", nodeNames)
 
-	lb, err = l.lbOps.GetByK8SServiceUID(ctx, svc)
-	if errors.Is(err, hcops.ErrNotFound) {
-		lbName := l.GetLoadBalancerName(ctx, clusterName, svc)
+	pinnedID, err := pinnedLBID(svc)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-		lb, err = l.lbOps.GetByName(ctx, lbName)
+	lb, err = l.lbOps.GetByK8SServiceUID(ctx, svc)
+	switch {
+	case pinnedID != 0 && err == nil:
+		lb, err = l.getPinned(ctx, pinnedID, lb, svc)
+	case pinnedID != 0 && errors.Is(err, hcops.ErrNotFound):
+		lb, err = l.getPinned(ctx, pinnedID, nil, svc)
+	case errors.Is(err, hcops.ErrNotFound):
+		lb, err = l.getByName(ctx, clusterName, svc)
 		if errors.Is(err, hcops.ErrNotFound) {
 			return nil
 		}
+		if err == nil {
+			_, err = l.lbOps.RestoreLabels(ctx, lb, svc)
+		}
 		// further error types handled below
 	}
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	l.logLBDiff(lb, svc, selectedNodes)
 	if _, err = l.lbOps.ReconcileHCLB(ctx, lb, svc); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if _, err = l.lbOps.ReconcileHCLBTargets(ctx, lb, svc, selectedNodes); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	// Targets of locked servers are skipped. The update is not recorded, so
+	// that the next pass retries them.
+	_, targetsErr := l.lbOps.ReconcileHCLBTargets(ctx, lb, svc, selectedNodes)
+	if targetsErr != nil && !errors.Is(targetsErr, hcops.ErrTargetsLocked) {
+		return fmt.Errorf("%s: %w", op, targetsErr)
 	}
 	if _, err = l.lbOps.ReconcileHCLBServices(ctx, lb, svc); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	if targetsErr != nil {
+		return fmt.Errorf("%s: %w", op, targetsErr)
+	}
+	l.updateNodeMembership(ctx, lb, nodes, selectedNodes)
+	l.updates.record(svc, nodes)
 	return nil
 }
 
@@ -312,6 +850,22 @@ func (l *loadBalancers) EnsureLoadBalancerDeleted(ctx context.Context, _ string,
 	const op = "hcloud/loadBalancers.EnsureLoadBalancerDeleted"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
+	if !l.isResponsible(service) {
+		klog.V(4).InfoS("ignore service of other load balancer class", "op", op, "service", klog.KObj(service), "class", *service.Spec.LoadBalancerClass)
+		return nil
+	}
+	if !l.inNamespaces(service) {
+		klog.V(4).InfoS("ignore service in other namespace", "op", op, "service", klog.KObj(service))
+		return cloudprovider.ImplementedElsewhere
+	}
+	if l.maintenance {
+		klog.InfoS("maintenance mode, skip deleting Load Balancer", "op", op, "service", klog.KObj(service))
+		return fmt.Errorf("%s: %w", op, errMaintenanceMode)
+	}
+
+	l.updates.forget(service)
+	l.targetHealth.forget(service)
+
 	loadBalancer, err := l.lbOps.GetByK8SServiceUID(ctx, service)
 	if errors.Is(err, hcops.ErrNotFound) {
 		return nil
@@ -321,18 +875,69 @@ func (l *loadBalancers) EnsureLoadBalancerDeleted(ctx context.Context, _ string,
 	}
 
 	if loadBalancer.Protection.Delete {
-		klog.InfoS("ignored: load balancer deletion protected", "op", op, "loadBalancerID", loadBalancer.ID)
-		return nil
+		klog.Warningf("%s: not deleting Load Balancer %d: delete protection is enabled, "+
+			"remove it in the Hetzner Cloud API to delete the Load Balancer", op, loadBalancer.ID)
+		return fmt.Errorf("%s: Load Balancer %d: %w", op, loadBalancer.ID, errLBDeleteProtected)
 	}
 
 	klog.InfoS("delete Load Balancer", "op", op, "loadBalancerID", loadBalancer.ID)
-	err = l.lbOps.Delete(ctx, loadBalancer)
-	if errors.Is(err, hcops.ErrNotFound) {
-		return nil
-	}
-	if err != nil {
+	if err := l.deleteWithRetry(ctx, loadBalancer); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	if err := l.nodeMembership.remove(ctx, loadBalancer.Name); err != nil {
+		klog.ErrorS(err, "failed to remove load balancer from node annotations", "op", op, "loadBalancerID", loadBalancer.ID)
+	}
 
 	return nil
 }
+
+// lbDiffer computes the differences between a Load Balancer and the state
+// desired by its Service. It is implemented by *hcops.LoadBalancerOps.
+type lbDiffer interface {
+	Diff(lb *hcloud.LoadBalancer, svc *corev1.Service, nodes []*corev1.Node) (*hcops.LoadBalancerDiff, error)
+}
+
+// logLBDiff logs the differences between lb and the state desired by svc and
+// nodes, if enabled by HCLOUD_DEBUG.
+func (l *loadBalancers) logLBDiff(lb *hcloud.LoadBalancer, svc *corev1.Service, nodes []*corev1.Node) {
+	const op = "hcloud/loadBalancers.logLBDiff"
+
+	differ, ok := l.lbOps.(lbDiffer)
+	if !l.logDiff || !ok {
+		return
+	}
+	diff, err := differ.Diff(lb, svc, nodes)
+	if err != nil {
+		klog.ErrorS(err, "compute Load Balancer diff", "op", op, "service", klog.KObj(svc), "loadBalancerID", lb.ID)
+		return
+	}
+	klog.V(4).InfoS("Load Balancer diff", "op", op, "service", klog.KObj(svc), "loadBalancerID", lb.ID, "diff", diff.String())
+}
+
+// deleteWithRetry deletes lb and retries with an exponential backoff on
+// transient errors, e.g. if the Load Balancer is locked by another action. A
+// Load Balancer which does not exist anymore counts as deleted.
+func (l *loadBalancers) deleteWithRetry(ctx context.Context, lb *hcloud.LoadBalancer) error {
+	const op = "hcloud/loadBalancers.deleteWithRetry"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	delay := l.deleteRetryDelay
+	for retry := 0; ; retry++ {
+		err := l.lbOps.Delete(ctx, lb)
+		if err == nil || errors.Is(err, hcops.ErrNotFound) {
+			return nil
+		}
+		if retry >= l.deleteRetries || !hcops.IsRetriable(err) {
+			return err
+		}
+
+		klog.InfoS("retry due to transient error",
+			"op", op, "loadBalancerID", lb.ID, "delay", fmt.Sprintf("%v", delay), "err", fmt.Sprintf("%v", err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -2,16 +2,29 @@ package hcloud
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
 )
 
 func newNodeSelectorNode(name string, labels map[string]string) *corev1.Node {
@@ -54,6 +67,36 @@ func TestLoadBalancers_GetLoadBalancer(t *testing.T) {
 				assert.Equal(t, tt.LB.PublicNet.IPv4.IP.String(), status.Ingress[0].IP)
 			},
 		},
+		{
+			Name:       "get load balancer without host name IPv4 disabled",
+			ServiceUID: "1",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBIPv4Disabled: true,
+			},
+			LB: &hcloud.LoadBalancer{
+				ID:   1,
+				Name: "no-host-name",
+				PublicNet: hcloud.LoadBalancerPublicNet{
+					IPv4: hcloud.LoadBalancerPublicNetIPv4{IP: net.ParseIP("1.2.3.4")},
+					IPv6: hcloud.LoadBalancerPublicNetIPv6{IP: net.ParseIP("fe80::1")},
+				},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.
+					On("GetByK8SServiceUID", tt.Ctx, tt.Service).
+					Return(tt.LB, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				status, exists, err := tt.LoadBalancers.GetLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service)
+				assert.NoError(t, err)
+				assert.True(t, exists)
+
+				if !assert.Len(t, status.Ingress, 1) {
+					return
+				}
+				assert.Equal(t, tt.LB.PublicNet.IPv6.IP.String(), status.Ingress[0].IP)
+			},
+		},
 		{
 			Name:       "get load balancer without host name",
 			ServiceUID: "1",
@@ -82,6 +125,32 @@ func TestLoadBalancers_GetLoadBalancer(t *testing.T) {
 				assert.Equal(t, tt.LB.PublicNet.IPv6.IP.String(), status.Ingress[1].IP)
 			},
 		},
+		{
+			Name:       "get load balancer with private ip exposed",
+			ServiceUID: "1",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBDisablePublicNetwork: true,
+				annotation.LBExposePrivateIP:      true,
+			},
+			LB: &hcloud.LoadBalancer{
+				ID:   1,
+				Name: "private-ip",
+				PrivateNet: []hcloud.LoadBalancerPrivateNet{
+					{Network: &hcloud.Network{ID: 4711}, IP: net.ParseIP("10.10.10.2")},
+				},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.
+					On("GetByK8SServiceUID", tt.Ctx, tt.Service).
+					Return(tt.LB, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				status, exists, err := tt.LoadBalancers.GetLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service)
+				assert.NoError(t, err)
+				assert.True(t, exists)
+				assert.Equal(t, []corev1.LoadBalancerIngress{{IP: "10.10.10.2"}}, status.Ingress)
+			},
+		},
 		{
 			Name:       "get load balancer with host name",
 			ServiceUID: "2",
@@ -203,6 +272,52 @@ func TestLoadBalancers_EnsureLoadBalancer_CreateLoadBalancer(t *testing.T) {
 				assert.Equal(t, expected, lbStat)
 			},
 		},
+		{
+			Name:       "public network only no ipv4",
+			ServiceUID: "2",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName:         "pub-net-only-no-ipv4",
+				annotation.LBIPv4Disabled: true,
+			},
+			LB: &hcloud.LoadBalancer{
+				ID:               1,
+				Name:             "pub-net-only-no-ipv4",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+				PublicNet: hcloud.LoadBalancerPublicNet{
+					Enabled: true,
+					IPv4:    hcloud.LoadBalancerPublicNetIPv4{IP: net.ParseIP("1.2.3.4")},
+					IPv6:    hcloud.LoadBalancerPublicNetIPv6{IP: net.ParseIP("fe80::1")},
+				},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				setupSuccessMocks(tt, "pub-net-only-no-ipv4")
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				expected := &corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{
+						{IP: tt.LB.PublicNet.IPv6.IP.String()},
+					},
+				}
+				lbStat, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, lbStat)
+			},
+		},
+		{
+			Name:       "fail if ipv4 and ipv6 are disabled",
+			ServiceUID: "2",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBIPv4Disabled: true,
+				annotation.LBIPv6Disabled: true,
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.EqualError(t, err, "hcloud/loadBalancers.EnsureLoadBalancer: "+
+					"load-balancer.hetzner.cloud/disable-ipv4 can not be combined with disabled IPv6, "+
+					"use load-balancer.hetzner.cloud/disable-public-network instead")
+			},
+		},
 		{
 			Name:       "public network only",
 			ServiceUID: "2",
@@ -364,6 +479,146 @@ func TestLoadBalancers_EnsureLoadBalancer_CreateLoadBalancer(t *testing.T) {
 				assert.Equal(t, expected, lbStat)
 			},
 		},
+		{
+			Name:       "enable private ingress via annotation despite default",
+			NetworkID:  4711,
+			ServiceUID: "5",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName:                  "with-priv-net-priv-ingress",
+				annotation.LBDisablePrivateIngress: false,
+			},
+			DisablePrivateIngressDefault: true,
+			LB: &hcloud.LoadBalancer{
+				ID:               1,
+				Name:             "with-priv-net-priv-ingress",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+				PublicNet: hcloud.LoadBalancerPublicNet{
+					Enabled: true,
+					IPv4:    hcloud.LoadBalancerPublicNetIPv4{IP: net.ParseIP("1.2.3.4")},
+					IPv6:    hcloud.LoadBalancerPublicNetIPv6{IP: net.ParseIP("fe80::1")},
+				},
+				PrivateNet: []hcloud.LoadBalancerPrivateNet{
+					{
+						Network: &hcloud.Network{
+							ID:   4711,
+							Name: "priv-net",
+						},
+						IP: net.ParseIP("10.10.10.2"),
+					},
+				},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				setupSuccessMocks(tt, "with-priv-net-priv-ingress")
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				expected := &corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{
+						{IP: tt.LB.PublicNet.IPv4.IP.String()},
+						{IP: tt.LB.PublicNet.IPv6.IP.String()},
+						{IP: tt.LB.PrivateNet[0].IP.String()},
+					},
+				}
+				lbStat, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, lbStat)
+			},
+		},
+		{
+			Name:       "expose private ip despite private ingress disabled by default",
+			NetworkID:  4711,
+			ServiceUID: "5",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName:                 "with-priv-net-expose-priv-ip",
+				annotation.LBDisablePublicNetwork: true,
+				annotation.LBExposePrivateIP:      true,
+			},
+			DisablePrivateIngressDefault: true,
+			LB: &hcloud.LoadBalancer{
+				ID:               1,
+				Name:             "with-priv-net-expose-priv-ip",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+				PrivateNet: []hcloud.LoadBalancerPrivateNet{
+					{
+						Network: &hcloud.Network{
+							ID:   4711,
+							Name: "priv-net",
+						},
+						IP: net.ParseIP("10.10.10.2"),
+					},
+				},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				setupSuccessMocks(tt, "with-priv-net-expose-priv-ip")
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				expected := &corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{
+						{IP: tt.LB.PrivateNet[0].IP.String()},
+					},
+				}
+				lbStat, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, lbStat)
+			},
+		},
+		{
+			Name:       "do not expose private ip",
+			NetworkID:  4711,
+			ServiceUID: "5",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName:            "with-priv-net-no-priv-ip",
+				annotation.LBExposePrivateIP: false,
+			},
+			LB: &hcloud.LoadBalancer{
+				ID:               1,
+				Name:             "with-priv-net-no-priv-ip",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+				PublicNet: hcloud.LoadBalancerPublicNet{
+					Enabled: true,
+					IPv4:    hcloud.LoadBalancerPublicNetIPv4{IP: net.ParseIP("1.2.3.4")},
+					IPv6:    hcloud.LoadBalancerPublicNetIPv6{IP: net.ParseIP("fe80::1")},
+				},
+				PrivateNet: []hcloud.LoadBalancerPrivateNet{
+					{
+						Network: &hcloud.Network{
+							ID:   4711,
+							Name: "priv-net",
+						},
+						IP: net.ParseIP("10.10.10.2"),
+					},
+				},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				setupSuccessMocks(tt, "with-priv-net-no-priv-ip")
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				expected := &corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{
+						{IP: tt.LB.PublicNet.IPv4.IP.String()},
+						{IP: tt.LB.PublicNet.IPv6.IP.String()},
+					},
+				}
+				lbStat, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, lbStat)
+			},
+		},
+		{
+			Name:       "expose private ip conflicts with disabled private ingress",
+			ServiceUID: "5",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBExposePrivateIP:       true,
+				annotation.LBDisablePrivateIngress: true,
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.EqualError(t, err, "hcloud/loadBalancers.EnsureLoadBalancer: "+
+					"load-balancer.hetzner.cloud/expose-private-ip can not be combined with load-balancer.hetzner.cloud/disable-private-ingress")
+			},
+		},
 		{
 			Name:       "attach Load Balancer to private network only",
 			NetworkID:  4711,
@@ -531,6 +786,7 @@ func TestLoadBalancer_EnsureLoadBalancer_UpdateLoadBalancer(t *testing.T) {
 			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
 				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(nil, hcops.ErrNotFound)
 				tt.LBOps.On("GetByName", tt.Ctx, "pre-existing-lb").Return(tt.LB, nil)
+				tt.LBOps.On("RestoreLabels", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
 				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
 				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(false, nil)
 				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(true, nil)
@@ -541,76 +797,721 @@ func TestLoadBalancer_EnsureLoadBalancer_UpdateLoadBalancer(t *testing.T) {
 				assert.NoError(t, err)
 			},
 		},
-	}
-
-	RunLoadBalancerTests(t, tests)
-}
-
-func TestLoadBalancer_UpdateLoadBalancer(t *testing.T) {
-	tests := []LoadBalancerTestCase{
 		{
-			Name:       "Load Balancer not found",
-			ServiceUID: "1",
+			Name:       "refuse load balancer found by name of other cluster",
+			ServiceUID: "5",
 			ServiceAnnotations: map[annotation.Name]interface{}{
-				annotation.LBName: "test-lb",
+				annotation.LBName: "pre-existing-lb",
+			},
+			LB: &hcloud.LoadBalancer{
+				ID:   5,
+				Name: "pre-existing-lb",
 			},
 			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
 				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(nil, hcops.ErrNotFound)
-				tt.LBOps.On("GetByName", tt.Ctx, "test-lb").Return(nil, hcops.ErrNotFound)
+				tt.LBOps.On("GetByName", tt.Ctx, "pre-existing-lb").Return(tt.LB, nil)
+				tt.LBOps.On("RestoreLabels", tt.Ctx, tt.LB, tt.Service).Return(false, hcops.ErrOwnedByOtherCluster)
 			},
 			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
-				err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
-				assert.NoError(t, err)
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.ErrorIs(t, err, hcops.ErrOwnedByOtherCluster)
+				tt.LBOps.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
+				tt.LBOps.AssertNotCalled(t, "ReconcileHCLB", mock.Anything, mock.Anything, mock.Anything)
 			},
 		},
 		{
-			Name:       "calls all reconcilement ops",
-			ServiceUID: "2",
+			Name:       "adopt load balancer pinned by id",
+			ServiceUID: "5",
 			ServiceAnnotations: map[annotation.Name]interface{}{
-				annotation.LBName: "test-lb",
+				annotation.LBID: 4711,
 			},
 			LB: &hcloud.LoadBalancer{
-				ID:               1,
+				ID:               4711,
+				Name:             "pre-existing-lb",
 				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
 				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
 			},
 			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
-				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(tt.LB, nil)
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(nil, hcops.ErrNotFound)
+				tt.LBOps.On("GetForAdoption", tt.Ctx, int64(4711), tt.Service).Return(tt.LB, nil)
+				tt.LBOps.On("RestoreLabels", tt.Ctx, tt.LB, tt.Service).Return(true, nil)
 				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
 				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(false, nil)
-				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(true, nil)
+				tt.LBOps.On("GetByID", tt.Ctx, tt.LB.ID).Times(1).Return(tt.LB, nil)
 			},
 			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
-				err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
 				assert.NoError(t, err)
+				tt.LBOps.AssertNotCalled(t, "GetByName", mock.Anything, mock.Anything)
+				tt.LBOps.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
 			},
 		},
 		{
-			Name:       "fall back to load balancer name",
-			ServiceUID: "3",
+			Name:       "refuse pinned load balancer of other service",
+			ServiceUID: "5",
 			ServiceAnnotations: map[annotation.Name]interface{}{
-				annotation.LBName: "previously-created-lb",
-			},
-			LB: &hcloud.LoadBalancer{
-				ID:               3,
-				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
-				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+				annotation.LBID: 4711,
 			},
 			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
 				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(nil, hcops.ErrNotFound)
-				tt.LBOps.On("GetByName", tt.Ctx, "previously-created-lb").Return(tt.LB, nil)
-				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
-				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(false, nil)
-				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("GetForAdoption", tt.Ctx, int64(4711), tt.Service).Return(nil, hcops.ErrOwnedByOtherService)
 			},
 			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
-				err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
-				assert.NoError(t, err)
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.ErrorIs(t, err, hcops.ErrOwnedByOtherService)
+				tt.LBOps.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
+				tt.LBOps.AssertNotCalled(t, "ReconcileHCLB", mock.Anything, mock.Anything, mock.Anything)
 			},
 		},
-	}
-
-	RunLoadBalancerTests(t, tests)
+		{
+			Name:       "refuse pinned id differing from labeled load balancer",
+			ServiceUID: "5",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBID: 4711,
+			},
+			LB: &hcloud.LoadBalancer{ID: 5},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(tt.LB, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.ErrorIs(t, err, hcops.ErrOwnedByOtherService)
+				tt.LBOps.AssertNotCalled(t, "GetForAdoption", mock.Anything, mock.Anything, mock.Anything)
+				tt.LBOps.AssertNotCalled(t, "ReconcileHCLB", mock.Anything, mock.Anything, mock.Anything)
+			},
+		},
+		{
+			Name:       "report target health",
+			ServiceUID: "6",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "test-lb",
+			},
+			ReportTargetHealth: true,
+			LB: &hcloud.LoadBalancer{
+				ID:               6,
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+				Targets: []hcloud.LoadBalancerTarget{
+					{
+						HealthStatus: []hcloud.LoadBalancerTargetHealthStatus{
+							{ListenPort: 80, Status: hcloud.LoadBalancerTargetHealthStatusStatusHealthy},
+							{ListenPort: 443, Status: hcloud.LoadBalancerTargetHealthStatusStatusHealthy},
+						},
+					},
+					{
+						HealthStatus: []hcloud.LoadBalancerTargetHealthStatus{
+							{ListenPort: 80, Status: hcloud.LoadBalancerTargetHealthStatusStatusHealthy},
+							{ListenPort: 443, Status: hcloud.LoadBalancerTargetHealthStatusStatusUnhealthy},
+						},
+					},
+					{
+						HealthStatus: []hcloud.LoadBalancerTargetHealthStatus{
+							{ListenPort: 80, Status: hcloud.LoadBalancerTargetHealthStatusStatusUnknown},
+						},
+					},
+				},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(tt.LB, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.Service.Name = "web"
+				tt.Service.Namespace = "default"
+				client := fake.NewSimpleClientset(tt.Service.DeepCopy())
+				tt.LoadBalancers.targetHealth.setClient(client)
+				patches := func() int {
+					n := 0
+					for _, a := range client.Actions() {
+						if a.GetVerb() == "patch" {
+							n++
+						}
+					}
+					return n
+				}
+
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				svc, err := client.CoreV1().Services("default").Get(tt.Ctx, "web", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, "1", svc.Annotations[string(annotation.LBTargetsHealthy)])
+				assert.Equal(t, "1", svc.Annotations[string(annotation.LBTargetsUnhealthy)])
+				assert.Equal(t, 1, patches())
+
+				// Unchanged numbers do not patch the Service again. The
+				// annotations set by the previous reconcile are not passed.
+				tt.Service.Annotations = map[string]string{string(annotation.LBName): "test-lb"}
+				_, err = tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, patches())
+
+				tt.LB.Targets[1].HealthStatus[1].Status = hcloud.LoadBalancerTargetHealthStatusStatusHealthy
+				tt.Service.Annotations = map[string]string{string(annotation.LBName): "test-lb"}
+				_, err = tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				svc, err = client.CoreV1().Services("default").Get(tt.Ctx, "web", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, "2", svc.Annotations[string(annotation.LBTargetsHealthy)])
+				assert.Equal(t, "0", svc.Annotations[string(annotation.LBTargetsUnhealthy)])
+				assert.Equal(t, 2, patches())
+			},
+		},
+	}
+
+	RunLoadBalancerTests(t, tests)
+}
+
+func TestLoadBalancer_EnsureLoadBalancer_ValidateAnnotations(t *testing.T) {
+	tests := []LoadBalancerTestCase{
+		{
+			Name:       "warn about unknown annotation",
+			ServiceUID: "1",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "test-lb",
+				"load-balancer.hetzner.cloud/health-check-intervall": "5s",
+			},
+			LB: &hcloud.LoadBalancer{
+				ID:               1,
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(tt.LB, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				recorder := record.NewFakeRecorder(10)
+				tt.LoadBalancers.recorder = recorder
+
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				if assert.Len(t, recorder.Events, 1) {
+					assert.Equal(t,
+						"Warning UnknownAnnotation Unknown annotation load-balancer.hetzner.cloud/health-check-intervall is ignored, check it for typos",
+						<-recorder.Events)
+				}
+			},
+		},
+		{
+			Name:       "reject invalid value",
+			ServiceUID: "2",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName:                   "test-lb",
+				annotation.LBSvcHealthCheckInterval: "5 seconds",
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.ErrorContains(t, err, `load-balancer.hetzner.cloud/health-check-interval: invalid value "5 seconds"`)
+			},
+		},
+	}
+
+	RunLoadBalancerTests(t, tests)
+}
+
+func TestLoadBalancers_EnsureLoadBalancer_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer tracing.SetTracerProvider(nil)
+
+	lb := &hcloud.LoadBalancer{
+		ID:               1,
+		LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+		Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+	}
+	tests := []LoadBalancerTestCase{
+		{
+			Name:       "trace reconcile",
+			ServiceUID: "1",
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.Service.Namespace = "default"
+				tt.Service.Name = "web"
+
+				// The context carries the span.
+				tt.LBOps.On("GetByK8SServiceUID", mock.Anything, tt.Service).Return(lb, nil)
+				tt.LBOps.On("ReconcileHCLB", mock.Anything, lb, tt.Service).Return(false, errors.New("test error"))
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.Error(t, err)
+
+				spans := exporter.GetSpans()
+				if assert.Len(t, spans, 1) {
+					span := spans[0]
+					assert.Equal(t, "hcloud/loadBalancers.EnsureLoadBalancer", span.Name)
+					assert.Contains(t, span.Attributes, attribute.String("k8s.namespace.name", "default"))
+					assert.Contains(t, span.Attributes, attribute.String("k8s.service.name", "web"))
+					assert.Equal(t, codes.Error, span.Status.Code)
+				}
+			},
+		},
+	}
+
+	RunLoadBalancerTests(t, tests)
+}
+
+func TestLoadBalancers_LoadBalancerClass(t *testing.T) {
+	lb := &hcloud.LoadBalancer{
+		ID:               1,
+		LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+		Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+	}
+	reconcile := func(t *testing.T, tt *LoadBalancerTestCase) {
+		tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(lb, nil)
+		tt.LBOps.On("ReconcileHCLB", tt.Ctx, lb, tt.Service).Return(false, nil)
+		tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, lb, tt.Service, tt.Nodes).Return(false, nil)
+		tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, lb, tt.Service).Return(false, nil)
+	}
+	tests := []LoadBalancerTestCase{
+		{
+			Name:       "manage service without class",
+			ServiceUID: "1",
+			Mock:       reconcile,
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.loadBalancerClass = "hcloud"
+
+				status, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.NotNil(t, status)
+			},
+		},
+		{
+			Name:       "manage service with matching class",
+			ServiceUID: "2",
+			Mock:       reconcile,
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.loadBalancerClass = "hcloud"
+				tt.Service.Spec.LoadBalancerClass = hcloud.Ptr("hcloud")
+
+				status, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.NotNil(t, status)
+			},
+		},
+		{
+			Name:       "ignore service with other class",
+			ServiceUID: "3",
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.loadBalancerClass = "hcloud"
+				tt.Service.Spec.LoadBalancerClass = hcloud.Ptr("other")
+
+				status, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.Nil(t, status)
+				assert.NoError(t, tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes))
+				assert.NoError(t, tt.LoadBalancers.EnsureLoadBalancerDeleted(tt.Ctx, tt.ClusterName, tt.Service))
+			},
+		},
+		{
+			Name:       "ignore service with class if none is configured",
+			ServiceUID: "4",
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.Service.Spec.LoadBalancerClass = hcloud.Ptr("hcloud")
+
+				status, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.Nil(t, status)
+			},
+		},
+	}
+
+	RunLoadBalancerTests(t, tests)
+}
+
+func TestLoadBalancers_Namespaces(t *testing.T) {
+	lb := &hcloud.LoadBalancer{
+		ID:               1,
+		LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+		Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+	}
+	tests := []LoadBalancerTestCase{
+		{
+			Name:       "manage service in configured namespace",
+			ServiceUID: "1",
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(lb, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, lb, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, lb, tt.Service, tt.Nodes).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, lb, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.namespaces = map[string]bool{"team-a": true, "team-b": true}
+				tt.Service.Namespace = "team-b"
+
+				status, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				assert.NotNil(t, status)
+			},
+		},
+		{
+			Name:       "ignore service in other namespace",
+			ServiceUID: "2",
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.namespaces = map[string]bool{"team-a": true}
+				tt.Service.Namespace = "team-c"
+
+				status, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.Equal(t, cloudprovider.ImplementedElsewhere, err)
+				assert.Nil(t, status)
+				err = tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.Equal(t, cloudprovider.ImplementedElsewhere, err)
+				err = tt.LoadBalancers.EnsureLoadBalancerDeleted(tt.Ctx, tt.ClusterName, tt.Service)
+				assert.Equal(t, cloudprovider.ImplementedElsewhere, err)
+			},
+		},
+	}
+
+	RunLoadBalancerTests(t, tests)
+}
+
+func TestLoadBalancers_ServiceWithoutPorts(t *testing.T) {
+	tests := []LoadBalancerTestCase{
+		{
+			Name:       "fail service without ports",
+			ServiceUID: "1",
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				recorder := record.NewFakeRecorder(10)
+				tt.LoadBalancers.recorder = recorder
+				tt.Service.Spec.Ports = nil
+
+				status, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.ErrorIs(t, err, errServiceWithoutPorts)
+				assert.Nil(t, status)
+				if assert.Len(t, recorder.Events, 1) {
+					assert.Equal(t, "Warning ServiceWithoutPorts Load Balancer not created: the Service has no ports", <-recorder.Events)
+				}
+			},
+		},
+		{
+			Name:       "skip service without ports",
+			ServiceUID: "2",
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.skipServicesWithoutPorts = true
+				tt.Service.Spec.Ports = nil
+
+				status, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.Equal(t, cloudprovider.ImplementedElsewhere, err)
+				assert.Nil(t, status)
+			},
+		},
+	}
+
+	RunLoadBalancerTests(t, tests)
+}
+
+func TestLoadBalancers_MaintenanceMode(t *testing.T) {
+	lb := &hcloud.LoadBalancer{
+		ID:               1,
+		LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+		Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+		PublicNet: hcloud.LoadBalancerPublicNet{
+			Enabled: true,
+			IPv4:    hcloud.LoadBalancerPublicNetIPv4{IP: net.ParseIP("1.2.3.4")},
+		},
+	}
+	tests := []LoadBalancerTestCase{
+		{
+			Name:       "report status of existing load balancer",
+			ServiceUID: "1",
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(lb, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.maintenance = true
+
+				status, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				if assert.NotNil(t, status) {
+					assert.Equal(t, "1.2.3.4", status.Ingress[0].IP)
+				}
+				assert.NoError(t, tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes))
+			},
+		},
+		{
+			Name:       "do not create load balancer",
+			ServiceUID: "2",
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(nil, hcops.ErrNotFound)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.maintenance = true
+
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.ErrorIs(t, err, errMaintenanceMode)
+			},
+		},
+		{
+			Name:       "do not delete load balancer",
+			ServiceUID: "3",
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.maintenance = true
+
+				err := tt.LoadBalancers.EnsureLoadBalancerDeleted(tt.Ctx, tt.ClusterName, tt.Service)
+				assert.ErrorIs(t, err, errMaintenanceMode)
+			},
+		},
+	}
+
+	RunLoadBalancerTests(t, tests)
+}
+
+func TestLoadBalancers_ClusterName(t *testing.T) {
+	lb := &hcloud.LoadBalancer{
+		ID:               1,
+		LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+		Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+	}
+	tests := []LoadBalancerTestCase{
+		{
+			Name:       "prefix generated name",
+			ServiceUID: "1",
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.clusterName = "prod"
+				assert.Equal(t, "prod-a1", tt.LoadBalancers.GetLoadBalancerName(tt.Ctx, tt.ClusterName, tt.Service))
+			},
+		},
+		{
+			Name:       "truncate long generated name",
+			ServiceUID: "0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d",
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.clusterName = strings.Repeat("c", 40)
+				name := tt.LoadBalancers.GetLoadBalancerName(tt.Ctx, tt.ClusterName, tt.Service)
+				assert.Len(t, name, hcops.DefaultMaxLBNameLength)
+				assert.True(t, strings.HasPrefix(name, strings.Repeat("c", 40)+"-a0a1b2c3d4e5"), name)
+				assert.Equal(t, name, tt.LoadBalancers.GetLoadBalancerName(tt.Ctx, tt.ClusterName, tt.Service))
+
+				tt.LoadBalancers.maxNameLength = 20
+				assert.Len(t, tt.LoadBalancers.GetLoadBalancerName(tt.Ctx, tt.ClusterName, tt.Service), 20)
+			},
+		},
+		{
+			Name:       "keep name from annotation",
+			ServiceUID: "1",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "test-lb",
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.clusterName = "prod"
+				assert.Equal(t, "test-lb", tt.LoadBalancers.GetLoadBalancerName(tt.Ctx, tt.ClusterName, tt.Service))
+			},
+		},
+		{
+			Name:       "create with prefixed name",
+			ServiceUID: "1",
+			LB:         lb,
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(nil, hcops.ErrNotFound)
+				tt.LBOps.On("GetByName", tt.Ctx, "prod-a1").Return(nil, hcops.ErrNotFound)
+				tt.LBOps.On("GetByName", tt.Ctx, "a1").Return(nil, hcops.ErrNotFound)
+				tt.LBOps.On("Create", tt.Ctx, "prod-a1", tt.Service).Return(tt.LB, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.clusterName = "prod"
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:       "adopt Load Balancer with name without prefix",
+			ServiceUID: "1",
+			LB:         lb,
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(nil, hcops.ErrNotFound)
+				tt.LBOps.On("GetByName", tt.Ctx, "prod-a1").Return(nil, hcops.ErrNotFound)
+				tt.LBOps.On("GetByName", tt.Ctx, "a1").Return(tt.LB, nil)
+				tt.LBOps.On("RestoreLabels", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.clusterName = "prod"
+				_, err := tt.LoadBalancers.EnsureLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				tt.LBOps.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
+			},
+		},
+	}
+
+	RunLoadBalancerTests(t, tests)
+}
+
+func TestLoadBalancer_UpdateLoadBalancer(t *testing.T) {
+	tests := []LoadBalancerTestCase{
+		{
+			Name:       "Load Balancer not found",
+			ServiceUID: "1",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "test-lb",
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(nil, hcops.ErrNotFound)
+				tt.LBOps.On("GetByName", tt.Ctx, "test-lb").Return(nil, hcops.ErrNotFound)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:       "calls all reconcilement ops",
+			ServiceUID: "2",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "test-lb",
+			},
+			LB: &hcloud.LoadBalancer{
+				ID:               1,
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(tt.LB, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:       "collapse repeated updates with unchanged state",
+			ServiceUID: "2",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "test-lb",
+			},
+			Nodes: []*corev1.Node{newNodeSelectorNode("node1", nil)},
+			LB: &hcloud.LoadBalancer{
+				ID:               1,
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(tt.LB, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, mock.Anything).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				for i := 0; i < 3; i++ {
+					err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+					assert.NoError(t, err)
+				}
+				tt.LBOps.AssertNumberOfCalls(t, "ReconcileHCLBTargets", 1)
+
+				// A changed set of nodes is always applied.
+				nodes := append(tt.Nodes, newNodeSelectorNode("node2", nil))
+				err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, nodes)
+				assert.NoError(t, err)
+				tt.LBOps.AssertNumberOfCalls(t, "ReconcileHCLBTargets", 2)
+
+				// As is the state after the window expired.
+				tt.LoadBalancers.updates.window = time.Nanosecond
+				err = tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, nodes)
+				assert.NoError(t, err)
+				tt.LBOps.AssertNumberOfCalls(t, "ReconcileHCLBTargets", 3)
+			},
+		},
+		{
+			Name:       "annotate target nodes",
+			ServiceUID: "2",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "test-lb",
+			},
+			Nodes: []*corev1.Node{newNodeSelectorNode("node1", nil)},
+			LB: &hcloud.LoadBalancer{
+				ID:               1,
+				Name:             "test-lb",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(tt.LB, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(true, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				client := fake.NewSimpleClientset(tt.Nodes[0])
+				tt.LoadBalancers.nodeMembership = newNodeLBMembership()
+				tt.LoadBalancers.nodeMembership.setClient(client)
+
+				err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+
+				node, err := client.CoreV1().Nodes().Get(tt.Ctx, "node1", metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, "test-lb", node.Annotations[nodeLBMembershipAnnotation])
+			},
+		},
+		{
+			Name:       "retry targets of locked servers",
+			ServiceUID: "2",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "test-lb",
+			},
+			Nodes: []*corev1.Node{newNodeSelectorNode("node1", nil)},
+			LB: &hcloud.LoadBalancer{
+				ID:               1,
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(tt.LB, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).
+					Return(true, fmt.Errorf("test: %w: node1", hcops.ErrTargetsLocked)).Once()
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(true, nil).Once()
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				// The services are reconciled despite the locked server.
+				err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.ErrorIs(t, err, hcops.ErrTargetsLocked)
+				tt.LBOps.AssertNumberOfCalls(t, "ReconcileHCLBServices", 1)
+
+				// The failed update is not deduplicated.
+				err = tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+				tt.LBOps.AssertNumberOfCalls(t, "ReconcileHCLBTargets", 2)
+			},
+		},
+		{
+			Name:       "fall back to load balancer name",
+			ServiceUID: "3",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "previously-created-lb",
+			},
+			LB: &hcloud.LoadBalancer{
+				ID:               3,
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1", NetworkZone: hcloud.NetworkZoneEUCentral},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.On("GetByK8SServiceUID", tt.Ctx, tt.Service).Return(nil, hcops.ErrNotFound)
+				tt.LBOps.On("GetByName", tt.Ctx, "previously-created-lb").Return(tt.LB, nil)
+				tt.LBOps.On("RestoreLabels", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLB", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBTargets", tt.Ctx, tt.LB, tt.Service, tt.Nodes).Return(false, nil)
+				tt.LBOps.On("ReconcileHCLBServices", tt.Ctx, tt.LB, tt.Service).Return(false, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				err := tt.LoadBalancers.UpdateLoadBalancer(tt.Ctx, tt.ClusterName, tt.Service, tt.Nodes)
+				assert.NoError(t, err)
+			},
+		},
+	}
+
+	RunLoadBalancerTests(t, tests)
 }
 
 func TestLoadBalancers_EnsureLoadBalancerDeleted(t *testing.T) {
@@ -668,6 +1569,77 @@ func TestLoadBalancers_EnsureLoadBalancerDeleted(t *testing.T) {
 				assert.NoError(t, err)
 			},
 		},
+		{
+			Name:       "retry deleting locked load balancer",
+			ServiceUID: "3",
+			LB: &hcloud.LoadBalancer{
+				ID:   3,
+				Name: "locked",
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.
+					On("GetByK8SServiceUID", tt.Ctx, tt.Service).
+					Return(tt.LB, nil)
+				tt.LBOps.
+					On("Delete", tt.Ctx, tt.LB).
+					Return(fmt.Errorf("hcops/LoadBalancerOps.Delete: %w", hcloud.Error{Code: hcloud.ErrorCodeLocked})).
+					Twice()
+				tt.LBOps.
+					On("Delete", tt.Ctx, tt.LB).
+					Return(hcops.ErrNotFound).
+					Once()
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.deleteRetryDelay = time.Millisecond
+				err := tt.LoadBalancers.EnsureLoadBalancerDeleted(tt.Ctx, tt.ClusterName, tt.Service)
+				assert.NoError(t, err)
+				tt.LBOps.AssertNumberOfCalls(t, "Delete", 3)
+			},
+		},
+		{
+			Name:       "give up deleting locked load balancer",
+			ServiceUID: "3",
+			LB: &hcloud.LoadBalancer{
+				ID:   3,
+				Name: "locked",
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.
+					On("GetByK8SServiceUID", tt.Ctx, tt.Service).
+					Return(tt.LB, nil)
+				tt.LBOps.
+					On("Delete", tt.Ctx, tt.LB).
+					Return(hcloud.Error{Code: hcloud.ErrorCodeLocked, Message: "locked"})
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LoadBalancers.deleteRetries = 2
+				tt.LoadBalancers.deleteRetryDelay = time.Millisecond
+				err := tt.LoadBalancers.EnsureLoadBalancerDeleted(tt.Ctx, tt.ClusterName, tt.Service)
+				assert.EqualError(t, err, "hcloud/loadBalancers.EnsureLoadBalancerDeleted: locked (locked)")
+				tt.LBOps.AssertNumberOfCalls(t, "Delete", 3)
+			},
+		},
+		{
+			Name:       "do not retry other errors",
+			ServiceUID: "3",
+			LB: &hcloud.LoadBalancer{
+				ID:   3,
+				Name: "broken",
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.
+					On("GetByK8SServiceUID", tt.Ctx, tt.Service).
+					Return(tt.LB, nil)
+				tt.LBOps.
+					On("Delete", tt.Ctx, tt.LB).
+					Return(errors.New("delete failed"))
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				err := tt.LoadBalancers.EnsureLoadBalancerDeleted(tt.Ctx, tt.ClusterName, tt.Service)
+				assert.EqualError(t, err, "hcloud/loadBalancers.EnsureLoadBalancerDeleted: delete failed")
+				tt.LBOps.AssertNumberOfCalls(t, "Delete", 1)
+			},
+		},
 		{
 			Name:       "delete protected load balancer",
 			ServiceUID: "4",
@@ -683,7 +1655,30 @@ func TestLoadBalancers_EnsureLoadBalancerDeleted(t *testing.T) {
 			},
 			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
 				err := tt.LoadBalancers.EnsureLoadBalancerDeleted(tt.Ctx, tt.ClusterName, tt.Service)
-				assert.NoError(t, err)
+				assert.ErrorIs(t, err, errLBDeleteProtected)
+				tt.LBOps.AssertNotCalled(t, "Delete", tt.Ctx, tt.LB)
+			},
+		},
+		{
+			Name:       "delete load balancer protected via annotation",
+			ServiceUID: "4",
+			ServiceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBDeletionProtection: true,
+			},
+			LB: &hcloud.LoadBalancer{
+				ID:         4,
+				Name:       "deletion protection annotation",
+				Protection: hcloud.LoadBalancerProtection{Delete: true},
+			},
+			Mock: func(t *testing.T, tt *LoadBalancerTestCase) {
+				tt.LBOps.
+					On("GetByK8SServiceUID", tt.Ctx, tt.Service).
+					Return(tt.LB, nil)
+			},
+			Perform: func(t *testing.T, tt *LoadBalancerTestCase) {
+				err := tt.LoadBalancers.EnsureLoadBalancerDeleted(tt.Ctx, tt.ClusterName, tt.Service)
+				assert.ErrorIs(t, err, errLBDeleteProtected)
+				tt.LBOps.AssertNotCalled(t, "Delete", tt.Ctx, tt.LB)
 			},
 		},
 		{
@@ -831,3 +1826,138 @@ func TestLoadBalancer_matchNodeSelector(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadBalancer_matchTargetZones(t *testing.T) {
+	zone := func(name, zone string) *corev1.Node {
+		if zone == "" {
+			return newNodeSelectorNode(name, nil)
+		}
+		return newNodeSelectorNode(name, map[string]string{corev1.LabelTopologyZone: zone})
+	}
+	nodes := []*corev1.Node{
+		zone("node1", "fsn1-dc14"),
+		zone("node2", "nbg1-dc3"),
+		zone("node3", "hel1"),
+		zone("node4", ""),
+	}
+
+	cases := []struct {
+		name     string
+		zones    *string
+		expected []string
+		err      string
+	}{
+		{
+			name:     "annotation not set",
+			expected: []string{"node1", "node2", "node3", "node4"},
+		},
+		{
+			name:     "empty annotation",
+			zones:    hcloud.Ptr(""),
+			expected: []string{"node1", "node2", "node3", "node4"},
+		},
+		{
+			name:     "locations",
+			zones:    hcloud.Ptr("fsn1, hel1"),
+			expected: []string{"node1", "node3"},
+		},
+		{
+			name:     "datacenter",
+			zones:    hcloud.Ptr("nbg1-dc3"),
+			expected: []string{"node2"},
+		},
+		{
+			name:  "no matching node",
+			zones: hcloud.Ptr("ash"),
+			err:   "hcloud/matchTargetZones: no node is in the zones ash",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if c.zones != nil {
+				svc.Annotations[string(annotation.LBTargetZones)] = *c.zones
+			}
+			selected, err := matchTargetZones(svc, nodes)
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, n := range selected {
+				names = append(names, n.Name)
+			}
+			assert.Equal(t, c.expected, names)
+		})
+	}
+}
+
+func TestLoadBalancer_applyTargetWeights(t *testing.T) {
+	cases := []struct {
+		name     string
+		service  *corev1.Service
+		k8sNodes []*corev1.Node
+		expected []*corev1.Node
+		err      string
+	}{
+		{
+			name:    "no weight label",
+			service: &corev1.Service{},
+			k8sNodes: []*corev1.Node{
+				newNodeSelectorNode("node1", map[string]string{"weight": "0"}),
+				newNodeSelectorNode("node2", nil),
+			},
+			expected: []*corev1.Node{
+				newNodeSelectorNode("node1", map[string]string{"weight": "0"}),
+				newNodeSelectorNode("node2", nil),
+			},
+		},
+		{
+			name: "nodes with weight 0 are excluded",
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						string(annotation.LBTargetWeightLabel): "weight",
+					},
+				},
+			},
+			k8sNodes: []*corev1.Node{
+				newNodeSelectorNode("node1", map[string]string{"weight": "0"}),
+				newNodeSelectorNode("node2", map[string]string{"weight": "3"}),
+				newNodeSelectorNode("node3", nil),
+			},
+			expected: []*corev1.Node{
+				newNodeSelectorNode("node2", map[string]string{"weight": "3"}),
+				newNodeSelectorNode("node3", nil),
+			},
+		},
+		{
+			name: "invalid weight",
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						string(annotation.LBTargetWeightLabel): "weight",
+					},
+				},
+			},
+			k8sNodes: []*corev1.Node{
+				newNodeSelectorNode("node1", map[string]string{"weight": "-1"}),
+			},
+			err: `hcloud/applyTargetWeights: node node1: invalid weight "-1" in label weight`,
+		},
+	}
+
+	for _, c := range cases {
+		c := c // prevent scopelint from complaining
+		t.Run(c.name, func(t *testing.T) {
+			nodes, err := applyTargetWeights(c.service, c.k8sNodes)
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, nodes)
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package hcloud
+
+import "errors"
+
+// errMaintenanceMode signals that a mutating operation was skipped, because
+// the cloud controller manager runs in maintenance mode. Operations which
+// must not be reported as done, e.g. creating a route, fail with it, so that
+// they are retried once the maintenance mode is disabled.
+var errMaintenanceMode = errors.New("maintenance mode, changes are paused")
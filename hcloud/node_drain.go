@@ -0,0 +1,239 @@
+package hcloud
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// nodeDrainFinalizer is added to the nodes which are targets of a Load
+// Balancer if draining is enabled. It is removed once the node has been
+// drained from all Load Balancers, or the drain timed out.
+const nodeDrainFinalizer = "load-balancer.hetzner.cloud/drain"
+
+// defaultNodeDrainTimeout is the maximum time a node deletion is blocked by
+// nodeDrainFinalizer if no other timeout is configured.
+const defaultNodeDrainTimeout = 2 * time.Minute
+
+// nodeTargetCheckInterval is the minimum time between two checks whether a
+// node without nodeDrainFinalizer became a target of a Load Balancer. Every
+// check lists all Load Balancers.
+const nodeTargetCheckInterval = time.Minute
+
+// nodeDrainer waits until the connections of a node are drained and removes
+// it from all Load Balancers afterwards.
+type nodeDrainer interface {
+	DrainNode(ctx context.Context, node *corev1.Node) error
+	IsNodeTarget(ctx context.Context, node *corev1.Node) (bool, error)
+}
+
+// nodeDrainController ensures nodes can only be deleted after they have
+// been removed from all Load Balancers.
+type nodeDrainController struct {
+	client  kubernetes.Interface
+	drainer nodeDrainer
+	timeout time.Duration
+
+	// maintenance skips draining, the finalizer of deleted nodes is removed
+	// without changing the Load Balancers and no finalizer is added.
+	maintenance bool
+
+	lister corelisters.NodeLister
+	queue  workqueue.RateLimitingInterface
+
+	// checked records when nodes without nodeDrainFinalizer were last found
+	// not to be a target of any Load Balancer.
+	mu      sync.Mutex
+	checked map[string]time.Time
+}
+
+func newNodeDrainController(client kubernetes.Interface, drainer nodeDrainer, timeout time.Duration) *nodeDrainController {
+	if timeout == 0 {
+		timeout = defaultNodeDrainTimeout
+	}
+	return &nodeDrainController{
+		client:  client,
+		drainer: drainer,
+		timeout: timeout,
+		queue:   workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		checked: make(map[string]time.Time),
+	}
+}
+
+func hasNodeDrainFinalizer(node *corev1.Node) bool {
+	for _, f := range node.Finalizers {
+		if f == nodeDrainFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// Run watches all nodes and processes them until ctx is done.
+func (c *nodeDrainController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	factory := informers.NewSharedInformerFactory(c.client, 5*time.Minute)
+	informer := factory.Core().V1().Nodes()
+	c.lister = informer.Lister()
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+	})
+	if err != nil {
+		klog.ErrorS(err, "failed to watch nodes for draining")
+		return
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return
+	}
+
+	// Draining blocks until the node is drained, use a few workers so that a
+	// single node does not delay the others.
+	for i := 0; i < 4; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+	<-ctx.Done()
+}
+
+func (c *nodeDrainController) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *nodeDrainController) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *nodeDrainController) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	node, err := c.lister.Get(key.(string))
+	if apierrors.IsNotFound(err) {
+		c.mu.Lock()
+		delete(c.checked, key.(string))
+		c.mu.Unlock()
+		c.queue.Forget(key)
+		return true
+	}
+	if err == nil {
+		err = c.syncNode(ctx, node.DeepCopy())
+	}
+	if err != nil {
+		klog.ErrorS(err, "failed to sync node drain finalizer", "node", key)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// syncNode adds nodeDrainFinalizer to nodes which are not deleted and are a
+// target of a Load Balancer. For deleted nodes it drains the node and
+// removes the finalizer afterwards. If draining does not succeed within the
+// timeout, counted from the deletion of the node, the finalizer is removed
+// anyway. In maintenance mode the finalizer is removed without draining.
+func (c *nodeDrainController) syncNode(ctx context.Context, node *corev1.Node) error {
+	const op = "hcloud/nodeDrainController.syncNode"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if node.DeletionTimestamp == nil {
+		if c.maintenance || hasNodeDrainFinalizer(node) || !c.dueForTargetCheck(node.Name) {
+			return nil
+		}
+		isTarget, err := c.drainer.IsNodeTarget(ctx, node)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if !isTarget {
+			c.mu.Lock()
+			c.checked[node.Name] = time.Now()
+			c.mu.Unlock()
+			return nil
+		}
+		node.Finalizers = append(node.Finalizers, nodeDrainFinalizer)
+		if _, err := c.client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("%s: add finalizer: %w", op, err)
+		}
+		return nil
+	}
+	c.mu.Lock()
+	delete(c.checked, node.Name)
+	c.mu.Unlock()
+	if !hasNodeDrainFinalizer(node) {
+		return nil
+	}
+
+	if c.maintenance {
+		klog.InfoS("maintenance mode, removing finalizer without draining node", "op", op, "node", node.Name)
+	} else if err := c.drainNode(ctx, node); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	finalizers := node.Finalizers[:0]
+	for _, f := range node.Finalizers {
+		if f != nodeDrainFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	node.Finalizers = finalizers
+	if _, err := c.client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("%s: remove finalizer: %w", op, err)
+	}
+	return nil
+}
+
+// drainNode drains node from all Load Balancers. It returns nil if draining
+// does not succeed within the timeout, counted from the deletion of the node.
+func (c *nodeDrainController) drainNode(ctx context.Context, node *corev1.Node) error {
+	const op = "hcloud/nodeDrainController.drainNode"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	deadline := node.DeletionTimestamp.Add(c.timeout)
+	drainCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	if err := c.drainer.DrainNode(drainCtx, node); err != nil {
+		if time.Now().Before(deadline) {
+			return err
+		}
+		klog.InfoS("draining node timed out, removing finalizer", "op", op, "node", node.Name, "err", err)
+	}
+	return nil
+}
+
+// dueForTargetCheck reports whether the node nodeName was not checked within
+// the nodeTargetCheckInterval.
+func (c *nodeDrainController) dueForTargetCheck(nodeName string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.checked[nodeName]
+	return !ok || time.Since(last) >= nodeTargetCheckInterval
+}
@@ -0,0 +1,175 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeNodeDrainer struct {
+	drained  []string
+	err      error
+	isTarget bool
+	checks   int
+}
+
+func (d *fakeNodeDrainer) DrainNode(_ context.Context, node *corev1.Node) error {
+	d.drained = append(d.drained, node.Name)
+	return d.err
+}
+
+func (d *fakeNodeDrainer) IsNodeTarget(context.Context, *corev1.Node) (bool, error) {
+	d.checks++
+	return d.isTarget, nil
+}
+
+func TestNodeDrainController_syncNode(t *testing.T) {
+	tests := []struct {
+		name               string
+		deletedAgo         time.Duration
+		finalizers         []string
+		isTarget           bool
+		drainErr           error
+		expectedDrained    bool
+		expectedFinalizers []string
+		expectedErr        bool
+	}{
+		{
+			name:               "add finalizer to running target node",
+			isTarget:           true,
+			expectedFinalizers: []string{nodeDrainFinalizer},
+		},
+		{
+			name: "do not add finalizer to node which is no target",
+		},
+		{
+			name:               "keep finalizers of running node",
+			finalizers:         []string{"other", nodeDrainFinalizer},
+			expectedFinalizers: []string{"other", nodeDrainFinalizer},
+		},
+		{
+			name:               "drain deleted node and remove finalizer",
+			deletedAgo:         time.Second,
+			finalizers:         []string{"other", nodeDrainFinalizer},
+			expectedDrained:    true,
+			expectedFinalizers: []string{"other"},
+		},
+		{
+			name:               "keep finalizer if draining fails before timeout",
+			deletedAgo:         time.Second,
+			finalizers:         []string{nodeDrainFinalizer},
+			drainErr:           errors.New("test error"),
+			expectedDrained:    true,
+			expectedFinalizers: []string{nodeDrainFinalizer},
+			expectedErr:        true,
+		},
+		{
+			name:               "remove finalizer if draining times out",
+			deletedAgo:         2 * time.Minute,
+			finalizers:         []string{nodeDrainFinalizer},
+			drainErr:           context.DeadlineExceeded,
+			expectedDrained:    true,
+			expectedFinalizers: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1", Finalizers: tt.finalizers},
+			}
+			if tt.deletedAgo > 0 {
+				node.DeletionTimestamp = &metav1.Time{Time: time.Now().Add(-tt.deletedAgo)}
+			}
+			client := fake.NewSimpleClientset(node)
+			drainer := &fakeNodeDrainer{err: tt.drainErr, isTarget: tt.isTarget}
+			c := newNodeDrainController(client, drainer, time.Minute)
+
+			err := c.syncNode(context.Background(), node.DeepCopy())
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedDrained, len(drainer.drained) == 1)
+
+			updated, err := client.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+			assert.NoError(t, err)
+			if len(tt.expectedFinalizers) == 0 {
+				assert.Empty(t, updated.Finalizers)
+			} else {
+				assert.Equal(t, tt.expectedFinalizers, updated.Finalizers)
+			}
+		})
+	}
+}
+
+func TestNodeDrainController_syncNodeChecksTargetsRarely(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	client := fake.NewSimpleClientset(node)
+	drainer := &fakeNodeDrainer{}
+	c := newNodeDrainController(client, drainer, time.Minute)
+
+	assert.NoError(t, c.syncNode(context.Background(), node.DeepCopy()))
+	assert.NoError(t, c.syncNode(context.Background(), node.DeepCopy()))
+	assert.Equal(t, 1, drainer.checks)
+
+	// The node became a target since the last check.
+	c.checked["node1"] = time.Now().Add(-nodeTargetCheckInterval)
+	drainer.isTarget = true
+	assert.NoError(t, c.syncNode(context.Background(), node.DeepCopy()))
+	assert.Equal(t, 2, drainer.checks)
+	updated, err := client.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{nodeDrainFinalizer}, updated.Finalizers)
+}
+
+func TestNodeDrainController_syncNodeMaintenance(t *testing.T) {
+	deleted := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:              "node1",
+		DeletionTimestamp: &metav1.Time{Time: time.Now()},
+		Finalizers:        []string{nodeDrainFinalizer},
+	}}
+	running := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}}
+	client := fake.NewSimpleClientset(deleted, running)
+	drainer := &fakeNodeDrainer{isTarget: true}
+	c := newNodeDrainController(client, drainer, time.Minute)
+	c.maintenance = true
+
+	// The finalizer of the deleted node is removed without draining it.
+	assert.NoError(t, c.syncNode(context.Background(), deleted.DeepCopy()))
+	assert.Empty(t, drainer.drained)
+	updated, err := client.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, updated.Finalizers)
+
+	// No finalizer is added to targets.
+	assert.NoError(t, c.syncNode(context.Background(), running.DeepCopy()))
+	assert.Equal(t, 0, drainer.checks)
+	updated, err = client.CoreV1().Nodes().Get(context.Background(), "node2", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, updated.Finalizers)
+}
+
+func TestMatchNodeSelector_KeepsDrainingNodes(t *testing.T) {
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		{ObjectMeta: metav1.ObjectMeta{
+			Name:              "node2",
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+			Finalizers:        []string{nodeDrainFinalizer},
+		}},
+	}
+
+	// Draining nodes stay targets until they are drained, the drain removes
+	// them afterwards.
+	selected, err := matchNodeSelector(&corev1.Service{}, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, nodes, selected)
+}
@@ -0,0 +1,109 @@
+package hcloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// nodeLookupFailedCondition is the type of the node condition which reports
+// that the node could not be resolved to a hcloud or robot server.
+const nodeLookupFailedCondition corev1.NodeConditionType = "node.hetzner.cloud/ServerNotFound"
+
+// nodeLookupCondition reports nodes which could not be resolved to a server,
+// e.g. orphaned nodes whose server was deleted, as the
+// nodeLookupFailedCondition of the node. The condition is removed once the
+// server of the node is found again.
+//
+// Transient errors, e.g. of the API, are not reported, they do not tell
+// whether the server exists.
+type nodeLookupCondition struct {
+	mu     sync.Mutex
+	client kubernetes.Interface
+}
+
+// setClient sets the client used to update the node conditions. Until the
+// client is set nothing is reported.
+func (c *nodeLookupCondition) setClient(client kubernetes.Interface) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.client = client
+}
+
+// report reports the outcome err of looking up the server of node. A nil err
+// removes a previously reported condition.
+func (c *nodeLookupCondition) report(ctx context.Context, node *corev1.Node, err error) {
+	const op = "hcloud/nodeLookupCondition.report"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return
+	}
+
+	current := findNodeCondition(node, nodeLookupFailedCondition)
+	var condition map[string]interface{}
+	switch {
+	case err == nil:
+		if current == nil {
+			return
+		}
+		condition = map[string]interface{}{"type": nodeLookupFailedCondition, "$patch": "delete"}
+	case errors.Is(err, errServerNotFound), errors.Is(err, errAmbiguousServerName):
+		reason := "ServerNotFound"
+		if errors.Is(err, errAmbiguousServerName) {
+			reason = "AmbiguousServerName"
+		}
+		msg := err.Error()
+		if current != nil && current.Status == corev1.ConditionTrue && current.Reason == reason && current.Message == msg {
+			return
+		}
+		now := metav1.Now()
+		condition = map[string]interface{}{
+			"type":               nodeLookupFailedCondition,
+			"status":             corev1.ConditionTrue,
+			"lastHeartbeatTime":  now,
+			"lastTransitionTime": now,
+			"reason":             reason,
+			"message":            msg,
+		}
+	default:
+		return
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{"conditions": []interface{}{condition}},
+	})
+	if err != nil {
+		klog.ErrorS(err, "marshal node condition", "op", op, "node", node.Name)
+		return
+	}
+	_, err = client.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		klog.ErrorS(err, "update node condition", "op", op, "node", node.Name)
+	}
+}
+
+// findNodeCondition returns the condition of node with the type t, or nil.
+func findNodeCondition(node *corev1.Node, t corev1.NodeConditionType) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == t {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package hcloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeLookupCondition(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv()
+	defer env.Teardown()
+
+	serverExists := false
+	env.Mux.HandleFunc("/servers/1", func(w http.ResponseWriter, r *http.Request) {
+		if !serverExists {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(schema.ErrorResponse{Error: schema.Error{Code: string(hcloud.ErrorCodeNotFound)}})
+			return
+		}
+		json.NewEncoder(w).Encode(schema.ServerGetResponse{
+			Server: schema.Server{ID: 1, Name: "node", ServerType: schema.ServerType{Name: "cx22"}},
+		})
+	})
+
+	client := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+		}},
+	})
+	getNode := func() *corev1.Node {
+		t.Helper()
+		node, err := client.CoreV1().Nodes().Get(ctx, "node", metav1.GetOptions{})
+		require.NoError(t, err)
+		return node
+	}
+	patches := func() int {
+		n := 0
+		for _, a := range client.Actions() {
+			if a.GetVerb() == "patch" {
+				n++
+			}
+		}
+		return n
+	}
+
+	instances := newInstances(env.Client, nil, AddressFamilyIPv4, 0)
+	instances.lookupCondition = &nodeLookupCondition{}
+
+	// Without a client the nodes are not updated.
+	_, err := instances.InstanceMetadata(ctx, getNode())
+	assert.ErrorIs(t, err, errServerNotFound)
+	assert.Equal(t, 0, patches())
+
+	instances.lookupCondition.setClient(client)
+	_, err = instances.InstanceMetadata(ctx, getNode())
+	assert.ErrorIs(t, err, errServerNotFound)
+	node := getNode()
+	condition := findNodeCondition(node, nodeLookupFailedCondition)
+	require.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, "ServerNotFound", condition.Reason)
+	assert.Contains(t, condition.Message, "no matching hcloud server found for node 'node'")
+	assert.NotNil(t, findNodeCondition(node, corev1.NodeReady))
+
+	// Repeated failures do not update the node.
+	n := patches()
+	_, err = instances.InstanceMetadata(ctx, node)
+	assert.ErrorIs(t, err, errServerNotFound)
+	assert.Equal(t, n, patches())
+
+	serverExists = true
+	exists, err := instances.InstanceExists(ctx, getNode())
+	require.NoError(t, err)
+	assert.True(t, exists)
+	node = getNode()
+	assert.Nil(t, findNodeCondition(node, nodeLookupFailedCondition))
+	assert.NotNil(t, findNodeCondition(node, corev1.NodeReady))
+
+	// Nodes without the condition are not updated.
+	n = patches()
+	_, err = instances.InstanceMetadata(ctx, node)
+	require.NoError(t, err)
+	assert.Equal(t, n, patches())
+}
@@ -2,15 +2,22 @@ package hcloud
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 )
@@ -19,6 +26,228 @@ type routes struct {
 	client      *hcloud.Client
 	network     *hcloud.Network
 	serverCache *hcops.AllServersCache
+
+	// networkName is set if the network was configured by name. If the
+	// network is deleted, it is resolved again using this name.
+	networkName string
+
+	// networkRef is updated with the ID of the network if it was resolved
+	// again by networkName, so that the Load Balancers and instances use the
+	// new network as well. Can be nil.
+	networkRef *hcops.NetworkRef
+
+	// networkDeleted is set once the network was found to be deleted. All
+	// route operations are skipped until the network is available again.
+	networkDeleted bool
+
+	// maintenance skips all changes of routes. Routes are still listed.
+	maintenance bool
+
+	// gateway selects the IP of the target node used as gateway.
+	gateway routeGateway
+
+	// subnets restricts the gateways to IPs in these subnets of the network,
+	// in order of preference. All IPs are used if empty.
+	subnets []*net.IPNet
+
+	// retry configures the retries of deleting routes and changing the
+	// protection of the network after transient errors.
+	retry hcops.RetryOpts
+
+	// nodeClient looks up the nodes whose server is not attached to the
+	// network, to skip the ones opting out of the check. Can be nil.
+	nodeClient kubernetes.Interface
+
+	// protectNetwork enables the delete protection of the network, also of
+	// a recreated one. Deleting the network would break the routing between
+	// the pods.
+	protectNetwork bool
+}
+
+// routeGateway selects which IP of a node in the network is used as gateway
+// of the route to its pod CIDR. Hetzner Cloud routes have no further
+// properties, e.g. an MTU or a priority, the gateway is the only one.
+type routeGateway string
+
+const (
+	// routeGatewayPrimary uses the primary IP of the node in the network.
+	routeGatewayPrimary routeGateway = "primary"
+
+	// routeGatewayAlias uses the first alias IP of the node in the network.
+	// Nodes without alias IPs use their primary IP.
+	routeGatewayAlias routeGateway = "alias"
+)
+
+// gatewayIP returns the gateway of routes to a node attached to the network
+// with privNet.
+//
+// If route subnets are configured, the gateway is the first IP of the node in
+// the first of these subnets which contains one, e.g. for networks with a
+// subnet per location. Nodes without an IP in these subnets use the gateway
+// selected without subnets.
+func (r *routes) gatewayIP(privNet hcloud.ServerPrivateNet) net.IP {
+	candidates := append([]net.IP{privNet.IP}, privNet.Aliases...)
+	if r.gateway == routeGatewayAlias && len(privNet.Aliases) > 0 {
+		candidates = append(append([]net.IP{}, privNet.Aliases...), privNet.IP)
+	}
+	for _, subnet := range r.subnets {
+		for _, ip := range candidates {
+			if subnet.Contains(ip) {
+				return ip
+			}
+		}
+	}
+	return candidates[0]
+}
+
+// validateRouteSubnets returns an error if a route subnet is no subnet of
+// network.
+func validateRouteSubnets(network *hcloud.Network, subnets []*net.IPNet) error {
+	for _, subnet := range subnets {
+		found := false
+		for _, s := range network.Subnets {
+			if s.IPRange != nil && s.IPRange.String() == subnet.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("route subnet %s is no subnet of network %d", subnet, network.ID)
+		}
+	}
+	return nil
+}
+
+// overlappingSubnet returns the subnet of the network which overlaps the
+// destination of a route. Traffic to such a destination would be routed
+// inside the subnet instead of to the gateway.
+func (r *routes) overlappingSubnet(destination *net.IPNet) (*net.IPNet, bool) {
+	for _, s := range r.network.Subnets {
+		if s.IPRange == nil {
+			continue
+		}
+		if s.IPRange.Contains(destination.IP) || destination.Contains(s.IPRange.IP) {
+			return s.IPRange, true
+		}
+	}
+	return nil, false
+}
+
+var errNetworkDeleted = errors.New("network deleted")
+
+// routeOwnerLabelPrefix prefixes the network labels which record the cluster
+// owning a route. hcloud routes can not carry labels themselves, so the owner
+// of each route is stored in a label of the network, keyed by the
+// destination of the route.
+const routeOwnerLabelPrefix = "hcloud-ccm/route-"
+
+// routeOwnerLabel returns the key of the network label recording the owner of
+// the route to destination.
+func routeOwnerLabel(destination string) string {
+	return routeOwnerLabelPrefix + strings.NewReplacer(":", "_", "/", "-").Replace(destination)
+}
+
+// routeOwnerValue returns the value of the route owner label for
+// clusterName. Names which are no valid label value are hashed.
+func routeOwnerValue(clusterName string) string {
+	if errs := validation.IsValidLabelValue(clusterName); len(errs) == 0 {
+		return clusterName
+	}
+	sum := sha256.Sum256([]byte(clusterName))
+	return "sha256-" + hex.EncodeToString(sum[:])[:16]
+}
+
+// routeOwner returns the owner recorded for the route to destination. Routes
+// without an owner were created by an older version of the
+// hcloud-cloud-controller-manager or by a third party.
+func (r *routes) routeOwner(destination string) (string, bool) {
+	owner, ok := r.network.Labels[routeOwnerLabel(destination)]
+	return owner, ok
+}
+
+// isForeignRoute reports whether the route to destination is owned by
+// another cluster than clusterName.
+func (r *routes) isForeignRoute(clusterName, destination string) bool {
+	owner, ok := r.routeOwner(destination)
+	return ok && owner != routeOwnerValue(clusterName)
+}
+
+// routeOwnerUpdateAttempts is the number of times updateRouteOwners writes
+// the owner labels before it gives up.
+const routeOwnerUpdateAttempts = 5
+
+// updateRouteOwners sets the owner labels in set and removes those in
+// remove from the network.
+//
+// The labels of a network can only be replaced as a whole, and other clusters
+// sharing the network write them as well. The labels are therefore read right
+// before they are written and read again afterwards. If a concurrent update
+// overwrote the changes, they are applied to the new labels again.
+func (r *routes) updateRouteOwners(ctx context.Context, set map[string]string, remove []string) error {
+	const op = "hcloud/updateRouteOwners"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	for attempt := 1; ; attempt++ {
+		network, err := r.getNetwork(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		labels := make(map[string]string, len(network.Labels)+len(set))
+		for k, v := range network.Labels {
+			labels[k] = v
+		}
+		for k, v := range set {
+			labels[k] = v
+		}
+		for _, k := range remove {
+			delete(labels, k)
+		}
+		if _, _, err := r.client.Network.Update(ctx, network, hcloud.NetworkUpdateOpts{Labels: labels}); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		network, err = r.getNetwork(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		r.network = network
+		if routeOwnersApplied(network.Labels, set, remove) {
+			return nil
+		}
+		if attempt >= routeOwnerUpdateAttempts {
+			return fmt.Errorf("%s: owner labels overwritten by concurrent updates %d times", op, attempt)
+		}
+		klog.InfoS("owner labels overwritten by a concurrent update, retrying", "op", op, "networkID", network.ID)
+	}
+}
+
+// getNetwork returns the current state of the network.
+func (r *routes) getNetwork(ctx context.Context) (*hcloud.Network, error) {
+	network, _, err := r.client.Network.GetByID(ctx, r.network.ID)
+	if err != nil {
+		return nil, err
+	}
+	if network == nil {
+		return nil, fmt.Errorf("network %d: %w", r.network.ID, errNetworkDeleted)
+	}
+	return network, nil
+}
+
+// routeOwnersApplied reports whether labels contain the owner labels in set
+// and none of those in remove.
+func routeOwnersApplied(labels, set map[string]string, remove []string) bool {
+	for k, v := range set {
+		if labels[k] != v {
+			return false
+		}
+	}
+	for _, k := range remove {
+		if _, ok := labels[k]; ok {
+			return false
+		}
+	}
+	return true
 }
 
 func newRoutes(client *hcloud.Client, networkID int64) (*routes, error) {
@@ -42,6 +271,7 @@ func newRoutes(client *hcloud.Client, networkID int64) (*routes, error) {
 			LoadFunc: client.Server.All,
 			Network:  networkObj,
 		},
+		retry: hcops.DefaultRetryOpts,
 	}, nil
 }
 
@@ -53,24 +283,94 @@ func (r *routes) reloadNetwork(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	if networkObj == nil && r.networkName != "" {
+		networkObj, _, err = r.client.Network.GetByName(ctx, r.networkName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if networkObj != nil {
+			klog.InfoS("network was recreated, using new network",
+				"op", op, "name", r.networkName, "oldNetworkID", r.network.ID, "networkID", networkObj.ID)
+			r.serverCache.Network = networkObj
+			r.serverCache.InvalidateCache()
+			if r.networkRef != nil {
+				r.networkRef.Set(networkObj.ID)
+			}
+		}
+	}
 	if networkObj == nil {
-		return fmt.Errorf("network not found: %s", r.network.Name)
+		if !r.networkDeleted {
+			klog.Warningf("%s: network %d (%s) not found, skipping routes until it is available again",
+				op, r.network.ID, r.network.Name)
+			r.networkDeleted = true
+		}
+		return fmt.Errorf("%s: %d: %w", op, r.network.ID, errNetworkDeleted)
 	}
+	r.networkDeleted = false
 	r.network = networkObj
+	// The routes do not depend on the protection, failures are retried on
+	// the next reload.
+	if err := r.ensureNetworkProtection(ctx); err != nil {
+		klog.ErrorS(err, "enable delete protection of network", "op", op, "networkID", r.network.ID)
+	}
+	return nil
+}
+
+// ensureNetworkProtection enables the delete protection of the network if
+// protectNetwork is set. The protection is never disabled, so that it can
+// also be managed outside of Kubernetes.
+func (r *routes) ensureNetworkProtection(ctx context.Context) error {
+	const op = "hcloud/routes.ensureNetworkProtection"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if !r.protectNetwork || r.maintenance || r.network.Protection.Delete {
+		return nil
+	}
+
+	opts := hcloud.NetworkChangeProtectionOpts{Delete: hcloud.Ptr(true)}
+	var action *hcloud.Action
+	err := hcops.Retry(ctx, op, r.retry, func() error {
+		var err error
+		action, _, err = r.client.Network.ChangeProtection(ctx, r.network, opts)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := hcops.WatchAction(ctx, &r.client.Action, action); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	klog.InfoS("enabled delete protection of network", "op", op, "networkID", r.network.ID)
+	r.network.Protection.Delete = true
 	return nil
 }
 
 // ListRoutes lists all managed routes that belong to the specified clusterName.
-func (r *routes) ListRoutes(ctx context.Context, _ string) ([]*cloudprovider.Route, error) {
+// Routes owned by another cluster sharing the network are omitted, so that
+// they are never deleted by this cluster.
+func (r *routes) ListRoutes(ctx context.Context, clusterName string) ([]*cloudprovider.Route, error) {
 	const op = "hcloud/ListRoutes"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
-	if err := r.reloadNetwork(ctx); err != nil {
+	err := r.reloadNetwork(ctx)
+	if errors.Is(err, errNetworkDeleted) {
+		return []*cloudprovider.Route{}, nil
+	}
+	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if !r.maintenance {
+		if err := r.removeStaleRouteOwners(ctx, clusterName); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
 	routes := make([]*cloudprovider.Route, 0, len(r.network.Routes))
 	for _, route := range r.network.Routes {
+		if r.isForeignRoute(clusterName, route.Destination.String()) {
+			continue
+		}
 		ro, err := r.hcloudRouteToRoute(route)
 		if err != nil {
 			return routes, fmt.Errorf("%s: %w", op, err)
@@ -80,6 +380,96 @@ func (r *routes) ListRoutes(ctx context.Context, _ string) ([]*cloudprovider.Rou
 	return routes, nil
 }
 
+// removeStaleRouteOwners removes the owner labels of clusterName for routes
+// which no longer exist, e.g. because they were deleted manually. Otherwise
+// another cluster creating a route to the same destination could not take
+// ownership of it.
+func (r *routes) removeStaleRouteOwners(ctx context.Context, clusterName string) error {
+	const op = "hcloud/removeStaleRouteOwners"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	existing := make(map[string]bool, len(r.network.Routes))
+	for _, route := range r.network.Routes {
+		existing[routeOwnerLabel(route.Destination.String())] = true
+	}
+
+	var stale []string
+	owner := routeOwnerValue(clusterName)
+	for k, v := range r.network.Labels {
+		if strings.HasPrefix(k, routeOwnerLabelPrefix) && v == owner && !existing[k] {
+			stale = append(stale, k)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	if err := r.updateRouteOwners(ctx, nil, stale); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// cleanupOrphanedRoutes deletes the routes of clusterName whose target node
+// no longer exists in the cluster, e.g. because the node was deleted while
+// the hcloud-cloud-controller-manager was not running. It is called once on
+// startup.
+//
+// Only routes owned by clusterName are deleted. Nothing is deleted if the
+// nodes can not be listed completely or no node is found, the route
+// controller removes the remaining routes once the nodes are known.
+func (r *routes) cleanupOrphanedRoutes(ctx context.Context, clusterName string) error {
+	const op = "hcloud/routes.cleanupOrphanedRoutes"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if r.nodeClient == nil || r.maintenance {
+		return nil
+	}
+	nodes, err := r.nodeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if len(nodes.Items) == 0 || nodes.Continue != "" {
+		klog.InfoS("node list incomplete, skip cleanup of orphaned routes", "op", op, "nodes", len(nodes.Items))
+		return nil
+	}
+	nodeNames := make(map[string]bool, len(nodes.Items))
+	for _, node := range nodes.Items {
+		nodeNames[node.Name] = true
+	}
+
+	err = r.reloadNetwork(ctx)
+	if errors.Is(err, errNetworkDeleted) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	owner := routeOwnerValue(clusterName)
+	var orphaned []*cloudprovider.Route
+	for _, route := range r.network.Routes {
+		if o, ok := r.routeOwner(route.Destination.String()); !ok || o != owner {
+			continue
+		}
+		ro, err := r.hcloudRouteToRoute(route)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if !ro.Blackhole && nodeNames[string(ro.TargetNode)] {
+			continue
+		}
+		orphaned = append(orphaned, ro)
+	}
+
+	for _, ro := range orphaned {
+		klog.InfoS("delete orphaned route", "op", op, "node", ro.TargetNode, "destination", ro.DestinationCIDR)
+		if err := r.DeleteRoute(ctx, clusterName, ro); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
 // CreateRoute creates the described managed route
 // route.Name will be ignored, although the cloud-provider may use nameHint
 // to create a more user-meaningful name.
@@ -87,6 +477,14 @@ func (r *routes) CreateRoute(ctx context.Context, clusterName, nameHint string,
 	const op = "hcloud/CreateRoute"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
+	if r.networkDeleted {
+		return nil
+	}
+	if r.maintenance {
+		klog.InfoS("maintenance mode, skip creating route", "op", op, "node", route.TargetNode, "destination", route.DestinationCIDR)
+		return fmt.Errorf("%s: %w", op, errMaintenanceMode)
+	}
+
 	srv, err := r.serverCache.ByName(string(route.TargetNode))
 	if err != nil {
 		return fmt.Errorf("%s: %v", op, err)
@@ -102,17 +500,24 @@ func (r *routes) CreateRoute(ctx context.Context, clusterName, nameHint string,
 
 		privNet, ok = findServerPrivateNetByID(srv, r.network.ID)
 		if !ok {
+			if r.skipsAttachedCheck(ctx, string(route.TargetNode)) {
+				klog.InfoS("server not attached to network, skip route", "op", op, "node", route.TargetNode, "networkID", r.network.ID)
+				return nil
+			}
 			return fmt.Errorf("%s: server %v: network with id %d not attached to this server ", op, route.TargetNode, r.network.ID)
 		}
 	}
-	ip := privNet.IP
+	ip := r.gatewayIP(privNet)
 
 	_, cidr, err := net.ParseCIDR(route.DestinationCIDR)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	if subnet, ok := r.overlappingSubnet(cidr); ok {
+		return fmt.Errorf("%s: route %s overlaps subnet %s of network %d", op, cidr, subnet, r.network.ID)
+	}
 
-	doesRouteAlreadyExist, err := r.checkIfRouteAlreadyExists(ctx, route)
+	doesRouteAlreadyExist, err := r.checkIfRouteAlreadyExists(ctx, clusterName, route)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -141,15 +546,52 @@ func (r *routes) CreateRoute(ctx context.Context, clusterName, nameHint string,
 			return fmt.Errorf("%s: %w", op, err)
 		}
 	}
+
+	if owner, ok := r.routeOwner(cidr.String()); !ok || owner != routeOwnerValue(clusterName) {
+		key := routeOwnerLabel(cidr.String())
+		if err := r.updateRouteOwners(ctx, map[string]string{key: routeOwnerValue(clusterName)}, nil); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
 	return nil
 }
 
+// skipsAttachedCheck reports whether the node nodeName opts out of the check
+// whether its server is attached to the network.
+func (r *routes) skipsAttachedCheck(ctx context.Context, nodeName string) bool {
+	const op = "hcloud/routes.skipsAttachedCheck"
+
+	if r.nodeClient == nil {
+		return false
+	}
+	node, err := r.nodeClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.ErrorS(err, "get node", "op", op, "node", nodeName)
+		return false
+	}
+	skip, _ := annotation.NodeSkipNetworkAttachedCheck.BoolFromNode(node)
+	return skip
+}
+
 // DeleteRoute deletes the specified managed route
 // Route should be as returned by ListRoutes.
-func (r *routes) DeleteRoute(ctx context.Context, _ string, route *cloudprovider.Route) error {
+func (r *routes) DeleteRoute(ctx context.Context, clusterName string, route *cloudprovider.Route) error {
 	const op = "hcloud/DeleteRoute"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
+	if r.networkDeleted {
+		return nil
+	}
+	if r.maintenance {
+		klog.InfoS("maintenance mode, skip deleting route", "op", op, "destination", route.DestinationCIDR)
+		return fmt.Errorf("%s: %w", op, errMaintenanceMode)
+	}
+
+	if r.isForeignRoute(clusterName, route.DestinationCIDR) {
+		owner, _ := r.routeOwner(route.DestinationCIDR)
+		return fmt.Errorf("%s: route %s is owned by cluster %s", op, route.DestinationCIDR, owner)
+	}
+
 	// Get target IP from current list of routes, routes can be uniquely identified by their destination cidr.
 	var ip net.IP
 	for _, cloudRoute := range r.network.Routes {
@@ -171,6 +613,12 @@ func (r *routes) DeleteRoute(ctx context.Context, _ string, route *cloudprovider
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+
+	if _, ok := r.routeOwner(cidr.String()); ok {
+		if err := r.updateRouteOwners(ctx, nil, []string{routeOwnerLabel(cidr.String())}); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
 	return nil
 }
 
@@ -185,16 +633,13 @@ func (r *routes) deleteRouteFromHcloud(ctx context.Context, cidr *net.IPNet, ip
 		},
 	}
 
-	action, _, err := r.client.Network.DeleteRoute(ctx, r.network, opts)
+	var action *hcloud.Action
+	err := hcops.Retry(ctx, op, r.retry, func() error {
+		var err error
+		action, _, err = r.client.Network.DeleteRoute(ctx, r.network, opts)
+		return err
+	})
 	if err != nil {
-		if hcloud.IsError(err, hcloud.ErrorCodeLocked) || hcloud.IsError(err, hcloud.ErrorCodeConflict) {
-			retryDelay := time.Second * 5
-			klog.InfoS("retry due to conflict or lock",
-				"op", op, "delay", fmt.Sprintf("%v", retryDelay), "err", fmt.Sprintf("%v", err))
-			time.Sleep(retryDelay)
-
-			return r.deleteRouteFromHcloud(ctx, cidr, ip)
-		}
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	if err := hcops.WatchAction(ctx, &r.client.Action, action); err != nil {
@@ -227,7 +672,7 @@ func (r *routes) hcloudRouteToRoute(route hcloud.NetworkRoute) (*cloudprovider.R
 	return cpRoute, nil
 }
 
-func (r *routes) checkIfRouteAlreadyExists(ctx context.Context, route *cloudprovider.Route) (bool, error) {
+func (r *routes) checkIfRouteAlreadyExists(ctx context.Context, clusterName string, route *cloudprovider.Route) (bool, error) {
 	const op = "hcloud/checkIfRouteAlreadyExists"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
@@ -237,6 +682,10 @@ func (r *routes) checkIfRouteAlreadyExists(ctx context.Context, route *cloudprov
 
 	for _, _route := range r.network.Routes {
 		if _route.Destination.String() == route.DestinationCIDR {
+			if r.isForeignRoute(clusterName, route.DestinationCIDR) {
+				owner, _ := r.routeOwner(route.DestinationCIDR)
+				return false, fmt.Errorf("%s: route %s is owned by cluster %s", op, route.DestinationCIDR, owner)
+			}
 			srv, err := r.serverCache.ByName(string(route.TargetNode))
 			if err != nil {
 				return false, fmt.Errorf("%s: %v", op, err)
@@ -245,7 +694,7 @@ func (r *routes) checkIfRouteAlreadyExists(ctx context.Context, route *cloudprov
 			if !ok {
 				return false, fmt.Errorf("%s: server %v: no network with id: %d", op, route.TargetNode, r.network.ID)
 			}
-			ip := privNet.IP
+			ip := r.gatewayIP(privNet)
 
 			if !_route.Gateway.Equal(ip) {
 				action, _, err := r.client.Network.DeleteRoute(context.Background(), r.network, hcloud.NetworkDeleteRouteOpts{
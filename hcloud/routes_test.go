@@ -3,11 +3,20 @@ package hcloud
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"reflect"
 	"testing"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
 	cloudprovider "k8s.io/cloud-provider"
 )
 
@@ -30,12 +39,21 @@ func TestRoutes_CreateRoute(t *testing.T) {
 			},
 		})
 	})
+	var labels map[string]string
 	env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var reqBody schema.NetworkUpdateRequest
+			if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+				t.Fatal(err)
+			}
+			labels = *reqBody.Labels
+		}
 		json.NewEncoder(w).Encode(schema.NetworkGetResponse{
 			Network: schema.Network{
 				ID:      1,
 				Name:    "network-1",
 				IPRange: "10.0.0.0/8",
+				Labels:  labels,
 			},
 		})
 	})
@@ -82,6 +100,274 @@ func TestRoutes_CreateRoute(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
+	if labels["hcloud-ccm/route-10.5.0.0-24"] != "my-cluster" {
+		t.Errorf("Unexpected network labels %v", labels)
+	}
+}
+
+func TestRoutes_CreateRouteSkipAttachedCheck(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ServerListResponse{
+			Servers: []schema.Server{
+				{ID: 1, Name: "node-migrating"},
+				{ID: 2, Name: "node-detached"},
+			},
+		})
+	})
+	env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.NetworkGetResponse{
+			Network: schema.Network{ID: 1, Name: "network-1", IPRange: "10.0.0.0/8"},
+		})
+	})
+	env.Mux.HandleFunc("/networks/1/actions/add_route", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Unexpected route for a server which is not attached to the network")
+	})
+	routes, err := newRoutes(env.Client, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	routes.nodeClient = fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:        "node-migrating",
+			Annotations: map[string]string{string(annotation.NodeSkipNetworkAttachedCheck): "true"},
+		}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-detached"}},
+	)
+
+	// The node opting out of the check gets no route.
+	err = routes.CreateRoute(context.TODO(), "my-cluster", "route", &cloudprovider.Route{
+		Name:            "route",
+		TargetNode:      "node-migrating",
+		DestinationCIDR: "10.5.0.0/24",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = routes.CreateRoute(context.TODO(), "my-cluster", "route", &cloudprovider.Route{
+		Name:            "route",
+		TargetNode:      "node-detached",
+		DestinationCIDR: "10.5.1.0/24",
+	})
+	if err == nil {
+		t.Fatal("Expected error for a server which is not attached to the network")
+	}
+}
+
+func TestRoutes_CreateRouteGateway(t *testing.T) {
+	tests := []struct {
+		name            string
+		gateway         routeGateway
+		expectedGateway string
+	}{
+		{name: "primary", gateway: routeGatewayPrimary, expectedGateway: "10.0.0.2"},
+		{name: "unset", expectedGateway: "10.0.0.2"},
+		{name: "alias", gateway: routeGatewayAlias, expectedGateway: "10.0.0.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv()
+			defer env.Teardown()
+			env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(schema.ServerListResponse{
+					Servers: []schema.Server{
+						{
+							ID:   1,
+							Name: "node15",
+							PrivateNet: []schema.ServerPrivateNet{
+								{
+									Network: 2,
+									IP:      "192.168.0.2",
+								},
+								{
+									Network:  1,
+									IP:       "10.0.0.2",
+									AliasIPs: []string{"10.0.0.3", "10.0.0.4"},
+								},
+							},
+						},
+					},
+				})
+			})
+			var labels map[string]string
+			env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					var reqBody schema.NetworkUpdateRequest
+					if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+						t.Fatal(err)
+					}
+					labels = *reqBody.Labels
+				}
+				json.NewEncoder(w).Encode(schema.NetworkGetResponse{
+					Network: schema.Network{ID: 1, Name: "network-1", IPRange: "10.0.0.0/8", Labels: labels},
+				})
+			})
+			env.Mux.HandleFunc("/actions", func(w http.ResponseWriter, _ *http.Request) {
+				json.NewEncoder(w).Encode(schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 1, Status: string(hcloud.ActionStatusSuccess), Progress: 100}},
+				})
+			})
+			var gateway string
+			env.Mux.HandleFunc("/networks/1/actions/add_route", func(w http.ResponseWriter, r *http.Request) {
+				var reqBody schema.NetworkActionAddRouteRequest
+				if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+					t.Fatal(err)
+				}
+				gateway = reqBody.Gateway
+				json.NewEncoder(w).Encode(schema.NetworkActionAddRouteResponse{
+					Action: schema.Action{ID: 1, Status: string(hcloud.ActionStatusRunning)},
+				})
+			})
+			routes, err := newRoutes(env.Client, 1)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			routes.gateway = tt.gateway
+
+			err = routes.CreateRoute(context.TODO(), "my-cluster", "route", &cloudprovider.Route{
+				Name:            "route",
+				TargetNode:      "node15",
+				DestinationCIDR: "10.5.0.0/24",
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if gateway != tt.expectedGateway {
+				t.Errorf("Unexpected gateway %s, expected %s", gateway, tt.expectedGateway)
+			}
+		})
+	}
+}
+
+func TestRoutes_CreateRouteSubnets(t *testing.T) {
+	tests := []struct {
+		name            string
+		subnets         []string
+		node            string
+		destination     string
+		expectedGateway string
+		expectedErr     string
+	}{
+		{name: "node in first subnet", subnets: []string{"10.0.1.0/24", "10.0.0.0/24"}, node: "node-fsn1", expectedGateway: "10.0.0.2"},
+		{name: "node in second subnet", subnets: []string{"10.0.1.0/24", "10.0.0.0/24"}, node: "node-hel1", expectedGateway: "10.0.1.2"},
+		{name: "preferred subnet of alias IP", subnets: []string{"10.0.1.0/24", "10.0.0.0/24"}, node: "node-both", expectedGateway: "10.0.1.4"},
+		{name: "no subnets", node: "node-both", expectedGateway: "10.0.0.3"},
+		{name: "node not in subnets", subnets: []string{"10.0.1.0/24"}, node: "node-fsn1", expectedGateway: "10.0.0.2"},
+		{
+			name:        "destination overlaps subnet",
+			node:        "node-fsn1",
+			destination: "10.0.1.0/25",
+			expectedErr: "hcloud/CreateRoute: route 10.0.1.0/25 overlaps subnet 10.0.1.0/24 of network 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv()
+			defer env.Teardown()
+			env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "node-fsn1", PrivateNet: []schema.ServerPrivateNet{{Network: 1, IP: "10.0.0.2"}}},
+						{ID: 2, Name: "node-hel1", PrivateNet: []schema.ServerPrivateNet{{Network: 1, IP: "10.0.1.2"}}},
+						{ID: 3, Name: "node-both", PrivateNet: []schema.ServerPrivateNet{
+							{Network: 1, IP: "10.0.0.3", AliasIPs: []string{"10.0.1.4"}},
+						}},
+					},
+				})
+			})
+			var labels map[string]string
+			env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					var reqBody schema.NetworkUpdateRequest
+					if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+						t.Fatal(err)
+					}
+					labels = *reqBody.Labels
+				}
+				json.NewEncoder(w).Encode(schema.NetworkGetResponse{
+					Network: schema.Network{
+						ID:      1,
+						Name:    "network-1",
+						IPRange: "10.0.0.0/8",
+						Labels:  labels,
+						Subnets: []schema.NetworkSubnet{
+							{Type: "cloud", IPRange: "10.0.0.0/24", NetworkZone: "eu-central"},
+							{Type: "cloud", IPRange: "10.0.1.0/24", NetworkZone: "eu-central"},
+						},
+					},
+				})
+			})
+			env.Mux.HandleFunc("/actions", func(w http.ResponseWriter, _ *http.Request) {
+				json.NewEncoder(w).Encode(schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 1, Status: string(hcloud.ActionStatusSuccess), Progress: 100}},
+				})
+			})
+			var gateway string
+			env.Mux.HandleFunc("/networks/1/actions/add_route", func(w http.ResponseWriter, r *http.Request) {
+				var reqBody schema.NetworkActionAddRouteRequest
+				if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+					t.Fatal(err)
+				}
+				gateway = reqBody.Gateway
+				json.NewEncoder(w).Encode(schema.NetworkActionAddRouteResponse{
+					Action: schema.Action{ID: 1, Status: string(hcloud.ActionStatusRunning)},
+				})
+			})
+			routes, err := newRoutes(env.Client, 1)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, s := range tt.subnets {
+				routes.subnets = append(routes.subnets, mustParseCIDR(t, s))
+			}
+			if err := validateRouteSubnets(routes.network, routes.subnets); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			destination := tt.destination
+			if destination == "" {
+				destination = "10.5.0.0/24"
+			}
+			err = routes.CreateRoute(context.TODO(), "my-cluster", "route", &cloudprovider.Route{
+				Name:            "route",
+				TargetNode:      types.NodeName(tt.node),
+				DestinationCIDR: destination,
+			})
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Fatalf("Unexpected error %v, expected %s", err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if gateway != tt.expectedGateway {
+				t.Errorf("Unexpected gateway %s, expected %s", gateway, tt.expectedGateway)
+			}
+		})
+	}
+}
+
+func TestRoutes_ValidateSubnets(t *testing.T) {
+	network := &hcloud.Network{ID: 1, Subnets: []hcloud.NetworkSubnet{{IPRange: mustParseCIDR(t, "10.0.0.0/24")}}}
+	err := validateRouteSubnets(network, []*net.IPNet{mustParseCIDR(t, "10.0.2.0/24")})
+	if err == nil || err.Error() != "route subnet 10.0.2.0/24 is no subnet of network 1" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func mustParseCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ipNet
 }
 
 func TestRoutes_ListRoutes(t *testing.T) {
@@ -138,6 +424,62 @@ func TestRoutes_ListRoutes(t *testing.T) {
 	}
 }
 
+func TestRoutes_MaintenanceMode(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ServerListResponse{
+			Servers: []schema.Server{
+				{ID: 1, Name: "node15", PrivateNet: []schema.ServerPrivateNet{{Network: 1, IP: "10.0.0.2"}}},
+			},
+		})
+	})
+	env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Unexpected %s request to network", r.Method)
+		}
+		json.NewEncoder(w).Encode(schema.NetworkGetResponse{
+			Network: schema.Network{
+				ID:      1,
+				Name:    "network-1",
+				IPRange: "10.0.0.0/8",
+				Routes:  []schema.NetworkRoute{{Destination: "10.5.0.0/24", Gateway: "10.0.0.2"}},
+				// A stale owner label is not removed in maintenance mode.
+				Labels: map[string]string{routeOwnerLabel("10.6.0.0/24"): "my-cluster"},
+			},
+		})
+	})
+	env.Mux.HandleFunc("/networks/1/actions/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request %s", r.URL.Path)
+	})
+	routes, err := newRoutes(env.Client, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	routes.maintenance = true
+
+	r, err := routes.ListRoutes(context.TODO(), "my-cluster")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(r) != 1 || r[0].TargetNode != "node15" {
+		t.Errorf("Unexpected routes %v", r)
+	}
+
+	err = routes.CreateRoute(context.TODO(), "my-cluster", "route", &cloudprovider.Route{
+		Name:            "route",
+		TargetNode:      "node15",
+		DestinationCIDR: "10.6.0.0/24",
+	})
+	if !errors.Is(err, errMaintenanceMode) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	err = routes.DeleteRoute(context.TODO(), "my-cluster", r[0])
+	if !errors.Is(err, errMaintenanceMode) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
 func TestRoutes_DeleteRoute(t *testing.T) {
 	env := newTestEnv()
 	defer env.Teardown()
@@ -200,3 +542,401 @@ func TestRoutes_DeleteRoute(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
+
+func TestRoutes_NetworkDeleted(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	deleted := false
+	env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+		if deleted {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(schema.ErrorResponse{Error: schema.Error{Code: string(hcloud.ErrorCodeNotFound)}})
+			return
+		}
+		json.NewEncoder(w).Encode(schema.NetworkGetResponse{
+			Network: schema.Network{ID: 1, Name: "network-1", IPRange: "10.0.0.0/8"},
+		})
+	})
+	env.Mux.HandleFunc("/networks", func(w http.ResponseWriter, r *http.Request) {
+		var networks []schema.Network
+		if r.URL.Query().Get("name") == "network-1" {
+			networks = append(networks, schema.Network{
+				ID:      2,
+				Name:    "network-1",
+				IPRange: "10.0.0.0/8",
+				Routes:  []schema.NetworkRoute{{Destination: "10.5.0.0/24", Gateway: "10.0.0.2"}},
+			})
+		}
+		json.NewEncoder(w).Encode(schema.NetworkListResponse{Networks: networks})
+	})
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ServerListResponse{
+			Servers: []schema.Server{
+				{
+					ID:         1,
+					Name:       "node15",
+					PrivateNet: []schema.ServerPrivateNet{{Network: 2, IP: "10.0.0.2"}},
+				},
+			},
+		})
+	})
+
+	routes, err := newRoutes(env.Client, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deleted = true
+
+	// Without a network name the routes are disabled.
+	r, err := routes.ListRoutes(context.TODO(), "my-cluster")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(r) != 0 {
+		t.Errorf("Unexpected routes %v", len(r))
+	}
+	err = routes.CreateRoute(context.TODO(), "my-cluster", "route", &cloudprovider.Route{
+		Name:            "route",
+		TargetNode:      "node15",
+		DestinationCIDR: "10.6.0.0/24",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// With a network name the recreated network is used, also by the Load
+	// Balancers and instances sharing the network.
+	routes.networkName = "network-1"
+	routes.networkRef = hcops.NewNetworkRef(1)
+	r, err = routes.ListRoutes(context.TODO(), "my-cluster")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if routes.networkDeleted || routes.network.ID != 2 {
+		t.Fatalf("Expected recreated network to be used, got %d", routes.network.ID)
+	}
+	if id := routes.networkRef.ID(); id != 2 {
+		t.Fatalf("Expected shared network to be updated, got %d", id)
+	}
+	if len(r) != 1 || r[0].TargetNode != "node15" {
+		t.Errorf("Unexpected routes %+v", r)
+	}
+}
+
+func TestRoutes_Ownership(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	labels := map[string]string{
+		"hcloud-ccm/route-10.5.0.0-24": "my-cluster",
+		"hcloud-ccm/route-10.6.0.0-24": "other-cluster",
+		"hcloud-ccm/route-10.8.0.0-24": "my-cluster",
+		"hcloud-ccm/route-10.9.0.0-24": "other-cluster",
+	}
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ServerListResponse{
+			Servers: []schema.Server{
+				{
+					ID:         1,
+					Name:       "node15",
+					PrivateNet: []schema.ServerPrivateNet{{Network: 1, IP: "10.0.0.2"}},
+				},
+			},
+		})
+	})
+	env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var reqBody schema.NetworkUpdateRequest
+			if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+				t.Fatal(err)
+			}
+			labels = *reqBody.Labels
+		}
+		json.NewEncoder(w).Encode(schema.NetworkGetResponse{
+			Network: schema.Network{
+				ID:      1,
+				Name:    "network-1",
+				IPRange: "10.0.0.0/8",
+				Labels:  labels,
+				Routes: []schema.NetworkRoute{
+					{Destination: "10.5.0.0/24", Gateway: "10.0.0.2"},
+					{Destination: "10.6.0.0/24", Gateway: "10.0.0.3"},
+					{Destination: "10.7.0.0/24", Gateway: "10.0.0.2"},
+				},
+			},
+		})
+	})
+	env.Mux.HandleFunc("/networks/1/actions/delete_route", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected deletion of a route owned by another cluster")
+	})
+
+	routes, err := newRoutes(env.Client, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Routes of other clusters are not listed, routes without an owner are.
+	r, err := routes.ListRoutes(context.TODO(), "my-cluster")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(r) != 2 || r[0].DestinationCIDR != "10.5.0.0/24" || r[1].DestinationCIDR != "10.7.0.0/24" {
+		t.Errorf("Unexpected routes %+v", r)
+	}
+
+	// The stale owner label of this cluster was removed, the one of the other
+	// cluster was kept.
+	if _, ok := labels["hcloud-ccm/route-10.8.0.0-24"]; ok {
+		t.Errorf("Expected stale route owner to be removed: %v", labels)
+	}
+	if labels["hcloud-ccm/route-10.9.0.0-24"] != "other-cluster" {
+		t.Errorf("Expected route owner of other cluster to be kept: %v", labels)
+	}
+
+	// Routes of other clusters are never deleted or replaced.
+	err = routes.DeleteRoute(context.TODO(), "my-cluster", &cloudprovider.Route{
+		Name:            "route",
+		DestinationCIDR: "10.6.0.0/24",
+	})
+	if err == nil || err.Error() != "hcloud/DeleteRoute: route 10.6.0.0/24 is owned by cluster other-cluster" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	err = routes.CreateRoute(context.TODO(), "my-cluster", "route", &cloudprovider.Route{
+		Name:            "route",
+		TargetNode:      "node15",
+		DestinationCIDR: "10.6.0.0/24",
+	})
+	if err == nil {
+		t.Error("Expected error creating a route owned by another cluster")
+	}
+}
+
+func TestRoutes_UpdateRouteOwnersConcurrently(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	labels := map[string]string{"hcloud-ccm/route-10.6.0.0-24": "other-cluster"}
+	puts := 0
+	env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var reqBody schema.NetworkUpdateRequest
+			if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+				t.Fatal(err)
+			}
+			puts++
+			labels = *reqBody.Labels
+			if puts == 1 {
+				// Another cluster read the labels before this update and
+				// writes them after it.
+				labels = map[string]string{
+					"hcloud-ccm/route-10.6.0.0-24": "other-cluster",
+					"hcloud-ccm/route-10.7.0.0-24": "other-cluster",
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(schema.NetworkGetResponse{
+			Network: schema.Network{ID: 1, Name: "network-1", IPRange: "10.0.0.0/8", Labels: labels},
+		})
+	})
+
+	routes, err := newRoutes(env.Client, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	set := map[string]string{routeOwnerLabel("10.5.0.0/24"): "my-cluster"}
+	if err := routes.updateRouteOwners(context.TODO(), set, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if puts != 2 {
+		t.Errorf("Expected the overwritten update to be applied again, got %d updates", puts)
+	}
+	expected := map[string]string{
+		"hcloud-ccm/route-10.5.0.0-24": "my-cluster",
+		"hcloud-ccm/route-10.6.0.0-24": "other-cluster",
+		"hcloud-ccm/route-10.7.0.0-24": "other-cluster",
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	if routes.network.Labels["hcloud-ccm/route-10.7.0.0-24"] != "other-cluster" {
+		t.Errorf("Expected the network of routes to be updated: %v", routes.network.Labels)
+	}
+}
+
+func TestRoutes_CleanupOrphanedRoutes(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	labels := map[string]string{
+		"hcloud-ccm/route-10.5.0.0-24": "my-cluster",
+		"hcloud-ccm/route-10.6.0.0-24": "my-cluster",
+		"hcloud-ccm/route-10.7.0.0-24": "my-cluster",
+		"hcloud-ccm/route-10.8.0.0-24": "other-cluster",
+	}
+	env.Mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.ServerListResponse{
+			Servers: []schema.Server{
+				{ID: 1, Name: "node1", PrivateNet: []schema.ServerPrivateNet{{Network: 1, IP: "10.0.0.2"}}},
+				{ID: 2, Name: "node2", PrivateNet: []schema.ServerPrivateNet{{Network: 1, IP: "10.0.0.3"}}},
+			},
+		})
+	})
+	env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var reqBody schema.NetworkUpdateRequest
+			if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+				t.Fatal(err)
+			}
+			labels = *reqBody.Labels
+		}
+		json.NewEncoder(w).Encode(schema.NetworkGetResponse{
+			Network: schema.Network{
+				ID:      1,
+				Name:    "network-1",
+				IPRange: "10.0.0.0/8",
+				Labels:  labels,
+				Routes: []schema.NetworkRoute{
+					// node1 still exists.
+					{Destination: "10.5.0.0/24", Gateway: "10.0.0.2"},
+					// The server of node2 exists, but the node was deleted.
+					{Destination: "10.6.0.0/24", Gateway: "10.0.0.3"},
+					// The server of the node was deleted.
+					{Destination: "10.7.0.0/24", Gateway: "10.0.0.4"},
+					// Owned by another cluster.
+					{Destination: "10.8.0.0/24", Gateway: "10.0.0.3"},
+					// Without an owner.
+					{Destination: "10.9.0.0/24", Gateway: "10.0.0.3"},
+				},
+			},
+		})
+	})
+	env.Mux.HandleFunc("/actions", func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(schema.ActionListResponse{
+			Actions: []schema.Action{
+				{ID: 1, Status: string(hcloud.ActionStatusSuccess), Progress: 100},
+			},
+		})
+	})
+	var deleted []string
+	env.Mux.HandleFunc("/networks/1/actions/delete_route", func(w http.ResponseWriter, r *http.Request) {
+		var reqBody schema.NetworkActionDeleteRouteRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Fatal(err)
+		}
+		deleted = append(deleted, reqBody.Destination)
+		json.NewEncoder(w).Encode(schema.NetworkActionDeleteRouteResponse{
+			Action: schema.Action{ID: 1, Status: string(hcloud.ActionStatusRunning)},
+		})
+	})
+
+	routes, err := newRoutes(env.Client, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Without nodes, e.g. if the node list is not available yet, routes are
+	// not deleted.
+	routes.nodeClient = fake.NewSimpleClientset()
+	if err := routes.cleanupOrphanedRoutes(context.TODO(), "my-cluster"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Unexpected deleted routes %v", deleted)
+	}
+
+	routes.nodeClient = fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	if err := routes.cleanupOrphanedRoutes(context.TODO(), "my-cluster"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(deleted) != 2 || deleted[0] != "10.6.0.0/24" || deleted[1] != "10.7.0.0/24" {
+		t.Errorf("Unexpected deleted routes %v", deleted)
+	}
+	if _, ok := labels["hcloud-ccm/route-10.6.0.0-24"]; ok {
+		t.Errorf("Expected route owner of deleted route to be removed: %v", labels)
+	}
+	if labels["hcloud-ccm/route-10.5.0.0-24"] != "my-cluster" || labels["hcloud-ccm/route-10.8.0.0-24"] != "other-cluster" {
+		t.Errorf("Expected route owners of remaining routes to be kept: %v", labels)
+	}
+}
+
+func TestRoutes_ProtectNetwork(t *testing.T) {
+	env := newTestEnv()
+	defer env.Teardown()
+
+	protected := false
+	env.Mux.HandleFunc("/networks/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.NetworkGetResponse{
+			Network: schema.Network{
+				ID:         1,
+				Name:       "network-1",
+				IPRange:    "10.0.0.0/8",
+				Protection: schema.NetworkProtection{Delete: protected},
+			},
+		})
+	})
+	env.Mux.HandleFunc("/actions", func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(schema.ActionListResponse{
+			Actions: []schema.Action{
+				{ID: 1, Status: string(hcloud.ActionStatusSuccess), Progress: 100},
+			},
+		})
+	})
+	calls := 0
+	env.Mux.HandleFunc("/networks/1/actions/change_protection", func(w http.ResponseWriter, r *http.Request) {
+		var reqBody schema.NetworkActionChangeProtectionRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Fatal(err)
+		}
+		if reqBody.Delete == nil || !*reqBody.Delete {
+			t.Errorf("unexpected Delete: %v", reqBody.Delete)
+		}
+		calls++
+		protected = true
+		json.NewEncoder(w).Encode(schema.NetworkActionChangeProtectionResponse{
+			Action: schema.Action{ID: 1, Status: string(hcloud.ActionStatusRunning)},
+		})
+	})
+
+	routes, err := newRoutes(env.Client, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Disabled by default.
+	if _, err := routes.ListRoutes(context.TODO(), "my-cluster"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Unexpected change of the network protection")
+	}
+
+	routes.protectNetwork = true
+	if err := routes.ensureNetworkProtection(context.TODO()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls != 1 || !routes.network.Protection.Delete {
+		t.Errorf("Expected delete protection of the network to be enabled")
+	}
+
+	// The protection is only changed once.
+	if _, err := routes.ListRoutes(context.TODO(), "my-cluster"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Unexpected change of the network protection, %d calls", calls)
+	}
+}
+
+func TestRouteOwnerLabel(t *testing.T) {
+	if l := routeOwnerLabel("fd00:1::/64"); l != "hcloud-ccm/route-fd00_1__-64" {
+		t.Errorf("Unexpected label %s", l)
+	}
+	if v := routeOwnerValue("my-cluster"); v != "my-cluster" {
+		t.Errorf("Unexpected value %s", v)
+	}
+	if v := routeOwnerValue("my cluster"); len(v) != len("sha256-")+16 {
+		t.Errorf("Unexpected value %s", v)
+	}
+}
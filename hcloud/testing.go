@@ -75,6 +75,7 @@ type LoadBalancerTestCase struct {
 	ServiceAnnotations           map[annotation.Name]interface{}
 	DisablePrivateIngressDefault bool
 	DisableIPv6Default           bool
+	ReportTargetHealth           bool
 	Nodes                        []*corev1.Node
 	LB                           *hcloud.LoadBalancer
 	LBCreateResult               *hcloud.LoadBalancerCreateResult
@@ -110,6 +111,7 @@ func (tt *LoadBalancerTestCase) run(t *testing.T) {
 	}
 	tt.Service = &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{UID: types.UID(tt.ServiceUID)},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80, NodePort: 8080}}},
 	}
 	for k, v := range tt.ServiceAnnotations {
 		if err := k.AnnotateService(tt.Service, v); err != nil {
@@ -125,6 +127,9 @@ func (tt *LoadBalancerTestCase) run(t *testing.T) {
 	}
 
 	tt.LoadBalancers = newLoadBalancers(tt.LBOps, tt.ActionClient, tt.DisablePrivateIngressDefault, tt.DisableIPv6Default)
+	if tt.ReportTargetHealth {
+		tt.LoadBalancers.targetHealth = newLBTargetHealth()
+	}
 	tt.Perform(t, tt)
 
 	tt.LBOps.AssertExpectations(t)
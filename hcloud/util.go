@@ -20,12 +20,12 @@ import (
 	"context"
 	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/providerid"
 	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
 	"github.com/syself/hrobot-go/models"
 	corev1 "k8s.io/api/core/v1"
@@ -38,25 +38,15 @@ func getHCloudServerByName(ctx context.Context, c *hcloud.Client, name string) (
 
 	server, _, err := c.Server.GetByName(ctx, name)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, hcops.NewAPIError("get", "server "+name, err))
 	}
 
 	return server, nil
 }
 
-func getHCloudServerByID(ctx context.Context, c *hcloud.Client, id int64) (*hcloud.Server, error) {
-	const op = "hcloud/getServerByID"
-	metrics.OperationCalled.WithLabelValues(op).Inc()
-
-	server, _, err := c.Server.GetByID(ctx, id)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	return server, nil
-}
-
-func getRobotServerByName(c robotclient.Client, node *corev1.Node) (server *models.Server, err error) {
-	const op = "robot/getServerByName"
+// getRobotServersByName returns all robot servers named like node.
+func getRobotServersByName(c robotclient.Client, node *corev1.Node) ([]models.Server, error) {
+	const op = "robot/getServersByName"
 
 	if c == nil {
 		return nil, errMissingRobotCredentials
@@ -64,24 +54,111 @@ func getRobotServerByName(c robotclient.Client, node *corev1.Node) (server *mode
 
 	// check for rate limit
 	if hcops.IsRateLimitExceeded(node) {
-		return nil, fmt.Errorf("%s: rate limit exceeded - next try at %q", op, hcops.TimeOfNextPossibleAPICall().String())
+		err := fmt.Errorf("%s: rate limit exceeded - next try at %q", op, hcops.TimeOfNextPossibleAPICall().String())
+		return staleRobotServersByName(c, node, err)
 	}
 
 	serverList, err := c.ServerGetList()
 	if err != nil {
 		hcops.HandleRateLimitExceededError(err, node)
-		return nil, fmt.Errorf("%s: %w", op, err)
+		err = fmt.Errorf("%s: %w", op, hcops.NewAPIError("list", "robot servers", err))
+		if hcops.IsRobotRateLimitError(err) {
+			return staleRobotServersByName(c, node, err)
+		}
+		return nil, err
+	}
+
+	return robotServersNamed(serverList, node.Name), nil
+}
+
+func robotServersNamed(serverList []models.Server, name string) []models.Server {
+	var servers []models.Server
+	for _, s := range serverList {
+		if s.Name == name {
+			servers = append(servers, s)
+		}
+	}
+	return servers
+}
+
+// staleRobotServers returns the cached robot servers of c while the rate
+// limit of the Robot API is exceeded, which keeps the metadata of robot nodes
+// stable until the servers can be listed again. The servers may be stale.
+func staleRobotServers(c robotclient.Client, node *corev1.Node) ([]models.Server, bool) {
+	cc, ok := c.(robotclient.CachingClient)
+	if !ok {
+		return nil, false
+	}
+	servers, ok := cc.CachedServerGetList()
+	if !ok {
+		return nil, false
 	}
+	metrics.RobotCacheRequests.WithLabelValues("stale").Inc()
+	klog.Warningf("robot rate limit exceeded, using cached and possibly stale robot servers for node %s", node.Name)
+	return servers, true
+}
 
-	for i, s := range serverList {
-		if s.Name == node.Name {
-			server = &serverList[i]
+// staleRobotServersByName returns the cached robot servers named like node,
+// or err if none is cached. A server missing from the cache may have been
+// added since, so it is not reported as not found.
+func staleRobotServersByName(c robotclient.Client, node *corev1.Node, err error) ([]models.Server, error) {
+	cached, ok := staleRobotServers(c, node)
+	if !ok {
+		return nil, err
+	}
+	servers := robotServersNamed(cached, node.Name)
+	if len(servers) == 0 {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// staleRobotServerByID returns the cached robot server id of node, or err if
+// it is not cached.
+func staleRobotServerByID(c robotclient.Client, id int, node *corev1.Node, err error) (*models.Server, error) {
+	cached, ok := staleRobotServers(c, node)
+	if !ok {
+		return nil, err
+	}
+	for i := range cached {
+		if cached[i].ServerNumber == id && cached[i].Name == node.Name {
+			return &cached[i], nil
 		}
 	}
+	return nil, err
+}
 
+func getHCloudServerByID(ctx context.Context, c *hcloud.Client, id int64) (*hcloud.Server, error) {
+	const op = "hcloud/getServerByID"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	server, _, err := c.Server.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, hcops.NewAPIError("get", fmt.Sprintf("server %d", id), err))
+	}
 	return server, nil
 }
 
+// getRobotServerByName returns the robot server named like node, nil if
+// there is none. Robot server names are not unique, errAmbiguousServerName is
+// returned if more than one server has the name.
+func getRobotServerByName(c robotclient.Client, node *corev1.Node) (*models.Server, error) {
+	const op = "robot/getServerByName"
+
+	servers, err := getRobotServersByName(c, node)
+	if err != nil {
+		return nil, err
+	}
+	switch len(servers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &servers[0], nil
+	default:
+		return nil, fmt.Errorf("%s: %w", op, ambiguousServerName(node.Name, len(servers)))
+	}
+}
+
 func getRobotServerByID(c robotclient.Client, id int, node *corev1.Node) (s *models.Server, e error) {
 	const op = "robot/getServerByID"
 	if node.Name == "" {
@@ -94,16 +171,21 @@ func getRobotServerByID(c robotclient.Client, id int, node *corev1.Node) (s *mod
 
 	// check for rate limit
 	if hcops.IsRateLimitExceeded(node) {
-		return nil, fmt.Errorf("%s: rate limit exceeded - next try at %q", op, hcops.TimeOfNextPossibleAPICall().String())
+		err := fmt.Errorf("%s: rate limit exceeded - next try at %q", op, hcops.TimeOfNextPossibleAPICall().String())
+		return staleRobotServerByID(c, id, node, err)
 	}
 
 	server, err := c.ServerGet(id)
-	if models.IsError(err, models.ErrorCodeServerNotFound) {
+	if hcops.IsRobotError(err, models.ErrorCodeServerNotFound) {
 		return nil, nil
 	}
 	if err != nil {
 		hcops.HandleRateLimitExceededError(err, node)
-		return nil, fmt.Errorf("%s: %w", op, err)
+		err = fmt.Errorf("%s: %w", op, hcops.NewAPIError("get", fmt.Sprintf("robot server %d", id), err))
+		if hcops.IsRobotRateLimitError(err) {
+			return staleRobotServerByID(c, id, node, err)
+		}
+		return nil, err
 	}
 
 	// check whether name matches - otherwise this server does not belong to the respective node anymore
@@ -118,43 +200,33 @@ func getRobotServerByID(c robotclient.Client, id int, node *corev1.Node) (s *mod
 	return server, nil
 }
 
-func providerIDToServerID(providerID string) (id int64, isHCloudServer bool, err error) {
-	const op = "hcloud/providerIDToServerID"
-	metrics.OperationCalled.WithLabelValues(op).Inc()
+func isHCloudServerByName(name string) bool {
+	return !strings.HasPrefix(name, hostNamePrefixRobot)
+}
 
-	providerPrefixHCloud := providerName + "://"
-	providerPrefixRobot := providerName + "://" + hostNamePrefixRobot
+// providerPrefixHRobot prefixes the provider IDs of robot servers in the
+// robotProviderIDFormatHRobot format.
+const providerPrefixHRobot = providerid.PrefixHRobot
 
-	if !strings.HasPrefix(providerID, providerPrefixHCloud) && !strings.HasPrefix(providerID, providerPrefixRobot) {
-		klog.Infof("%s: make sure your cluster configured for an external cloud provider", op)
-		return 0, false, fmt.Errorf("%s: missing prefix %s or %s. %s", providerPrefixHCloud, providerPrefixRobot, op, providerID)
-	}
+// robotProviderIDFormat selects the provider ID of robot nodes. Provider IDs
+// of both formats are always accepted, as the provider ID of existing nodes
+// can not be changed.
+type robotProviderIDFormat string
 
-	isHCloudServer = true
-	idString := providerID
-	if strings.HasPrefix(providerID, providerPrefixRobot) {
-		isHCloudServer = false
-		idString = strings.ReplaceAll(idString, providerPrefixRobot, "")
-	} else {
-		idString = strings.ReplaceAll(providerID, providerPrefixHCloud, "")
-	}
+const (
+	// robotProviderIDFormatHCloud formats the provider IDs of robot servers
+	// as "hcloud://bm-<server number>".
+	robotProviderIDFormatHCloud robotProviderIDFormat = "hcloud"
 
-	if idString == "" {
-		return 0, false, fmt.Errorf("%s: missing serverID: %s", op, providerID)
-	}
+	// robotProviderIDFormatHRobot formats the provider IDs of robot servers
+	// as "hrobot://<server number>".
+	robotProviderIDFormatHRobot robotProviderIDFormat = "hrobot"
+)
 
-	id, err = strconv.ParseInt(idString, 10, 64)
-	if err != nil {
-		return 0, false, fmt.Errorf("%s: invalid serverID: %s", op, providerID)
+func serverIDToProviderIDRobot(format robotProviderIDFormat, serverID int) string {
+	if format == robotProviderIDFormatHRobot {
+		return fmt.Sprintf("%s%d", providerPrefixHRobot, serverID)
 	}
-	return id, isHCloudServer, nil
-}
-
-func isHCloudServerByName(name string) bool {
-	return !strings.HasPrefix(name, hostNamePrefixRobot)
-}
-
-func serverIDToProviderIDRobot(serverID int) string {
 	return fmt.Sprintf("%s://%s%d", providerName, hostNamePrefixRobot, serverID)
 }
 
@@ -10,7 +10,8 @@ import (
 
 const (
 	// LBID is the ID assigned to the Hetzner Cloud Load Balancer by the
-	// backend. Read-only.
+	// backend. It can be set to adopt the existing Load Balancer with this ID
+	// instead of looking it up by name or creating it.
 	LBID Name = "load-balancer.hetzner.cloud/id"
 
 	// LBPublicIPv4 is the public IPv4 address assigned to the Load Balancer by
@@ -36,10 +37,58 @@ const (
 	// Default: false.
 	LBIPv6Disabled Name = "load-balancer.hetzner.cloud/ipv6-disabled"
 
+	// LBTargetIPFamily selects the IP family used for IP targets of
+	// dedicated (robot) servers. Possible values are ipv4, ipv6 and
+	// dualstack. If the server has no address of the selected family, its
+	// other address is used and a warning event is recorded.
+	//
+	// Default: dualstack, or ipv4 if LBIPv6Disabled is set.
+	LBTargetIPFamily Name = "load-balancer.hetzner.cloud/target-ip-family"
+
+	// LBTargetIPv6Offset selects the IPv6 address of dedicated (robot)
+	// servers used as target by its offset within the IPv6 subnet of the
+	// server, e.g. ::2 for 2a01:f48:111:4221::2 in the subnet
+	// 2a01:f48:111:4221::/64. Larger subnets allow selecting other /64
+	// subnets, e.g. 0:0:0:1::1. The offset must be within the subnet.
+	//
+	// Default: ::1, the first address of the subnet.
+	LBTargetIPv6Offset Name = "load-balancer.hetzner.cloud/target-ipv6-offset"
+
+	// LBIPv4Disabled stops reporting the public IPv4 address of the Load
+	// Balancer as ingress, which makes the Load Balancer IPv6-only for
+	// clients of the Service. The Hetzner Cloud API always assigns a public
+	// IPv4 address to Load Balancers with a public interface, it is not
+	// removed from the Load Balancer.
+	//
+	// Can not be combined with LBIPv6Disabled. Use LBDisablePublicNetwork
+	// instead.
+	//
+	// Default: false.
+	LBIPv4Disabled Name = "load-balancer.hetzner.cloud/disable-ipv4"
+
+	// LBTargetsHealthy is the number of targets of the Load Balancer which
+	// are healthy for all of its services. Read-only.
+	//
+	// Only set if HCLOUD_LOAD_BALANCERS_REPORT_TARGET_HEALTH is enabled.
+	LBTargetsHealthy Name = "load-balancer.hetzner.cloud/targets-healthy"
+
+	// LBTargetsUnhealthy is the number of targets of the Load Balancer which
+	// are unhealthy for at least one of its services. Read-only.
+	//
+	// Only set if HCLOUD_LOAD_BALANCERS_REPORT_TARGET_HEALTH is enabled.
+	LBTargetsUnhealthy Name = "load-balancer.hetzner.cloud/targets-unhealthy"
+
 	// LBName is the name of the Load Balancer. The name will be visible in
 	// the Hetzner Cloud API console.
 	LBName Name = "load-balancer.hetzner.cloud/name"
 
+	// LBDeletionProtection enables the delete protection of the Load
+	// Balancer. Protected Load Balancers are not deleted together with their
+	// Service, the deletion of the Service is retried until the protection is
+	// removed. If set to false, the protection is removed. If not set, the
+	// protection is not changed.
+	LBDeletionProtection Name = "load-balancer.hetzner.cloud/deletion-protection"
+
 	// LBDisablePublicNetwork disables the public network of the Hetzner Cloud
 	// Load Balancer. It will still have a public network assigned, but all
 	// traffic is routed over the private network.
@@ -49,6 +98,12 @@ const (
 	// ingress.
 	LBDisablePrivateIngress Name = "load-balancer.hetzner.cloud/disable-private-ingress"
 
+	// LBExposePrivateIP controls whether the IPs of the Load Balancer in the
+	// private networks are reported in the status of the Service. If not set,
+	// they are reported unless LBDisablePrivateIngress is enabled. Setting it
+	// to true can not be combined with LBDisablePrivateIngress.
+	LBExposePrivateIP Name = "load-balancer.hetzner.cloud/expose-private-ip"
+
 	// LBUsePrivateIP configures the Load Balancer to use the private IP for
 	// Load Balancer server targets.
 	LBUsePrivateIP Name = "load-balancer.hetzner.cloud/use-private-ip"
@@ -58,6 +113,18 @@ const (
 	// specified.
 	LBHostname Name = "load-balancer.hetzner.cloud/hostname"
 
+	// LBWaitForReady makes EnsureLoadBalancer wait until the Load Balancer
+	// has all addresses reported in the status of the Service assigned, at
+	// most for LBWaitForReadyTimeout. Load Balancers without addresses in
+	// the status, e.g. with LBHostname, are ready right away. By default the
+	// status is reported as soon as the Load Balancer is created.
+	LBWaitForReady Name = "load-balancer.hetzner.cloud/wait-for-ready"
+
+	// LBWaitForReadyTimeout is the maximum time EnsureLoadBalancer waits for
+	// the Load Balancer to become ready if LBWaitForReady is enabled.
+	// Default: 2m.
+	LBWaitForReadyTimeout Name = "load-balancer.hetzner.cloud/wait-for-ready-timeout"
+
 	// LBSvcProtocol specifies the protocol of the service. Default: tcp, Possible
 	// values: tcp, http, https
 	LBSvcProtocol Name = "load-balancer.hetzner.cloud/protocol"
@@ -85,6 +152,16 @@ const (
 	// Mutually exclusive with LBNetworkZone.
 	LBLocation Name = "load-balancer.hetzner.cloud/location"
 
+	// LBLocationFallback is a comma separated list of locations which are
+	// tried in order if the Load Balancer can not be created in LBLocation
+	// (or LBNetworkZone) because the location is out of capacity. The
+	// location the Load Balancer was created in is recorded in the
+	// hcloud-ccm/location label of the Load Balancer.
+	//
+	// Like LBLocation, the fallback is only used when the Load Balancer is
+	// created.
+	LBLocationFallback Name = "load-balancer.hetzner.cloud/location-fallback"
+
 	// LBNetworkZone specifies the network zone where the Load Balancer will be
 	// created in.
 	//
@@ -107,12 +184,85 @@ const (
 	// Format: https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#label-selectors
 	LBNodeSelector Name = "load-balancer.hetzner.cloud/node-selector"
 
+	// LBTargetZones restricts the targets of the Load Balancer to Nodes in
+	// the listed zones, separated by commas. Entries are matched against
+	// the topology.kubernetes.io/zone label of the Nodes, either as
+	// datacenter, e.g. fsn1-dc14, or as location, e.g. fsn1. Nodes without
+	// zone label are not added as targets.
+	//
+	// The zones are applied in addition to LBNodeSelector.
+	LBTargetZones Name = "load-balancer.hetzner.cloud/target-zones"
+
+	// LBSourceRanges is a comma separated list of client CIDRs which should be
+	// able to reach the Load Balancer. It takes precedence over
+	// spec.loadBalancerSourceRanges of the Service.
+	//
+	// Hetzner Cloud Load Balancers do not filter traffic by source address
+	// and the targets only see the address of the Load Balancer. The ranges
+	// are validated, but not enforced. A warning event is recorded on the
+	// Service instead.
+	LBSourceRanges Name = "load-balancer.hetzner.cloud/source-ranges"
+
+	// LBAdditionalTargets is a comma separated list of IP addresses which are
+	// added as IP targets to the Load Balancer in addition to the Nodes, e.g.
+	// for servers outside of the cluster. Private addresses require the Load
+	// Balancer to be attached to the network of the cluster, and have to be in
+	// its IP range.
+	LBAdditionalTargets Name = "load-balancer.hetzner.cloud/additional-targets"
+
+	// LBSkipUnsupportedPorts skips ports of the Service with a protocol
+	// Hetzner Cloud Load Balancers do not support, e.g. UDP. A warning event
+	// is recorded for every skipped port. If not set, such ports fail the
+	// reconciliation of the Load Balancer.
+	//
+	// Default: false.
+	LBSkipUnsupportedPorts Name = "load-balancer.hetzner.cloud/skip-unsupported-ports"
+
+	// LBMaxTargetsPolicy configures what happens if there are more Nodes than
+	// the type of the Load Balancer supports as targets. If set to "upgrade"
+	// the Load Balancer is changed to the next larger type. This requires
+	// LBType to be unset. If set to "subset" a deterministic subset of the
+	// Nodes, sorted by name, is added as targets. If not set, Nodes are added
+	// until the limit is reached and a Warning Event is created.
+	LBMaxTargetsPolicy Name = "load-balancer.hetzner.cloud/max-targets-policy"
+
+	// LBProfile references a named set of annotations configured in the
+	// profiles ConfigMap of the cloud controller manager. The annotations of
+	// the profile are applied to the Service unless the Service sets them
+	// explicitly.
+	LBProfile Name = "load-balancer.hetzner.cloud/profile"
+
+	// LBSessionMode is a shorthand for the protocol, algorithm type and
+	// sticky sessions of common configurations. The expanded annotations are
+	// only applied unless the Service or its profile sets them explicitly.
+	//
+	// Possible values: sticky-http, sticky-https, least-connections
+	LBSessionMode Name = "load-balancer.hetzner.cloud/session-mode"
+
+	// LBTargetWeightLabel specifies the key of a Node label which is used to
+	// group the Load Balancer targets by weight. The value of the label must
+	// be a non-negative integer. Nodes without the label have a weight of 1.
+	//
+	// Hetzner Cloud Load Balancers do not support weighted targets. Nodes
+	// with a weight of 0 are not added as targets, all other nodes are added
+	// with equal weight. The intended distribution is logged on every
+	// reconcile.
+	LBTargetWeightLabel Name = "load-balancer.hetzner.cloud/target-weight-label"
+
 	// LBSvcProxyProtocol specifies if the Load Balancer services should
 	// use the proxy protocol.
 	//
 	// Default: false.
 	LBSvcProxyProtocol Name = "load-balancer.hetzner.cloud/uses-proxyprotocol"
 
+	// LBSvcDestinationPortNames maps ports of the Service to the names of
+	// other ports of the Service, e.g. "80=http-proxy,443=https-proxy". The
+	// Load Balancer service of a mapped port forwards the traffic to the node
+	// port of the named port instead of its own node port. This allows e.g.
+	// to expose the proxy protocol ports of an ingress controller on the
+	// standard ports.
+	LBSvcDestinationPortNames Name = "load-balancer.hetzner.cloud/destination-port-names"
+
 	// LBSvcHTTPCookieName specifies the cookie name when using  HTTP or HTTPS
 	// as protocol.
 	LBSvcHTTPCookieName Name = "load-balancer.hetzner.cloud/http-cookie-name"
@@ -177,6 +327,21 @@ const (
 	// on.
 	LBSvcHealthCheckPort Name = "load-balancer.hetzner.cloud/health-check-port"
 
+	// LBSvcHealthCheckPortName specifies the name of a port of the Service
+	// the health check is performed on. The health check is performed on
+	// the node port of the named port.
+	//
+	// Mutually exclusive with LBSvcHealthCheckPort.
+	LBSvcHealthCheckPortName Name = "load-balancer.hetzner.cloud/health-check-port-name"
+
+	// LBSvcHealthCheckDestinationPort specifies a port of the Service the
+	// health check is performed on, e.g. a dedicated health port. The health
+	// check is performed on the node port of this port.
+	//
+	// Mutually exclusive with LBSvcHealthCheckPort and
+	// LBSvcHealthCheckPortName.
+	LBSvcHealthCheckDestinationPort Name = "load-balancer.hetzner.cloud/health-check-destination-port"
+
 	// LBSvcHealthCheckInterval specifies the interval in which time we perform
 	// a health check in seconds.
 	LBSvcHealthCheckInterval Name = "load-balancer.hetzner.cloud/health-check-interval"
@@ -185,25 +350,49 @@ const (
 	LBSvcHealthCheckTimeout Name = "load-balancer.hetzner.cloud/health-check-timeout"
 
 	// LBSvcHealthCheckRetries specifies the number of time a health check is
-	// retried until a target is marked as unhealthy.
+	// retried until a target is marked as unhealthy, between 0 and
+	// MaxHealthCheckRetries. Fewer retries remove unhealthy targets faster.
 	LBSvcHealthCheckRetries Name = "load-balancer.hetzner.cloud/health-check-retries"
 
 	// LBSvcHealthCheckHTTPDomain specifies the domain we try to access when
 	// performing the health check.
 	LBSvcHealthCheckHTTPDomain Name = "load-balancer.hetzner.cloud/health-check-http-domain"
 
+	// LBSvcHealthCheckHTTPHost specifies the HTTP Host header sent when
+	// performing HTTP or HTTPS health checks. It is an alias of
+	// LBSvcHealthCheckHTTPDomain and takes precedence if both are set.
+	LBSvcHealthCheckHTTPHost Name = "load-balancer.hetzner.cloud/health-check-http-host"
+
+	// LBSvcHealthCheckHTTPSSNI specifies the server name for HTTPS health
+	// checks of targets which require SNI. The Hetzner Cloud API has a single
+	// domain setting for HTTP and HTTPS health checks, so it is an alias of
+	// LBSvcHealthCheckHTTPDomain which is only allowed for HTTPS health checks.
+	// It must not conflict with LBSvcHealthCheckHTTPDomain or
+	// LBSvcHealthCheckHTTPHost.
+	LBSvcHealthCheckHTTPSSNI Name = "load-balancer.hetzner.cloud/health-check-https-sni"
+
 	// LBSvcHealthCheckHTTPPath specifies the path we try to access when
 	// performing the health check.
 	LBSvcHealthCheckHTTPPath Name = "load-balancer.hetzner.cloud/health-check-http-path"
 
 	// LBSvcHealthCheckHTTPValidateCertificate specifies whether the health
 	// check should validate the SSL certificate that comes from the target
-	// nodes.
+	// nodes. Like LBSvcHealthCheckHTTPHost it requires an HTTP or HTTPS health
+	// check.
 	LBSvcHealthCheckHTTPValidateCertificate Name = "load-balancer.hetzner.cloud/health-check-http-validate-certificate"
 
 	// LBSvcHealthCheckHTTPStatusCodes is a comma separated list of HTTP status
 	// codes which we expect.
 	LBSvcHealthCheckHTTPStatusCodes Name = "load-balancer.hetzner.cloud/http-status-codes"
+
+	// LBSvcHealthCheckDisabled configures the most lenient health check for
+	// Services which manage their own health. The Hetzner Cloud API requires a
+	// health check for each service of a Load Balancer, so it can not be
+	// removed. Instead a TCP health check on the destination port with the
+	// longest interval and timeout and the most retries is used.
+	//
+	// Mutually exclusive with all other health check annotations.
+	LBSvcHealthCheckDisabled Name = "load-balancer.hetzner.cloud/disable-health-check"
 )
 
 // LBToService sets the relevant annotations on svc to their respective values
@@ -281,6 +470,54 @@ func LBToService(svc *corev1.Service, lb *hcloud.LoadBalancer) error {
 	return nil
 }
 
+// LBTargetHealthToService sets the number of healthy and unhealthy targets
+// of lb as annotations on svc.
+//
+// A target is considered healthy if it is healthy for all services of lb and
+// unhealthy if it is unhealthy for at least one service. Targets with an
+// unknown health status are not counted.
+func LBTargetHealthToService(svc *corev1.Service, lb *hcloud.LoadBalancer) error {
+	const op = "annotation/LBTargetHealthToService"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	var healthy, unhealthy int
+
+	for _, target := range lb.Targets {
+		switch targetHealth(target.HealthStatus) {
+		case hcloud.LoadBalancerTargetHealthStatusStatusHealthy:
+			healthy++
+		case hcloud.LoadBalancerTargetHealthStatusStatusUnhealthy:
+			unhealthy++
+		}
+	}
+
+	sa := &serviceAnnotator{Svc: svc}
+	sa.Annotate(LBTargetsHealthy, healthy)
+	sa.Annotate(LBTargetsUnhealthy, unhealthy)
+
+	if sa.Err != nil {
+		return fmt.Errorf("%s: %w", op, sa.Err)
+	}
+	return nil
+}
+
+func targetHealth(statuses []hcloud.LoadBalancerTargetHealthStatus) hcloud.LoadBalancerTargetHealthStatusStatus {
+	if len(statuses) == 0 {
+		return hcloud.LoadBalancerTargetHealthStatusStatusUnknown
+	}
+	health := hcloud.LoadBalancerTargetHealthStatusStatusHealthy
+	for _, hs := range statuses {
+		switch hs.Status {
+		case hcloud.LoadBalancerTargetHealthStatusStatusUnhealthy:
+			return hcloud.LoadBalancerTargetHealthStatusStatusUnhealthy
+		case hcloud.LoadBalancerTargetHealthStatusStatusHealthy:
+		default:
+			health = hcloud.LoadBalancerTargetHealthStatusStatusUnknown
+		}
+	}
+	return health
+}
+
 func isHTTP(s hcloud.LoadBalancerService) bool {
 	return s.Protocol == hcloud.LoadBalancerServiceProtocolHTTP
 }
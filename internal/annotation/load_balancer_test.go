@@ -166,3 +166,29 @@ func TestLBToService_AddAnnotations(t *testing.T) {
 		})
 	}
 }
+
+func TestLBTargetHealthToService(t *testing.T) {
+	// The health of all targets is part of the Load Balancer, it is
+	// aggregated without further requests regardless of the number of
+	// targets.
+	lb := &hcloud.LoadBalancer{}
+	for i := 0; i < 300; i++ {
+		statuses := []hcloud.LoadBalancerTargetHealthStatus{
+			{ListenPort: 80, Status: hcloud.LoadBalancerTargetHealthStatusStatusHealthy},
+			{ListenPort: 443, Status: hcloud.LoadBalancerTargetHealthStatusStatusHealthy},
+		}
+		switch i % 3 {
+		case 1:
+			statuses[1].Status = hcloud.LoadBalancerTargetHealthStatusStatusUnhealthy
+		case 2:
+			statuses[1].Status = hcloud.LoadBalancerTargetHealthStatusStatusUnknown
+		}
+		lb.Targets = append(lb.Targets, hcloud.LoadBalancerTarget{HealthStatus: statuses})
+	}
+
+	svc := &corev1.Service{}
+	err := annotation.LBTargetHealthToService(svc, lb)
+	assert.NoError(t, err)
+	assert.Equal(t, "100", svc.Annotations[string(annotation.LBTargetsHealthy)])
+	assert.Equal(t, "100", svc.Annotations[string(annotation.LBTargetsUnhealthy)])
+}
@@ -166,6 +166,41 @@ func (s Name) IntsFromService(svc *corev1.Service) ([]int, error) {
 	return is, err
 }
 
+// PortNamesFromService retrieves the map of ports to port names belonging to
+// the annotation from svc. The value is a comma separated list of
+// <port>=<name> pairs.
+//
+// PortNamesFromService returns an error if the value could not be converted,
+// a port is listed more than once, or the annotation was not set. In the case
+// of a missing value, the error wraps ErrNotSet.
+func (s Name) PortNamesFromService(svc *corev1.Service) (map[int]string, error) {
+	const op = "annotation/Name.PortNamesFromService"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	var names map[int]string
+
+	err := s.applyToValue(op, svc, func(v string) error {
+		names = make(map[int]string)
+		for _, pair := range strings.Split(v, ",") {
+			port, name, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || name == "" {
+				return fmt.Errorf("invalid port mapping %q, expected <port>=<name>", pair)
+			}
+			p, err := strconv.Atoi(port)
+			if err != nil {
+				return err
+			}
+			if _, ok := names[p]; ok {
+				return fmt.Errorf("port %d mapped more than once", p)
+			}
+			names[p] = name
+		}
+		return nil
+	})
+
+	return names, err
+}
+
 // IPFromService retrieves the net.IP value belonging to the annotation from
 // svc.
 //
@@ -189,6 +224,58 @@ func (s Name) IPFromService(svc *corev1.Service) (net.IP, error) {
 	return ip, err
 }
 
+// IPsFromService retrieves the []net.IP value belonging to the annotation
+// from svc. The value is a comma separated list of IP addresses.
+//
+// IPsFromService returns an error if any of the values could not be
+// converted to a net.IP, or the annotation was not set. In the case of a
+// missing value, the error wraps ErrNotSet.
+func (s Name) IPsFromService(svc *corev1.Service) ([]net.IP, error) {
+	const op = "annotation/Name.IPsFromService"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	var ips []net.IP
+
+	err := s.applyToValue(op, svc, func(v string) error {
+		for _, raw := range strings.Split(v, ",") {
+			ip := net.ParseIP(strings.TrimSpace(raw))
+			if ip == nil {
+				return fmt.Errorf("invalid ip address: %s", strings.TrimSpace(raw))
+			}
+			ips = append(ips, ip)
+		}
+		return nil
+	})
+
+	return ips, err
+}
+
+// IPNetsFromService retrieves the []*net.IPNet value belonging to the
+// annotation from svc. The value is a comma separated list of CIDRs.
+//
+// IPNetsFromService returns an error if any of the values could not be
+// converted to a *net.IPNet, or the annotation was not set. In the case of a
+// missing value, the error wraps ErrNotSet.
+func (s Name) IPNetsFromService(svc *corev1.Service) ([]*net.IPNet, error) {
+	const op = "annotation/Name.IPNetsFromService"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	var ipNets []*net.IPNet
+
+	err := s.applyToValue(op, svc, func(v string) error {
+		for _, cidr := range strings.Split(v, ",") {
+			_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return err
+			}
+			ipNets = append(ipNets, ipNet)
+		}
+		return nil
+	})
+
+	return ipNets, err
+}
+
 // DurationFromService retrieves the time.Duration value belonging to the
 // annotation from svc.
 //
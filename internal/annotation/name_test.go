@@ -188,6 +188,22 @@ func TestName_BoolFromService(t *testing.T) {
 	})
 }
 
+func TestName_BoolFromNode(t *testing.T) {
+	node := func(annotations map[string]string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+	}
+
+	v, err := ann.BoolFromNode(node(map[string]string{string(ann): "true"}))
+	assert.NoError(t, err)
+	assert.True(t, v)
+
+	_, err = ann.BoolFromNode(node(nil))
+	assert.ErrorIs(t, err, annotation.ErrNotSet)
+
+	_, err = ann.BoolFromNode(node(map[string]string{string(ann): "invalid"}))
+	assert.ErrorIs(t, err, strconv.ErrSyntax)
+}
+
 func TestName_IntFromService(t *testing.T) {
 	tests := []typedAccessorTest{
 		{
@@ -238,6 +254,40 @@ func TestName_IntsFromService(t *testing.T) {
 	})
 }
 
+func TestName_PortNamesFromService(t *testing.T) {
+	tests := []typedAccessorTest{
+		{
+			name: "value set",
+			svcAnnotations: map[annotation.Name]interface{}{
+				ann: "80=http-proxy, 443=https-proxy",
+			},
+			expected: map[int]string{80: "http-proxy", 443: "https-proxy"},
+		},
+		{
+			name: "missing name",
+			svcAnnotations: map[annotation.Name]interface{}{
+				ann: "80=",
+			},
+			err: fmt.Errorf(`annotation/Name.PortNamesFromService: invalid port mapping "80=", expected <port>=<name>`),
+		},
+		{
+			name: "port mapped twice",
+			svcAnnotations: map[annotation.Name]interface{}{
+				ann: "80=http-proxy,80=https-proxy",
+			},
+			err: fmt.Errorf("annotation/Name.PortNamesFromService: port 80 mapped more than once"),
+		},
+		{
+			name: "value not set",
+			err:  annotation.ErrNotSet,
+		},
+	}
+
+	runAllTypedAccessorTests(t, tests, func(svc *corev1.Service) (interface{}, error) {
+		return ann.PortNamesFromService(svc)
+	})
+}
+
 func TestName_IPFromService(t *testing.T) {
 	tests := []typedAccessorTest{
 		{
@@ -272,6 +322,63 @@ func TestName_IPFromService(t *testing.T) {
 	})
 }
 
+func TestName_IPsFromService(t *testing.T) {
+	tests := []typedAccessorTest{
+		{
+			name: "value set",
+			svcAnnotations: map[annotation.Name]interface{}{
+				ann: "203.0.113.7, 2001:db8::1",
+			},
+			expected: []net.IP{net.ParseIP("203.0.113.7"), net.ParseIP("2001:db8::1")},
+		},
+		{
+			name: "value invalid",
+			svcAnnotations: map[annotation.Name]interface{}{
+				ann: "203.0.113.7,10.0.0.0/8",
+			},
+			err: errors.New("annotation/Name.IPsFromService: invalid ip address: 10.0.0.0/8"),
+		},
+		{
+			name: "value not set",
+			err:  annotation.ErrNotSet,
+		},
+	}
+
+	runAllTypedAccessorTests(t, tests, func(svc *corev1.Service) (interface{}, error) {
+		return ann.IPsFromService(svc)
+	})
+}
+
+func TestName_IPNetsFromService(t *testing.T) {
+	tests := []typedAccessorTest{
+		{
+			name: "value set",
+			svcAnnotations: map[annotation.Name]interface{}{
+				ann: "10.0.0.0/8, 2001:db8::/32",
+			},
+			expected: []*net.IPNet{
+				{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+				{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(32, 128)},
+			},
+		},
+		{
+			name: "value invalid",
+			svcAnnotations: map[annotation.Name]interface{}{
+				ann: "10.0.0.0/8,10.0.0.1",
+			},
+			err: errors.New("annotation/Name.IPNetsFromService: invalid CIDR address: 10.0.0.1"),
+		},
+		{
+			name: "value not set",
+			err:  annotation.ErrNotSet,
+		},
+	}
+
+	runAllTypedAccessorTests(t, tests, func(svc *corev1.Service) (interface{}, error) {
+		return ann.IPNetsFromService(svc)
+	})
+}
+
 func TestName_DurationFromService(t *testing.T) {
 	tests := []typedAccessorTest{
 		{
@@ -0,0 +1,37 @@
+package annotation
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NodeSkipNetworkAttachedCheck opts a node out of the check whether its
+// server is attached to the network of the cluster, e.g. during a migration
+// in which some nodes are intentionally not attached. If set to "true", Load
+// Balancers using private IPs skip the node without a warning and no route is
+// created for it.
+const NodeSkipNetworkAttachedCheck Name = "network.hetzner.cloud/skip-attached-check"
+
+// BoolFromNode retrieves the boolean value belonging to the annotation from
+// node.
+//
+// BoolFromNode returns an error if the value could not be converted to a
+// boolean, or the annotation was not set. In the case of a missing value, the
+// error wraps ErrNotSet.
+func (s Name) BoolFromNode(node *corev1.Node) (bool, error) {
+	const op = "annotation/Name.BoolFromNode"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	v, ok := node.Annotations[string(s)]
+	if !ok {
+		return false, fmt.Errorf("%s: %v: %w", op, s, ErrNotSet)
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v: %w", op, s, err)
+	}
+	return b, nil
+}
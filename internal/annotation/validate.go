@@ -0,0 +1,254 @@
+package annotation
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// LBPrefix is the prefix of all Load Balancer annotations.
+const LBPrefix = "load-balancer.hetzner.cloud/"
+
+// MinRobotIPv6PrefixLength is the prefix length of the largest IPv6 subnet
+// of dedicated servers. Offsets of LBTargetIPv6Offset have to be within it,
+// the subnet of each server is checked when its targets are reconciled.
+const MinRobotIPv6PrefixLength = 48
+
+// MaxHealthCheckRetries is the maximum number of health check retries
+// supported by Hetzner Cloud Load Balancers, see LBSvcHealthCheckRetries.
+const MaxHealthCheckRetries = 5
+
+// zonePattern matches the names of Hetzner Cloud locations, e.g. fsn1 or ash,
+// and datacenters, e.g. fsn1-dc14.
+var zonePattern = regexp.MustCompile(`^[a-z]+[0-9]*(-dc[0-9]+)?$`)
+
+// lbValidators contains all known Load Balancer annotations with a function
+// validating their value. Annotations whose value is an arbitrary string
+// have no validation function, as well as the addresses set by the cloud
+// controller manager, which are "<nil>" if the Load Balancer has no address of
+// the family. New annotations have to be added here, otherwise they are
+// reported as unknown by ValidateService.
+var lbValidators = map[Name]func(Name, *corev1.Service) error{
+	LBID:             validateInt,
+	LBPublicIPv4:     nil,
+	LBPublicIPv4RDNS: nil,
+	LBPublicIPv6:     nil,
+	LBPublicIPv6RDNS: nil,
+	LBIPv6Disabled:   validateBool,
+	LBTargetIPFamily: func(n Name, svc *corev1.Service) error {
+		v, _ := n.StringFromService(svc)
+		return oneOf(strings.ToLower(v), "ipv4", "ipv6", "dualstack")
+	},
+	LBTargetIPv6Offset:      validateIPv6Offset,
+	LBIPv4Disabled:          validateBool,
+	LBTargetsHealthy:        validateInt,
+	LBTargetsUnhealthy:      validateInt,
+	LBName:                  nil,
+	LBDeletionProtection:    validateBool,
+	LBDisablePublicNetwork:  validateBool,
+	LBDisablePrivateIngress: validateBool,
+	LBExposePrivateIP:       validateBool,
+	LBUsePrivateIP:          validateBool,
+	LBHostname:              nil,
+	LBWaitForReady:          validateBool,
+	LBWaitForReadyTimeout:   validateDuration,
+	LBSvcProtocol: func(n Name, svc *corev1.Service) error {
+		_, err := n.LBSvcProtocolFromService(svc)
+		return err
+	},
+	LBAlgorithmType: func(n Name, svc *corev1.Service) error {
+		_, err := n.LBAlgorithmTypeFromService(svc)
+		return err
+	},
+	LBType:             nil,
+	LBLocation:         nil,
+	LBLocationFallback: nil,
+	LBNetworkZone:      nil,
+	LBNodeSelector: func(n Name, svc *corev1.Service) error {
+		v, _ := n.StringFromService(svc)
+		_, err := labels.Parse(v)
+		return err
+	},
+	LBTargetZones: func(n Name, svc *corev1.Service) error {
+		zones, err := n.StringsFromService(svc)
+		if err != nil {
+			return err
+		}
+		for _, zone := range zones {
+			if zone = strings.TrimSpace(zone); zone != "" && !zonePattern.MatchString(zone) {
+				return fmt.Errorf("%s is neither a location nor a datacenter", zone)
+			}
+		}
+		return nil
+	},
+	LBSourceRanges: func(n Name, svc *corev1.Service) error {
+		_, err := n.IPNetsFromService(svc)
+		return err
+	},
+	LBAdditionalTargets: func(n Name, svc *corev1.Service) error {
+		ips, err := n.IPsFromService(svc)
+		if err != nil {
+			return err
+		}
+		for _, ip := range ips {
+			if ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.IsLinkLocalUnicast() {
+				return fmt.Errorf("%s is not a valid target", ip)
+			}
+		}
+		return nil
+	},
+	LBSkipUnsupportedPorts:  validateBool,
+	LBMaxTargetsPolicy:      validateOneOf("upgrade", "subset"),
+	LBProfile:               nil,
+	LBSessionMode:           nil,
+	LBTargetWeightLabel:     nil,
+	LBSvcProxyProtocol:      validateBool,
+	LBSvcHTTPCookieName:     nil,
+	LBSvcHTTPCookieLifetime: validateDuration,
+	LBSvcHTTPCertificateType: func(n Name, svc *corev1.Service) error {
+		_, err := n.CertificateTypeFromService(svc)
+		return err
+	},
+	LBSvcHTTPCertificates:                     nil,
+	LBSvcHTTPManagedCertificateName:           nil,
+	LBSvcHTTPManagedCertificateUseACMEStaging: validateBool,
+	LBSvcHTTPManagedCertificateDomains:        nil,
+	LBSvcRedirectHTTP:                         validateBool,
+	LBSvcHTTPStickySessions:                   validateBool,
+	LBSvcHealthCheckProtocol: func(n Name, svc *corev1.Service) error {
+		_, err := n.LBSvcProtocolFromService(svc)
+		return err
+	},
+	LBSvcHealthCheckPort:                    validateInt,
+	LBSvcHealthCheckPortName:                nil,
+	LBSvcHealthCheckDestinationPort:         validateInt,
+	LBSvcHealthCheckInterval:                validateDuration,
+	LBSvcHealthCheckTimeout:                 validateDuration,
+	LBSvcHealthCheckRetries:                 validateIntRange(0, MaxHealthCheckRetries),
+	LBSvcHealthCheckHTTPDomain:              nil,
+	LBSvcHealthCheckHTTPHost:                nil,
+	LBSvcHealthCheckHTTPSSNI:                nil,
+	LBSvcHealthCheckHTTPPath:                nil,
+	LBSvcHealthCheckHTTPValidateCertificate: validateBool,
+	LBSvcHealthCheckHTTPStatusCodes:         nil,
+	LBSvcHealthCheckDisabled:                validateBool,
+	LBSvcDestinationPortNames: func(n Name, svc *corev1.Service) error {
+		_, err := n.PortNamesFromService(svc)
+		return err
+	},
+}
+
+// ValidateService validates the values of all Load Balancer annotations of
+// svc. It returns the names of annotations with LBPrefix which are not known,
+// e.g. because of a typo, sorted by name. The error contains all annotations
+// with invalid values.
+func ValidateService(svc *corev1.Service) ([]string, error) {
+	const op = "annotation/ValidateService"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	keys := make([]string, 0, len(svc.Annotations))
+	for k := range svc.Annotations {
+		if strings.HasPrefix(k, LBPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var (
+		unknown []string
+		errs    []error
+	)
+	for _, k := range keys {
+		validate, ok := lbValidators[Name(k)]
+		if !ok {
+			unknown = append(unknown, k)
+			continue
+		}
+		if validate == nil {
+			continue
+		}
+		if err := validate(Name(k), svc); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q: %w", k, svc.Annotations[k], err))
+		}
+	}
+	if len(errs) > 0 {
+		return unknown, fmt.Errorf("%s: %w", op, errors.Join(errs...))
+	}
+	return unknown, nil
+}
+
+func validateBool(n Name, svc *corev1.Service) error {
+	_, err := n.BoolFromService(svc)
+	return err
+}
+
+func validateInt(n Name, svc *corev1.Service) error {
+	_, err := n.IntFromService(svc)
+	return err
+}
+
+// validateIntRange returns a validation function accepting only integers
+// between lo and hi.
+func validateIntRange(lo, hi int) func(Name, *corev1.Service) error {
+	return func(n Name, svc *corev1.Service) error {
+		v, err := n.IntFromService(svc)
+		if err != nil {
+			return err
+		}
+		if v < lo || v > hi {
+			return fmt.Errorf("must be between %d and %d", lo, hi)
+		}
+		return nil
+	}
+}
+
+// validateIPv6Offset accepts IPv6 offsets other than :: which are within a
+// subnet of MinRobotIPv6PrefixLength.
+func validateIPv6Offset(n Name, svc *corev1.Service) error {
+	offset, err := n.IPFromService(svc)
+	if err != nil {
+		return err
+	}
+	if offset.To4() != nil {
+		return errors.New("must be an IPv6 address")
+	}
+	if offset.Equal(net.IPv6unspecified) {
+		return errors.New("must not select the subnet address")
+	}
+	mask := net.CIDRMask(MinRobotIPv6PrefixLength, 8*net.IPv6len)
+	for i := range offset {
+		if offset[i]&mask[i] != 0 {
+			return fmt.Errorf("must be within a /%d subnet", MinRobotIPv6PrefixLength)
+		}
+	}
+	return nil
+}
+
+func validateDuration(n Name, svc *corev1.Service) error {
+	_, err := n.DurationFromService(svc)
+	return err
+}
+
+// validateOneOf returns a validation function accepting only values.
+func validateOneOf(values ...string) func(Name, *corev1.Service) error {
+	return func(n Name, svc *corev1.Service) error {
+		v, _ := n.StringFromService(svc)
+		return oneOf(v, values...)
+	}
+}
+
+func oneOf(v string, values ...string) error {
+	for _, allowed := range values {
+		if v == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+}
@@ -0,0 +1,107 @@
+package annotation_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateService(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		unknown     []string
+		err         string
+	}{
+		{
+			name: "valid annotations",
+			annotations: map[string]string{
+				string(annotation.LBLocation):               "fsn1",
+				string(annotation.LBSvcHealthCheckInterval): "15s",
+				string(annotation.LBTargetIPFamily):         "IPv6",
+				string(annotation.LBSvcProxyProtocol):       "true",
+				string(annotation.LBTargetIPv6Offset):       "0:0:0:1::2",
+				string(annotation.LBTargetZones):            "fsn1-dc14, ash",
+				"example.com/other":                         "ignored",
+			},
+		},
+		{
+			name: "unknown annotations",
+			annotations: map[string]string{
+				"load-balancer.hetzner.cloud/locaton":      "fsn1",
+				"load-balancer.hetzner.cloud/algorithm":    "round_robin",
+				string(annotation.LBSvcHealthCheckRetries): "3",
+			},
+			unknown: []string{
+				"load-balancer.hetzner.cloud/algorithm",
+				"load-balancer.hetzner.cloud/locaton",
+			},
+		},
+		{
+			name: "invalid values",
+			annotations: map[string]string{
+				string(annotation.LBSvcHealthCheckRetries): "three",
+				string(annotation.LBMaxTargetsPolicy):      "grow",
+			},
+			err: `load-balancer.hetzner.cloud/health-check-retries: invalid value "three"`,
+		},
+		{
+			name: "value out of range",
+			annotations: map[string]string{
+				string(annotation.LBSvcHealthCheckRetries): "6",
+			},
+			err: `load-balancer.hetzner.cloud/health-check-retries: invalid value "6": must be between 0 and 5`,
+		},
+		{
+			name: "invalid value of allowed set",
+			annotations: map[string]string{
+				string(annotation.LBMaxTargetsPolicy): "grow",
+			},
+			err: `load-balancer.hetzner.cloud/max-targets-policy: invalid value "grow": must be one of upgrade, subset`,
+		},
+		{
+			name: "ipv6 offset out of range",
+			annotations: map[string]string{
+				string(annotation.LBTargetIPv6Offset): "2a01:f48::2",
+			},
+			err: `load-balancer.hetzner.cloud/target-ipv6-offset: invalid value "2a01:f48::2": must be within a /48 subnet`,
+		},
+		{
+			name: "ipv4 offset",
+			annotations: map[string]string{
+				string(annotation.LBTargetIPv6Offset): "0.0.0.2",
+			},
+			err: `load-balancer.hetzner.cloud/target-ipv6-offset: invalid value "0.0.0.2": must be an IPv6 address`,
+		},
+		{
+			name: "invalid target zone",
+			annotations: map[string]string{
+				string(annotation.LBTargetZones): "fsn1, nbg1 dc3",
+			},
+			err: `load-balancer.hetzner.cloud/target-zones: invalid value "fsn1, nbg1 dc3": nbg1 dc3 is neither a location nor a datacenter`,
+		},
+		{
+			name: "invalid additional target",
+			annotations: map[string]string{
+				string(annotation.LBAdditionalTargets): "203.0.113.7,127.0.0.1",
+			},
+			err: `load-balancer.hetzner.cloud/additional-targets: invalid value "203.0.113.7,127.0.0.1": 127.0.0.1 is not a valid target`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+
+			unknown, err := annotation.ValidateService(svc)
+			assert.Equal(t, tt.unknown, unknown)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
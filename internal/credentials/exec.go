@@ -0,0 +1,210 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultTokenCommandInterval is the interval in which the token command
+	// is run if its output does not contain an expiration time.
+	DefaultTokenCommandInterval = 5 * time.Minute
+
+	// tokenCommandTimeout limits the runtime of a single run of the token
+	// command.
+	tokenCommandTimeout = 30 * time.Second
+
+	// defaultTokenCommandRetryDelay is the delay before the token command is
+	// run again after a failure.
+	defaultTokenCommandRetryDelay = 30 * time.Second
+
+	// minTokenRefreshDelay prevents running the token command in a tight
+	// loop for tokens which are about to expire or already expired.
+	minTokenRefreshDelay = 10 * time.Second
+)
+
+// ExecToken is the token returned by a token command.
+type ExecToken struct {
+	Token string
+
+	// Expiration is the time the token expires. Zero if the command did not
+	// report it.
+	Expiration time.Time
+}
+
+// execCredential is the JSON output of a token command. It follows the
+// ExecCredential of the Kubernetes client-go credential plugins, of which only
+// the status is used.
+type execCredential struct {
+	Status struct {
+		Token               string    `json:"token"`
+		ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+	} `json:"status"`
+}
+
+// TokenCommand obtains the Hetzner Cloud token by running a command, e.g. the
+// CLI of a secrets manager which issues short-lived tokens. The command
+// prints either the token or an ExecCredential in JSON like the credential
+// plugins of kubectl:
+//
+//	{"kind": "ExecCredential", "status": {"token": "...", "expirationTimestamp": "2024-01-01T00:00:00Z"}}
+//
+// The token is refreshed before it expires, or in Interval if the command
+// does not report an expiration time.
+type TokenCommand struct {
+	Command  []string
+	Interval time.Duration
+
+	// run runs the command and returns its standard output. Replaced in
+	// tests.
+	run        func(ctx context.Context, command []string) ([]byte, error)
+	now        func() time.Time
+	retryDelay time.Duration
+}
+
+// NewTokenCommand returns a TokenCommand running command, which is split into
+// fields at whitespace. The command is not run by a shell.
+func NewTokenCommand(command string, interval time.Duration) (*TokenCommand, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("token command is empty")
+	}
+	if interval <= 0 {
+		interval = DefaultTokenCommandInterval
+	}
+	return &TokenCommand{
+		Command:    fields,
+		Interval:   interval,
+		run:        runCommand,
+		now:        time.Now,
+		retryDelay: defaultTokenCommandRetryDelay,
+	}, nil
+}
+
+func runCommand(ctx context.Context, command []string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...) //nolint:gosec // The command is configured by the operator.
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// Token runs the command and returns the validated token.
+func (c *TokenCommand) Token(ctx context.Context) (ExecToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, tokenCommandTimeout)
+	defer cancel()
+
+	out, err := c.run(ctx, c.Command)
+	if err != nil {
+		return ExecToken{}, fmt.Errorf("running token command %q: %w", c.Command[0], err)
+	}
+	token, err := parseTokenCommandOutput(out)
+	if err != nil {
+		return ExecToken{}, fmt.Errorf("token command %q: %w", c.Command[0], err)
+	}
+	return token, nil
+}
+
+func parseTokenCommandOutput(out []byte) (ExecToken, error) {
+	out = bytes.TrimSpace(out)
+	if !bytes.HasPrefix(out, []byte("{")) {
+		token := string(out)
+		if err := validateHcloudToken(token); err != nil {
+			return ExecToken{}, err
+		}
+		return ExecToken{Token: token}, nil
+	}
+
+	var cred execCredential
+	if err := json.Unmarshal(out, &cred); err != nil {
+		return ExecToken{}, fmt.Errorf("invalid ExecCredential: %w", err)
+	}
+	token := strings.TrimSpace(cred.Status.Token)
+	if err := validateHcloudToken(token); err != nil {
+		return ExecToken{}, err
+	}
+	return ExecToken{Token: token, Expiration: cred.Status.ExpirationTimestamp}, nil
+}
+
+// refreshDelay returns the time until the token has to be refreshed. Tokens
+// with an expiration time are refreshed after 80% of their remaining
+// lifetime, but not later than Interval.
+func (c *TokenCommand) refreshDelay(token ExecToken) time.Duration {
+	if token.Expiration.IsZero() {
+		return c.Interval
+	}
+	delay := token.Expiration.Sub(c.now()) * 4 / 5
+	if delay > c.Interval {
+		delay = c.Interval
+	}
+	if delay < minTokenRefreshDelay {
+		delay = minTokenRefreshDelay
+	}
+	return delay
+}
+
+// Refresh runs the command whenever token has to be refreshed and applies
+// the new token to hcloudClient, until ctx is done. If the command fails or
+// returns an invalid token, the last good token is kept and the command is
+// retried.
+func (c *TokenCommand) Refresh(ctx context.Context, hcloudClient *hcloud.Client, token ExecToken) {
+	hcloudMutex.Lock()
+	oldHcloudToken = token.Token
+	hcloudMutex.Unlock()
+
+	timer := time.NewTimer(c.refreshDelay(token))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		next, err := c.Token(ctx)
+		if err != nil {
+			if !token.Expiration.IsZero() && token.Expiration.Before(c.now()) {
+				klog.Errorf("refreshing Hetzner Cloud token failed, the last token expired at %s: %s", token.Expiration, err)
+			} else {
+				klog.Errorf("refreshing Hetzner Cloud token failed, keeping the last token: %s", err)
+			}
+			timer.Reset(c.retryDelay)
+			continue
+		}
+
+		token = next
+		setHcloudToken(token.Token, hcloudClient)
+		timer.Reset(c.refreshDelay(token))
+	}
+}
+
+// setHcloudToken applies token to hcloudClient if it changed.
+func setHcloudToken(token string, hcloudClient *hcloud.Client) {
+	hcloudMutex.Lock()
+	defer hcloudMutex.Unlock()
+
+	if token == oldHcloudToken {
+		return
+	}
+	oldHcloudToken = token
+	hcloudTokenReloadCounter++
+	hcloud.WithToken(token)(hcloudClient)
+
+	klog.Infof("Hetzner Cloud token updated to new value: %s...", tokenPrefix(token))
+}
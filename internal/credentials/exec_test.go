@@ -0,0 +1,192 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTokenCommand writes a shell script printing output to a temporary
+// directory and returns its path.
+func writeTokenCommand(t *testing.T, output string, exitCode int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "token-command")
+	script := "#!/bin/sh\ncat <<'EOF'\n" + output + "\nEOF\n"
+	if exitCode != 0 {
+		script += "echo 'secrets manager unavailable' >&2\nexit 1\n"
+	}
+	require.NoError(t, os.WriteFile(path, []byte(script), 0o700))
+	return path
+}
+
+func TestTokenCommand_Token(t *testing.T) {
+	token := strings.Repeat("a", 64)
+
+	tests := []struct {
+		name     string
+		output   string
+		exitCode int
+		expected ExecToken
+		err      string
+	}{
+		{
+			name:     "plain token",
+			output:   token,
+			expected: ExecToken{Token: token},
+		},
+		{
+			name:   "exec credential",
+			output: `{"kind": "ExecCredential", "status": {"token": "` + token + `", "expirationTimestamp": "2024-01-01T12:00:00Z"}}`,
+			expected: ExecToken{
+				Token:      token,
+				Expiration: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "invalid token",
+			output: "abc",
+			err:    "(abc...) is invalid",
+		},
+		{
+			name:   "invalid exec credential",
+			output: `{"status": {`,
+			err:    "invalid ExecCredential",
+		},
+		{
+			name:     "command fails",
+			output:   token,
+			exitCode: 1,
+			err:      "exit status 1: secrets manager unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewTokenCommand(writeTokenCommand(t, tt.output, tt.exitCode)+" --format json", 0)
+			require.NoError(t, err)
+			assert.Equal(t, DefaultTokenCommandInterval, c.Interval)
+
+			got, err := c.Token(context.Background())
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestNewTokenCommand_Empty(t *testing.T) {
+	_, err := NewTokenCommand(" ", time.Minute)
+	assert.EqualError(t, err, "token command is empty")
+}
+
+func TestTokenCommand_RefreshDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &TokenCommand{Interval: time.Hour, now: func() time.Time { return now }}
+
+	assert.Equal(t, time.Hour, c.refreshDelay(ExecToken{}))
+	assert.Equal(t, 8*time.Minute, c.refreshDelay(ExecToken{Expiration: now.Add(10 * time.Minute)}))
+	assert.Equal(t, time.Hour, c.refreshDelay(ExecToken{Expiration: now.Add(24 * time.Hour)}))
+	assert.Equal(t, minTokenRefreshDelay, c.refreshDelay(ExecToken{Expiration: now.Add(-time.Minute)}))
+}
+
+func TestTokenCommand_RefreshKeepsLastGoodToken(t *testing.T) {
+	first := strings.Repeat("a", 64)
+	second := strings.Repeat("b", 64)
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	c := &TokenCommand{
+		Command:    []string{"token-command"},
+		Interval:   10 * time.Millisecond,
+		retryDelay: 10 * time.Millisecond,
+		now:        time.Now,
+		run: func(_ context.Context, _ []string) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			switch calls {
+			case 1:
+				return nil, errors.New("secrets manager unavailable")
+			case 2:
+				return []byte("invalid"), nil
+			default:
+				return []byte(second), nil
+			}
+		},
+	}
+
+	client := hcloud.NewClient(hcloud.WithToken(first))
+	counter := GetHcloudReloadCounter()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Refresh(ctx, client, ExecToken{Token: first})
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return GetHcloudReloadCounter() == counter+1
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+
+	hcloudMutex.Lock()
+	assert.Equal(t, second, oldHcloudToken)
+	hcloudMutex.Unlock()
+
+	mu.Lock()
+	assert.GreaterOrEqual(t, calls, 3)
+	mu.Unlock()
+}
+
+func TestTokenCommand_RefreshConcurrentInitialCredentials(t *testing.T) {
+	// Run with -race: the token is written by Refresh and by reading the
+	// initial credentials at the same time.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hcloud"), []byte(strings.Repeat("a", 64)), 0o600))
+
+	c := &TokenCommand{
+		Command:    []string{"token-command"},
+		Interval:   time.Millisecond,
+		retryDelay: time.Millisecond,
+		now:        time.Now,
+		run: func(_ context.Context, _ []string) ([]byte, error) {
+			return []byte(strings.Repeat("b", 64)), nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Refresh(ctx, hcloud.NewClient(), ExecToken{Token: strings.Repeat("b", 64)})
+		close(done)
+	}()
+
+	for i := 0; i < 20; i++ {
+		_, err := GetInitialHcloudCredentialsFromDirectory(dir)
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Refresh did not return after the context was cancelled")
+	}
+}
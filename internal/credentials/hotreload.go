@@ -1,18 +1,28 @@
 package credentials
 
 import (
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	fsnotify "github.com/fsnotify/fsnotify"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
 	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
 	"k8s.io/klog/v2"
 )
 
+const (
+	robotUserFileENVVar     = "ROBOT_USER_FILE"
+	robotPasswordFileENVVar = "ROBOT_PASSWORD_FILE"
+)
+
 var (
 	// fsnotify creates several events for a single update of a mounted secret.
 	// To avoid multiple reloads, we store the old values and only reload when
@@ -50,7 +60,11 @@ func GetHcloudReloadCounter() uint64 {
 }
 
 // Watch the mounted secrets. Reload the credentials, when the files get updated. The robotClient can be nil.
-func Watch(credentialsDir string, hcloudClient *hcloud.Client, robotClient robotclient.Client) error {
+//
+// Each reload is delayed by a random duration of up to jitter. All replicas see
+// a rotated secret at about the same time, the jitter spreads their reloads,
+// and the API requests made with the new credentials, over the interval.
+func Watch(credentialsDir string, hcloudClient *hcloud.Client, robotClient robotclient.Client, jitter time.Duration) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		klog.Fatal(err)
@@ -64,12 +78,16 @@ func Watch(credentialsDir string, hcloudClient *hcloud.Client, robotClient robot
 					continue
 				}
 
-				// get last element of path. Example: /etc/hetzner-secret/robot-user -> robot-user
-				baseName := filepath.Base(event.Name)
-
-				if err := handleEvent(credentialsDir, baseName, hcloudClient, robotClient, event); err != nil {
-					klog.Errorf("error processing fsnotify event: %s", err.Error())
+				handle := func() {
+					if err := handleEvent(credentialsDir, hcloudClient, robotClient, event); err != nil {
+						klog.Errorf("error processing fsnotify event: %s", err.Error())
+					}
 				}
+				if delay := jitterDelay(jitter); delay > 0 {
+					time.AfterFunc(delay, handle)
+					continue
+				}
+				handle()
 
 			case err := <-watcher.Errors:
 				klog.Infof("error from fsnotify file watcher of %q: %s", credentialsDir, err)
@@ -77,22 +95,94 @@ func Watch(credentialsDir string, hcloudClient *hcloud.Client, robotClient robot
 		}
 	}()
 
-	err = watcher.Add(credentialsDir)
-	if err != nil {
-		return fmt.Errorf("watcher.Add: %w", err)
+	for _, dir := range watchedDirectories(credentialsDir) {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("watcher.Add: %w", err)
+		}
 	}
 	return nil
 }
 
-func handleEvent(credentialsDir, baseName string, hcloudClient *hcloud.Client, robotClient robotclient.Client, event fsnotify.Event) error {
-	var err error
-	switch baseName {
-	case "robot-user", "robot-password":
-		// This case is executed, when the process is running on a local machine.
+// RobotCredentialFilesConfigured reports whether the robot credentials are
+// read from files configured by ROBOT_USER_FILE or ROBOT_PASSWORD_FILE
+// instead of the credentials directory.
+func RobotCredentialFilesConfigured() bool {
+	return os.Getenv(robotUserFileENVVar) != "" || os.Getenv(robotPasswordFileENVVar) != ""
+}
+
+// robotCredentialFiles returns the files the robot user name and password
+// are read from. They default to robot-user and robot-password in
+// credentialsDir, ROBOT_USER_FILE and ROBOT_PASSWORD_FILE override them for
+// secrets mounted elsewhere.
+func robotCredentialFiles(credentialsDir string) (userFile, passwordFile string) {
+	userFile = os.Getenv(robotUserFileENVVar)
+	if userFile == "" {
+		userFile = filepath.Join(credentialsDir, "robot-user")
+	}
+	passwordFile = os.Getenv(robotPasswordFileENVVar)
+	if passwordFile == "" {
+		passwordFile = filepath.Join(credentialsDir, "robot-password")
+	}
+	return filepath.Clean(userFile), filepath.Clean(passwordFile)
+}
+
+// watchedDirectories returns the directories containing credential files.
+// The credentials directory is skipped if it does not exist and the robot
+// credentials are read from other files.
+func watchedDirectories(credentialsDir string) []string {
+	var dirs []string
+	if _, err := os.Stat(credentialsDir); err == nil || !RobotCredentialFilesConfigured() {
+		dirs = append(dirs, filepath.Clean(credentialsDir))
+	}
+	userFile, passwordFile := robotCredentialFiles(credentialsDir)
+	for _, file := range []string{userFile, passwordFile} {
+		if dir := filepath.Dir(file); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// isRobotCredentialsEvent reports whether the event of the file name changed
+// the robot credentials, which are not stored in the credentials directory.
+// Secrets mounted by Kubernetes are updated by replacing the ..data
+// directory next to the files.
+func isRobotCredentialsEvent(credentialsDir, name string) bool {
+	name = filepath.Clean(name)
+	userFile, passwordFile := robotCredentialFiles(credentialsDir)
+	if name == userFile || name == passwordFile {
+		return true
+	}
+	dir := filepath.Dir(name)
+	return filepath.Base(name) == "..data" && dir != filepath.Clean(credentialsDir) &&
+		(dir == filepath.Dir(userFile) || dir == filepath.Dir(passwordFile))
+}
+
+// jitterDelay returns a random duration in [0, jitter). It returns 0 if jitter
+// is not positive.
+func jitterDelay(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return rand.N(jitter)
+}
+
+func handleEvent(credentialsDir string, hcloudClient *hcloud.Client, robotClient robotclient.Client, event fsnotify.Event) error {
+	if isRobotCredentialsEvent(credentialsDir, event.Name) {
+		// This case is executed, when the process is running on a local
+		// machine, or the robot credentials are mounted separately.
 		return loadRobotCredentials(credentialsDir, robotClient)
+	}
+
+	// get last element of path. Example: /etc/hetzner-secret/hcloud -> hcloud
+	baseName := filepath.Base(event.Name)
 
+	switch baseName {
 	case "hcloud":
 		// This case is executed, when the process is running on a local machine.
+		if hcloudClient == nil {
+			return nil
+		}
 		return loadHcloudCredentials(credentialsDir, hcloudClient)
 
 	case "..data":
@@ -102,16 +192,23 @@ func handleEvent(credentialsDir, baseName string, hcloudClient *hcloud.Client, r
 		// This means the files/symlinks don't change. When the secrets get changed, then
 		// a new ..data directory gets created. This is done by Kubernetes to make the
 		// update of all files atomic.
-		err = loadHcloudCredentials(credentialsDir, hcloudClient)
-		if err != nil {
-			return err
+		var errs []error
+		if hcloudClient != nil {
+			errs = append(errs, loadHcloudCredentials(credentialsDir, hcloudClient))
 		}
-		if robotClient == nil {
-			return nil
+		if robotClient != nil {
+			errs = append(errs, loadRobotCredentials(credentialsDir, robotClient))
+			errs = append(errs, loadRobotCredentialSets(credentialsDir, robotClient)...)
 		}
-		return loadRobotCredentials(credentialsDir, robotClient)
+		return errors.Join(errs...)
 
 	default:
+		if name, ok := robotCredentialSetOfFile(baseName); ok {
+			if setClient, ok := robotClient.(robotclient.CredentialSetClient); ok && slices.Contains(setClient.CredentialSets(), name) {
+				// This case is executed, when the process is running on a local machine.
+				return loadRobotCredentialSet(credentialsDir, name, setClient)
+			}
+		}
 		klog.Infof("Ignoring fsnotify event for file %q: %s", baseName, event.String())
 		return nil
 	}
@@ -163,22 +260,23 @@ func GetInitialRobotCredentials(credentialsDir string) (username, password strin
 	}
 
 	// Update global variables
+	robotMutex.Lock()
 	oldRobotUser = u
 	oldRobotPassword = p
+	robotMutex.Unlock()
 
 	return u, p, nil
 }
 
 func readRobotCredentials(credentialsDir string) (username, password string, err error) {
-	robotUserNameFile := filepath.Join(credentialsDir, "robot-user")
-	robotPasswordFile := filepath.Join(credentialsDir, "robot-password")
+	robotUserNameFile, robotPasswordFile := robotCredentialFiles(credentialsDir)
 
-	u, err := os.ReadFile(robotUserNameFile)
+	u, err := readCredentialFile(robotUserNameFile)
 	if err != nil {
 		return "", "", fmt.Errorf("reading robot user name from %q failed: %w", robotUserNameFile, err)
 	}
 
-	p, err := os.ReadFile(robotPasswordFile)
+	p, err := readCredentialFile(robotPasswordFile)
 	if err != nil {
 		return "", "", fmt.Errorf("reading robot password from %q failed: %w", robotPasswordFile, err)
 	}
@@ -195,9 +293,8 @@ func loadHcloudCredentials(credentialsDir string, hcloudClient *hcloud.Client) e
 		return err
 	}
 
-	if len(token) != 64 {
-		return fmt.Errorf("loadHcloudCredentials: entered token (%s...) is invalid (must be exactly 64 characters long)",
-			token[:5])
+	if err := validateHcloudToken(token); err != nil {
+		return fmt.Errorf("loadHcloudCredentials: %w", err)
 	}
 
 	if token == oldHcloudToken {
@@ -215,6 +312,21 @@ func loadHcloudCredentials(credentialsDir string, hcloudClient *hcloud.Client) e
 	return nil
 }
 
+func validateHcloudToken(token string) error {
+	if len(token) != 64 {
+		return fmt.Errorf("entered token (%s...) is invalid (must be exactly 64 characters long)", tokenPrefix(token))
+	}
+	return nil
+}
+
+// tokenPrefix returns the first characters of token, which are safe to log.
+func tokenPrefix(token string) string {
+	if len(token) < 5 {
+		return token
+	}
+	return token[:5]
+}
+
 func GetInitialHcloudCredentialsFromDirectory(credentialsDir string) (string, error) {
 	token, err := readHcloudCredentials(credentialsDir)
 	if err != nil {
@@ -222,20 +334,36 @@ func GetInitialHcloudCredentialsFromDirectory(credentialsDir string) (string, er
 	}
 
 	// Update global variable
+	hcloudMutex.Lock()
 	oldHcloudToken = token
+	hcloudMutex.Unlock()
 
 	return token, nil
 }
 
 func readHcloudCredentials(credentialsDir string) (string, error) {
 	hcloudTokenFile := filepath.Join(credentialsDir, "hcloud")
-	data, err := os.ReadFile(hcloudTokenFile)
+	data, err := readCredentialFile(hcloudTokenFile)
 	if err != nil {
 		return "", fmt.Errorf("reading hcloud token from %q failed: %w", hcloudTokenFile, err)
 	}
 	return strings.TrimSpace(string(data)), nil
 }
 
+// readCredentialFile reads the credential file path. It records the
+// modification time of the file in a metric, so that operators can verify
+// that rotated secrets reach the pod.
+func readCredentialFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		metrics.CredentialFileLastModified.WithLabelValues(path).Set(float64(info.ModTime().Unix()))
+	}
+	return data, nil
+}
+
 // GetDirectory returns the directory where the credentials are stored.
 // The credentials are stored in the directory etc/hetzner-secret.
 func GetDirectory(rootDir string) string {
@@ -0,0 +1,143 @@
+package credentials
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
+	"k8s.io/klog/v2"
+)
+
+// ReloadPath is the path of the HTTP endpoint which forces a reload of the
+// credentials.
+const ReloadPath = "/credentials/reload"
+
+// Reload re-reads the hcloud token and the robot credentials, including all
+// robot credential sets, from credentialsDir and applies them, even if they
+// did not change. All credentials are validated before any of them is
+// applied, so invalid files never replace working credentials. If the robot
+// client rejects the credentials anyway, the robot credentials applied before
+// are restored and the hcloud token is not changed. The clients can be nil,
+// their credentials are skipped then.
+func Reload(credentialsDir string, hcloudClient *hcloud.Client, robotClient robotclient.Client) error {
+	hcloudMutex.Lock()
+	defer hcloudMutex.Unlock()
+	robotMutex.Lock()
+	defer robotMutex.Unlock()
+
+	var (
+		token              string
+		username, password string
+		err                error
+	)
+	if hcloudClient != nil {
+		token, err = readHcloudCredentials(credentialsDir)
+		if err != nil {
+			return fmt.Errorf("reload: %w", err)
+		}
+		if err := validateHcloudToken(token); err != nil {
+			return fmt.Errorf("reload: %w", err)
+		}
+	}
+	if robotClient != nil {
+		username, password, err = readRobotCredentials(credentialsDir)
+		if err != nil {
+			return fmt.Errorf("reload: %w", err)
+		}
+		if username == "" || password == "" {
+			return fmt.Errorf("reload: robot user name and password must not be empty")
+		}
+	}
+	var sets []RobotCredentialSet
+	setClient, _ := robotClient.(robotclient.CredentialSetClient)
+	if setClient != nil {
+		for _, name := range setClient.CredentialSets() {
+			set, err := readRobotCredentialSet(credentialsDir, name)
+			if err != nil {
+				return fmt.Errorf("reload: %w", err)
+			}
+			sets = append(sets, set)
+		}
+	}
+
+	// The robot credentials are applied first, the hcloud token can not be
+	// rejected.
+	var restore []func()
+	rollback := func() {
+		for i := len(restore) - 1; i >= 0; i-- {
+			restore[i]()
+		}
+	}
+	if robotClient != nil {
+		if err := robotClient.SetCredentials(username, password); err != nil {
+			return fmt.Errorf("reload: SetCredentials: %w", err)
+		}
+		if oldRobotUser != "" && oldRobotPassword != "" {
+			user, password := oldRobotUser, oldRobotPassword
+			restore = append(restore, func() { _ = robotClient.SetCredentials(user, password) })
+		}
+	}
+	for _, set := range sets {
+		if err := setClient.SetCredentialSet(set.Name, set.Username, set.Password); err != nil {
+			rollback()
+			return fmt.Errorf("reload: SetCredentialSet: %w", err)
+		}
+		if old, ok := oldRobotSets[set.Name]; ok {
+			name := set.Name
+			restore = append(restore, func() { _ = setClient.SetCredentialSet(name, old[0], old[1]) })
+		}
+	}
+
+	if robotClient != nil {
+		oldRobotUser = username
+		oldRobotPassword = password
+		robotReloadCounter++
+		klog.Infof("Hetzner Robot credentials reloaded: %q", username)
+	}
+	for _, set := range sets {
+		oldRobotSets[set.Name] = [2]string{set.Username, set.Password}
+		robotReloadCounter++
+		klog.Infof("Hetzner Robot credentials of set %q reloaded: %q", set.Name, set.Username)
+	}
+	if hcloudClient != nil {
+		oldHcloudToken = token
+		hcloudTokenReloadCounter++
+		hcloud.WithToken(token)(hcloudClient)
+		klog.Infof("Hetzner Cloud token reloaded: %s...", tokenPrefix(token))
+	}
+	return nil
+}
+
+// ReloadHandler returns an HTTP handler which calls Reload on POST requests.
+// Only requests from localhost are accepted, as the endpoint is served
+// without authentication.
+func ReloadHandler(credentialsDir string, hcloudClient *hcloud.Client, robotClient robotclient.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !isLoopback(r.RemoteAddr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err := Reload(credentialsDir, hcloudClient, robotClient); err != nil {
+			klog.Errorf("forced credential reload failed: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
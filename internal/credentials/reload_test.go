@@ -0,0 +1,192 @@
+package credentials
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
+)
+
+type fakeRobotClient struct {
+	robotclient.Client
+	username, password string
+	err                error
+}
+
+func (c *fakeRobotClient) SetCredentials(username, password string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.username, c.password = username, password
+	return nil
+}
+
+func writeCredentialFiles(t *testing.T, dir, token, username, password string) {
+	t.Helper()
+	for name, v := range map[string]string{"hcloud": token, "robot-user": username, "robot-password": password} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(v), 0o600))
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	dir := t.TempDir()
+	token := strings.Repeat("a", 64)
+	writeCredentialFiles(t, dir, token, "user", "password")
+
+	robotClient := &fakeRobotClient{}
+	handler := ReloadHandler(dir, hcloud.NewClient(), robotClient)
+
+	hcloudCount := GetHcloudReloadCounter()
+	robotCount := GetRobotReloadCounter()
+
+	req := httptest.NewRequest(http.MethodPost, ReloadPath, nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, hcloudCount+1, GetHcloudReloadCounter())
+	assert.Equal(t, robotCount+1, GetRobotReloadCounter())
+	assert.Equal(t, "user", robotClient.username)
+	assert.Equal(t, "password", robotClient.password)
+
+	// Unchanged credentials are applied again.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, hcloudCount+2, GetHcloudReloadCounter())
+	assert.Equal(t, robotCount+2, GetRobotReloadCounter())
+}
+
+func TestReloadHandler_Rejected(t *testing.T) {
+	dir := t.TempDir()
+	writeCredentialFiles(t, dir, "too-short", "new-user", "new-password")
+
+	robotClient := &fakeRobotClient{}
+	handler := ReloadHandler(dir, hcloud.NewClient(), robotClient)
+
+	hcloudCount := GetHcloudReloadCounter()
+	robotCount := GetRobotReloadCounter()
+
+	tests := []struct {
+		name       string
+		method     string
+		remoteAddr string
+		expected   int
+	}{
+		{name: "remote client", method: http.MethodPost, remoteAddr: "203.0.113.7:12345", expected: http.StatusForbidden},
+		{name: "wrong method", method: http.MethodGet, remoteAddr: "127.0.0.1:12345", expected: http.StatusMethodNotAllowed},
+		{name: "invalid token", method: http.MethodPost, remoteAddr: "[::1]:12345", expected: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, ReloadPath, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.expected, rec.Code)
+		})
+	}
+
+	// The valid robot credentials are not applied if the token is invalid.
+	assert.Equal(t, hcloudCount, GetHcloudReloadCounter())
+	assert.Equal(t, robotCount, GetRobotReloadCounter())
+	assert.Empty(t, robotClient.username)
+}
+
+func TestReload_RobotRejected(t *testing.T) {
+	dir := t.TempDir()
+	writeCredentialFiles(t, dir, strings.Repeat("b", 64), "user", "password")
+
+	robotClient := &fakeRobotClient{err: errors.New("rejected")}
+	hcloudCount := GetHcloudReloadCounter()
+	robotCount := GetRobotReloadCounter()
+
+	err := Reload(dir, hcloud.NewClient(), robotClient)
+	assert.ErrorContains(t, err, "reload: SetCredentials: rejected")
+
+	// The valid hcloud token is not applied if the robot credentials are
+	// rejected.
+	assert.Equal(t, hcloudCount, GetHcloudReloadCounter())
+	assert.Equal(t, robotCount, GetRobotReloadCounter())
+	assert.NotEqual(t, strings.Repeat("b", 64), oldHcloudToken)
+}
+
+func TestGetInitialRobotCredentialSets(t *testing.T) {
+	dir := t.TempDir()
+	for name, v := range map[string]string{
+		"robot-user-a":     "user-a",
+		"robot-password-a": "password-a",
+		"robot-servers-a":  "1,2\n3",
+		"robot-user-b":     "user-b",
+		"robot-password-b": "password-b",
+		"robot-servers-b":  "4",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(v), 0o600))
+	}
+
+	sets, err := GetInitialRobotCredentialSets(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []RobotCredentialSet{
+		{Name: "a", Username: "user-a", Password: "password-a", Servers: []int{1, 2, 3}},
+		{Name: "b", Username: "user-b", Password: "password-b", Servers: []int{4}},
+	}, sets)
+
+	// A server must not be part of several sets.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "robot-servers-b"), []byte("3 4"), 0o600))
+	_, err = GetInitialRobotCredentialSets(dir)
+	assert.EqualError(t, err, `robot server 3 is part of the credential sets "a" and "b"`)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "robot-servers-b"), []byte("four"), 0o600))
+	_, err = GetInitialRobotCredentialSets(dir)
+	assert.ErrorContains(t, err, `robot credential set "b": invalid server number "four"`)
+}
+
+func TestJitterDelay(t *testing.T) {
+	assert.Zero(t, jitterDelay(0))
+	assert.Zero(t, jitterDelay(-time.Second))
+
+	seen := make(map[time.Duration]struct{})
+	for i := 0; i < 100; i++ {
+		d := jitterDelay(time.Minute)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.Less(t, d, time.Minute)
+		seen[d] = struct{}{}
+	}
+	assert.Greater(t, len(seen), 1, "delays are not random")
+}
+
+func TestCredentialFileLastModified(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hcloud")
+	require.NoError(t, os.WriteFile(file, []byte(strings.Repeat("a", 64)), 0o600))
+	modified := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(file, modified, modified))
+
+	lastModified := func() float64 {
+		return testutil.ToFloat64(metrics.CredentialFileLastModified.WithLabelValues(file))
+	}
+
+	_, err := GetInitialHcloudCredentialsFromDirectory(dir)
+	require.NoError(t, err)
+	assert.Equal(t, float64(modified.Unix()), lastModified())
+
+	require.NoError(t, Watch(dir, hcloud.NewClient(), nil, 0))
+	require.NoError(t, os.WriteFile(file, []byte(strings.Repeat("b", 64)), 0o600))
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return lastModified() == float64(info.ModTime().Unix())
+	}, 3*time.Second, 50*time.Millisecond)
+}
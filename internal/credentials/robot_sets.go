@@ -0,0 +1,178 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
+	"k8s.io/klog/v2"
+)
+
+const (
+	robotSetUserPrefix     = "robot-user-"
+	robotSetPasswordPrefix = "robot-password-"
+	robotSetServersPrefix  = "robot-servers-"
+)
+
+// RobotCredentialSet is an additional set of Hetzner Robot credentials,
+// which is used for the servers listed in Servers.
+//
+// A set named "pool-a" is read from the files robot-user-pool-a,
+// robot-password-pool-a and robot-servers-pool-a. The latter contains the
+// server numbers, separated by commas or whitespace.
+type RobotCredentialSet struct {
+	Name     string
+	Username string
+	Password string
+	Servers  []int
+}
+
+// oldRobotSets stores the credentials of the sets last applied, keyed by the
+// name of the set. See oldRobotUser.
+var oldRobotSets = map[string][2]string{}
+
+// GetInitialRobotCredentialSets reads all additional robot credential sets
+// from credentialsDir. It returns no sets and no error, if there are none.
+func GetInitialRobotCredentialSets(credentialsDir string) ([]RobotCredentialSet, error) {
+	robotMutex.Lock()
+	defer robotMutex.Unlock()
+
+	names, err := robotCredentialSetNames(credentialsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make([]RobotCredentialSet, 0, len(names))
+	claimed := make(map[int]string)
+	for _, name := range names {
+		set, err := readRobotCredentialSet(credentialsDir, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range set.Servers {
+			if other, ok := claimed[id]; ok {
+				return nil, fmt.Errorf("robot server %d is part of the credential sets %q and %q", id, other, name)
+			}
+			claimed[id] = name
+		}
+		sets = append(sets, set)
+	}
+
+	for _, set := range sets {
+		oldRobotSets[set.Name] = [2]string{set.Username, set.Password}
+	}
+	return sets, nil
+}
+
+// robotCredentialSetNames returns the names of all credential sets found in
+// credentialsDir, sorted by name.
+func robotCredentialSetNames(credentialsDir string) ([]string, error) {
+	entries, err := os.ReadDir(credentialsDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading robot credential sets from %q failed: %w", credentialsDir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutPrefix(entry.Name(), robotSetUserPrefix); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func readRobotCredentialSet(credentialsDir, name string) (RobotCredentialSet, error) {
+	set := RobotCredentialSet{Name: name}
+
+	files := map[string]*string{
+		robotSetUserPrefix + name:     &set.Username,
+		robotSetPasswordPrefix + name: &set.Password,
+	}
+	for file, v := range files {
+		path := filepath.Join(credentialsDir, file)
+		data, err := readCredentialFile(path)
+		if err != nil {
+			return set, fmt.Errorf("reading robot credential set %q from %q failed: %w", name, path, err)
+		}
+		*v = strings.TrimSpace(string(data))
+	}
+	if set.Username == "" || set.Password == "" {
+		return set, fmt.Errorf("robot credential set %q: user name and password must not be empty", name)
+	}
+
+	path := filepath.Join(credentialsDir, robotSetServersPrefix+name)
+	data, err := readCredentialFile(path)
+	if err != nil {
+		return set, fmt.Errorf("reading servers of robot credential set %q from %q failed: %w", name, path, err)
+	}
+	for _, field := range strings.FieldsFunc(string(data), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t' || r == '\r'
+	}) {
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return set, fmt.Errorf("robot credential set %q: invalid server number %q: %w", name, field, err)
+		}
+		set.Servers = append(set.Servers, id)
+	}
+	if len(set.Servers) == 0 {
+		return set, fmt.Errorf("robot credential set %q: no servers configured in %q", name, path)
+	}
+	return set, nil
+}
+
+// loadRobotCredentialSet reloads the credentials of the set name. The servers
+// of a set are only read on startup.
+func loadRobotCredentialSet(credentialsDir, name string, robotClient robotclient.CredentialSetClient) error {
+	robotMutex.Lock()
+	defer robotMutex.Unlock()
+
+	set, err := readRobotCredentialSet(credentialsDir, name)
+	if err != nil {
+		return fmt.Errorf("reading robot credentials from secret failed: %w", err)
+	}
+
+	if old, ok := oldRobotSets[name]; ok && old == [2]string{set.Username, set.Password} {
+		return nil
+	}
+
+	oldRobotSets[name] = [2]string{set.Username, set.Password}
+	robotReloadCounter++
+
+	if err := robotClient.SetCredentialSet(name, set.Username, set.Password); err != nil {
+		return fmt.Errorf("SetCredentialSet: %w", err)
+	}
+
+	klog.Infof("Hetzner Robot credentials of set %q updated to new value: %q", name, set.Username)
+	return nil
+}
+
+// loadRobotCredentialSets reloads the credentials of all sets known to
+// robotClient. Sets are reloaded independently, a broken set does not keep
+// the others from being updated.
+func loadRobotCredentialSets(credentialsDir string, robotClient robotclient.Client) []error {
+	setClient, ok := robotClient.(robotclient.CredentialSetClient)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, name := range setClient.CredentialSets() {
+		errs = append(errs, loadRobotCredentialSet(credentialsDir, name, setClient))
+	}
+	return errs
+}
+
+// robotCredentialSetOfFile returns the name of the credential set the file
+// baseName belongs to.
+func robotCredentialSetOfFile(baseName string) (string, bool) {
+	for _, prefix := range []string{robotSetUserPrefix, robotSetPasswordPrefix} {
+		if name, ok := strings.CutPrefix(baseName, prefix); ok && name != "" {
+			return name, true
+		}
+	}
+	return "", false
+}
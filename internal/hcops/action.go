@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type HCloudActionClient interface {
@@ -11,7 +13,14 @@ type HCloudActionClient interface {
 }
 
 func WatchAction(ctx context.Context, ac HCloudActionClient, a *hcloud.Action) error {
+	var attrs []attribute.KeyValue
+	if a != nil {
+		attrs = append(attrs, attribute.Int64("hcloud.action.id", a.ID), attribute.String("hcloud.action.command", a.Command))
+	}
+	ctx, span := tracing.Start(ctx, "hcops/WatchAction", attrs...)
+
 	_, errCh := ac.WatchProgress(ctx, a)
 	err := <-errCh
+	tracing.End(span, err)
 	return err
 }
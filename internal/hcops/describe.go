@@ -0,0 +1,182 @@
+package hcops
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ServiceConfig is the configuration of the Load Balancer of a Service, as
+// resolved from its annotations and the defaults.
+type ServiceConfig struct {
+	Type        string              `json:"type"`
+	Location    string              `json:"location,omitempty"`
+	NetworkZone string              `json:"networkZone,omitempty"`
+	Algorithm   string              `json:"algorithm,omitempty"`
+	Ports       []ServicePortConfig `json:"ports"`
+
+	// UnknownAnnotations lists annotations with the prefix of the Load
+	// Balancer annotations which are ignored, probably typos.
+	UnknownAnnotations []string `json:"unknownAnnotations,omitempty"`
+}
+
+// ServicePortConfig is the configuration of the Load Balancer service of a
+// port of a Service.
+type ServicePortConfig struct {
+	ListenPort      int    `json:"listenPort"`
+	DestinationPort int    `json:"destinationPort,omitempty"`
+	Protocol        string `json:"protocol"`
+	ProxyProtocol   bool   `json:"proxyProtocol,omitempty"`
+
+	// Certificates are the IDs or names of the certificates, or "managed"
+	// for a managed certificate created for the Service.
+	Certificates   []string `json:"certificates,omitempty"`
+	RedirectHTTP   bool     `json:"redirectHTTP,omitempty"`
+	StickySessions bool     `json:"stickySessions,omitempty"`
+	CookieName     string   `json:"cookieName,omitempty"`
+	CookieLifetime string   `json:"cookieLifetime,omitempty"`
+
+	HealthCheck HealthCheckConfig `json:"healthCheck"`
+}
+
+// HealthCheckConfig is the health check of a Load Balancer service. Empty
+// values leave the Hetzner Cloud defaults in place.
+type HealthCheckConfig struct {
+	Protocol    string   `json:"protocol"`
+	Port        int      `json:"port,omitempty"`
+	Interval    string   `json:"interval,omitempty"`
+	Timeout     string   `json:"timeout,omitempty"`
+	Retries     *int     `json:"retries,omitempty"`
+	Domain      string   `json:"domain,omitempty"`
+	Path        string   `json:"path,omitempty"`
+	StatusCodes []string `json:"statusCodes,omitempty"`
+	TLS         *bool    `json:"tls,omitempty"`
+}
+
+// DescribeService resolves the configuration of the Load Balancer of svc
+// from its annotations and defaults, without any request to the Hetzner
+// Cloud API. It allows validating annotations before applying them.
+//
+// The destination ports of Services which were not created yet are 0, they
+// are the node ports assigned by Kubernetes.
+func DescribeService(svc *corev1.Service, defaults LoadBalancerDefaults) (*ServiceConfig, error) {
+	const op = "hcops/DescribeService"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	unknown, err := annotation.ValidateService(svc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := ValidatePortProtocols(svc); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cfg := &ServiceConfig{Type: "lb11", UnknownAnnotations: unknown}
+	if v, ok := annotation.LBType.StringFromService(svc); ok {
+		cfg.Type = v
+	}
+	location, networkZone, err := createLocation(svc, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if location != nil {
+		cfg.Location = location.Name
+	}
+	cfg.NetworkZone = string(networkZone)
+
+	algType, err := describeAlgorithm(svc, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	cfg.Algorithm = string(algType)
+
+	cfg.Ports, err = describePorts(svc, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return cfg, nil
+}
+
+// describeAlgorithm returns the algorithm of the Load Balancer of svc.
+func describeAlgorithm(svc *corev1.Service, defaults LoadBalancerDefaults) (hcloud.LoadBalancerAlgorithmType, error) {
+	algType, err := annotation.LBAlgorithmType.LBAlgorithmTypeFromService(svc)
+	if errors.Is(err, annotation.ErrNotSet) {
+		return defaults.Algorithm, nil
+	}
+	return algType, err
+}
+
+// describePorts returns the configuration of the Load Balancer services of
+// the supported ports of svc.
+func describePorts(svc *corev1.Service, defaults LoadBalancerDefaults) ([]ServicePortConfig, error) {
+	var ports []ServicePortConfig
+	for _, port := range svc.Spec.Ports {
+		if !isSupportedPortProtocol(port) {
+			continue
+		}
+		b := &hclbServiceOptsBuilder{Port: port, Service: svc, Defaults: defaults, offline: true}
+		opts, err := b.buildAddServiceOpts()
+		if err != nil {
+			return nil, fmt.Errorf("port %d: %w", port.Port, err)
+		}
+		ports = append(ports, describePort(svc, opts))
+	}
+	return ports, nil
+}
+
+func describePort(svc *corev1.Service, opts hcloud.LoadBalancerAddServiceOpts) ServicePortConfig {
+	p := ServicePortConfig{
+		ListenPort:      *opts.ListenPort,
+		DestinationPort: *opts.DestinationPort,
+		Protocol:        string(opts.Protocol),
+		ProxyProtocol:   opts.Proxyprotocol != nil && *opts.Proxyprotocol,
+	}
+	if opts.HTTP != nil {
+		for _, c := range opts.HTTP.Certificates {
+			if c.ID != 0 {
+				p.Certificates = append(p.Certificates, strconv.FormatInt(c.ID, 10))
+			} else {
+				p.Certificates = append(p.Certificates, c.Name)
+			}
+		}
+		if v, ok := annotation.LBSvcHTTPCertificateType.StringFromService(svc); ok && v == string(hcloud.CertificateTypeManaged) {
+			p.Certificates = []string{string(hcloud.CertificateTypeManaged)}
+		}
+		p.RedirectHTTP = opts.HTTP.RedirectHTTP != nil && *opts.HTTP.RedirectHTTP
+		p.StickySessions = opts.HTTP.StickySessions != nil && *opts.HTTP.StickySessions
+		if opts.HTTP.CookieName != nil {
+			p.CookieName = *opts.HTTP.CookieName
+		}
+		if opts.HTTP.CookieLifetime != nil {
+			p.CookieLifetime = opts.HTTP.CookieLifetime.String()
+		}
+	}
+
+	hc := opts.HealthCheck
+	p.HealthCheck = HealthCheckConfig{Protocol: string(hc.Protocol), Retries: hc.Retries}
+	if hc.Port != nil {
+		p.HealthCheck.Port = *hc.Port
+	}
+	if hc.Interval != nil {
+		p.HealthCheck.Interval = hc.Interval.String()
+	}
+	if hc.Timeout != nil {
+		p.HealthCheck.Timeout = hc.Timeout.String()
+	}
+	if hc.HTTP != nil {
+		if hc.HTTP.Domain != nil {
+			p.HealthCheck.Domain = *hc.HTTP.Domain
+		}
+		if hc.HTTP.Path != nil {
+			p.HealthCheck.Path = *hc.HTTP.Path
+		}
+		p.HealthCheck.StatusCodes = hc.HTTP.StatusCodes
+		p.HealthCheck.TLS = hc.HTTP.TLS
+	}
+	return p
+}
@@ -0,0 +1,134 @@
+package hcops_test
+
+import (
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDescribeService(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[annotation.Name]string
+		defaults    hcops.LoadBalancerDefaults
+		expected    *hcops.ServiceConfig
+		expectedErr string
+	}{
+		{
+			name: "defaults",
+			defaults: hcops.LoadBalancerDefaults{
+				Location:  "hel1",
+				Algorithm: hcloud.LoadBalancerAlgorithmTypeRoundRobin,
+			},
+			expected: &hcops.ServiceConfig{
+				Type:      "lb11",
+				Location:  "hel1",
+				Algorithm: "round_robin",
+				Ports: []hcops.ServicePortConfig{{
+					ListenPort:      443,
+					DestinationPort: 30443,
+					Protocol:        "tcp",
+					HealthCheck:     hcops.HealthCheckConfig{Protocol: "tcp", Port: 30443},
+				}},
+			},
+		},
+		{
+			name: "https with certificates and http health check",
+			annotations: map[annotation.Name]string{
+				annotation.LBType:                     "lb21",
+				annotation.LBNetworkZone:              "eu-central",
+				annotation.LBAlgorithmType:            "least_connections",
+				annotation.LBSvcProtocol:              "https",
+				annotation.LBSvcHTTPCertificates:      "1,my-cert",
+				annotation.LBSvcRedirectHTTP:          "true",
+				annotation.LBSvcHealthCheckProtocol:   "http",
+				annotation.LBSvcHealthCheckInterval:   "15s",
+				annotation.LBSvcHealthCheckRetries:    "2",
+				annotation.LBSvcHealthCheckHTTPPath:   "/healthz",
+				annotation.LBSvcHealthCheckHTTPDomain: "example.com",
+				"load-balancer.hetzner.cloud/tpye":    "lb11",
+			},
+			expected: &hcops.ServiceConfig{
+				Type:        "lb21",
+				NetworkZone: "eu-central",
+				Algorithm:   "least_connections",
+				Ports: []hcops.ServicePortConfig{{
+					ListenPort:      443,
+					DestinationPort: 30443,
+					Protocol:        "https",
+					Certificates:    []string{"1", "my-cert"},
+					RedirectHTTP:    true,
+					HealthCheck: hcops.HealthCheckConfig{
+						Protocol: "http",
+						Port:     30443,
+						Interval: "15s",
+						Retries:  hcloud.Ptr(2),
+						Domain:   "example.com",
+						Path:     "/healthz",
+					},
+				}},
+				UnknownAnnotations: []string{"load-balancer.hetzner.cloud/tpye"},
+			},
+		},
+		{
+			name: "managed certificate",
+			annotations: map[annotation.Name]string{
+				annotation.LBLocation:                         "fsn1",
+				annotation.LBSvcProtocol:                      "https",
+				annotation.LBSvcHTTPCertificateType:           "managed",
+				annotation.LBSvcHTTPManagedCertificateDomains: "example.com",
+			},
+			expected: &hcops.ServiceConfig{
+				Type:     "lb11",
+				Location: "fsn1",
+				Ports: []hcops.ServicePortConfig{{
+					ListenPort:      443,
+					DestinationPort: 30443,
+					Protocol:        "https",
+					Certificates:    []string{"managed"},
+					HealthCheck:     hcops.HealthCheckConfig{Protocol: "tcp", Port: 30443},
+				}},
+			},
+		},
+		{
+			name: "invalid value",
+			annotations: map[annotation.Name]string{
+				annotation.LBLocation:               "fsn1",
+				annotation.LBSvcHealthCheckInterval: "often",
+			},
+			expectedErr: "load-balancer.hetzner.cloud/health-check-interval",
+		},
+		{
+			name:        "no location",
+			expectedErr: "neither load-balancer.hetzner.cloud/location nor load-balancer.hetzner.cloud/network-zone set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Annotations: map[string]string{}},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{{Port: 443, NodePort: 30443, Protocol: corev1.ProtocolTCP}},
+				},
+			}
+			for k, v := range tt.annotations {
+				svc.Annotations[string(k)] = v
+			}
+
+			cfg, err := hcops.DescribeService(svc, tt.defaults)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg)
+		})
+	}
+}
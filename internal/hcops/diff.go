@@ -0,0 +1,268 @@
+package hcops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// diffAbsent is the value of a Change for a service or label which does not
+// exist.
+const diffAbsent = "<none>"
+
+// LoadBalancerDiff lists the differences between the actual state of a Load
+// Balancer and the state desired by its Service.
+type LoadBalancerDiff struct {
+	Changes []Change
+}
+
+// Change is a difference of a single field of a Load Balancer, e.g.
+// "services[443].healthCheck.interval".
+type Change struct {
+	Field   string
+	Actual  string
+	Desired string
+}
+
+// String formats the changes of d for logging.
+func (d *LoadBalancerDiff) String() string {
+	if len(d.Changes) == 0 {
+		return "no changes"
+	}
+	parts := make([]string, len(d.Changes))
+	for i, c := range d.Changes {
+		parts[i] = fmt.Sprintf("%s: %s -> %s", c.Field, c.Actual, c.Desired)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (d *LoadBalancerDiff) add(field, actual, desired string) {
+	if actual != desired {
+		d.Changes = append(d.Changes, Change{Field: field, Actual: actual, Desired: desired})
+	}
+}
+
+// Diff computes the differences between lb and the state desired by svc and
+// nodes. It compares the type, the algorithm, the labels, the services
+// including their health checks, and the server targets. Annotations are not
+// validated, see DescribeService.
+//
+// Values which are not set by svc or the defaults are not compared, they
+// keep the values of the Hetzner Cloud API. Certificates are compared by
+// their IDs, the Load Balancer only reports those. Certificates referenced by
+// name and managed certificates are resolved with CertOps, which are the only
+// requests to the Hetzner Cloud API. IP targets are not compared, the
+// addresses of dedicated servers are only known to the Robot API.
+func (l *LoadBalancerOps) Diff(lb *hcloud.LoadBalancer, svc *corev1.Service, nodes []*corev1.Node) (*LoadBalancerDiff, error) {
+	const op = "hcops/LoadBalancerOps.Diff"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	algorithm, err := describeAlgorithm(svc, l.Defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	desiredPortConfigs, err := describePorts(svc, l.Defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for i, p := range desiredPortConfigs {
+		desiredPortConfigs[i].Certificates, err = l.resolveCertificateIDs(svc, p.Certificates)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	diff := &LoadBalancerDiff{}
+	if v, ok := annotation.LBType.StringFromService(svc); ok && lb.LoadBalancerType != nil {
+		diff.add("type", lb.LoadBalancerType.Name, v)
+	}
+	if algorithm != "" {
+		diff.add("algorithm", string(lb.Algorithm.Type), string(algorithm))
+	}
+
+	labels := l.serviceLabels(svc)
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		actual, ok := lb.Labels[k]
+		if !ok {
+			actual = diffAbsent
+		}
+		diff.add("labels."+k, actual, labels[k])
+	}
+
+	actualPorts := make(map[int]ServicePortConfig, len(lb.Services))
+	for _, s := range lb.Services {
+		actualPorts[s.ListenPort] = describeLBService(s)
+	}
+	desiredPorts := make(map[int]bool, len(desiredPortConfigs))
+	for _, p := range desiredPortConfigs {
+		desiredPorts[p.ListenPort] = true
+		field := fmt.Sprintf("services[%d]", p.ListenPort)
+		actual, ok := actualPorts[p.ListenPort]
+		if !ok {
+			diff.add(field, diffAbsent, p.Protocol)
+			continue
+		}
+		actualFields, err := flattenConfig(actual)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		desiredFields, err := flattenConfig(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		names := make([]string, 0, len(desiredFields))
+		for name := range desiredFields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v, ok := actualFields[name]
+			if !ok {
+				v = diffAbsent
+			}
+			diff.add(field+"."+name, v, desiredFields[name])
+		}
+	}
+	for _, s := range lb.Services {
+		if !desiredPorts[s.ListenPort] {
+			diff.add(fmt.Sprintf("services[%d]", s.ListenPort), string(s.Protocol), diffAbsent)
+		}
+	}
+
+	var actualTargets, desiredTargets []string
+	for _, t := range lb.Targets {
+		if t.Type == hcloud.LoadBalancerTargetTypeServer && t.Server != nil && t.Server.Server != nil {
+			actualTargets = append(actualTargets, "server/"+strconv.FormatInt(t.Server.Server.ID, 10))
+		}
+	}
+	for _, n := range nodes {
+		id, isHCloudServer, err := l.providerIDToServerID(n.Spec.ProviderID)
+		if err != nil || !isHCloudServer {
+			continue
+		}
+		desiredTargets = append(desiredTargets, "server/"+strconv.FormatInt(id, 10))
+	}
+	sort.Strings(actualTargets)
+	sort.Strings(desiredTargets)
+	diff.add("targets", strings.Join(actualTargets, ","), strings.Join(desiredTargets, ","))
+
+	return diff, nil
+}
+
+// resolveCertificateIDs replaces the names of certs and the managed
+// certificate of svc, as returned by describePorts, by their IDs. Certificates
+// which do not exist keep their name. Nothing is resolved without CertOps.
+func (l *LoadBalancerOps) resolveCertificateIDs(svc *corev1.Service, certs []string) ([]string, error) {
+	if l.CertOps == nil || len(certs) == 0 {
+		return certs, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resolved := make([]string, 0, len(certs))
+	for _, c := range certs {
+		if _, err := strconv.ParseInt(c, 10, 64); err == nil {
+			resolved = append(resolved, c)
+			continue
+		}
+		var (
+			cert *hcloud.Certificate
+			err  error
+		)
+		if c == string(hcloud.CertificateTypeManaged) {
+			cert, err = l.CertOps.GetCertificateByLabel(ctx, fmt.Sprintf("%s=%s", l.label(LabelServiceUID), svc.ObjectMeta.UID))
+		} else {
+			cert, err = l.CertOps.GetCertificateByNameOrID(ctx, c)
+		}
+		if errors.Is(err, ErrNotFound) {
+			resolved = append(resolved, c)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, strconv.FormatInt(cert.ID, 10))
+	}
+	return resolved, nil
+}
+
+// describeLBService returns the configuration of the existing Load Balancer
+// service s, in the format of DescribeService.
+func describeLBService(s hcloud.LoadBalancerService) ServicePortConfig {
+	p := ServicePortConfig{
+		ListenPort:      s.ListenPort,
+		DestinationPort: s.DestinationPort,
+		Protocol:        string(s.Protocol),
+		ProxyProtocol:   s.Proxyprotocol,
+	}
+	if s.Protocol == hcloud.LoadBalancerServiceProtocolHTTP || s.Protocol == hcloud.LoadBalancerServiceProtocolHTTPS {
+		for _, c := range s.HTTP.Certificates {
+			p.Certificates = append(p.Certificates, strconv.FormatInt(c.ID, 10))
+		}
+		p.RedirectHTTP = s.HTTP.RedirectHTTP
+		p.StickySessions = s.HTTP.StickySessions
+		p.CookieName = s.HTTP.CookieName
+		if s.HTTP.CookieLifetime > 0 {
+			p.CookieLifetime = s.HTTP.CookieLifetime.String()
+		}
+	}
+
+	hc := s.HealthCheck
+	p.HealthCheck = HealthCheckConfig{Protocol: string(hc.Protocol), Port: hc.Port, Retries: hcloud.Ptr(hc.Retries)}
+	if hc.Interval > 0 {
+		p.HealthCheck.Interval = hc.Interval.String()
+	}
+	if hc.Timeout > 0 {
+		p.HealthCheck.Timeout = hc.Timeout.String()
+	}
+	if hc.HTTP != nil {
+		p.HealthCheck.Domain = hc.HTTP.Domain
+		p.HealthCheck.Path = hc.HTTP.Path
+		p.HealthCheck.StatusCodes = hc.HTTP.StatusCodes
+		p.HealthCheck.TLS = hcloud.Ptr(hc.HTTP.TLS)
+	}
+	return p
+}
+
+// flattenConfig returns the fields of cfg which are set, keyed by their JSON
+// path, e.g. "healthCheck.interval".
+func flattenConfig(cfg ServicePortConfig) (map[string]string, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	flattenInto(fields, "", m)
+	delete(fields, "listenPort")
+	return fields, nil
+}
+
+func flattenInto(fields map[string]string, prefix string, m map[string]interface{}) {
+	for k, v := range m {
+		if nested, ok := v.(map[string]interface{}); ok {
+			flattenInto(fields, prefix+k+".", nested)
+			continue
+		}
+		fields[prefix+k] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,104 @@
+package hcops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/mocks"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoadBalancerOps_Diff(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+			UID:       "svc-uid",
+			Annotations: map[string]string{
+				string(annotation.LBSvcProtocol):            "https",
+				string(annotation.LBSvcHTTPCertificates):    "7",
+				string(annotation.LBSvcHealthCheckInterval): "5s",
+			},
+		},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{Port: 443, NodePort: 30443, Protocol: corev1.ProtocolTCP},
+		}},
+	}
+	lb := &hcloud.LoadBalancer{
+		ID:               1,
+		LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+		Algorithm:        hcloud.LoadBalancerAlgorithm{Type: hcloud.LoadBalancerAlgorithmTypeRoundRobin},
+		Labels: map[string]string{
+			hcops.LabelServiceUID:       "svc-uid",
+			hcops.LabelServiceNamespace: "default",
+		},
+		Services: []hcloud.LoadBalancerService{
+			{
+				Protocol:        hcloud.LoadBalancerServiceProtocolHTTPS,
+				ListenPort:      443,
+				DestinationPort: 30443,
+				HTTP: hcloud.LoadBalancerServiceHTTP{
+					Certificates: []*hcloud.Certificate{{ID: 7, Certificate: "-----BEGIN CERTIFICATE-----"}},
+				},
+				HealthCheck: hcloud.LoadBalancerServiceHealthCheck{
+					Protocol: hcloud.LoadBalancerServiceProtocolHTTPS,
+					Port:     30443,
+					Interval: 15 * time.Second,
+					Timeout:  10 * time.Second,
+					Retries:  3,
+				},
+			},
+			{Protocol: hcloud.LoadBalancerServiceProtocolTCP, ListenPort: 80, DestinationPort: 30080},
+		},
+		Targets: []hcloud.LoadBalancerTarget{
+			{Type: hcloud.LoadBalancerTargetTypeServer, Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 1}}},
+		},
+	}
+	nodes := []*corev1.Node{
+		{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+		{Spec: corev1.NodeSpec{ProviderID: "hcloud://2"}},
+		{Spec: corev1.NodeSpec{ProviderID: "hcloud://bm-3"}},
+	}
+
+	ops := &hcops.LoadBalancerOps{}
+	diff, err := ops.Diff(lb, svc, nodes)
+	require.NoError(t, err)
+	assert.Equal(t, []hcops.Change{
+		{Field: "labels." + hcops.LabelServiceName, Actual: "<none>", Desired: "web"},
+		{Field: "services[443].healthCheck.interval", Actual: "15s", Desired: "5s"},
+		{Field: "services[80]", Actual: "tcp", Desired: "<none>"},
+		{Field: "targets", Actual: "server/1", Desired: "server/1,server/2"},
+	}, diff.Changes)
+	assert.Equal(t, "labels.hcloud-ccm/service-name: <none> -> web; "+
+		"services[443].healthCheck.interval: 15s -> 5s; "+
+		"services[80]: tcp -> <none>; "+
+		"targets: server/1 -> server/1,server/2", diff.String())
+	assert.NotContains(t, diff.String(), "CERTIFICATE")
+
+	lb.Labels[hcops.LabelServiceName] = "web"
+	lb.Services = lb.Services[:1]
+	lb.Services[0].HealthCheck.Interval = 5 * time.Second
+	lb.Targets = append(lb.Targets, hcloud.LoadBalancerTarget{
+		Type: hcloud.LoadBalancerTargetTypeServer, Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 2}},
+	})
+	diff, err = ops.Diff(lb, svc, nodes)
+	require.NoError(t, err)
+	assert.Equal(t, "no changes", diff.String())
+
+	certClient := &mocks.CertificateClient{}
+	certClient.Test(t)
+	certClient.On("Get", mock.Anything, "my-cert").Return(&hcloud.Certificate{ID: 7, Name: "my-cert"}, nil, nil)
+	svc.Annotations[string(annotation.LBSvcHTTPCertificates)] = "my-cert"
+	ops.CertOps = &hcops.CertificateOps{CertClient: certClient}
+	diff, err = ops.Diff(lb, svc, nodes)
+	require.NoError(t, err)
+	assert.Equal(t, "no changes", diff.String())
+	certClient.AssertExpectations(t)
+}
@@ -0,0 +1,229 @@
+package hcops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// DefaultDrainPollInterval is the interval in which DrainNode checks the
+// health of the draining targets if LoadBalancerOps.DrainPollInterval is not
+// set.
+const DefaultDrainPollInterval = 5 * time.Second
+
+// drainRemoveTimeout bounds the removal of the targets once the wait of
+// DrainNode ended, also if the context of DrainNode is done already.
+const drainRemoveTimeout = 30 * time.Second
+
+// drainTarget is a target of a Load Balancer which is being drained.
+type drainTarget struct {
+	lb     *hcloud.LoadBalancer
+	target hcloud.LoadBalancerTarget
+}
+
+// DrainNode drains the server backing node from all Load Balancers managed
+// by the cloud controller manager. The Hetzner Cloud API can not stop the
+// traffic to a single target, so the targets are kept until none of these
+// Load Balancers reports them as healthy anymore, e.g. because the pods of
+// the node were evicted. Until then open connections can finish. Afterwards
+// the targets are removed.
+//
+// DrainNode does not enforce a timeout on its own. Callers are expected to
+// bound the wait using ctx, the targets are removed once ctx is done.
+func (l *LoadBalancerOps) DrainNode(ctx context.Context, node *corev1.Node) error {
+	const op = "hcops/LoadBalancerOps.DrainNode"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	targets, err := l.nodeTargets(ctx, node)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	pollInterval := l.DrainPollInterval
+	if pollInterval == 0 {
+		pollInterval = DefaultDrainPollInterval
+	}
+	var remove []drainTarget
+	for i, t := range targets {
+		if ctx.Err() != nil {
+			// The wait timed out, remove the remaining targets right away.
+			remove = append(remove, targets[i:]...)
+			break
+		}
+		exists, err := l.waitTargetUnhealthy(ctx, &t, pollInterval)
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err != nil {
+			klog.InfoS("draining node timed out, removing targets", "op", op, "node", node.Name, "loadBalancerID", t.lb.ID)
+		}
+		// Otherwise the Load Balancer or the target was removed in the
+		// meantime.
+		if exists {
+			remove = append(remove, t)
+		}
+	}
+
+	removeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), drainRemoveTimeout)
+	defer cancel()
+	for _, t := range remove {
+		var action *hcloud.Action
+		if t.target.Type == hcloud.LoadBalancerTargetTypeServer {
+			action, _, err = l.LBClient.RemoveServerTarget(removeCtx, t.lb, t.target.Server.Server)
+		} else {
+			action, _, err = l.LBClient.RemoveIPTarget(removeCtx, t.lb, net.ParseIP(t.target.IP.IP))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: remove target from load balancer %d: %w", op, t.lb.ID, err)
+		}
+		if err := WatchAction(removeCtx, l.ActionClient, action); err != nil {
+			return fmt.Errorf("%s: remove target from load balancer %d: %w", op, t.lb.ID, err)
+		}
+		klog.InfoS("removed drained node from load balancer", "op", op, "node", node.Name, "loadBalancerID", t.lb.ID)
+	}
+	return nil
+}
+
+// IsNodeTarget reports whether the server backing node is a target of a Load
+// Balancer managed by the cloud controller manager.
+func (l *LoadBalancerOps) IsNodeTarget(ctx context.Context, node *corev1.Node) (bool, error) {
+	const op = "hcops/LoadBalancerOps.IsNodeTarget"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	targets, err := l.nodeTargets(ctx, node)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return len(targets) > 0, nil
+}
+
+// nodeTargets returns the targets of the managed Load Balancers referencing
+// the server backing node.
+func (l *LoadBalancerOps) nodeTargets(ctx context.Context, node *corev1.Node) ([]drainTarget, error) {
+	id, isHCloudServer, err := l.providerIDToServerID(node.Spec.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var robotIP net.IP
+	if !isHCloudServer {
+		if l.RobotClient == nil {
+			return nil, fmt.Errorf("node %s: robot client not configured", node.Name)
+		}
+		servers, err := l.RobotClient.ServerGetList()
+		if err != nil {
+			HandleRateLimitExceededError(err, node)
+			return nil, NewAPIError("list", "robot servers", err)
+		}
+		for _, s := range servers {
+			if s.ServerNumber == int(id) {
+				robotIP = net.ParseIP(s.ServerIP)
+				break
+			}
+		}
+		if robotIP == nil {
+			// The server does not exist anymore and cannot be a target.
+			return nil, nil
+		}
+	}
+
+	lbs, err := l.LBClient.AllWithOpts(ctx, hcloud.LoadBalancerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: l.label(LabelServiceUID)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []drainTarget
+	for _, lb := range lbs {
+		if target, ok := findTarget(lb, id, isHCloudServer, robotIP); ok {
+			targets = append(targets, drainTarget{lb: lb, target: target})
+		}
+	}
+	return targets, nil
+}
+
+// waitTargetUnhealthy polls the Load Balancer of t until it does not report
+// the target as healthy anymore, and updates t to the current state. It
+// reports false if the Load Balancer or the target does not exist anymore.
+func (l *LoadBalancerOps) waitTargetUnhealthy(ctx context.Context, t *drainTarget, pollInterval time.Duration) (bool, error) {
+	isServer := t.target.Type == hcloud.LoadBalancerTargetTypeServer
+	id, ip := serverIDOfTarget(t.target), ipOfTarget(t.target)
+	for {
+		current, err := l.GetByID(ctx, t.lb.ID)
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			// Remove the last known target if the wait timed out.
+			return true, err
+		}
+		target, ok := findTarget(current, id, isServer, ip)
+		if !ok {
+			return false, nil
+		}
+		t.lb, t.target = current, target
+		if !isHealthy(target) {
+			return true, nil
+		}
+		select {
+		case <-ctx.Done():
+			return true, fmt.Errorf("wait for load balancer %d: %w", t.lb.ID, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func serverIDOfTarget(t hcloud.LoadBalancerTarget) int64 {
+	if t.Server != nil && t.Server.Server != nil {
+		return t.Server.Server.ID
+	}
+	return 0
+}
+
+func ipOfTarget(t hcloud.LoadBalancerTarget) net.IP {
+	if t.IP != nil {
+		return net.ParseIP(t.IP.IP)
+	}
+	return nil
+}
+
+// findTarget returns the target of lb referencing the server with the given
+// id (hcloud servers) or ip (robot servers).
+func findTarget(lb *hcloud.LoadBalancer, id int64, isHCloudServer bool, ip net.IP) (hcloud.LoadBalancerTarget, bool) {
+	if lb == nil {
+		return hcloud.LoadBalancerTarget{}, false
+	}
+	for _, target := range lb.Targets {
+		switch {
+		case isHCloudServer && target.Type == hcloud.LoadBalancerTargetTypeServer &&
+			target.Server != nil && target.Server.Server != nil:
+			if target.Server.Server.ID == id {
+				return target, true
+			}
+		case !isHCloudServer && target.Type == hcloud.LoadBalancerTargetTypeIP && target.IP != nil:
+			if net.ParseIP(target.IP.IP).Equal(ip) {
+				return target, true
+			}
+		}
+	}
+	return hcloud.LoadBalancerTarget{}, false
+}
+
+// isHealthy reports whether at least one service of the Load Balancer
+// considers target healthy.
+func isHealthy(target hcloud.LoadBalancerTarget) bool {
+	for _, hs := range target.HealthStatus {
+		if hs.Status == hcloud.LoadBalancerTargetHealthStatusStatusHealthy {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package hcops_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// drainTargets returns a target of the server 1 with the given health
+// status and a target of another server.
+func drainTargets(status hcloud.LoadBalancerTargetHealthStatusStatus) []hcloud.LoadBalancerTarget {
+	return []hcloud.LoadBalancerTarget{
+		{
+			Type:   hcloud.LoadBalancerTargetTypeServer,
+			Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 1}},
+			HealthStatus: []hcloud.LoadBalancerTargetHealthStatus{
+				{ListenPort: 80, Status: status},
+			},
+		},
+		{
+			Type:   hcloud.LoadBalancerTargetTypeServer,
+			Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 2}},
+		},
+	}
+}
+
+// mockDrainList mocks the list of the managed Load Balancers.
+func mockDrainList(fx *hcops.LoadBalancerOpsFixture, lbs ...*hcloud.LoadBalancer) {
+	fx.LBClient.
+		On("AllWithOpts", mock.Anything, hcloud.LoadBalancerListOpts{
+			ListOpts: hcloud.ListOpts{LabelSelector: hcops.LabelServiceUID},
+		}).
+		Return(lbs, nil)
+}
+
+// mockDrainRemove mocks the removal of the server 1 from lb. The removal
+// uses its own context, which outlives the one of DrainNode.
+func mockDrainRemove(fx *hcops.LoadBalancerOpsFixture, lb *hcloud.LoadBalancer) *mock.Call {
+	action := &hcloud.Action{ID: lb.ID}
+	resC := make(chan int)
+	errC := make(chan error)
+	close(resC)
+	close(errC)
+	fx.ActionClient.On("WatchProgress", mock.Anything, action).Return(resC, errC)
+	return fx.LBClient.On("RemoveServerTarget", mock.Anything, lb, lb.Targets[0].Server.Server).Return(action, nil, nil)
+}
+
+func TestLoadBalancerOps_DrainNode(t *testing.T) {
+	node := &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}}
+
+	fx := hcops.NewLoadBalancerOpsFixture(t)
+	fx.LBOps.DrainPollInterval = time.Millisecond
+
+	lb := &hcloud.LoadBalancer{ID: 10, Targets: drainTargets(hcloud.LoadBalancerTargetHealthStatusStatusHealthy)}
+	untouched := &hcloud.LoadBalancer{ID: 11, Targets: drainTargets(hcloud.LoadBalancerTargetHealthStatusStatusHealthy)[1:]}
+	mockDrainList(fx, lb, untouched)
+
+	// The target is kept while the Load Balancer reports it as healthy, and
+	// removed once the health checks of the node fail.
+	unhealthy := &hcloud.LoadBalancer{ID: 10, Targets: drainTargets(hcloud.LoadBalancerTargetHealthStatusStatusUnhealthy)}
+	mock.InOrder(
+		fx.LBClient.On("GetByID", fx.Ctx, lb.ID).Return(lb, nil, nil).Once(),
+		fx.LBClient.On("GetByID", fx.Ctx, lb.ID).Return(unhealthy, nil, nil).Once(),
+		mockDrainRemove(fx, unhealthy),
+	)
+
+	err := fx.LBOps.DrainNode(fx.Ctx, node)
+	assert.NoError(t, err)
+	fx.AssertExpectations()
+}
+
+func TestLoadBalancerOps_DrainNode_Timeout(t *testing.T) {
+	node := &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}}
+
+	fx := hcops.NewLoadBalancerOpsFixture(t)
+	fx.LBOps.DrainPollInterval = time.Millisecond
+
+	lb := &hcloud.LoadBalancer{ID: 10, Targets: drainTargets(hcloud.LoadBalancerTargetHealthStatusStatusHealthy)}
+	mockDrainList(fx, lb)
+	fx.LBClient.On("GetByID", mock.Anything, lb.ID).Return(lb, nil, nil)
+	mockDrainRemove(fx, lb)
+
+	// The target stays healthy, it is removed once the wait timed out.
+	ctx, cancel := context.WithTimeout(fx.Ctx, 20*time.Millisecond)
+	defer cancel()
+	err := fx.LBOps.DrainNode(ctx, node)
+	assert.NoError(t, err)
+	fx.AssertExpectations()
+}
+
+func TestLoadBalancerOps_DrainNode_TargetRemoved(t *testing.T) {
+	node := &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}}
+
+	fx := hcops.NewLoadBalancerOpsFixture(t)
+	fx.LBOps.DrainPollInterval = time.Millisecond
+
+	lb := &hcloud.LoadBalancer{ID: 10, Targets: drainTargets(hcloud.LoadBalancerTargetHealthStatusStatusHealthy)}
+	mockDrainList(fx, lb)
+	// The target was removed in the meantime, e.g. by a reconcile.
+	removed := &hcloud.LoadBalancer{ID: 10, Targets: lb.Targets[1:]}
+	fx.LBClient.On("GetByID", fx.Ctx, lb.ID).Return(removed, nil, nil)
+
+	err := fx.LBOps.DrainNode(fx.Ctx, node)
+	assert.NoError(t, err)
+	fx.LBClient.AssertNotCalled(t, "RemoveServerTarget", mock.Anything, mock.Anything, mock.Anything)
+	fx.AssertExpectations()
+}
+
+func TestLoadBalancerOps_DrainNode_InvalidProviderID(t *testing.T) {
+	fx := hcops.NewLoadBalancerOpsFixture(t)
+
+	err := fx.LBOps.DrainNode(fx.Ctx, &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "other://1"}})
+	assert.Error(t, err)
+	fx.AssertExpectations()
+}
+
+func TestLoadBalancerOps_IsNodeTarget(t *testing.T) {
+	fx := hcops.NewLoadBalancerOpsFixture(t)
+
+	lb := &hcloud.LoadBalancer{ID: 10, Targets: drainTargets(hcloud.LoadBalancerTargetHealthStatusStatusHealthy)}
+	mockDrainList(fx, lb)
+
+	isTarget, err := fx.LBOps.IsNodeTarget(fx.Ctx, &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}})
+	assert.NoError(t, err)
+	assert.True(t, isTarget)
+
+	isTarget, err = fx.LBOps.IsNodeTarget(fx.Ctx, &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "hcloud://3"}})
+	assert.NoError(t, err)
+	assert.False(t, isTarget)
+	fx.AssertExpectations()
+}
+
+func TestLoadBalancerOps_IsNodeTarget_AdditionalPrefix(t *testing.T) {
+	fx := hcops.NewLoadBalancerOpsFixture(t)
+	fx.LBOps.ProviderIDAdditionalPrefix = "mycluster://"
+
+	lb := &hcloud.LoadBalancer{ID: 10, Targets: drainTargets(hcloud.LoadBalancerTargetHealthStatusStatusHealthy)}
+	mockDrainList(fx, lb)
+
+	isTarget, err := fx.LBOps.IsNodeTarget(fx.Ctx, &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "mycluster://1"}})
+	assert.NoError(t, err)
+	assert.True(t, isTarget)
+	fx.AssertExpectations()
+}
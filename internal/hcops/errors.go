@@ -1,6 +1,15 @@
 package hcops
 
-import "errors"
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hrobot-go/models"
+)
 
 var (
 	// ErrNotFound signals that an item was not found by the Hetzner Cloud
@@ -15,4 +24,152 @@ var (
 	// ErrAlreadyExists signals that the resource creation failed, because the
 	// resource already exists.
 	ErrAlreadyExists = errors.New("already exists")
+
+	// ErrOwnedByOtherCluster signals that a resource is managed by another
+	// cluster and must not be adopted.
+	ErrOwnedByOtherCluster = errors.New("owned by another cluster")
+
+	// ErrOwnedByOtherService signals that a resource is managed for another
+	// Service and must not be adopted.
+	ErrOwnedByOtherService = errors.New("owned by another service")
+
+	// ErrTargetsLocked signals that some server targets of a Load Balancer
+	// were not added or removed, because their servers are locked, e.g. by a
+	// running action. All other targets were reconciled.
+	ErrTargetsLocked = errors.New("targets locked")
 )
+
+// APIError wraps an error returned by the Hetzner Cloud or the Hetzner Robot
+// API. Use errors.As to obtain it from a wrapped error.
+//
+// The message of an APIError is the message of the wrapped error.
+type APIError struct {
+	// Action is the operation which failed, e.g. "delete".
+	Action string
+
+	// Resource identifies the resource the action was performed on, e.g.
+	// "load balancer 4711".
+	Resource string
+
+	// Retriable reports whether the action may succeed if it is retried
+	// later without any changes.
+	Retriable bool
+
+	Err error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// NewAPIError wraps err in an *APIError and classifies whether it is
+// retriable. NewAPIError returns nil if err is nil.
+func NewAPIError(action, resource string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &APIError{
+		Action:    action,
+		Resource:  resource,
+		Retriable: isRetriable(err),
+		Err:       err,
+	}
+}
+
+// IsRetriable reports whether err is a transient error, i.e. the failed
+// action may succeed if it is retried later.
+func IsRetriable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retriable
+	}
+	return isRetriable(err)
+}
+
+// IsRobotError reports whether err wraps a Hetzner Robot API error with code.
+// Unlike models.IsError it also matches wrapped errors.
+func IsRobotError(err error, code models.ErrorCode) bool {
+	var robotErr models.Error
+	return errors.As(err, &robotErr) && robotErr.Code == code
+}
+
+// IsTransient reports whether err is a transient error of the Hetzner Cloud
+// API which the hcloud-go client does not retry itself: locked resources,
+// maintenance, an unavailable robot and server errors other than 502 Bad
+// Gateway and 504 Gateway Timeout. Conflicts, exceeded rate limits, 502, 504
+// and timeouts are retried by the client already, retrying them again would
+// only add requests to an exceeded rate limit.
+func IsTransient(err error) bool {
+	var hcloudErr hcloud.Error
+	if errors.As(err, &hcloudErr) {
+		switch hcloudErr.Code {
+		case hcloud.ErrorCodeLocked,
+			hcloud.ErrorCodeMaintenance,
+			hcloud.ErrorCodeRobotUnavailable,
+			hcloud.ErrorCodeServiceError:
+			return true
+		case hcloud.ErrorCodeConflict,
+			hcloud.ErrorCodeRateLimitExceeded:
+			return false
+		}
+		resp := hcloudErr.Response()
+		return resp != nil && resp.Response != nil && isServerErrorNotRetried(resp.StatusCode)
+	}
+	// Responses without error details are returned by proxies in front of
+	// the API, e.g. 503 Service Unavailable.
+	if errors.Is(err, hcloud.ErrStatusCode) {
+		code, ok := statusCodeOf(err)
+		return ok && isServerErrorNotRetried(code)
+	}
+	return false
+}
+
+// isServerErrorNotRetried reports whether code is a server error which the
+// hcloud-go client does not retry.
+func isServerErrorNotRetried(code int) bool {
+	return code >= http.StatusInternalServerError &&
+		code != http.StatusBadGateway && code != http.StatusGatewayTimeout
+}
+
+// statusCodeOf returns the status code of an hcloud.ErrStatusCode error,
+// which the hcloud-go client appends to its message.
+func statusCodeOf(err error) (int, bool) {
+	msg := err.Error()
+	code, err := strconv.Atoi(msg[strings.LastIndex(msg, " ")+1:])
+	return code, err == nil
+}
+
+func isRetriable(err error) bool {
+	var hcloudErr hcloud.Error
+	if errors.As(err, &hcloudErr) {
+		switch hcloudErr.Code {
+		case hcloud.ErrorCodeRateLimitExceeded,
+			hcloud.ErrorCodeLocked,
+			hcloud.ErrorCodeConflict,
+			hcloud.ErrorCodeResourceUnavailable,
+			hcloud.ErrorCodeMaintenance,
+			hcloud.ErrorCodeRobotUnavailable,
+			hcloud.ErrorCodeServiceError:
+			return true
+		}
+		return false
+	}
+
+	var robotErr models.Error
+	if errors.As(err, &robotErr) {
+		switch robotErr.Code {
+		case models.ErrorCodeRateLimitExceeded,
+			models.ErrorCodeConflict,
+			models.ErrorCodeInternalError:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
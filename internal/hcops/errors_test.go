@@ -0,0 +1,99 @@
+package hcops_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	"github.com/syself/hrobot-go/models"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestNewAPIError(t *testing.T) {
+	assert.NoError(t, hcops.NewAPIError("get", "server 1", nil))
+
+	cause := hcloud.Error{Code: hcloud.ErrorCodeLocked, Message: "server is locked"}
+	err := fmt.Errorf("hcloud/getServerByID: %w", hcops.NewAPIError("get", "server 1", cause))
+
+	// The message of the wrapped error is kept.
+	assert.EqualError(t, err, "hcloud/getServerByID: server is locked (locked)")
+	assert.True(t, hcloud.IsError(err, hcloud.ErrorCodeLocked))
+
+	var apiErr *hcops.APIError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, "get", apiErr.Action)
+		assert.Equal(t, "server 1", apiErr.Resource)
+		assert.True(t, apiErr.Retriable)
+	}
+}
+
+func TestIsRetriable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "hcloud locked", err: hcloud.Error{Code: hcloud.ErrorCodeLocked}, expected: true},
+		{name: "hcloud conflict", err: hcloud.Error{Code: hcloud.ErrorCodeConflict}, expected: true},
+		{name: "hcloud rate limit", err: hcloud.Error{Code: hcloud.ErrorCodeRateLimitExceeded}, expected: true},
+		{name: "hcloud not found", err: hcloud.Error{Code: hcloud.ErrorCodeNotFound}},
+		{name: "hcloud invalid input", err: hcloud.Error{Code: hcloud.ErrorCodeInvalidInput}},
+		{name: "robot rate limit", err: models.Error{Code: models.ErrorCodeRateLimitExceeded}, expected: true},
+		{name: "robot unauthorized", err: models.Error{Code: models.ErrorCodeUnauthorized}},
+		{name: "network timeout", err: fmt.Errorf("get: %w", timeoutError{}), expected: true},
+		{name: "wrapped api error", err: fmt.Errorf("op: %w", hcops.NewAPIError("delete", "load balancer 1", hcloud.Error{Code: hcloud.ErrorCodeLocked})), expected: true},
+		{name: "context canceled", err: context.Canceled},
+		{name: "other error", err: errors.New("something failed")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, hcops.IsRetriable(tt.err))
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "hcloud locked", err: hcloud.Error{Code: hcloud.ErrorCodeLocked}, expected: true},
+		{name: "hcloud conflict", err: hcloud.Error{Code: hcloud.ErrorCodeConflict}},
+		{name: "hcloud rate limit", err: hcloud.Error{Code: hcloud.ErrorCodeRateLimitExceeded}},
+		{name: "hcloud service error", err: hcloud.Error{Code: hcloud.ErrorCodeServiceError}, expected: true},
+		{name: "hcloud resource unavailable", err: hcloud.Error{Code: hcloud.ErrorCodeResourceUnavailable}},
+		{name: "hcloud invalid input", err: hcloud.Error{Code: hcloud.ErrorCodeInvalidInput}},
+		{name: "status code 503", err: fmt.Errorf("hcloud: %w 503", hcloud.ErrStatusCode), expected: true},
+		{name: "status code 502", err: fmt.Errorf("hcloud: %w 502", hcloud.ErrStatusCode)},
+		{name: "status code 404", err: fmt.Errorf("hcloud: %w 404", hcloud.ErrStatusCode)},
+		{name: "robot internal error", err: models.Error{Code: models.ErrorCodeInternalError}},
+		{name: "network timeout", err: fmt.Errorf("get: %w", timeoutError{})},
+		{name: "other error", err: errors.New("something failed")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, hcops.IsTransient(tt.err))
+		})
+	}
+}
+
+func TestIsRobotError(t *testing.T) {
+	err := fmt.Errorf("robot/getServerByID: %w",
+		hcops.NewAPIError("get", "robot server 1", models.Error{Code: models.ErrorCodeServerNotFound}))
+	assert.True(t, hcops.IsRobotError(err, models.ErrorCodeServerNotFound))
+	assert.False(t, hcops.IsRobotError(err, models.ErrorCodeRateLimitExceeded))
+	assert.False(t, hcops.IsRobotError(errors.New("other"), models.ErrorCodeServerNotFound))
+}
@@ -2,9 +2,13 @@ package hcops
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,9 +17,11 @@ import (
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/annotation"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/providerid"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
 	"github.com/syself/hrobot-go/models"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 )
@@ -24,6 +30,131 @@ import (
 // identify a load balancer managed by Hetzner Cloud Cloud Controller Manager.
 const LabelServiceUID = "hcloud-ccm/service-uid"
 
+// LabelServiceNamespace and LabelServiceName are labels added to the Hetzner
+// Cloud backend to allow operators to trace a load balancer back to its
+// Kubernetes Service.
+const (
+	LabelServiceNamespace = "hcloud-ccm/service-namespace"
+	LabelServiceName      = "hcloud-ccm/service-name"
+)
+
+// LabelCluster is added to load balancers if LoadBalancerOps.ClusterName is
+// set and identifies the cluster the load balancer belongs to.
+const LabelCluster = "hcloud-ccm/cluster"
+
+// LabelLocation is added to load balancers created with a location fallback
+// and records the location the load balancer was created in.
+const LabelLocation = "hcloud-ccm/location"
+
+// DefaultLabelPrefix is the prefix of the labels above. It can be replaced
+// with LoadBalancerOps.LabelPrefix, so that several clusters sharing a
+// project do not consider the Load Balancers of each other as their own.
+const DefaultLabelPrefix = "hcloud-ccm"
+
+// WithLabelPrefix replaces the DefaultLabelPrefix of key with prefix. An
+// empty prefix keeps the default.
+func WithLabelPrefix(prefix, key string) string {
+	if prefix == "" || prefix == DefaultLabelPrefix {
+		return key
+	}
+	return prefix + strings.TrimPrefix(key, DefaultLabelPrefix)
+}
+
+// label returns key with the label prefix of l.
+func (l *LoadBalancerOps) label(key string) string {
+	return WithLabelPrefix(l.LabelPrefix, key)
+}
+
+// maxLabelValueLength is the maximum length of a label value accepted by the
+// Hetzner Cloud API.
+const maxLabelValueLength = 63
+
+// serviceLabels returns the labels identifying the load balancer of svc.
+// Empty values are omitted.
+func (l *LoadBalancerOps) serviceLabels(svc *corev1.Service) map[string]string {
+	labels := map[string]string{
+		l.label(LabelServiceUID): string(svc.ObjectMeta.UID),
+	}
+	if v := sanitizeLabelValue(svc.ObjectMeta.Namespace); v != "" {
+		labels[l.label(LabelServiceNamespace)] = v
+	}
+	if v := sanitizeLabelValue(svc.ObjectMeta.Name); v != "" {
+		labels[l.label(LabelServiceName)] = v
+	}
+	if l.ClusterName != "" {
+		labels[l.label(LabelCluster)] = l.ClusterName
+	}
+	return labels
+}
+
+// checkOwnership returns ErrOwnedByOtherCluster if lb is identified as the
+// load balancer of another Service by a label with a different prefix, i.e.
+// it is managed by another cluster.
+func (l *LoadBalancerOps) checkOwnership(lb *hcloud.LoadBalancer, svc *corev1.Service) error {
+	ownKey := l.label(LabelServiceUID)
+	suffix := strings.TrimPrefix(LabelServiceUID, DefaultLabelPrefix)
+	for k, v := range lb.Labels {
+		if k == ownKey || !strings.HasSuffix(k, suffix) || v == string(svc.ObjectMeta.UID) {
+			continue
+		}
+		return fmt.Errorf("load balancer %d is labeled %s=%s: %w", lb.ID, k, v, ErrOwnedByOtherCluster)
+	}
+	return nil
+}
+
+// sanitizeLabelValue converts v into a valid Hetzner Cloud label value. Invalid
+// characters are replaced by "-", the value is truncated to
+// maxLabelValueLength and must start and end with an alphanumeric character.
+func sanitizeLabelValue(v string) string {
+	isAlnum := func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+	}
+	b := []rune(v)
+	for i, r := range b {
+		if !isAlnum(r) && r != '-' && r != '_' && r != '.' {
+			b[i] = '-'
+		}
+	}
+	if len(b) > maxLabelValueLength {
+		b = b[:maxLabelValueLength]
+	}
+	return strings.TrimFunc(string(b), func(r rune) bool { return !isAlnum(r) })
+}
+
+// DefaultMaxLBNameLength is the default maximum length of generated Load
+// Balancer names, the maximum length of names accepted by the Hetzner Cloud
+// API.
+const DefaultMaxLBNameLength = 63
+
+// MinLBNameLength is the minimum length generated Load Balancer names can be
+// restricted to. Shorter names would consist of the hash suffix only.
+const MinLBNameLength = 16
+
+// lbNameHashLength is the length of the hash suffix of truncated Load
+// Balancer names.
+const lbNameHashLength = 8
+
+// GenerateLBName converts the generated Load Balancer name into a valid name
+// of at most maxLength characters. Invalid characters are replaced by "-".
+// Longer names are truncated and suffixed with a hash of the full name, so the
+// result is stable and names which only differ in the truncated part stay
+// unique. maxLength must not be smaller than MinLBNameLength.
+func GenerateLBName(name string, maxLength int) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, name)
+	if len(sanitized) <= maxLength {
+		return sanitized
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	prefix := strings.TrimRight(sanitized[:maxLength-lbNameHashLength-1], "-_.")
+	return prefix + "-" + hex.EncodeToString(sum[:])[:lbNameHashLength]
+}
+
 // HCloudLoadBalancerClient defines the hcloud-go functions required by the
 // Load Balancer operations type.
 type HCloudLoadBalancerClient interface {
@@ -49,6 +180,7 @@ type HCloudLoadBalancerClient interface {
 	ChangeAlgorithm(ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerChangeAlgorithmOpts) (*hcloud.Action, *hcloud.Response, error)
 	ChangeType(ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerChangeTypeOpts) (*hcloud.Action, *hcloud.Response, error)
 	ChangeDNSPtr(ctx context.Context, lb *hcloud.LoadBalancer, ip string, ptr *string) (*hcloud.Action, *hcloud.Response, error)
+	ChangeProtection(ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerChangeProtectionOpts) (*hcloud.Action, *hcloud.Response, error)
 
 	AddServerTarget(ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerAddServerTargetOpts) (*hcloud.Action, *hcloud.Response, error)
 	RemoveServerTarget(ctx context.Context, lb *hcloud.LoadBalancer, server *hcloud.Server) (*hcloud.Action, *hcloud.Response, error)
@@ -77,9 +209,50 @@ type LoadBalancerOps struct {
 	RobotClient   client.Client
 	CertOps       *CertificateOps
 	RetryDelay    time.Duration
-	NetworkID     int64
-	Recorder      record.EventRecorder
-	Defaults      LoadBalancerDefaults
+
+	// NetworkID is the ID of the network of the cluster, or 0 if there is
+	// none. It is ignored if Network is set.
+	NetworkID int64
+
+	// Network replaces NetworkID if the network can change while the cloud
+	// controller manager is running. Optional.
+	Network *NetworkRef
+
+	// LabelPrefix replaces DefaultLabelPrefix in the labels added to Load
+	// Balancers and certificates. Optional.
+	LabelPrefix string
+
+	// ClusterName is added as LabelCluster to all Load Balancers. Optional.
+	ClusterName string
+
+	// ProviderIDAdditionalPrefix is accepted in addition to "hcloud://" when
+	// parsing the provider IDs of nodes. Optional.
+	ProviderIDAdditionalPrefix string
+
+	// DrainPollInterval is the interval in which DrainNode checks the health
+	// of removed targets. Defaults to DefaultDrainPollInterval.
+	DrainPollInterval time.Duration
+
+	networkNotFoundOnce sync.Once
+
+	// sourceRangesReported are the source ranges of each Service which were
+	// last reported as not enforced.
+	sourceRangesMu       sync.Mutex
+	sourceRangesReported map[types.UID]string
+
+	Recorder record.EventRecorder
+	Defaults LoadBalancerDefaults
+}
+
+// nodeInternalIP returns the first InternalIP of node, which is its IP in the
+// network of the cluster. Returns an empty string if node has none.
+func nodeInternalIP(node *corev1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	return ""
 }
 
 // LoadBalancerDefaults stores cluster-wide default values for load balancers.
@@ -88,6 +261,18 @@ type LoadBalancerDefaults struct {
 	NetworkZone  string
 	UsePrivateIP bool
 	DisableIPv6  bool
+
+	// FallbackLocation is the location of new Load Balancers if neither a
+	// location nor a network zone is set, by annotation or default.
+	FallbackLocation string
+
+	// Algorithm and the health check settings are used if the Service does
+	// not set the respective annotation. Zero values leave the Hetzner Cloud
+	// defaults in place.
+	Algorithm           hcloud.LoadBalancerAlgorithmType
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	HealthCheckRetries  int
 }
 
 // GetByK8SServiceUID tries to find a Load Balancer by its Kubernetes service
@@ -102,12 +287,12 @@ func (l *LoadBalancerOps) GetByK8SServiceUID(ctx context.Context, svc *corev1.Se
 
 	opts := hcloud.LoadBalancerListOpts{
 		ListOpts: hcloud.ListOpts{
-			LabelSelector: fmt.Sprintf("%s=%s", LabelServiceUID, svc.ObjectMeta.UID),
+			LabelSelector: fmt.Sprintf("%s=%s", l.label(LabelServiceUID), svc.ObjectMeta.UID),
 		},
 	}
 	lbs, err := l.LBClient.AllWithOpts(ctx, opts)
 	if err != nil {
-		return nil, fmt.Errorf("%s: api error: %v", op, err)
+		return nil, fmt.Errorf("%s: api error: %w", op, NewAPIError("list", "load balancers", err))
 	}
 	if len(lbs) == 0 {
 		return nil, fmt.Errorf("%s: %w", op, ErrNotFound)
@@ -132,7 +317,7 @@ func (l *LoadBalancerOps) GetByName(ctx context.Context, name string) (*hcloud.L
 		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
 			return nil, fmt.Errorf("%s: %s: %w", op, name, ErrNotFound)
 		}
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, NewAPIError("get", "load balancer "+name, err))
 	}
 	if lb == nil {
 		return nil, fmt.Errorf("%s: %s: %w", op, name, ErrNotFound)
@@ -153,7 +338,7 @@ func (l *LoadBalancerOps) GetByID(ctx context.Context, id int64) (*hcloud.LoadBa
 		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
 			return nil, fmt.Errorf("%s: %d: %w", op, id, ErrNotFound)
 		}
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, NewAPIError("get", fmt.Sprintf("load balancer %d", id), err))
 	}
 	if lb == nil {
 		return nil, fmt.Errorf("%s: %d: %w", op, id, ErrNotFound)
@@ -161,6 +346,82 @@ func (l *LoadBalancerOps) GetByID(ctx context.Context, id int64) (*hcloud.LoadBa
 	return lb, nil
 }
 
+// GetForAdoption retrieves the Hetzner Cloud Load Balancer with id, which svc
+// pins by the id annotation, and verifies that svc may adopt it.
+//
+// If no Load Balancer with id could be found, a wrapped ErrNotFound is
+// returned. Load Balancers labeled for another Service or cluster are not
+// adopted, a wrapped ErrOwnedByOtherService or ErrOwnedByOtherCluster is
+// returned. The location and network zone requested by the annotations of
+// svc must match the Load Balancer, as they can not be changed. A different
+// type is refused as well, adopting a Load Balancer must not resize it.
+func (l *LoadBalancerOps) GetForAdoption(ctx context.Context, id int64, svc *corev1.Service) (*hcloud.LoadBalancer, error) {
+	const op = "hcops/LoadBalancerOps.GetForAdoption"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	lb, err := l.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if v, ok := lb.Labels[l.label(LabelServiceUID)]; ok && v != string(svc.ObjectMeta.UID) {
+		return nil, fmt.Errorf("%s: load balancer %d is labeled %s=%s: %w",
+			op, lb.ID, l.label(LabelServiceUID), v, ErrOwnedByOtherService)
+	}
+	if err := l.checkOwnership(lb, svc); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if v, ok := annotation.LBLocation.StringFromService(svc); ok && v != "" && lb.Location != nil && lb.Location.Name != v {
+		return nil, fmt.Errorf("%s: load balancer %d is located in %s, not %s", op, lb.ID, lb.Location.Name, v)
+	}
+	if v, ok := annotation.LBNetworkZone.StringFromService(svc); ok && lb.Location != nil &&
+		string(lb.Location.NetworkZone) != v {
+		return nil, fmt.Errorf("%s: load balancer %d is in network zone %s, not %s", op, lb.ID, lb.Location.NetworkZone, v)
+	}
+	if v, ok := annotation.LBType.StringFromService(svc); ok && lb.LoadBalancerType != nil &&
+		lb.LoadBalancerType.Name != v {
+		return nil, fmt.Errorf("%s: load balancer %d has type %s, not %s", op, lb.ID, lb.LoadBalancerType.Name, v)
+	}
+
+	return lb, nil
+}
+
+// createLocation returns the location or, if no location is set, the network
+// zone a Load Balancer for svc is created in. Annotations of svc take
+// precedence over defaults.
+func createLocation(svc *corev1.Service, defaults LoadBalancerDefaults) (*hcloud.Location, hcloud.NetworkZone, error) {
+	var location *hcloud.Location
+	if defaults.Location != "" {
+		location = &hcloud.Location{Name: defaults.Location}
+	}
+	if v, ok := annotation.LBLocation.StringFromService(svc); ok {
+		if v == "" {
+			// Allow resetting the location in case someone wants to specify a network zone in an annotation
+			// and a location as default.
+			location = nil
+		} else {
+			location = &hcloud.Location{Name: v}
+		}
+	}
+	networkZone := hcloud.NetworkZone(defaults.NetworkZone)
+	if v, ok := annotation.LBNetworkZone.StringFromService(svc); ok {
+		networkZone = hcloud.NetworkZone(v)
+	}
+	if location == nil && networkZone == "" {
+		if defaults.FallbackLocation == "" {
+			return nil, "", fmt.Errorf("neither %s nor %s set", annotation.LBLocation, annotation.LBNetworkZone)
+		}
+		klog.Warningf("neither %s nor %s set for service %s/%s, using fallback location %s",
+			annotation.LBLocation, annotation.LBNetworkZone, svc.Namespace, svc.Name, defaults.FallbackLocation)
+		location = &hcloud.Location{Name: defaults.FallbackLocation}
+	}
+	if location != nil {
+		networkZone = ""
+	}
+	return location, networkZone, nil
+}
+
 // Create creates a new Load Balancer using the Hetzner Cloud API.
 //
 // It adds annotations identifying the HC Load Balancer to svc.
@@ -173,53 +434,43 @@ func (l *LoadBalancerOps) Create(
 	opts := hcloud.LoadBalancerCreateOpts{
 		Name:             lbName,
 		LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
-		Labels: map[string]string{
-			LabelServiceUID: string(svc.ObjectMeta.UID),
-		},
+		Labels:           l.serviceLabels(svc),
 	}
 	if v, ok := annotation.LBType.StringFromService(svc); ok {
 		opts.LoadBalancerType.Name = v
 	}
-	if l.Defaults.Location != "" {
-		opts.Location = &hcloud.Location{Name: l.Defaults.Location}
-	}
-	if v, ok := annotation.LBLocation.StringFromService(svc); ok {
-		if v == "" {
-			// Allow resetting the location in case someone wants to specify a network zone in an annotation
-			// and a location as default.
-			opts.Location = nil
-		} else {
-			opts.Location = &hcloud.Location{Name: v}
-		}
-	}
-	opts.NetworkZone = hcloud.NetworkZone(l.Defaults.NetworkZone)
-	if v, ok := annotation.LBNetworkZone.StringFromService(svc); ok {
-		opts.NetworkZone = hcloud.NetworkZone(v)
-	}
-	if opts.Location == nil && opts.NetworkZone == "" {
-		return nil, fmt.Errorf("%s: neither %s nor %s set", op, annotation.LBLocation, annotation.LBNetworkZone)
+	location, networkZone, err := createLocation(svc, l.Defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	if opts.Location != nil && opts.NetworkZone != "" {
-		opts.NetworkZone = ""
+	opts.Location = location
+	opts.NetworkZone = networkZone
+	fallbackLocations := locationFallbackFromService(svc)
+	if len(fallbackLocations) > 0 && opts.Location != nil {
+		opts.Labels[l.label(LabelLocation)] = opts.Location.Name
 	}
 
 	algType, err := annotation.LBAlgorithmType.LBAlgorithmTypeFromService(svc)
 	if err != nil && !errors.Is(err, annotation.ErrNotSet) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	if !errors.Is(err, annotation.ErrNotSet) {
+	if errors.Is(err, annotation.ErrNotSet) {
+		algType = l.Defaults.Algorithm
+	}
+	if algType != "" {
 		opts.Algorithm = &hcloud.LoadBalancerAlgorithm{Type: algType}
 	}
 
-	if l.NetworkID > 0 {
-		nw, _, err := l.NetworkClient.GetByID(ctx, l.NetworkID)
+	if l.networkID() > 0 {
+		nw, _, err := l.NetworkClient.GetByID(ctx, l.networkID())
 		if err != nil {
-			return nil, fmt.Errorf("%s: get network %d: %w", op, l.NetworkID, err)
+			return nil, fmt.Errorf("%s: get network %d: %w", op, l.networkID(), err)
 		}
 		if nw == nil {
-			return nil, fmt.Errorf("%s: get network %d: %w", op, l.NetworkID, ErrNotFound)
+			l.warnNetworkNotFound(op)
+		} else {
+			opts.Network = nw
 		}
-		opts.Network = nw
 	}
 	disablePubIface, err := annotation.LBDisablePublicNetwork.BoolFromService(svc)
 	if err != nil && !errors.Is(err, annotation.ErrNotSet) {
@@ -230,8 +481,19 @@ func (l *LoadBalancerOps) Create(
 	}
 
 	result, _, err := l.LBClient.Create(ctx, opts)
+	for len(fallbackLocations) > 0 && isCapacityError(err) {
+		next := fallbackLocations[0]
+		fallbackLocations = fallbackLocations[1:]
+		klog.Warningf("%s: creating load balancer %s failed, trying location %s: %v", op, lbName, next, err)
+
+		opts.Location = &hcloud.Location{Name: next}
+		opts.NetworkZone = ""
+		opts.Labels = l.serviceLabels(svc)
+		opts.Labels[l.label(LabelLocation)] = next
+		result, _, err = l.LBClient.Create(ctx, opts)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, NewAPIError("create", "load balancer "+lbName, err))
 	}
 	if err := WatchAction(ctx, l.ActionClient, result.Action); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -244,6 +506,125 @@ func (l *LoadBalancerOps) Create(
 	return lb, nil
 }
 
+// locationFallbackFromService returns the locations to try in order if the
+// load balancer of svc can not be created in its primary location.
+func locationFallbackFromService(svc *corev1.Service) []string {
+	values, err := annotation.LBLocationFallback.StringsFromService(svc)
+	if err != nil {
+		return nil
+	}
+	var locations []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			locations = append(locations, v)
+		}
+	}
+	return locations
+}
+
+// isCapacityError reports whether err indicates that a location currently
+// has no capacity left for new load balancers.
+func isCapacityError(err error) bool {
+	return hcloud.IsError(err, hcloud.ErrorCodeResourceUnavailable) ||
+		hcloud.IsError(err, hcloud.ErrorCodePlacementError)
+}
+
+// warnNetworkNotFound logs once that the configured network does not exist
+// anymore. Load Balancers are created and reconciled without attaching them
+// to the network in this case.
+func (l *LoadBalancerOps) warnNetworkNotFound(op string) {
+	l.networkNotFoundOnce.Do(func() {
+		klog.Warningf("%s: network %d not found, load balancers are not attached to it", op, l.networkID())
+	})
+}
+
+// SourceRanges returns the client CIDRs which should be able to reach the
+// load balancer of svc. The LBSourceRanges annotation takes precedence over
+// spec.loadBalancerSourceRanges. An error is returned if any of the ranges
+// is not a valid CIDR.
+func SourceRanges(svc *corev1.Service) ([]*net.IPNet, error) {
+	ranges, err := annotation.LBSourceRanges.IPNetsFromService(svc)
+	if !errors.Is(err, annotation.ErrNotSet) {
+		return ranges, err
+	}
+	for _, cidr := range svc.Spec.LoadBalancerSourceRanges {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("spec.loadBalancerSourceRanges: %w", err)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+// checkSourceRanges validates the source ranges of svc. Hetzner Cloud Load
+// Balancers can not restrict clients by their address, so a warning event is
+// recorded if any ranges are configured. The event is only recorded again if
+// the ranges changed, as every reconcile checks them.
+func (l *LoadBalancerOps) checkSourceRanges(svc *corev1.Service) error {
+	ranges, err := SourceRanges(svc)
+	if err != nil {
+		return err
+	}
+	var reported string
+	if len(ranges) > 0 {
+		reported = fmt.Sprintf("%v", ranges)
+	}
+
+	l.sourceRangesMu.Lock()
+	defer l.sourceRangesMu.Unlock()
+
+	if l.sourceRangesReported[svc.UID] == reported {
+		return nil
+	}
+	if reported == "" {
+		delete(l.sourceRangesReported, svc.UID)
+		return nil
+	}
+	if l.sourceRangesReported == nil {
+		l.sourceRangesReported = make(map[types.UID]string)
+	}
+	l.sourceRangesReported[svc.UID] = reported
+	l.Recorder.Eventf(
+		svc,
+		"Warning",
+		"LoadBalancerSourceRangesNotEnforced",
+		"Hetzner Cloud Load Balancers do not filter traffic by source address, "+
+			"%s are not enforced. Restrict access in the Service backends instead.", reported,
+	)
+	return nil
+}
+
+// errUnsupportedProtocol signals that a Service port uses a protocol Hetzner
+// Cloud Load Balancers do not support.
+var errUnsupportedProtocol = errors.New("protocol not supported by Hetzner Cloud Load Balancers")
+
+// isSupportedPortProtocol reports whether port can be served by a Hetzner
+// Cloud Load Balancer, which only forwards TCP.
+func isSupportedPortProtocol(port corev1.ServicePort) bool {
+	return port.Protocol == "" || port.Protocol == corev1.ProtocolTCP
+}
+
+// ValidatePortProtocols returns an error if svc has a port with a protocol
+// Hetzner Cloud Load Balancers do not support, unless the
+// LBSkipUnsupportedPorts annotation is set.
+func ValidatePortProtocols(svc *corev1.Service) error {
+	skip, err := annotation.LBSkipUnsupportedPorts.BoolFromService(svc)
+	if err != nil && !errors.Is(err, annotation.ErrNotSet) {
+		return err
+	}
+	if skip {
+		return nil
+	}
+	for _, port := range svc.Spec.Ports {
+		if !isSupportedPortProtocol(port) {
+			return fmt.Errorf("port %d: %s: %w, set %s to skip the port",
+				port.Port, port.Protocol, errUnsupportedProtocol, annotation.LBSkipUnsupportedPorts)
+		}
+	}
+	return nil
+}
+
 // Delete removes a Hetzner Cloud load balancer from the backend.
 func (l *LoadBalancerOps) Delete(ctx context.Context, lb *hcloud.LoadBalancer) error {
 	const op = "hcops/LoadBalancerOps.Delete"
@@ -254,7 +635,7 @@ func (l *LoadBalancerOps) Delete(ctx context.Context, lb *hcloud.LoadBalancer) e
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("%s: %v", op, err)
+		return fmt.Errorf("%s: %w", op, NewAPIError("delete", fmt.Sprintf("load balancer %d", lb.ID), err))
 	}
 	return nil
 }
@@ -267,6 +648,10 @@ func (l *LoadBalancerOps) ReconcileHCLB(ctx context.Context, lb *hcloud.LoadBala
 
 	var changed bool
 
+	if err := l.checkSourceRanges(svc); err != nil {
+		return changed, fmt.Errorf("%s: %w", op, err)
+	}
+
 	labelSet, err := l.changeHCLBInfo(ctx, lb, svc)
 	if err != nil {
 		return changed, fmt.Errorf("%s: %w", op, err)
@@ -297,17 +682,21 @@ func (l *LoadBalancerOps) ReconcileHCLB(ctx context.Context, lb *hcloud.LoadBala
 	}
 	changed = changed || typeChanged
 
-	networkDetached, err := l.detachFromNetwork(ctx, lb)
+	// Attach the Load Balancer to the network before detaching it from
+	// others. If the network of the cluster changed, the Load Balancer keeps
+	// its connection to the targets in the old network until it is attached
+	// to the new one. A failed detach is completed by the next reconcile.
+	networkAttached, err := l.attachToNetwork(ctx, lb)
 	if err != nil {
 		return changed, fmt.Errorf("%s: %w", op, err)
 	}
-	changed = changed || networkDetached
+	changed = changed || networkAttached
 
-	networkAttached, err := l.attachToNetwork(ctx, lb)
+	networkDetached, err := l.detachFromNetwork(ctx, lb)
 	if err != nil {
 		return changed, fmt.Errorf("%s: %w", op, err)
 	}
-	changed = changed || networkAttached
+	changed = changed || networkDetached
 
 	pubIfaceToggled, err := l.togglePublicInterface(ctx, lb, svc)
 	if err != nil {
@@ -315,11 +704,48 @@ func (l *LoadBalancerOps) ReconcileHCLB(ctx context.Context, lb *hcloud.LoadBala
 	}
 	changed = changed || pubIfaceToggled
 
+	protectionChanged, err := l.changeProtection(ctx, lb, svc)
+	if err != nil {
+		return changed, fmt.Errorf("%s: %w", op, err)
+	}
+	changed = changed || protectionChanged
+
 	return changed, nil
 }
 
-// changeHCLBInfo changes a Load Balancers name and sets the service UID label
-// if necessary.
+// changeProtection enables or disables the delete protection of the Load
+// Balancer as requested by the deletion-protection annotation. The protection
+// is left unchanged if the annotation is not set, so that it can also be
+// managed outside of Kubernetes.
+func (l *LoadBalancerOps) changeProtection(ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service) (bool, error) {
+	const op = "hcops/LoadBalancerOps.changeProtection"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	protect, err := annotation.LBDeletionProtection.BoolFromService(svc)
+	if errors.Is(err, annotation.ErrNotSet) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if protect == lb.Protection.Delete {
+		return false, nil
+	}
+
+	opts := hcloud.LoadBalancerChangeProtectionOpts{Delete: hcloud.Ptr(protect)}
+	action, _, err := l.LBClient.ChangeProtection(ctx, lb, opts)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	err = WatchAction(ctx, l.ActionClient, action)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return true, nil
+}
+
+// changeHCLBInfo changes a Load Balancers name and sets the service UID,
+// namespace and name labels if necessary.
 //
 // This is implemented in one method as both changes need to be made using
 // hcloud.LoadBalancerUpdateOpts. Using one method reduces the number of API
@@ -333,14 +759,11 @@ func (l *LoadBalancerOps) changeHCLBInfo(ctx context.Context, lb *hcloud.LoadBal
 		opts   hcloud.LoadBalancerUpdateOpts
 	)
 
-	if lb.Labels[LabelServiceUID] != string(svc.ObjectMeta.UID) {
-		// Make a defensive copy of labels. This way we do not modify lb unless
-		// updating is really successful.
-		labels := make(map[string]string, len(lb.Labels)+1)
-		labels[LabelServiceUID] = string(svc.ObjectMeta.UID)
-		for k, v := range lb.Labels {
-			labels[k] = v
-		}
+	if err := l.checkOwnership(lb, svc); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if labels, ok := l.missingServiceLabels(lb, svc); ok {
 		opts.Labels = labels
 		update = true
 	}
@@ -364,6 +787,58 @@ func (l *LoadBalancerOps) changeHCLBInfo(ctx context.Context, lb *hcloud.LoadBal
 	return true, nil
 }
 
+// missingServiceLabels returns the labels of lb with the labels identifying
+// it as the Load Balancer of svc, if any of them is missing or has a different
+// value. lb is not modified.
+func (l *LoadBalancerOps) missingServiceLabels(lb *hcloud.LoadBalancer, svc *corev1.Service) (map[string]string, bool) {
+	wantLabels := l.serviceLabels(svc)
+	for k, v := range wantLabels {
+		if lb.Labels[k] == v {
+			continue
+		}
+		labels := make(map[string]string, len(lb.Labels)+len(wantLabels))
+		for k, v := range lb.Labels {
+			labels[k] = v
+		}
+		for k, v := range wantLabels {
+			labels[k] = v
+		}
+		return labels, true
+	}
+	return nil, false
+}
+
+// RestoreLabels re-applies the labels identifying lb as the Load Balancer of
+// svc. It is called for Load Balancers which were found by their name instead
+// of the Service UID, e.g. because the labels were removed in the Hetzner
+// Cloud Console. Restoring them before anything else is reconciled ensures
+// the Load Balancer is found by the Service UID again, even if a later step
+// fails, and no second Load Balancer is created for svc.
+//
+// It returns true if the labels were changed.
+func (l *LoadBalancerOps) RestoreLabels(ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service) (bool, error) {
+	const op = "hcops/LoadBalancerOps.RestoreLabels"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if err := l.checkOwnership(lb, svc); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	labels, ok := l.missingServiceLabels(lb, svc)
+	if !ok {
+		return false, nil
+	}
+
+	klog.InfoS("restore labels of Load Balancer", "op", op, "loadBalancerID", lb.ID, "service", klog.KObj(svc))
+	updated, _, err := l.LBClient.Update(ctx, lb, hcloud.LoadBalancerUpdateOpts{Labels: labels})
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, NewAPIError("update", fmt.Sprintf("load balancer %d", lb.ID), err))
+	}
+	lb.Labels = updated.Labels
+
+	return true, nil
+}
+
 func (l *LoadBalancerOps) changeIPv4RDNS(ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service) (bool, error) {
 	const op = "hcops/LoadBalancerOps.changeIPv4RDNS"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
@@ -420,12 +895,12 @@ func (l *LoadBalancerOps) changeAlgorithm(ctx context.Context, lb *hcloud.LoadBa
 
 	at, err := annotation.LBAlgorithmType.LBAlgorithmTypeFromService(svc)
 	if errors.Is(err, annotation.ErrNotSet) {
-		return false, nil
+		at, err = l.Defaults.Algorithm, nil
 	}
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
-	if at == lb.Algorithm.Type {
+	if at == "" || at == lb.Algorithm.Type {
 		return false, nil
 	}
 
@@ -474,7 +949,7 @@ func (l *LoadBalancerOps) detachFromNetwork(ctx context.Context, lb *hcloud.Load
 	for _, lbpn := range lb.PrivateNet {
 		// Don't detach the Load Balancer from the network it is supposed to
 		// be attached to.
-		if l.NetworkID == lbpn.Network.ID {
+		if l.networkID() == lbpn.Network.ID {
 			continue
 		}
 		klog.InfoS("detach from network", "op", op, "loadBalancerID", lb.ID, "networkID", lbpn.Network.ID)
@@ -492,23 +967,32 @@ func (l *LoadBalancerOps) detachFromNetwork(ctx context.Context, lb *hcloud.Load
 	return changed, nil
 }
 
+// networkID returns the ID of the network of the cluster, see Network.
+func (l *LoadBalancerOps) networkID() int64 {
+	if l.Network != nil {
+		return l.Network.ID()
+	}
+	return l.NetworkID
+}
+
 func (l *LoadBalancerOps) attachToNetwork(ctx context.Context, lb *hcloud.LoadBalancer) (bool, error) {
 	const op = "hcops/LoadBalancerOps.attachToNetwork"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
 	// Don't attach the Load Balancer if network is not set, or the load
 	// balancer is already attached.
-	if l.NetworkID == 0 || lbAttached(lb, l.NetworkID) {
+	if l.networkID() == 0 || lbAttached(lb, l.networkID()) {
 		return false, nil
 	}
-	klog.InfoS("attach to network", "op", op, "loadBalancerID", lb.ID, "networkID", l.NetworkID)
+	klog.InfoS("attach to network", "op", op, "loadBalancerID", lb.ID, "networkID", l.networkID())
 
-	nw, _, err := l.NetworkClient.GetByID(ctx, l.NetworkID)
+	nw, _, err := l.NetworkClient.GetByID(ctx, l.networkID())
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
-	if nw == nil || hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
-		return false, fmt.Errorf("%s: %d: not found", op, l.NetworkID)
+	if nw == nil {
+		l.warnNetworkNotFound(op)
+		return false, nil
 	}
 
 	retryDelay := l.RetryDelay
@@ -609,6 +1093,10 @@ func (l *LoadBalancerOps) ReconcileHCLBTargets(
 		// the node with this server id is assigned to the K8S cluster.
 		hclbTargetIPs = make(map[string]bool)
 
+		// Names of the nodes whose servers were locked, their targets are
+		// reconciled by the next pass.
+		locked []string
+
 		changed bool
 	)
 
@@ -617,28 +1105,55 @@ func (l *LoadBalancerOps) ReconcileHCLBTargets(
 		return changed, fmt.Errorf("%s: %w", op, err)
 	}
 
+	useIPv4, useIPv6, err := l.getTargetIPFamilies(svc, disableIPv6)
+	if err != nil {
+		return changed, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ipv6Offset, err := annotation.LBTargetIPv6Offset.IPFromService(svc)
+	if err != nil && !errors.Is(err, annotation.ErrNotSet) {
+		return changed, fmt.Errorf("%s: %w", op, err)
+	}
+
 	usePrivateIP, err := l.getUsePrivateIP(svc)
 	if err != nil {
 		return changed, fmt.Errorf("%s: %w", op, err)
 	}
-	if usePrivateIP && l.NetworkID == 0 {
+	if usePrivateIP && l.networkID() == 0 {
 		return changed, fmt.Errorf("%s: use private ip: missing network id", op)
 	}
 
+	nodes, changed, err = l.applyMaxTargetsPolicy(ctx, lb, svc, nodes)
+	if err != nil {
+		return changed, fmt.Errorf("%s: %w", op, err)
+	}
+
 	// Extract HC server IDs of all K8S nodes assigned to the K8S cluster.
+	skipAttachedCheck := make(map[int64]bool)
+	k8sNodePrivateIPs := make(map[int64]string)
 	for _, node := range nodes {
-		id, isHCloudServer, err := providerIDToServerID(node.Spec.ProviderID)
+		id, isHCloudServer, err := l.providerIDToServerID(node.Spec.ProviderID)
 		if err != nil {
 			return changed, fmt.Errorf("%s: %w", op, err)
 		}
 		if isHCloudServer {
 			k8sNodeIDsHCloud[id] = true
+			if skip, _ := annotation.NodeSkipNetworkAttachedCheck.BoolFromNode(node); skip {
+				skipAttachedCheck[id] = true
+			}
+			if ip := nodeInternalIP(node); usePrivateIP && ip != "" {
+				k8sNodePrivateIPs[id] = ip
+			}
 		} else {
 			k8sNodeIDsRobot[int(id)] = true
 		}
 		k8sNodeNames[id] = node.Name
 	}
 
+	if !usePrivateIP {
+		l.warnLocationMismatch(lb, svc, nodes)
+	}
+
 	// List all robot servers to check whether the ip targets of the load balancer
 	// correspond to a dedicated server
 	var dedicatedServers []models.Server
@@ -647,15 +1162,66 @@ func (l *LoadBalancerOps) ReconcileHCLBTargets(
 		dedicatedServers, err = l.RobotClient.ServerGetList()
 		if err != nil {
 			HandleRateLimitExceededError(err, svc)
-			return changed, fmt.Errorf("%s: failed to get list of dedicated servers: %w", op, err)
+			return changed, fmt.Errorf("%s: failed to get list of dedicated servers: %w", op, NewAPIError("list", "robot servers", err))
 		}
 	}
 
 	for _, s := range dedicatedServers {
 		robotIPsToIDs[s.ServerIP] = s.ServerNumber
-		robotIPsToIDs[s.ServerIPv6Net+"1"] = s.ServerNumber
 		robotIDToIPv4[s.ServerNumber] = s.ServerIP
-		robotIDToIPv6[s.ServerNumber] = s.ServerIPv6Net + "1"
+		ipv6, err := RobotServerIPv6WithOffset(&s, ipv6Offset)
+		if errors.Is(err, errInvalidIPv6Offset) {
+			return changed, fmt.Errorf("%s: %s: %w", op, annotation.LBTargetIPv6Offset, err)
+		}
+		if err != nil {
+			klog.Warningf("%s: skipping IPv6 target: %s", op, err)
+		}
+		if ipv6 != "" {
+			robotIPsToIDs[ipv6] = s.ServerNumber
+			robotIDToIPv6[s.ServerNumber] = ipv6
+		}
+	}
+
+	// Determine the IPs of the dedicated servers which should be targets of
+	// the HC Load Balancer.
+	robotTargetIPs := make(map[int][]string, len(k8sNodeIDsRobot))
+	desiredRobotIPs := make(map[string]bool)
+	for id := range k8sNodeIDsRobot {
+		ips, fallback := selectRobotTargetIPs(robotIDToIPv4[id], robotIDToIPv6[id], useIPv4, useIPv6)
+		if fallback {
+			l.Recorder.Eventf(
+				svc,
+				"Warning",
+				"LoadBalancerTargetIPFamilyUnavailable",
+				"dedicated server %d does not have an address of the configured ip family, using %v instead", id, ips,
+			)
+		}
+		robotTargetIPs[id] = ips
+		for _, ip := range ips {
+			desiredRobotIPs[ip] = true
+		}
+	}
+
+	additionalIPs, err := l.getAdditionalTargetIPs(ctx, svc)
+	if err != nil {
+		return changed, fmt.Errorf("%s: %w", op, err)
+	}
+	// Private IPs of hcloud nodes are targeted by the server of the node
+	// instead, server targets keep working when the IP of the node changes.
+	k8sNodePrivateIPsToIDs := make(map[string]int64, len(k8sNodePrivateIPs))
+	for id, ip := range k8sNodePrivateIPs {
+		k8sNodePrivateIPsToIDs[ip] = id
+	}
+	additionalIPs = slices.DeleteFunc(additionalIPs, func(ip string) bool {
+		id, ok := k8sNodePrivateIPsToIDs[ip]
+		if ok {
+			klog.InfoS("use server target instead of additional ip target", "op", op, "service", svc.ObjectMeta.Name, "targetName", k8sNodeNames[id], "ip", ip)
+		}
+		return ok
+	})
+	desiredAdditionalIPs := make(map[string]bool, len(additionalIPs))
+	for _, ip := range additionalIPs {
+		desiredAdditionalIPs[ip] = true
 	}
 
 	numberOfTargets := len(lb.Targets)
@@ -676,6 +1242,13 @@ func (l *LoadBalancerOps) ReconcileHCLBTargets(
 			// Target needs to be re-created or node currently not in use by k8s
 			// Load Balancer. Remove it from the HC Load Balancer
 			a, _, err := l.LBClient.RemoveServerTarget(ctx, lb, target.Server.Server)
+			if hcloud.IsError(err, hcloud.ErrorCodeLocked) {
+				klog.InfoS("server locked, retry removing target later", "op", op, "service", svc.ObjectMeta.Name, "targetName", k8sNodeNames[id], "serverID", id)
+				locked = append(locked, serverTargetName(k8sNodeNames, id))
+				// The target still exists, it must not be added again.
+				hclbTargetIDs[id] = true
+				continue
+			}
 			if err != nil {
 				return changed, fmt.Errorf("%s: target: %s: %w", op, k8sNodeNames[id], err)
 			}
@@ -689,7 +1262,7 @@ func (l *LoadBalancerOps) ReconcileHCLBTargets(
 		if target.Type == hcloud.LoadBalancerTargetTypeIP {
 			ip := target.IP.IP
 			id, foundServer := robotIPsToIDs[ip]
-			hclbTargetIPs[ip] = foundServer && k8sNodeIDsRobot[id]
+			hclbTargetIPs[ip] = desiredRobotIPs[ip] || desiredAdditionalIPs[ip]
 			if hclbTargetIPs[ip] {
 				continue
 			}
@@ -744,6 +1317,27 @@ func (l *LoadBalancerOps) ReconcileHCLBTargets(
 			UsePrivateIP: &usePrivateIP,
 		}
 		a, _, err := l.LBClient.AddServerTarget(ctx, lb, opts)
+		if hcloud.IsError(err, hcloud.ErrorCodeLocked) {
+			klog.InfoS("server locked, retry adding target later", "op", op, "service", svc.ObjectMeta.Name, "targetName", k8sNodeNames[id], "serverID", id)
+			locked = append(locked, serverTargetName(k8sNodeNames, id))
+			continue
+		}
+		if usePrivateIP && hcloud.IsError(err, hcloud.ErrorCodeServerNotAttachedToNetwork) {
+			// A single node without a private IP must not prevent the
+			// remaining nodes from becoming targets.
+			klog.InfoS("server not attached to network, skip target", "op", op, "service", svc.ObjectMeta.Name, "targetName", k8sNodeNames[id], "serverID", id, "networkID", l.networkID())
+			if skipAttachedCheck[id] {
+				// The node is intentionally not attached.
+				continue
+			}
+			l.Recorder.Eventf(
+				svc,
+				"Warning",
+				"LoadBalancerTargetPrivateIPUnavailable",
+				"node %s is not attached to network %d, it is no target of the load balancer using private IPs", serverTargetName(k8sNodeNames, id), l.networkID(),
+			)
+			continue
+		}
 		if err != nil {
 			if hcloud.IsError(err, hcloud.ErrorCodeResourceLimitExceeded) {
 				klog.InfoS("resource limit exceeded", "err", err.Error(), "op", op, "service", svc.ObjectMeta.Name, "targetName", k8sNodeNames[id])
@@ -761,28 +1355,17 @@ func (l *LoadBalancerOps) ReconcileHCLBTargets(
 	// Assign the dedicated servers which are currently assigned as nodes
 	// to the K8S Load Balancer as IP targets to the HC Load Balancer.
 	for id := range k8sNodeIDsRobot {
-		var arr []string
-		if disableIPv6 {
-			arr = []string{
-				robotIDToIPv4[id],
-			}
-		} else {
-			arr = []string{
-				robotIDToIPv4[id],
-				robotIDToIPv6[id],
-			}
+		if len(robotTargetIPs[id]) == 0 {
+			klog.InfoS("k8s node found but no corresponding server in robot", "id", id)
+			continue
 		}
 
-		for _, ip := range arr {
+		for _, ip := range robotTargetIPs[id] {
 			// Don't assign the node again if it is already assigned to the HC load
 			// balancer.
 			if hclbTargetIPs[ip] {
 				continue
 			}
-			if ip == "" {
-				klog.InfoS("k8s node found but no corresponding server in robot", "id", id)
-				continue
-			}
 
 			if lb.LoadBalancerType != nil && maxTargetsReached(numberOfTargets, lb.LoadBalancerType.Name) {
 				l.Recorder.Eventf(
@@ -813,9 +1396,139 @@ func (l *LoadBalancerOps) ReconcileHCLBTargets(
 			numberOfTargets++
 		}
 	}
+
+	// Assign the additional IPs of the Service as IP targets.
+	for _, ip := range additionalIPs {
+		if hclbTargetIPs[ip] {
+			continue
+		}
+		if lb.LoadBalancerType != nil && maxTargetsReached(numberOfTargets, lb.LoadBalancerType.Name) {
+			l.Recorder.Eventf(
+				svc,
+				"Warning",
+				"LoadBalancerTargetsReached",
+				"cannot add additional ip target %v because max number of targets have been reached for load balancer %s", ip, lb.Name,
+			)
+			continue
+		}
+
+		klog.InfoS("add additional target", "op", op, "service", svc.ObjectMeta.Name, "ip", ip)
+		a, _, err := l.LBClient.AddIPTarget(ctx, lb, hcloud.LoadBalancerAddIPTargetOpts{IP: net.ParseIP(ip)})
+		if err != nil {
+			if hcloud.IsError(err, hcloud.ErrorCodeResourceLimitExceeded) {
+				klog.InfoS("resource limit exceeded", "err", err.Error(), "op", op, "service", svc.ObjectMeta.Name, "ip", ip)
+				return false, nil
+			}
+			return changed, fmt.Errorf("%s: targetIP: %s: %w", op, ip, err)
+		}
+		if err := WatchAction(ctx, l.ActionClient, a); err != nil {
+			return changed, fmt.Errorf("%s: targetIP: %s: %w", op, ip, err)
+		}
+		hclbTargetIPs[ip] = true
+		changed = true
+		numberOfTargets++
+	}
+
+	if len(locked) > 0 {
+		sort.Strings(locked)
+		return changed, fmt.Errorf("%s: %w: %s", op, ErrTargetsLocked, strings.Join(locked, ", "))
+	}
 	return changed, nil
 }
 
+// serverTargetName returns the name of the node of the server with id, or the
+// id if the server is not a node of the cluster.
+func serverTargetName(k8sNodeNames map[int64]string, id int64) string {
+	if name, ok := k8sNodeNames[id]; ok {
+		return name
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// getAdditionalTargetIPs returns the IPs of the LBAdditionalTargets
+// annotation. Private IPs are only reachable by the Load Balancer through the
+// network of the cluster, which the Load Balancer is attached to, so they have
+// to be in its IP range.
+func (l *LoadBalancerOps) getAdditionalTargetIPs(ctx context.Context, svc *corev1.Service) ([]string, error) {
+	ips, err := annotation.LBAdditionalTargets.IPsFromService(svc)
+	if errors.Is(err, annotation.ErrNotSet) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var nw *hcloud.Network
+	result := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.IsLinkLocalUnicast() {
+			return nil, fmt.Errorf("%s: %s is not a valid target", annotation.LBAdditionalTargets, ip)
+		}
+		if ip.IsPrivate() {
+			if l.networkID() == 0 {
+				return nil, fmt.Errorf("%s: private ip %s requires a network", annotation.LBAdditionalTargets, ip)
+			}
+			if nw == nil {
+				nw, _, err = l.NetworkClient.GetByID(ctx, l.networkID())
+				if err != nil {
+					return nil, err
+				}
+				if nw == nil {
+					return nil, fmt.Errorf("%s: network %d not found", annotation.LBAdditionalTargets, l.networkID())
+				}
+			}
+			if nw.IPRange == nil || !nw.IPRange.Contains(ip) {
+				return nil, fmt.Errorf("%s: private ip %s is not in the ip range of network %s", annotation.LBAdditionalTargets, ip, nw.Name)
+			}
+		}
+		if s := ip.String(); !slices.Contains(result, s) {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+// getTargetIPFamilies returns the IP families used for IP targets of
+// dedicated servers. Without the target-ip-family annotation both families
+// are used, unless IPv6 is disabled.
+func (l *LoadBalancerOps) getTargetIPFamilies(svc *corev1.Service, disableIPv6 bool) (useIPv4, useIPv6 bool, err error) {
+	v, ok := annotation.LBTargetIPFamily.StringFromService(svc)
+	if !ok {
+		return true, !disableIPv6, nil
+	}
+	switch strings.ToLower(v) {
+	case "ipv4":
+		return true, false, nil
+	case "ipv6":
+		return false, true, nil
+	case "dualstack":
+		return true, true, nil
+	default:
+		return false, false, fmt.Errorf("%s: invalid value %q, expected ipv4, ipv6 or dualstack", annotation.LBTargetIPFamily, v)
+	}
+}
+
+// selectRobotTargetIPs returns the IPs of a dedicated server which should be
+// used as IP targets. If the server has no address of the requested families,
+// the remaining address is used and fallback is true.
+func selectRobotTargetIPs(ipv4, ipv6 string, useIPv4, useIPv6 bool) (ips []string, fallback bool) {
+	if useIPv4 && ipv4 != "" {
+		ips = append(ips, ipv4)
+	}
+	if useIPv6 && ipv6 != "" {
+		ips = append(ips, ipv6)
+	}
+	if len(ips) > 0 {
+		return ips, false
+	}
+	for _, ip := range []string{ipv4, ipv6} {
+		if ip != "" {
+			return []string{ip}, true
+		}
+	}
+	return nil, false
+}
+
 func (l *LoadBalancerOps) getUsePrivateIP(svc *corev1.Service) (bool, error) {
 	usePrivateIP, err := annotation.LBUsePrivateIP.BoolFromService(svc)
 	if err != nil {
@@ -828,17 +1541,86 @@ func (l *LoadBalancerOps) getUsePrivateIP(svc *corev1.Service) (bool, error) {
 }
 
 func maxTargetsReached(currentNumber int, lbType string) bool {
-	var maxNumber int
+	return currentNumber >= maxTargets(lbType)
+}
+
+func maxTargets(lbType string) int {
 	switch lbType {
 	case "lb31":
-		maxNumber = 150
+		return 150
 	case "lb21":
-		maxNumber = 75
+		return 75
 	default:
-		maxNumber = 25
+		return 25
+	}
+}
+
+// lbTypeUpgrades maps a Load Balancer type to the next larger type.
+var lbTypeUpgrades = map[string]string{
+	"lb11": "lb21",
+	"lb21": "lb31",
+}
+
+// applyMaxTargetsPolicy handles the case that there are more nodes than the
+// type of lb supports as targets according to the LBMaxTargetsPolicy
+// annotation. It returns the nodes which should be added as targets.
+func (l *LoadBalancerOps) applyMaxTargetsPolicy(
+	ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service, nodes []*corev1.Node,
+) ([]*corev1.Node, bool, error) {
+	const op = "hcops/LoadBalancerOps.applyMaxTargetsPolicy"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	policy, ok := annotation.LBMaxTargetsPolicy.StringFromService(svc)
+	if !ok || lb.LoadBalancerType == nil || len(nodes) <= maxTargets(lb.LoadBalancerType.Name) {
+		return nodes, false, nil
 	}
 
-	return currentNumber >= maxNumber
+	switch policy {
+	case "upgrade":
+		if _, ok := annotation.LBType.StringFromService(svc); ok {
+			return nil, false, fmt.Errorf("%s: %s=%s requires %s to be unset",
+				op, annotation.LBMaxTargetsPolicy, policy, annotation.LBType)
+		}
+
+		var changed bool
+		for len(nodes) > maxTargets(lb.LoadBalancerType.Name) {
+			next, ok := lbTypeUpgrades[lb.LoadBalancerType.Name]
+			if !ok {
+				klog.InfoS("largest load balancer type reached", "op", op, "loadBalancerID", lb.ID,
+					"type", lb.LoadBalancerType.Name, "nodes", len(nodes))
+				break
+			}
+			klog.InfoS("upgrade load balancer type", "op", op, "loadBalancerID", lb.ID,
+				"from", lb.LoadBalancerType.Name, "to", next, "nodes", len(nodes))
+
+			opts := hcloud.LoadBalancerChangeTypeOpts{LoadBalancerType: &hcloud.LoadBalancerType{Name: next}}
+			action, _, err := l.LBClient.ChangeType(ctx, lb, opts)
+			if err != nil {
+				return nil, changed, fmt.Errorf("%s: %w", op, err)
+			}
+			if err := WatchAction(ctx, l.ActionClient, action); err != nil {
+				return nil, changed, fmt.Errorf("%s: %w", op, err)
+			}
+			lb.LoadBalancerType = &hcloud.LoadBalancerType{Name: next}
+			changed = true
+		}
+		return nodes, changed, nil
+	case "subset":
+		limit := maxTargets(lb.LoadBalancerType.Name)
+		sorted := make([]*corev1.Node, len(nodes))
+		copy(sorted, nodes)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+		overflow := make([]string, 0, len(sorted)-limit)
+		for _, n := range sorted[limit:] {
+			overflow = append(overflow, n.Name)
+		}
+		klog.InfoS("max number of targets exceeded, using subset of nodes", "op", op,
+			"loadBalancerID", lb.ID, "maxTargets", limit, "skippedNodes", overflow)
+		return sorted[:limit], false, nil
+	default:
+		return nil, false, fmt.Errorf("%s: invalid %s: %s", op, annotation.LBMaxTargetsPolicy, policy)
+	}
 }
 
 // ReconcileHCLBServices synchronizes services exposed by the Hetzner Cloud
@@ -851,6 +1633,10 @@ func (l *LoadBalancerOps) ReconcileHCLBServices(
 
 	var changed bool
 
+	if err := ValidatePortProtocols(svc); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
 	if err := l.reconcileManagedCertificate(ctx, svc); err != nil {
 		return false, fmt.Errorf("%s: %v", op, err)
 	}
@@ -872,11 +1658,25 @@ func (l *LoadBalancerOps) ReconcileHCLBServices(
 			err error
 		)
 
+		if !isSupportedPortProtocol(port) {
+			klog.InfoS("skip port with unsupported protocol", "op", op, "port", port.Port, "protocol", port.Protocol)
+			l.Recorder.Eventf(
+				svc,
+				"Warning",
+				"UnsupportedPortSkipped",
+				"Port %d uses protocol %s, which Hetzner Cloud Load Balancers do not support. The port is not exposed.",
+				port.Port, port.Protocol,
+			)
+			continue
+		}
+
 		portNo := int(port.Port)
 		portExists := hclbListenPorts[portNo]
 		delete(hclbListenPorts, portNo)
 
-		b := &hclbServiceOptsBuilder{Port: port, Service: svc, CertOps: l.CertOps}
+		b := &hclbServiceOptsBuilder{
+			Port: port, Service: svc, CertOps: l.CertOps, Defaults: l.Defaults, LabelPrefix: l.LabelPrefix,
+		}
 		if portExists {
 			klog.InfoS("update service", "op", op, "port", portNo, "loadBalancerID", lb.ID)
 
@@ -884,6 +1684,7 @@ func (l *LoadBalancerOps) ReconcileHCLBServices(
 			if err != nil {
 				return changed, fmt.Errorf("%s: %w", op, err)
 			}
+			l.reportChangedCertificates(lb, svc, b.listenPort, updOpts)
 			action, _, err = l.LBClient.UpdateService(ctx, lb, b.listenPort, updOpts)
 			if err != nil {
 				return changed, fmt.Errorf("%s: %w", op, err)
@@ -940,7 +1741,7 @@ func (l *LoadBalancerOps) reconcileManagedCertificate(ctx context.Context, svc *
 		return fmt.Errorf("%s: no domains for managed certificate", op)
 	}
 	labels := map[string]string{
-		LabelServiceUID: string(svc.ObjectMeta.UID),
+		l.label(LabelServiceUID): string(svc.ObjectMeta.UID),
 	}
 	// It's ok to ignore the error here. We are only interested if the
 	// annotation is set and parseable as a truthy boolean. Anything else tells
@@ -959,9 +1760,11 @@ func (l *LoadBalancerOps) reconcileManagedCertificate(ctx context.Context, svc *
 }
 
 type hclbServiceOptsBuilder struct {
-	Port    corev1.ServicePort
-	Service *corev1.Service
-	CertOps *CertificateOps
+	Port        corev1.ServicePort
+	Service     *corev1.Service
+	CertOps     *CertificateOps
+	Defaults    LoadBalancerDefaults
+	LabelPrefix string
 
 	listenPort      int
 	destinationPort int
@@ -991,6 +1794,10 @@ type hclbServiceOptsBuilder struct {
 	}
 	addHealthCheck bool
 
+	// offline skips the lookup of certificates in the Hetzner Cloud API.
+	// Certificates are kept as referenced by the annotations.
+	offline bool
+
 	once sync.Once
 	err  error
 }
@@ -1002,6 +1809,32 @@ func (b *hclbServiceOptsBuilder) extract() {
 	b.listenPort = int(b.Port.Port)
 	b.destinationPort = int(b.Port.NodePort)
 
+	b.do(func() error {
+		names, err := annotation.LBSvcDestinationPortNames.PortNamesFromService(b.Service)
+		if errors.Is(err, annotation.ErrNotSet) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		for port := range names {
+			if !hasServicePort(b.Service, port) {
+				return fmt.Errorf("%s: %s: service %s/%s has no port %d",
+					op, annotation.LBSvcDestinationPortNames, b.Service.Namespace, b.Service.Name, port)
+			}
+		}
+		name, ok := names[b.listenPort]
+		if !ok {
+			return nil
+		}
+		nodePort, err := namedNodePort(b.Service, name)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", op, annotation.LBSvcDestinationPortNames, err)
+		}
+		b.destinationPort = nodePort
+		return nil
+	})
+
 	b.do(func() error {
 		pp, err := annotation.LBSvcProxyProtocol.BoolFromService(b.Service)
 		if errors.Is(err, annotation.ErrNotSet) {
@@ -1060,6 +1893,12 @@ func (b *hclbServiceOptsBuilder) extract() {
 			return fmt.Errorf("%s: %w", op, err)
 		}
 
+		if b.offline {
+			b.httpOpts.Certificates = certs
+			b.addHTTP = true
+			return nil
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
@@ -1078,12 +1917,18 @@ func (b *hclbServiceOptsBuilder) extract() {
 			// Not a a managed certificate.
 			return nil
 		}
+		if b.offline {
+			// The managed certificate is created when the Load Balancer
+			// is reconciled.
+			b.addHTTP = true
+			return nil
+		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
 		svcUID := b.Service.ObjectMeta.UID
-		cert, err := b.CertOps.GetCertificateByLabel(ctx, fmt.Sprintf("%s=%s", LabelServiceUID, svcUID))
+		cert, err := b.CertOps.GetCertificateByLabel(ctx, fmt.Sprintf("%s=%s", WithLabelPrefix(b.LabelPrefix, LabelServiceUID), svcUID))
 		if err != nil {
 			return err
 		}
@@ -1141,10 +1986,100 @@ func (b *hclbServiceOptsBuilder) resolveCertsByNameOrID(ctx context.Context, cs
 	return resolved, nil
 }
 
+// reportChangedCertificates reports if the certificates of the service of lb
+// listening on port are replaced by opts, e.g. because a certificate
+// referenced by name was rotated and got a new ID.
+func (l *LoadBalancerOps) reportChangedCertificates(
+	lb *hcloud.LoadBalancer, svc *corev1.Service, port int, opts hcloud.LoadBalancerUpdateServiceOpts,
+) {
+	const op = "hcops/LoadBalancerOps.reportChangedCertificates"
+
+	if opts.HTTP == nil || opts.HTTP.Certificates == nil {
+		return
+	}
+	var current []*hcloud.Certificate
+	for _, s := range lb.Services {
+		if s.ListenPort == port {
+			current = s.HTTP.Certificates
+			break
+		}
+	}
+	currentIDs, desiredIDs := certificateIDs(current), certificateIDs(opts.HTTP.Certificates)
+	if len(currentIDs) == 0 || slices.Equal(currentIDs, desiredIDs) {
+		return
+	}
+	klog.InfoS("certificates changed", "op", op, "service", svc.ObjectMeta.Name, "port", port, "current", currentIDs, "desired", desiredIDs)
+	l.Recorder.Eventf(
+		svc,
+		corev1.EventTypeNormal,
+		"LoadBalancerCertificatesChanged",
+		"port %d of load balancer %s uses certificates %v instead of %v", port, lb.Name, desiredIDs, currentIDs,
+	)
+}
+
+// certificateIDs returns the sorted IDs of certs.
+func certificateIDs(certs []*hcloud.Certificate) []int64 {
+	ids := make([]int64, 0, len(certs))
+	for _, c := range certs {
+		ids = append(ids, c.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// hasServicePort reports whether svc exposes port.
+func hasServicePort(svc *corev1.Service, port int) bool {
+	for _, p := range svc.Spec.Ports {
+		if int(p.Port) == port {
+			return true
+		}
+	}
+	return false
+}
+
+// servicePortNodePort returns the node port of the port of svc with the
+// number port.
+func servicePortNodePort(svc *corev1.Service, port int) (int, error) {
+	for _, p := range svc.Spec.Ports {
+		if int(p.Port) != port {
+			continue
+		}
+		if p.NodePort == 0 {
+			return 0, fmt.Errorf("port %d of service %s/%s has no node port", port, svc.Namespace, svc.Name)
+		}
+		return int(p.NodePort), nil
+	}
+	return 0, fmt.Errorf("service %s/%s has no port %d", svc.Namespace, svc.Name, port)
+}
+
+// namedNodePort returns the node port of the port of svc named name.
+func namedNodePort(svc *corev1.Service, name string) (int, error) {
+	for _, p := range svc.Spec.Ports {
+		if p.Name != name {
+			continue
+		}
+		if p.NodePort == 0 {
+			return 0, fmt.Errorf("port %q of service %s/%s has no node port", name, svc.Namespace, svc.Name)
+		}
+		return int(p.NodePort), nil
+	}
+	return 0, fmt.Errorf("service %s/%s has no port named %q", svc.Namespace, svc.Name, name)
+}
+
 func (b *hclbServiceOptsBuilder) extractHealthCheck() {
 	const op = "hcops/hclbServiceOptsBuilder.extractHealthCheck"
 	metrics.OperationCalled.WithLabelValues(op).Inc()
 
+	disabled, err := annotation.LBSvcHealthCheckDisabled.BoolFromService(b.Service)
+	if err != nil && !errors.Is(err, annotation.ErrNotSet) {
+		b.do(func() error { return fmt.Errorf("%s: %w", op, err) })
+		return
+	}
+	if disabled {
+		b.extractLenientHealthCheck()
+		return
+	}
+
 	b.do(func() error {
 		p, err := annotation.LBSvcHealthCheckProtocol.LBSvcProtocolFromService(b.Service)
 		if errors.Is(err, annotation.ErrNotSet) {
@@ -1177,13 +2112,57 @@ func (b *hclbServiceOptsBuilder) extractHealthCheck() {
 	})
 
 	b.do(func() error {
-		hcInterval, err := annotation.LBSvcHealthCheckInterval.DurationFromService(b.Service)
+		portName, ok := annotation.LBSvcHealthCheckPortName.StringFromService(b.Service)
+		if !ok {
+			return nil
+		}
+		if _, ok := annotation.LBSvcHealthCheckPort.StringFromService(b.Service); ok {
+			return fmt.Errorf("%s: %s and %s are mutually exclusive",
+				op, annotation.LBSvcHealthCheckPort, annotation.LBSvcHealthCheckPortName)
+		}
+		nodePort, err := namedNodePort(b.Service, portName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		b.healthCheckOpts.Port = hcloud.Ptr(nodePort)
+		b.addHealthCheck = true
+		return nil
+	})
+
+	b.do(func() error {
+		port, err := annotation.LBSvcHealthCheckDestinationPort.IntFromService(b.Service)
 		if errors.Is(err, annotation.ErrNotSet) {
 			return nil
 		}
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
+		for _, a := range []annotation.Name{annotation.LBSvcHealthCheckPort, annotation.LBSvcHealthCheckPortName} {
+			if _, ok := a.StringFromService(b.Service); ok {
+				return fmt.Errorf("%s: %s and %s are mutually exclusive",
+					op, a, annotation.LBSvcHealthCheckDestinationPort)
+			}
+		}
+		nodePort, err := servicePortNodePort(b.Service, port)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", op, annotation.LBSvcHealthCheckDestinationPort, err)
+		}
+		b.healthCheckOpts.Port = hcloud.Ptr(nodePort)
+		b.addHealthCheck = true
+		return nil
+	})
+
+	b.do(func() error {
+		hcInterval, err := annotation.LBSvcHealthCheckInterval.DurationFromService(b.Service)
+		if errors.Is(err, annotation.ErrNotSet) {
+			if b.Defaults.HealthCheckInterval == 0 {
+				return nil
+			}
+			hcInterval, err = b.Defaults.HealthCheckInterval, nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
 		b.healthCheckOpts.Interval = hcloud.Ptr(hcInterval)
 		b.addHealthCheck = true
 		return nil
@@ -1192,7 +2171,10 @@ func (b *hclbServiceOptsBuilder) extractHealthCheck() {
 	b.do(func() error {
 		t, err := annotation.LBSvcHealthCheckTimeout.DurationFromService(b.Service)
 		if errors.Is(err, annotation.ErrNotSet) {
-			return nil
+			if b.Defaults.HealthCheckTimeout == 0 {
+				return nil
+			}
+			t, err = b.Defaults.HealthCheckTimeout, nil
 		}
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
@@ -1205,17 +2187,45 @@ func (b *hclbServiceOptsBuilder) extractHealthCheck() {
 	b.do(func() error {
 		v, err := annotation.LBSvcHealthCheckRetries.IntFromService(b.Service)
 		if errors.Is(err, annotation.ErrNotSet) {
-			return nil
+			if b.Defaults.HealthCheckRetries == 0 {
+				return nil
+			}
+			v, err = b.Defaults.HealthCheckRetries, nil
 		}
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
+		if v < 0 || v > annotation.MaxHealthCheckRetries {
+			return fmt.Errorf("%s: %s: must be between 0 and %d", op, annotation.LBSvcHealthCheckRetries, annotation.MaxHealthCheckRetries)
+		}
 		b.healthCheckOpts.Retries = hcloud.Ptr(v)
 		b.addHealthCheck = true
 		return nil
 	})
 
+	b.extractTrafficPolicyHealthCheck()
+
+	sni, hasSNI := annotation.LBSvcHealthCheckHTTPSSNI.StringFromService(b.Service)
+	if hasSNI && b.healthCheckOpts.Protocol != hcloud.LoadBalancerServiceProtocolHTTPS {
+		b.do(func() error {
+			return fmt.Errorf("%s: %s requires an https health check", op, annotation.LBSvcHealthCheckHTTPSSNI)
+		})
+		return
+	}
+
 	if b.healthCheckOpts.Protocol == hcloud.LoadBalancerServiceProtocolTCP {
+		b.do(func() error {
+			for _, a := range []annotation.Name{
+				annotation.LBSvcHealthCheckHTTPHost,
+				annotation.LBSvcHealthCheckHTTPDomain,
+				annotation.LBSvcHealthCheckHTTPValidateCertificate,
+			} {
+				if _, ok := a.StringFromService(b.Service); ok {
+					return fmt.Errorf("%s: %s requires an http or https health check", op, a)
+				}
+			}
+			return nil
+		})
 		return
 	}
 
@@ -1223,6 +2233,20 @@ func (b *hclbServiceOptsBuilder) extractHealthCheck() {
 		b.healthCheckOpts.httpOpts.Domain = &v
 	}
 
+	if v, ok := annotation.LBSvcHealthCheckHTTPHost.StringFromService(b.Service); ok {
+		b.healthCheckOpts.httpOpts.Domain = &v
+	}
+
+	if hasSNI {
+		b.do(func() error {
+			if d := b.healthCheckOpts.httpOpts.Domain; d != nil && *d != sni {
+				return fmt.Errorf("%s: %s %q conflicts with health check domain %q", op, annotation.LBSvcHealthCheckHTTPSSNI, sni, *d)
+			}
+			b.healthCheckOpts.httpOpts.Domain = &sni
+			return nil
+		})
+	}
+
 	if v, ok := annotation.LBSvcHealthCheckHTTPPath.StringFromService(b.Service); ok {
 		b.healthCheckOpts.httpOpts.Path = &v
 	}
@@ -1252,6 +2276,81 @@ func (b *hclbServiceOptsBuilder) extractHealthCheck() {
 	})
 }
 
+// Limits of the Hetzner Cloud API for health checks. They configure the most
+// lenient health check for Services which disable health checks.
+const (
+	lenientHealthCheckInterval = 60 * time.Second
+	lenientHealthCheckTimeout  = 30 * time.Second
+	lenientHealthCheckRetries  = 5
+)
+
+// extractLenientHealthCheck configures the most lenient health check for
+// Services disabling health checks by annotation. It takes precedence over
+// the defaults and the externalTrafficPolicy of the Service.
+func (b *hclbServiceOptsBuilder) extractLenientHealthCheck() {
+	const op = "hcops/hclbServiceOptsBuilder.extractLenientHealthCheck"
+
+	b.do(func() error {
+		for _, a := range []annotation.Name{
+			annotation.LBSvcHealthCheckProtocol,
+			annotation.LBSvcHealthCheckPort,
+			annotation.LBSvcHealthCheckPortName,
+			annotation.LBSvcHealthCheckDestinationPort,
+			annotation.LBSvcHealthCheckInterval,
+			annotation.LBSvcHealthCheckTimeout,
+			annotation.LBSvcHealthCheckRetries,
+			annotation.LBSvcHealthCheckHTTPDomain,
+			annotation.LBSvcHealthCheckHTTPHost,
+			annotation.LBSvcHealthCheckHTTPSSNI,
+			annotation.LBSvcHealthCheckHTTPPath,
+			annotation.LBSvcHealthCheckHTTPValidateCertificate,
+			annotation.LBSvcHealthCheckHTTPStatusCodes,
+		} {
+			if _, ok := a.StringFromService(b.Service); ok {
+				return fmt.Errorf("%s: %s and %s are mutually exclusive", op, annotation.LBSvcHealthCheckDisabled, a)
+			}
+		}
+		b.healthCheckOpts.Protocol = hcloud.LoadBalancerServiceProtocolTCP
+		b.healthCheckOpts.Interval = hcloud.Ptr(lenientHealthCheckInterval)
+		b.healthCheckOpts.Timeout = hcloud.Ptr(lenientHealthCheckTimeout)
+		b.healthCheckOpts.Retries = hcloud.Ptr(lenientHealthCheckRetries)
+		b.addHealthCheck = true
+		return nil
+	})
+}
+
+// extractTrafficPolicyHealthCheck configures the health check for the
+// externalTrafficPolicy of the Service, unless the protocol or port of the
+// health check are set by annotations.
+//
+// With the policy Local, kube-proxy answers HTTP requests to /healthz on the
+// healthCheckNodePort of the Service with an error on all nodes without
+// endpoints of the Service. These nodes fail the health check and receive no
+// traffic, without removing them from the targets. With the policy Cluster,
+// all nodes forward the traffic and the health check uses the node port of
+// the Service port again, once the policy is switched back.
+func (b *hclbServiceOptsBuilder) extractTrafficPolicyHealthCheck() {
+	for _, a := range []annotation.Name{
+		annotation.LBSvcHealthCheckProtocol,
+		annotation.LBSvcHealthCheckPort,
+		annotation.LBSvcHealthCheckPortName,
+		annotation.LBSvcHealthCheckDestinationPort,
+	} {
+		if _, ok := a.StringFromService(b.Service); ok {
+			return
+		}
+	}
+
+	if b.Service.Spec.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyLocal ||
+		b.Service.Spec.HealthCheckNodePort == 0 {
+		return
+	}
+	b.healthCheckOpts.Protocol = hcloud.LoadBalancerServiceProtocolHTTP
+	b.healthCheckOpts.Port = hcloud.Ptr(int(b.Service.Spec.HealthCheckNodePort))
+	b.healthCheckOpts.httpOpts.Path = hcloud.Ptr("/healthz")
+	b.addHealthCheck = true
+}
+
 func (b *hclbServiceOptsBuilder) initialize() error {
 	b.once.Do(b.extract)
 	return b.err
@@ -1373,42 +2472,50 @@ func (b *hclbServiceOptsBuilder) buildUpdateServiceOpts() (hcloud.LoadBalancerUp
 	return opts, nil
 }
 
-// TODO this is a copy of the function in hcloud/utils.go => refactor.
-const (
-	providerName        = "hcloud"
-	hostNamePrefixRobot = "bm-"
-)
+// warnLocationMismatch emits a Warning Event if nodes are located outside of
+// the location of lb. Traffic to targets in other locations is routed over
+// the public network, which adds latency and may add costs.
+func (l *LoadBalancerOps) warnLocationMismatch(lb *hcloud.LoadBalancer, svc *corev1.Service, nodes []*corev1.Node) {
+	const op = "hcops/LoadBalancerOps.warnLocationMismatch"
 
-func providerIDToServerID(providerID string) (id int64, isHCloudServer bool, err error) {
-	const op = "hcloud/providerIDToServerID"
-	metrics.OperationCalled.WithLabelValues(op).Inc()
-
-	providerPrefixHCloud := providerName + "://"
-	providerPrefixRobot := providerName + "://" + hostNamePrefixRobot
-
-	if !strings.HasPrefix(providerID, providerPrefixHCloud) && !strings.HasPrefix(providerID, providerPrefixRobot) {
-		klog.Infof("%s: make sure your cluster configured for an external cloud provider", op)
-		return 0, false, fmt.Errorf("%s: missing prefix %s or %s. %s", providerPrefixHCloud, providerPrefixRobot, op, providerID)
+	if lb.Location == nil || lb.Location.Name == "" {
+		return
 	}
-
-	isHCloudServer = true
-	idString := providerID
-	if strings.HasPrefix(providerID, providerPrefixRobot) {
-		isHCloudServer = false
-		idString = strings.ReplaceAll(idString, providerPrefixRobot, "")
-	} else {
-		idString = strings.ReplaceAll(providerID, providerPrefixHCloud, "")
+	var mismatched []string
+	for _, node := range nodes {
+		if location := NodeLocation(node); location != "" && location != lb.Location.Name {
+			mismatched = append(mismatched, fmt.Sprintf("%s (%s)", node.Name, location))
+		}
 	}
-
-	if idString == "" {
-		return 0, false, fmt.Errorf("%s: missing serverID: %s", op, providerID)
+	if len(mismatched) == 0 {
+		return
 	}
+	sort.Strings(mismatched)
+	klog.InfoS("targets in other locations", "op", op, "service", svc.ObjectMeta.Name, "location", lb.Location.Name, "nodes", mismatched)
+	l.Recorder.Eventf(
+		svc,
+		"Warning",
+		"LoadBalancerTargetLocationMismatch",
+		"nodes %s are not in location %s of the load balancer, traffic to them uses the public network",
+		strings.Join(mismatched, ", "), lb.Location.Name,
+	)
+}
 
-	id, err = strconv.ParseInt(idString, 10, 64)
-	if err != nil {
-		return 0, false, fmt.Errorf("%s: invalid serverID: %s", op, providerID)
+// NodeLocation returns the location of node from its zone label, which is set
+// to the location, or to the datacenter in the location, e.g. "fsn1-dc14".
+// Returns an empty string if the node has no zone label.
+func NodeLocation(node *corev1.Node) string {
+	zone := node.Labels[corev1.LabelTopologyZone]
+	if i := strings.Index(zone, "-dc"); i > 0 {
+		return zone[:i]
 	}
-	return id, isHCloudServer, nil
+	return zone
+}
+
+// providerIDToServerID parses providerID, accepting the additional provider ID
+// prefix if configured.
+func (l *LoadBalancerOps) providerIDToServerID(providerID string) (int64, bool, error) {
+	return providerid.ToServerID(providerID, l.ProviderIDAdditionalPrefix)
 }
 
 func lbAttached(lb *hcloud.LoadBalancer, nwID int64) bool {
@@ -1,7 +1,9 @@
 package hcops
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -310,6 +312,102 @@ func TestHCLBServiceOptsBuilder(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:        "add HTTPS health check with host header and without TLS verification",
+			servicePort: corev1.ServicePort{Port: 84, NodePort: 8084},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckProtocol:                hcloud.LoadBalancerServiceProtocolHTTPS,
+				annotation.LBSvcHealthCheckHTTPHost:                "www.example.com",
+				annotation.LBSvcHealthCheckHTTPDomain:              "example.com",
+				annotation.LBSvcHealthCheckHTTPValidateCertificate: "false",
+			},
+			expectedAddOpts: hcloud.LoadBalancerAddServiceOpts{
+				ListenPort:      hcloud.Ptr(84),
+				DestinationPort: hcloud.Ptr(8084),
+				Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+				HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+					Protocol: hcloud.LoadBalancerServiceProtocolHTTPS,
+					Port:     hcloud.Ptr(8084),
+					HTTP: &hcloud.LoadBalancerAddServiceOptsHealthCheckHTTP{
+						Domain: hcloud.Ptr("www.example.com"),
+						TLS:    hcloud.Ptr(false),
+					},
+				},
+			},
+			expectedUpdateOpts: hcloud.LoadBalancerUpdateServiceOpts{
+				DestinationPort: hcloud.Ptr(8084),
+				Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+				HealthCheck: &hcloud.LoadBalancerUpdateServiceOptsHealthCheck{
+					Protocol: hcloud.LoadBalancerServiceProtocolHTTPS,
+					Port:     hcloud.Ptr(8084),
+					HTTP: &hcloud.LoadBalancerUpdateServiceOptsHealthCheckHTTP{
+						Domain: hcloud.Ptr("www.example.com"),
+						TLS:    hcloud.Ptr(false),
+					},
+				},
+			},
+		},
+		{
+			name:        "add HTTPS health check with SNI",
+			servicePort: corev1.ServicePort{Port: 84, NodePort: 8084},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckProtocol: hcloud.LoadBalancerServiceProtocolHTTPS,
+				annotation.LBSvcHealthCheckHTTPSSNI: "www.example.com",
+			},
+			expectedAddOpts: hcloud.LoadBalancerAddServiceOpts{
+				ListenPort:      hcloud.Ptr(84),
+				DestinationPort: hcloud.Ptr(8084),
+				Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+				HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+					Protocol: hcloud.LoadBalancerServiceProtocolHTTPS,
+					Port:     hcloud.Ptr(8084),
+					HTTP: &hcloud.LoadBalancerAddServiceOptsHealthCheckHTTP{
+						Domain: hcloud.Ptr("www.example.com"),
+					},
+				},
+			},
+			expectedUpdateOpts: hcloud.LoadBalancerUpdateServiceOpts{
+				DestinationPort: hcloud.Ptr(8084),
+				Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+				HealthCheck: &hcloud.LoadBalancerUpdateServiceOptsHealthCheck{
+					Protocol: hcloud.LoadBalancerServiceProtocolHTTPS,
+					Port:     hcloud.Ptr(8084),
+					HTTP: &hcloud.LoadBalancerUpdateServiceOptsHealthCheckHTTP{
+						Domain: hcloud.Ptr("www.example.com"),
+					},
+				},
+			},
+		},
+		{
+			name:        "disable health check",
+			servicePort: corev1.ServicePort{Port: 84, NodePort: 8084},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckDisabled: true,
+			},
+			expectedAddOpts: hcloud.LoadBalancerAddServiceOpts{
+				ListenPort:      hcloud.Ptr(84),
+				DestinationPort: hcloud.Ptr(8084),
+				Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+				HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+					Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+					Port:     hcloud.Ptr(8084),
+					Interval: hcloud.Ptr(60 * time.Second),
+					Timeout:  hcloud.Ptr(30 * time.Second),
+					Retries:  hcloud.Ptr(5),
+				},
+			},
+			expectedUpdateOpts: hcloud.LoadBalancerUpdateServiceOpts{
+				DestinationPort: hcloud.Ptr(8084),
+				Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+				HealthCheck: &hcloud.LoadBalancerUpdateServiceOptsHealthCheck{
+					Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+					Port:     hcloud.Ptr(8084),
+					Interval: hcloud.Ptr(60 * time.Second),
+					Timeout:  hcloud.Ptr(30 * time.Second),
+					Retries:  hcloud.Ptr(5),
+				},
+			},
+		},
 		{
 			name:        "health check port defaults to node port/destination Port if not specified",
 			servicePort: corev1.ServicePort{Port: 84, NodePort: 8084},
@@ -395,3 +493,231 @@ func TestHCLBServiceOptsBuilder(t *testing.T) {
 		})
 	}
 }
+
+func TestHCLBServiceOptsBuilder_HTTPHealthCheckOptionsRequireHTTP(t *testing.T) {
+	tests := map[annotation.Name]string{
+		annotation.LBSvcHealthCheckHTTPHost:                "example.com",
+		annotation.LBSvcHealthCheckHTTPDomain:              "example.com",
+		annotation.LBSvcHealthCheckHTTPValidateCertificate: "true",
+	}
+	for a, v := range tests {
+		builder := &hclbServiceOptsBuilder{
+			Port:    corev1.ServicePort{Port: 84, NodePort: 8084},
+			Service: &corev1.Service{},
+		}
+		if err := annotation.LBSvcHealthCheckProtocol.AnnotateService(
+			builder.Service, hcloud.LoadBalancerServiceProtocolTCP); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.AnnotateService(builder.Service, v); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := builder.buildAddServiceOpts()
+		assert.EqualError(t, err, fmt.Sprintf(
+			"hcops/hclbServiceOptsBuilder.buildAddServiceOpts: "+
+				"hcops/hclbServiceOptsBuilder.extractHealthCheck: %s requires an http or https health check", a))
+	}
+}
+
+func TestHCLBServiceOptsBuilder_HTTPSSNI(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[annotation.Name]interface{}
+		err         string
+	}{
+		{
+			name: "requires https",
+			annotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckProtocol: hcloud.LoadBalancerServiceProtocolHTTP,
+				annotation.LBSvcHealthCheckHTTPSSNI: "example.com",
+			},
+			err: "load-balancer.hetzner.cloud/health-check-https-sni requires an https health check",
+		},
+		{
+			name: "conflicting domain",
+			annotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckProtocol:   hcloud.LoadBalancerServiceProtocolHTTPS,
+				annotation.LBSvcHealthCheckHTTPDomain: "example.com",
+				annotation.LBSvcHealthCheckHTTPSSNI:   "www.example.com",
+			},
+			err: `load-balancer.hetzner.cloud/health-check-https-sni "www.example.com" conflicts with health check domain "example.com"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &hclbServiceOptsBuilder{
+				Port:    corev1.ServicePort{Port: 84, NodePort: 8084},
+				Service: &corev1.Service{},
+			}
+			for k, v := range tt.annotations {
+				if err := k.AnnotateService(builder.Service, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := builder.buildAddServiceOpts()
+			assert.EqualError(t, err,
+				"hcops/hclbServiceOptsBuilder.buildAddServiceOpts: hcops/hclbServiceOptsBuilder.extractHealthCheck: "+tt.err)
+		})
+	}
+}
+
+func TestHCLBServiceOptsBuilder_DisabledHealthCheck(t *testing.T) {
+	t.Run("ignores defaults and traffic policy", func(t *testing.T) {
+		builder := &hclbServiceOptsBuilder{
+			Port: corev1.ServicePort{Port: 84, NodePort: 8084},
+			Service: &corev1.Service{
+				Spec: corev1.ServiceSpec{
+					ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyLocal,
+					HealthCheckNodePort:   30001,
+				},
+			},
+			Defaults: LoadBalancerDefaults{HealthCheckInterval: 5 * time.Second},
+		}
+		if err := annotation.LBSvcHealthCheckDisabled.AnnotateService(builder.Service, true); err != nil {
+			t.Fatal(err)
+		}
+
+		opts, err := builder.buildAddServiceOpts()
+		assert.NoError(t, err)
+		assert.Equal(t, &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+			Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+			Port:     hcloud.Ptr(8084),
+			Interval: hcloud.Ptr(60 * time.Second),
+			Timeout:  hcloud.Ptr(30 * time.Second),
+			Retries:  hcloud.Ptr(5),
+		}, opts.HealthCheck)
+	})
+
+	t.Run("conflicts with other health check annotations", func(t *testing.T) {
+		builder := &hclbServiceOptsBuilder{
+			Port:    corev1.ServicePort{Port: 84, NodePort: 8084},
+			Service: &corev1.Service{},
+		}
+		if err := annotation.LBSvcHealthCheckDisabled.AnnotateService(builder.Service, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := annotation.LBSvcHealthCheckInterval.AnnotateService(builder.Service, time.Second); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := builder.buildAddServiceOpts()
+		assert.EqualError(t, err, "hcops/hclbServiceOptsBuilder.buildAddServiceOpts: "+
+			"hcops/hclbServiceOptsBuilder.extractLenientHealthCheck: load-balancer.hetzner.cloud/disable-health-check "+
+			"and load-balancer.hetzner.cloud/health-check-interval are mutually exclusive")
+	})
+}
+
+func TestSanitizeLabelValue(t *testing.T) {
+	tests := map[string]string{
+		"my-svc":                       "my-svc",
+		"-my:svc.":                     "my-svc",
+		"":                             "",
+		strings.Repeat("a", 70):        strings.Repeat("a", 63),
+		strings.Repeat("a", 62) + ".b": strings.Repeat("a", 62),
+	}
+	for in, expected := range tests {
+		assert.Equal(t, expected, sanitizeLabelValue(in), in)
+	}
+}
+
+func TestGenerateLBName(t *testing.T) {
+	tests := map[string]string{
+		"prod-a1":                 "prod-a1",
+		"prod:a1":                 "prod-a1",
+		strings.Repeat("a", 63):   strings.Repeat("a", 63),
+		strings.Repeat("a", 70):   strings.Repeat("a", 54) + "-6bd5e503",
+		strings.Repeat("a-", 35):  strings.Repeat("a-", 26) + "a-439fd037",
+		"my-cluster-a1b2c3d4e5f6": "my-cluster-a1b2c3d4e5f6",
+	}
+	for in, expected := range tests {
+		assert.Equal(t, expected, GenerateLBName(in, DefaultMaxLBNameLength), in)
+	}
+
+	// Long names are stable, valid and stay unique if they only differ in
+	// the truncated part.
+	a := GenerateLBName(strings.Repeat("c", 60)+"-a1b2c3d4e5f6", 32)
+	b := GenerateLBName(strings.Repeat("c", 60)+"-f6e5d4c3b2a1", 32)
+	assert.Len(t, a, 32)
+	assert.Len(t, b, 32)
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, a, GenerateLBName(strings.Repeat("c", 60)+"-a1b2c3d4e5f6", 32))
+}
+
+func TestLoadBalancerOps_applyMaxTargetsPolicy(t *testing.T) {
+	nodes := make([]*corev1.Node, 30)
+	for i := range nodes {
+		// Reverse order to verify the subset is sorted by name.
+		nodes[i] = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%02d", len(nodes)-i)}}
+	}
+
+	newService := func(annotations map[annotation.Name]string) *corev1.Service {
+		svc := &corev1.Service{}
+		for k, v := range annotations {
+			if err := k.AnnotateService(svc, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return svc
+	}
+
+	t.Run("keep nodes without policy", func(t *testing.T) {
+		lbOps := &LoadBalancerOps{}
+		lb := &hcloud.LoadBalancer{LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"}}
+
+		selected, changed, err := lbOps.applyMaxTargetsPolicy(context.Background(), lb, newService(nil), nodes)
+		assert.NoError(t, err)
+		assert.False(t, changed)
+		assert.Equal(t, nodes, selected)
+	})
+
+	t.Run("subset", func(t *testing.T) {
+		lbOps := &LoadBalancerOps{}
+		lb := &hcloud.LoadBalancer{LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"}}
+		svc := newService(map[annotation.Name]string{annotation.LBMaxTargetsPolicy: "subset"})
+
+		selected, changed, err := lbOps.applyMaxTargetsPolicy(context.Background(), lb, svc, nodes)
+		assert.NoError(t, err)
+		assert.False(t, changed)
+		assert.Len(t, selected, 25)
+		assert.Equal(t, "node-01", selected[0].Name)
+		assert.Equal(t, "node-25", selected[24].Name)
+	})
+
+	t.Run("upgrade", func(t *testing.T) {
+		ctx := context.Background()
+		lbClient := &mocks.LoadBalancerClient{}
+		lbClient.Test(t)
+		actionClient := &mocks.ActionClient{}
+		actionClient.Test(t)
+		lbOps := &LoadBalancerOps{LBClient: lbClient, ActionClient: actionClient}
+		lb := &hcloud.LoadBalancer{ID: 1, LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"}}
+		svc := newService(map[annotation.Name]string{annotation.LBMaxTargetsPolicy: "upgrade"})
+
+		action := &hcloud.Action{ID: 4711}
+		opts := hcloud.LoadBalancerChangeTypeOpts{LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb21"}}
+		lbClient.On("ChangeType", ctx, lb, opts).Return(action, nil, nil)
+		actionClient.MockWatchProgress(ctx, action, nil)
+
+		selected, changed, err := lbOps.applyMaxTargetsPolicy(ctx, lb, svc, nodes)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, nodes, selected)
+		assert.Equal(t, "lb21", lb.LoadBalancerType.Name)
+		lbClient.AssertExpectations(t)
+		actionClient.AssertExpectations(t)
+	})
+
+	t.Run("upgrade conflicts with explicit type", func(t *testing.T) {
+		lbOps := &LoadBalancerOps{}
+		lb := &hcloud.LoadBalancer{LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"}}
+		svc := newService(map[annotation.Name]string{
+			annotation.LBMaxTargetsPolicy: "upgrade",
+			annotation.LBType:             "lb11",
+		})
+
+		_, _, err := lbOps.applyMaxTargetsPolicy(context.Background(), lb, svc, nodes)
+		assert.Error(t, err)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/stretchr/testify/assert"
@@ -163,11 +164,12 @@ func TestLoadBalancerOps_GetByID(t *testing.T) {
 
 func TestGetByK8SServiceUID(t *testing.T) {
 	tests := []struct {
-		name      string
-		uid       string
-		lbs       []*hcloud.LoadBalancer
-		err       error
-		clientErr error
+		name        string
+		uid         string
+		labelPrefix string
+		lbs         []*hcloud.LoadBalancer
+		err         error
+		clientErr   error
 	}{
 		{
 			name: "load balancer found",
@@ -196,16 +198,29 @@ func TestGetByK8SServiceUID(t *testing.T) {
 			clientErr: errors.New("some error"),
 			err:       errors.New("hcops/LoadBalancerOps.GetByK8SServiceUID: api error: some error"),
 		},
+		{
+			name:        "custom label prefix",
+			uid:         "some-svc-uid",
+			labelPrefix: "cluster-a",
+			lbs: []*hcloud.LoadBalancer{
+				{ID: 1, Name: "some-lb", Labels: map[string]string{"cluster-a/service-uid": "some-svc-uid"}},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			fx := hcops.NewLoadBalancerOpsFixture(t)
+			fx.LBOps.LabelPrefix = tt.labelPrefix
 
+			labelKey := hcops.LabelServiceUID
+			if tt.labelPrefix != "" {
+				labelKey = tt.labelPrefix + "/service-uid"
+			}
 			opts := hcloud.LoadBalancerListOpts{
 				ListOpts: hcloud.ListOpts{
-					LabelSelector: fmt.Sprintf("%s=%s", hcops.LabelServiceUID, tt.uid),
+					LabelSelector: fmt.Sprintf("%s=%s", labelKey, tt.uid),
 				},
 			}
 			fx.LBClient.
@@ -361,6 +376,55 @@ func TestLoadBalancerOps_Create(t *testing.T) {
 			},
 			lb: &hcloud.LoadBalancer{ID: 2},
 		},
+		{
+			name: "create with fallback location",
+			defaults: hcops.LoadBalancerDefaults{
+				FallbackLocation: "nbg1",
+			},
+			createOpts: hcloud.LoadBalancerCreateOpts{
+				Name:             "some-lb",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1"},
+				Labels: map[string]string{
+					hcops.LabelServiceUID: "some-lb-uid",
+				},
+			},
+			lb: &hcloud.LoadBalancer{ID: 5},
+		},
+		{
+			name: "fallback location overridden by network zone",
+			defaults: hcops.LoadBalancerDefaults{
+				FallbackLocation: "nbg1",
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBNetworkZone: "eu-central",
+			},
+			createOpts: hcloud.LoadBalancerCreateOpts{
+				Name:             "another-lb",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				NetworkZone:      hcloud.NetworkZoneEUCentral,
+				Labels: map[string]string{
+					hcops.LabelServiceUID: "another-lb-uid",
+				},
+			},
+			lb: &hcloud.LoadBalancer{ID: 6},
+		},
+		{
+			name: "fallback location overridden by default location",
+			defaults: hcops.LoadBalancerDefaults{
+				Location:         "hel1",
+				FallbackLocation: "nbg1",
+			},
+			createOpts: hcloud.LoadBalancerCreateOpts{
+				Name:             "some-lb",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "hel1"},
+				Labels: map[string]string{
+					hcops.LabelServiceUID: "some-lb-uid",
+				},
+			},
+			lb: &hcloud.LoadBalancer{ID: 7},
+		},
 		{
 			name:               "fails if location and network zone missing",
 			serviceAnnotations: map[annotation.Name]interface{}{},
@@ -416,6 +480,25 @@ func TestLoadBalancerOps_Create(t *testing.T) {
 			},
 			lb: &hcloud.LoadBalancer{ID: 4},
 		},
+		{
+			name: "set default Load Balancer algorithm type",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBLocation: "nbg1",
+			},
+			defaults: hcops.LoadBalancerDefaults{
+				Algorithm: hcloud.LoadBalancerAlgorithmTypeLeastConnections,
+			},
+			createOpts: hcloud.LoadBalancerCreateOpts{
+				Name:             "another-lb",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1"},
+				Algorithm:        &hcloud.LoadBalancerAlgorithm{Type: hcloud.LoadBalancerAlgorithmTypeLeastConnections},
+				Labels: map[string]string{
+					hcops.LabelServiceUID: "another-lb-uid",
+				},
+			},
+			lb: &hcloud.LoadBalancer{ID: 4},
+		},
 		{
 			name: "fail on invalid Load Balancer algorithm type",
 			serviceAnnotations: map[annotation.Name]interface{}{
@@ -453,15 +536,27 @@ func TestLoadBalancerOps_Create(t *testing.T) {
 			lb: &hcloud.LoadBalancer{ID: 5},
 		},
 		{
-			name: "fail if network could not be found",
+			name: "create without network if network could not be found",
 			serviceAnnotations: map[annotation.Name]interface{}{
 				annotation.LBLocation: "nbg1",
 			},
+			createOpts: hcloud.LoadBalancerCreateOpts{
+				Name:             "lb-without-network",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1"},
+				Labels: map[string]string{
+					hcops.LabelServiceUID: "lb-without-network-uid",
+				},
+			},
 			mock: func(t *testing.T, tt *testCase, fx *hcops.LoadBalancerOpsFixture) {
 				fx.LBOps.NetworkID = 4711
 				fx.NetworkClient.On("GetByID", fx.Ctx, fx.LBOps.NetworkID).Return(nil, nil, nil)
+
+				action := fx.MockCreate(tt.createOpts, tt.lb, nil)
+				fx.MockGetByID(tt.lb, nil)
+				fx.MockWatchProgress(action, nil)
 			},
-			err: fmt.Errorf("hcops/LoadBalancerOps.Create: get network %d: %w", 4711, hcops.ErrNotFound),
+			lb: &hcloud.LoadBalancer{ID: 6},
 		},
 		{
 			name: "fail if looking for network returns an error",
@@ -504,6 +599,54 @@ func TestLoadBalancerOps_Create(t *testing.T) {
 			},
 			lb: &hcloud.LoadBalancer{ID: 6},
 		},
+		{
+			name: "fall back to next location if location is out of capacity",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBLocation:         "fsn1",
+				annotation.LBLocationFallback: "nbg1, hel1",
+			},
+			createOpts: hcloud.LoadBalancerCreateOpts{
+				Name:             "fallback-lb",
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+				Location:         &hcloud.Location{Name: "nbg1"},
+				Labels: map[string]string{
+					hcops.LabelServiceUID: "fallback-lb-uid",
+					hcops.LabelLocation:   "nbg1",
+				},
+			},
+			mock: func(t *testing.T, tt *testCase, fx *hcops.LoadBalancerOpsFixture) {
+				fsn1Opts := tt.createOpts
+				fsn1Opts.Location = &hcloud.Location{Name: "fsn1"}
+				fsn1Opts.Labels = map[string]string{
+					hcops.LabelServiceUID: "fallback-lb-uid",
+					hcops.LabelLocation:   "fsn1",
+				}
+				fx.MockCreate(fsn1Opts, nil, hcloud.Error{Code: hcloud.ErrorCodeResourceUnavailable})
+
+				action := fx.MockCreate(tt.createOpts, tt.lb, nil)
+				fx.MockGetByID(tt.lb, nil)
+				fx.MockWatchProgress(action, nil)
+			},
+			lb: &hcloud.LoadBalancer{ID: 7},
+		},
+		{
+			name: "do not fall back on other errors",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBLocation:         "fsn1",
+				annotation.LBLocationFallback: "nbg1",
+			},
+			mock: func(t *testing.T, tt *testCase, fx *hcops.LoadBalancerOpsFixture) {
+				fx.MockCreate(hcloud.LoadBalancerCreateOpts{
+					LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+					Location:         &hcloud.Location{Name: "fsn1"},
+					Labels: map[string]string{
+						hcops.LabelServiceUID: "",
+						hcops.LabelLocation:   "fsn1",
+					},
+				}, nil, errTestLbClient)
+			},
+			err: fmt.Errorf("hcops/LoadBalancerOps.Create: %w", errTestLbClient),
+		},
 	}
 
 	for _, tt := range tests {
@@ -691,6 +834,157 @@ func TestLoadBalancerOps_ReconcileHCLB(t *testing.T) {
 				assert.False(t, changed)
 			},
 		},
+		{
+			name: "warn about source ranges",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSourceRanges: "10.0.0.0/8,192.168.0.0/16",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+				Algorithm: hcloud.LoadBalancerAlgorithm{
+					Type: hcloud.LoadBalancerAlgorithmTypeRoundRobin,
+				},
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+				if assert.Len(t, tt.fx.Recorder.Events, 1) {
+					event := <-tt.fx.Recorder.Events
+					assert.Contains(t, event, "LoadBalancerSourceRangesNotEnforced")
+					assert.Contains(t, event, "[10.0.0.0/8 192.168.0.0/16]")
+				}
+
+				// Unchanged ranges are not reported again.
+				_, err = tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.Empty(t, tt.fx.Recorder.Events)
+
+				tt.service.Annotations[string(annotation.LBSourceRanges)] = "10.0.0.0/8"
+				_, err = tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				if assert.Len(t, tt.fx.Recorder.Events, 1) {
+					assert.Contains(t, <-tt.fx.Recorder.Events, "[10.0.0.0/8]")
+				}
+			},
+		},
+		{
+			name: "fail on invalid source ranges",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSourceRanges: "10.0.0.0/33",
+			},
+			initialLB: &hcloud.LoadBalancer{ID: 3},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.EqualError(t, err,
+					"hcops/LoadBalancerOps.ReconcileHCLB: annotation/Name.IPNetsFromService: invalid CIDR address: 10.0.0.0/33")
+				assert.False(t, changed)
+				assert.Empty(t, tt.fx.Recorder.Events)
+			},
+		},
+		{
+			name: "enable deletion protection",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBDeletionProtection: true,
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				opts := hcloud.LoadBalancerChangeProtectionOpts{Delete: hcloud.Ptr(true)}
+
+				action := &hcloud.Action{ID: 4711}
+				tt.fx.LBClient.
+					On("ChangeProtection", tt.fx.Ctx, tt.initialLB, opts).
+					Return(action, nil, nil)
+				tt.fx.MockWatchProgress(action, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "disable deletion protection",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBDeletionProtection: false,
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID:         3,
+				Protection: hcloud.LoadBalancerProtection{Delete: true},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				opts := hcloud.LoadBalancerChangeProtectionOpts{Delete: hcloud.Ptr(false)}
+
+				action := &hcloud.Action{ID: 4711}
+				tt.fx.LBClient.
+					On("ChangeProtection", tt.fx.Ctx, tt.initialLB, opts).
+					Return(action, nil, nil)
+				tt.fx.MockWatchProgress(action, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "keep deletion protection if annotation is not set",
+			initialLB: &hcloud.LoadBalancer{
+				ID:         3,
+				Protection: hcloud.LoadBalancerProtection{Delete: true},
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+			},
+		},
+		{
+			name: "update algorithm to default",
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+				Algorithm: hcloud.LoadBalancerAlgorithm{
+					Type: hcloud.LoadBalancerAlgorithmTypeRoundRobin,
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.Defaults.Algorithm = hcloud.LoadBalancerAlgorithmTypeLeastConnections
+				opts := hcloud.LoadBalancerChangeAlgorithmOpts{Type: hcloud.LoadBalancerAlgorithmTypeLeastConnections}
+
+				action := &hcloud.Action{ID: 4711}
+				tt.fx.LBClient.
+					On("ChangeAlgorithm", tt.fx.Ctx, tt.initialLB, opts).
+					Return(action, nil, nil)
+				tt.fx.MockWatchProgress(action, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "algorithm annotation overrides default",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBAlgorithmType: string(hcloud.LoadBalancerAlgorithmTypeRoundRobin),
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+				Algorithm: hcloud.LoadBalancerAlgorithm{
+					Type: hcloud.LoadBalancerAlgorithmTypeRoundRobin,
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.Defaults.Algorithm = hcloud.LoadBalancerAlgorithmTypeLeastConnections
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+			},
+		},
 		{
 			name: "update type",
 			serviceAnnotations: map[annotation.Name]interface{}{
@@ -873,6 +1167,19 @@ func TestLoadBalancerOps_ReconcileHCLB(t *testing.T) {
 				assert.False(t, changed)
 			},
 		},
+		{
+			name:      "skip attaching Load Balancer to deleted network",
+			initialLB: &hcloud.LoadBalancer{ID: 4},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.NetworkID = 15
+				tt.fx.NetworkClient.On("GetByID", tt.fx.Ctx, int64(15)).Return(nil, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+			},
+		},
 		{
 			name:      "attach Load Balancer to network",
 			initialLB: &hcloud.LoadBalancer{ID: 4},
@@ -893,6 +1200,52 @@ func TestLoadBalancerOps_ReconcileHCLB(t *testing.T) {
 				assert.True(t, changed)
 			},
 		},
+		{
+			name: "move Load Balancer to new network",
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+				PrivateNet: []hcloud.LoadBalancerPrivateNet{
+					{
+						Network: &hcloud.Network{ID: 14, Name: "old-network"},
+					},
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				nw := &hcloud.Network{ID: 15, Name: "new-network"}
+				tt.fx.NetworkClient.On("GetByID", tt.fx.Ctx, nw.ID).Return(nw, nil, nil)
+
+				tt.fx.LBOps.NetworkID = nw.ID
+
+				var calls []string
+				attachOpts := hcloud.LoadBalancerAttachToNetworkOpts{Network: nw}
+				attachAction := &hcloud.Action{ID: rand.Int63()}
+				tt.fx.LBClient.
+					On("AttachToNetwork", tt.fx.Ctx, tt.initialLB, attachOpts).
+					Run(func(mock.Arguments) { calls = append(calls, "attach") }).
+					Return(attachAction, nil, nil)
+				tt.fx.MockWatchProgress(attachAction, nil)
+
+				detachOpts := hcloud.LoadBalancerDetachFromNetworkOpts{
+					Network: &hcloud.Network{ID: 14, Name: "old-network"},
+				}
+				detachAction := &hcloud.Action{ID: rand.Int63()}
+				tt.fx.LBClient.
+					On("DetachFromNetwork", tt.fx.Ctx, tt.initialLB, detachOpts).
+					Run(func(mock.Arguments) {
+						// The Load Balancer must not lose its connection to the
+						// targets while it is moved.
+						assert.Equal(t, []string{"attach"}, calls)
+						calls = append(calls, "detach")
+					}).
+					Return(detachAction, nil, nil)
+				tt.fx.MockWatchProgress(detachAction, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
 		{
 			name:      "re-try attach to network on conflict",
 			initialLB: &hcloud.LoadBalancer{ID: 5},
@@ -1086,11 +1439,118 @@ func TestLoadBalancerOps_ReconcileHCLB(t *testing.T) {
 			},
 		},
 		{
-			name:       "rename load balancer",
+			name:       "add service UID label with custom prefix",
 			serviceUID: "11",
-			serviceAnnotations: map[annotation.Name]interface{}{
-				annotation.LBName: "new-name",
-			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 11,
+				Labels: map[string]string{
+					// Labeled by this cluster before the prefix was configured.
+					hcops.LabelServiceUID: "11",
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.LabelPrefix = "cluster-a"
+
+				labels := map[string]string{
+					hcops.LabelServiceUID:   tt.serviceUID,
+					"cluster-a/service-uid": tt.serviceUID,
+				}
+				updated := *tt.initialLB
+				updated.Labels = labels
+				tt.fx.LBClient.
+					On("Update", tt.fx.Ctx, tt.initialLB, hcloud.LoadBalancerUpdateOpts{Labels: labels}).
+					Return(&updated, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name:       "add cluster label",
+			serviceUID: "11",
+			initialLB: &hcloud.LoadBalancer{
+				ID: 11,
+				Labels: map[string]string{
+					hcops.LabelServiceUID: "11",
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.ClusterName = "prod"
+
+				labels := map[string]string{
+					hcops.LabelServiceUID: tt.serviceUID,
+					hcops.LabelCluster:    "prod",
+				}
+				updated := *tt.initialLB
+				updated.Labels = labels
+				tt.fx.LBClient.
+					On("Update", tt.fx.Ctx, tt.initialLB, hcloud.LoadBalancerUpdateOpts{Labels: labels}).
+					Return(&updated, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name:       "refuse load balancer of other cluster",
+			serviceUID: "11",
+			initialLB: &hcloud.LoadBalancer{
+				ID: 11,
+				Labels: map[string]string{
+					"cluster-b/service-uid": "other-uid",
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.LabelPrefix = "cluster-a"
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.ErrorIs(t, err, hcops.ErrOwnedByOtherCluster)
+				tt.fx.LBClient.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name: "add service namespace and name labels",
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{UID: "12", Namespace: "default", Name: "my-svc"},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 12,
+				Labels: map[string]string{
+					hcops.LabelServiceUID: "12",
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				labels := map[string]string{
+					hcops.LabelServiceUID:       "12",
+					hcops.LabelServiceNamespace: "default",
+					hcops.LabelServiceName:      "my-svc",
+				}
+				updated := *tt.initialLB
+				updated.Labels = labels
+				opts := hcloud.LoadBalancerUpdateOpts{Labels: labels}
+				tt.fx.LBClient.
+					On("Update", tt.fx.Ctx, tt.initialLB, opts).
+					Return(&updated, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLB(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+				assert.Equal(t, "default", tt.initialLB.Labels[hcops.LabelServiceNamespace])
+				assert.Equal(t, "my-svc", tt.initialLB.Labels[hcops.LabelServiceName])
+			},
+		},
+		{
+			name:       "rename load balancer",
+			serviceUID: "11",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBName: "new-name",
+			},
 			initialLB: &hcloud.LoadBalancer{
 				ID:   11,
 				Name: "old-name",
@@ -1121,6 +1581,183 @@ func TestLoadBalancerOps_ReconcileHCLB(t *testing.T) {
 	}
 }
 
+func TestLoadBalancerOps_RestoreLabels(t *testing.T) {
+	tests := []LBReconcilementTestCase{
+		{
+			name:       "restore missing service uid label",
+			serviceUID: "1",
+			initialLB: &hcloud.LoadBalancer{
+				ID:     1,
+				Name:   "my-lb",
+				Labels: map[string]string{"owner": "platform"},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				labels := map[string]string{
+					"owner":               "platform",
+					hcops.LabelServiceUID: "1",
+				}
+				updated := *tt.initialLB
+				updated.Labels = labels
+				tt.fx.LBClient.
+					On("Update", tt.fx.Ctx, tt.initialLB, hcloud.LoadBalancerUpdateOpts{Labels: labels}).
+					Return(&updated, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.RestoreLabels(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+				assert.Equal(t, "1", tt.initialLB.Labels[hcops.LabelServiceUID])
+			},
+		},
+		{
+			name:       "labels unchanged",
+			serviceUID: "2",
+			initialLB: &hcloud.LoadBalancer{
+				ID:     2,
+				Labels: map[string]string{hcops.LabelServiceUID: "2"},
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.RestoreLabels(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+				tt.fx.LBClient.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name:       "refuse load balancer of other cluster",
+			serviceUID: "3",
+			initialLB: &hcloud.LoadBalancer{
+				ID:     3,
+				Labels: map[string]string{"cluster-b/service-uid": "other-uid"},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.LabelPrefix = "cluster-a"
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.RestoreLabels(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.ErrorIs(t, err, hcops.ErrOwnedByOtherCluster)
+				tt.fx.LBClient.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, tt.run)
+	}
+}
+
+func TestLoadBalancerOps_GetForAdoption(t *testing.T) {
+	tests := []LBReconcilementTestCase{
+		{
+			name:       "adopt unlabeled load balancer",
+			serviceUID: "1",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBLocation:    "fsn1",
+				annotation.LBNetworkZone: "eu-central",
+				annotation.LBType:        "lb11",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID:               1,
+				Labels:           map[string]string{"owner": "platform"},
+				Location:         &hcloud.Location{Name: "fsn1", NetworkZone: hcloud.NetworkZoneEUCentral},
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBClient.On("GetByID", tt.fx.Ctx, int64(1)).Return(tt.initialLB, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				lb, err := tt.fx.LBOps.GetForAdoption(tt.fx.Ctx, 1, tt.service)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.initialLB, lb)
+			},
+		},
+		{
+			name:       "load balancer not found",
+			serviceUID: "2",
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBClient.On("GetByID", tt.fx.Ctx, int64(2)).Return(nil, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.GetForAdoption(tt.fx.Ctx, 2, tt.service)
+				assert.ErrorIs(t, err, hcops.ErrNotFound)
+			},
+		},
+		{
+			name:       "refuse load balancer of other service",
+			serviceUID: "3",
+			initialLB: &hcloud.LoadBalancer{
+				ID:     3,
+				Labels: map[string]string{hcops.LabelServiceUID: "other-uid"},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBClient.On("GetByID", tt.fx.Ctx, int64(3)).Return(tt.initialLB, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.GetForAdoption(tt.fx.Ctx, 3, tt.service)
+				assert.ErrorIs(t, err, hcops.ErrOwnedByOtherService)
+			},
+		},
+		{
+			name:       "refuse load balancer of other cluster",
+			serviceUID: "4",
+			initialLB: &hcloud.LoadBalancer{
+				ID:     4,
+				Labels: map[string]string{"cluster-b/service-uid": "other-uid"},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.LabelPrefix = "cluster-a"
+				tt.fx.LBClient.On("GetByID", tt.fx.Ctx, int64(4)).Return(tt.initialLB, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.GetForAdoption(tt.fx.Ctx, 4, tt.service)
+				assert.ErrorIs(t, err, hcops.ErrOwnedByOtherCluster)
+			},
+		},
+		{
+			name:       "refuse load balancer in other location",
+			serviceUID: "5",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBLocation: "nbg1",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID:       5,
+				Location: &hcloud.Location{Name: "fsn1", NetworkZone: hcloud.NetworkZoneEUCentral},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBClient.On("GetByID", tt.fx.Ctx, int64(5)).Return(tt.initialLB, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.GetForAdoption(tt.fx.Ctx, 5, tt.service)
+				assert.EqualError(t, err, "hcops/LoadBalancerOps.GetForAdoption: load balancer 5 is located in fsn1, not nbg1")
+			},
+		},
+		{
+			name:       "refuse load balancer of other type",
+			serviceUID: "6",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBType: "lb21",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID:               6,
+				LoadBalancerType: &hcloud.LoadBalancerType{Name: "lb11"},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBClient.On("GetByID", tt.fx.Ctx, int64(6)).Return(tt.initialLB, nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.GetForAdoption(tt.fx.Ctx, 6, tt.service)
+				assert.EqualError(t, err, "hcops/LoadBalancerOps.GetForAdoption: load balancer 6 has type lb11, not lb21")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, tt.run)
+	}
+}
+
 func TestLoadBalancerOps_ReconcileHCLBTargets(t *testing.T) {
 	tests := []LBReconcilementTestCase{
 		{
@@ -1232,142 +1869,1174 @@ func TestLoadBalancerOps_ReconcileHCLBTargets(t *testing.T) {
 
 				action = tt.fx.MockRemoveIPTarget(tt.initialLB, net.ParseIP("1.2.3.4"), nil)
 				tt.fx.MockWatchProgress(action, nil)
-
-				tt.fx.MockListRobotServers(tt.robotServers, nil)
+
+				tt.fx.MockListRobotServers(tt.robotServers, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+			defaults: hcops.LoadBalancerDefaults{DisableIPv6: true},
+		},
+		{
+			name: "skip targets of locked servers",
+			k8sNodes: []*corev1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://2"}},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+				Targets: []hcloud.LoadBalancerTarget{
+					{
+						Type:   hcloud.LoadBalancerTargetTypeServer,
+						Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 3}},
+					},
+					{
+						Type:   hcloud.LoadBalancerTargetTypeServer,
+						Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 4}},
+					},
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				locked := hcloud.Error{Code: hcloud.ErrorCodeLocked, Message: "server is locked"}
+
+				opts := hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 1}, UsePrivateIP: hcloud.Ptr(false)}
+				action := tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				opts = hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 2}, UsePrivateIP: hcloud.Ptr(false)}
+				tt.fx.MockAddServerTarget(tt.initialLB, opts, locked)
+
+				tt.fx.MockRemoveServerTarget(tt.initialLB, &hcloud.Server{ID: 3}, locked)
+
+				action = tt.fx.MockRemoveServerTarget(tt.initialLB, &hcloud.Server{ID: 4}, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.ErrorIs(t, err, hcops.ErrTargetsLocked)
+				assert.ErrorContains(t, err, "targets locked: 3, node2")
+				assert.True(t, changed)
+			},
+			defaults: hcops.LoadBalancerDefaults{DisableIPv6: true},
+		},
+		{
+			name: "add IPv6 IP targets only",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBTargetIPFamily: "ipv6",
+			},
+			k8sNodes: []*corev1.Node{
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://bm-3"}},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+				Targets: []hcloud.LoadBalancerTarget{
+					{
+						Type: hcloud.LoadBalancerTargetTypeIP,
+						IP:   &hcloud.LoadBalancerTargetIP{IP: "1.2.3.4"},
+					},
+				},
+			},
+			robotServers: []models.Server{
+				{
+					ServerNumber:  3,
+					ServerIP:      "1.2.3.4",
+					ServerIPv6Net: "2a01:f48:111:4221::",
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				action := tt.fx.MockRemoveIPTarget(tt.initialLB, net.ParseIP("1.2.3.4"), nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				optsIP := hcloud.LoadBalancerAddIPTargetOpts{IP: net.ParseIP("2a01:f48:111:4221::1")}
+				action = tt.fx.MockAddIPTarget(tt.initialLB, optsIP, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(tt.robotServers, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+				assert.Empty(t, tt.fx.Recorder.Events)
+			},
+		},
+		{
+			name: "fall back to IPv4 IP target if server has no IPv6",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBTargetIPFamily: "ipv6",
+			},
+			k8sNodes: []*corev1.Node{
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://bm-3"}},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+			},
+			robotServers: []models.Server{
+				{
+					ServerNumber: 3,
+					ServerIP:     "1.2.3.4",
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				optsIP := hcloud.LoadBalancerAddIPTargetOpts{IP: net.ParseIP("1.2.3.4")}
+				action := tt.fx.MockAddIPTarget(tt.initialLB, optsIP, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(tt.robotServers, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+				if assert.Len(t, tt.fx.Recorder.Events, 1) {
+					assert.Contains(t, <-tt.fx.Recorder.Events, "LoadBalancerTargetIPFamilyUnavailable")
+				}
+			},
+		},
+		{
+			name: "skip malformed IPv6 subnet of dedicated server",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBTargetIPFamily: "dualstack",
+			},
+			k8sNodes: []*corev1.Node{
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://bm-3"}},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+			},
+			robotServers: []models.Server{
+				{
+					ServerNumber:  3,
+					ServerIP:      "1.2.3.4",
+					ServerIPv6Net: "invalid",
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				optsIP := hcloud.LoadBalancerAddIPTargetOpts{IP: net.ParseIP("1.2.3.4")}
+				action := tt.fx.MockAddIPTarget(tt.initialLB, optsIP, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(tt.robotServers, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "move IPv6 IP target to configured offset",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBTargetIPFamily:   "ipv6",
+				annotation.LBTargetIPv6Offset: "::2",
+			},
+			k8sNodes: []*corev1.Node{
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://bm-3"}},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+				Targets: []hcloud.LoadBalancerTarget{
+					{
+						Type: hcloud.LoadBalancerTargetTypeIP,
+						IP:   &hcloud.LoadBalancerTargetIP{IP: "2a01:f48:111:4221::1"},
+					},
+				},
+			},
+			robotServers: []models.Server{
+				{
+					ServerNumber:  3,
+					ServerIP:      "1.2.3.4",
+					ServerIPv6Net: "2a01:f48:111:4221::/64",
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				action := tt.fx.MockRemoveIPTarget(tt.initialLB, net.ParseIP("2a01:f48:111:4221::1"), nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				optsIP := hcloud.LoadBalancerAddIPTargetOpts{IP: net.ParseIP("2a01:f48:111:4221::2")}
+				action = tt.fx.MockAddIPTarget(tt.initialLB, optsIP, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(tt.robotServers, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "fail on IPv6 offset outside of subnet",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBTargetIPv6Offset: "0:0:0:1::1",
+			},
+			k8sNodes: []*corev1.Node{
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://bm-3"}},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+			},
+			robotServers: []models.Server{
+				{
+					ServerNumber:  3,
+					ServerIP:      "1.2.3.4",
+					ServerIPv6Net: "2a01:f48:111:4221::/64",
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.MockListRobotServers(tt.robotServers, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.EqualError(t, err, "hcops/LoadBalancerOps.ReconcileHCLBTargets: load-balancer.hetzner.cloud/target-ipv6-offset: "+
+					`dedicated server 3: IPv6 subnet "2a01:f48:111:4221::/64": invalid IPv6 offset ::1:0:0:0:1: not within a /64 subnet`)
+			},
+		},
+		{
+			name: "fail on invalid target IP family",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBTargetIPFamily: "ipv5",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.EqualError(t, err, "hcops/LoadBalancerOps.ReconcileHCLBTargets: "+
+					`load-balancer.hetzner.cloud/target-ip-family: invalid value "ipv5", expected ipv4, ipv6 or dualstack`)
+			},
+		},
+		{
+			name: "add additional ip targets",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBAdditionalTargets: "203.0.113.7, 203.0.113.8,203.0.113.7",
+			},
+			k8sNodes: []*corev1.Node{
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+				Targets: []hcloud.LoadBalancerTarget{
+					{
+						Type:   hcloud.LoadBalancerTargetTypeServer,
+						Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 1}},
+					},
+					{
+						Type: hcloud.LoadBalancerTargetTypeIP,
+						IP:   &hcloud.LoadBalancerTargetIP{IP: "203.0.113.8"},
+					},
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				optsIP := hcloud.LoadBalancerAddIPTargetOpts{IP: net.ParseIP("203.0.113.7")}
+				action := tt.fx.MockAddIPTarget(tt.initialLB, optsIP, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "remove additional ip targets",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBAdditionalTargets: "203.0.113.8",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+				Targets: []hcloud.LoadBalancerTarget{
+					{
+						Type: hcloud.LoadBalancerTargetTypeIP,
+						IP:   &hcloud.LoadBalancerTargetIP{IP: "203.0.113.7"},
+					},
+					{
+						Type: hcloud.LoadBalancerTargetTypeIP,
+						IP:   &hcloud.LoadBalancerTargetIP{IP: "203.0.113.8"},
+					},
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				action := tt.fx.MockRemoveIPTarget(tt.initialLB, net.ParseIP("203.0.113.7"), nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "add private additional ip target in network",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBAdditionalTargets: "10.0.1.5",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.NetworkID = 4711
+				nw := &hcloud.Network{ID: 4711, Name: "cluster", IPRange: &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(16, 32)}}
+				tt.fx.NetworkClient.On("GetByID", tt.fx.Ctx, int64(4711)).Return(nw, nil, nil)
+
+				optsIP := hcloud.LoadBalancerAddIPTargetOpts{IP: net.ParseIP("10.0.1.5")}
+				action := tt.fx.MockAddIPTarget(tt.initialLB, optsIP, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "fail on private additional ip target outside of network",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBAdditionalTargets: "192.168.0.5",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.NetworkID = 4711
+				nw := &hcloud.Network{ID: 4711, Name: "cluster", IPRange: &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(16, 32)}}
+				tt.fx.NetworkClient.On("GetByID", tt.fx.Ctx, int64(4711)).Return(nw, nil, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.EqualError(t, err, "hcops/LoadBalancerOps.ReconcileHCLBTargets: "+
+					"load-balancer.hetzner.cloud/additional-targets: private ip 192.168.0.5 is not in the ip range of network cluster")
+			},
+		},
+		{
+			name: "fail on private additional ip target without network",
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBAdditionalTargets: "10.0.1.5",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.EqualError(t, err, "hcops/LoadBalancerOps.ReconcileHCLBTargets: "+
+					"load-balancer.hetzner.cloud/additional-targets: private ip 10.0.1.5 requires a network")
+			},
+		},
+		{
+			name: "enable use of private network via default",
+			defaults: hcops.LoadBalancerDefaults{
+				// Make sure the annotation overrides the default
+				UsePrivateIP: true,
+				DisableIPv6:  true,
+			},
+			k8sNodes: []*corev1.Node{
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://2"}},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.NetworkID = 4711
+
+				opts := hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 1}, UsePrivateIP: hcloud.Ptr(true)}
+				action := tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				opts = hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 2}, UsePrivateIP: hcloud.Ptr(true)}
+				action = tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "enable use of private network via annotation",
+			defaults: hcops.LoadBalancerDefaults{
+				// Make sure the annotation overrides the default
+				UsePrivateIP: false,
+				DisableIPv6:  true,
+			},
+			k8sNodes: []*corev1.Node{
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://2"}},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBUsePrivateIP: "true",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.NetworkID = 4711
+
+				opts := hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 1}, UsePrivateIP: hcloud.Ptr(true)}
+				action := tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				opts = hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 2}, UsePrivateIP: hcloud.Ptr(true)}
+				action = tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "keep server targets whose private IP changed",
+			defaults: hcops.LoadBalancerDefaults{
+				DisableIPv6: true,
+			},
+			k8sNodes: []*corev1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+					Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+					Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+						{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+					}},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "node2"},
+					Spec:       corev1.NodeSpec{ProviderID: "hcloud://2"},
+					Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+						{Type: corev1.NodeInternalIP, Address: "10.0.0.3"},
+					}},
+				},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBUsePrivateIP: "true",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+				Targets: []hcloud.LoadBalancerTarget{
+					{
+						Type:         hcloud.LoadBalancerTargetTypeServer,
+						Server:       &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 1}},
+						UsePrivateIP: true,
+					},
+					{
+						Type:         hcloud.LoadBalancerTargetTypeServer,
+						Server:       &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 2}},
+						UsePrivateIP: true,
+					},
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.NetworkID = 4711
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+
+				// node1 was re-attached to the network and got another IP. Its
+				// server target uses the new IP without being registered again.
+				tt.k8sNodes[0].Status.Addresses[0].Address = "10.0.0.5"
+				changed, err = tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+				tt.fx.LBClient.AssertNotCalled(t, "RemoveServerTarget", mock.Anything, mock.Anything, mock.Anything)
+				tt.fx.LBClient.AssertNotCalled(t, "AddServerTarget", mock.Anything, mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name: "replace additional ip targets of hcloud nodes with server targets",
+			defaults: hcops.LoadBalancerDefaults{
+				DisableIPv6: true,
+			},
+			k8sNodes: []*corev1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+					Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+					Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+						{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+					}},
+				},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBUsePrivateIP:      "true",
+				annotation.LBAdditionalTargets: "10.0.0.2,10.0.1.5",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 1,
+				Targets: []hcloud.LoadBalancerTarget{
+					{
+						Type: hcloud.LoadBalancerTargetTypeIP,
+						IP:   &hcloud.LoadBalancerTargetIP{IP: "10.0.0.2"},
+					},
+					{
+						Type: hcloud.LoadBalancerTargetTypeIP,
+						IP:   &hcloud.LoadBalancerTargetIP{IP: "10.0.1.5"},
+					},
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.NetworkID = 4711
+				nw := &hcloud.Network{ID: 4711, Name: "cluster", IPRange: &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(16, 32)}}
+				tt.fx.NetworkClient.On("GetByID", tt.fx.Ctx, int64(4711)).Return(nw, nil, nil)
+
+				action := tt.fx.MockRemoveIPTarget(tt.initialLB, net.ParseIP("10.0.0.2"), nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				opts := hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 1}, UsePrivateIP: hcloud.Ptr(true)}
+				action = tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+				tt.fx.LBClient.AssertNotCalled(t, "AddIPTarget", mock.Anything, mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name: "warn about targets in other locations",
+			k8sNodes: []*corev1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{corev1.LabelTopologyZone: "nbg1"}},
+					Spec:       corev1.NodeSpec{ProviderID: "hcloud://1"},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{corev1.LabelTopologyZone: "fsn1-dc14"}},
+					Spec:       corev1.NodeSpec{ProviderID: "hcloud://2"},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "node3"},
+					Spec:       corev1.NodeSpec{ProviderID: "hcloud://3"},
+				},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID:       3,
+				Location: &hcloud.Location{Name: "nbg1"},
+				Targets: []hcloud.LoadBalancerTarget{
+					{Type: hcloud.LoadBalancerTargetTypeServer, Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 1}}},
+					{Type: hcloud.LoadBalancerTargetTypeServer, Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 2}}},
+					{Type: hcloud.LoadBalancerTargetTypeServer, Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 3}}},
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.False(t, changed)
+				if assert.Len(t, tt.fx.Recorder.Events, 1) {
+					event := <-tt.fx.Recorder.Events
+					assert.Contains(t, event, "LoadBalancerTargetLocationMismatch")
+					assert.Contains(t, event, "nodes node2 (fsn1) are not in location nbg1")
+				}
+			},
+		},
+		{
+			name: "skip nodes without private IPs",
+			defaults: hcops.LoadBalancerDefaults{
+				DisableIPv6: true,
+			},
+			k8sNodes: []*corev1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://2"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node3"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://3"}},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBUsePrivateIP: "true",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.NetworkID = 4711
+				notAttached := hcloud.Error{Code: hcloud.ErrorCodeServerNotAttachedToNetwork, Message: "server not attached to network"}
+
+				opts := hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 1}, UsePrivateIP: hcloud.Ptr(true)}
+				action := tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				opts = hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 2}, UsePrivateIP: hcloud.Ptr(true)}
+				tt.fx.MockAddServerTarget(tt.initialLB, opts, notAttached)
+
+				opts = hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 3}, UsePrivateIP: hcloud.Ptr(true)}
+				action = tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+				if assert.Len(t, tt.fx.Recorder.Events, 1) {
+					event := <-tt.fx.Recorder.Events
+					assert.Contains(t, event, "LoadBalancerTargetPrivateIPUnavailable")
+					assert.Contains(t, event, "node node2 is not attached to network 4711")
+				}
+			},
+		},
+		{
+			name: "skip nodes opting out of the network attached check without warning",
+			defaults: hcops.LoadBalancerDefaults{
+				DisableIPv6: true,
+			},
+			k8sNodes: []*corev1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "node2",
+						Annotations: map[string]string{string(annotation.NodeSkipNetworkAttachedCheck): "true"},
+					},
+					Spec: corev1.NodeSpec{ProviderID: "hcloud://2"},
+				},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBUsePrivateIP: "true",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 3,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.NetworkID = 4711
+				notAttached := hcloud.Error{Code: hcloud.ErrorCodeServerNotAttachedToNetwork, Message: "server not attached to network"}
+
+				opts := hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 1}, UsePrivateIP: hcloud.Ptr(true)}
+				action := tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				opts = hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 2}, UsePrivateIP: hcloud.Ptr(true)}
+				tt.fx.MockAddServerTarget(tt.initialLB, opts, notAttached)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+				assert.Empty(t, tt.fx.Recorder.Events)
+			},
+		},
+		{
+			name: "disable use of private network via annotation",
+			defaults: hcops.LoadBalancerDefaults{
+				// Make sure the annotation overrides the default
+				UsePrivateIP: true,
+				DisableIPv6:  true,
+			},
+			k8sNodes: []*corev1.Node{
+				{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBUsePrivateIP: "false",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+				Targets: []hcloud.LoadBalancerTarget{
+					{
+						Type:         hcloud.LoadBalancerTargetTypeServer,
+						Server:       &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 1}},
+						UsePrivateIP: true,
+					},
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				action := tt.fx.MockRemoveServerTarget(tt.initialLB, &hcloud.Server{ID: 1}, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				opts := hcloud.LoadBalancerAddServerTargetOpts{
+					Server:       &hcloud.Server{ID: 1},
+					UsePrivateIP: hcloud.Ptr(false),
+				}
+				action = tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				tt.fx.MockListRobotServers(nil, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, tt.run)
+	}
+}
+
+func TestLoadBalancerOps_ReconcileHCLBServices(t *testing.T) {
+	tests := []LBReconcilementTestCase{
+		{
+			name: "add services to hc Load Balancer",
+			servicePorts: []corev1.ServicePort{
+				{Port: 80, NodePort: 8080},
+				{Port: 443, NodePort: 8443},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				opts := hcloud.LoadBalancerAddServiceOpts{
+					Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+					ListenPort:      hcloud.Ptr(80),
+					DestinationPort: hcloud.Ptr(8080),
+					HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+						Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+						Port:     hcloud.Ptr(8080),
+					},
+				}
+				action := tt.fx.MockAddService(opts, tt.initialLB, nil)
+				tt.fx.MockWatchProgress(action, nil)
+
+				opts = hcloud.LoadBalancerAddServiceOpts{
+					Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+					ListenPort:      hcloud.Ptr(443),
+					DestinationPort: hcloud.Ptr(8443),
+					HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+						Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+						Port:     hcloud.Ptr(8443),
+					},
+				}
+				action = tt.fx.MockAddService(opts, tt.initialLB, nil)
+				tt.fx.MockWatchProgress(action, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "add service with health check defaults",
+			servicePorts: []corev1.ServicePort{
+				{Port: 80, NodePort: 8080},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckInterval: "15s",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.Defaults.HealthCheckInterval = 5 * time.Second
+				tt.fx.LBOps.Defaults.HealthCheckTimeout = 3 * time.Second
+				tt.fx.LBOps.Defaults.HealthCheckRetries = 2
+
+				opts := hcloud.LoadBalancerAddServiceOpts{
+					Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+					ListenPort:      hcloud.Ptr(80),
+					DestinationPort: hcloud.Ptr(8080),
+					HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+						Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+						Port:     hcloud.Ptr(8080),
+						Interval: hcloud.Ptr(15 * time.Second),
+						Timeout:  hcloud.Ptr(3 * time.Second),
+						Retries:  hcloud.Ptr(2),
+					},
+				}
+				action := tt.fx.MockAddService(opts, tt.initialLB, nil)
+				tt.fx.MockWatchProgress(action, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "add service with health check retries",
+			servicePorts: []corev1.ServicePort{
+				{Port: 80, NodePort: 8080},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckRetries: 1,
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				tt.fx.LBOps.Defaults.HealthCheckRetries = 3
+
+				opts := hcloud.LoadBalancerAddServiceOpts{
+					Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+					ListenPort:      hcloud.Ptr(80),
+					DestinationPort: hcloud.Ptr(8080),
+					HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+						Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+						Port:     hcloud.Ptr(8080),
+						Retries:  hcloud.Ptr(1),
+					},
+				}
+				action := tt.fx.MockAddService(opts, tt.initialLB, nil)
+				tt.fx.MockWatchProgress(action, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "fail on health check retries out of range",
+			servicePorts: []corev1.ServicePort{
+				{Port: 80, NodePort: 8080},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckRetries: 6,
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.ErrorContains(t, err, "load-balancer.hetzner.cloud/health-check-retries: must be between 0 and 5")
+			},
+		},
+		{
+			name: "add service with health check on named port",
+			servicePorts: []corev1.ServicePort{
+				{Name: "http", Port: 80, NodePort: 8080},
+				{Name: "health", Port: 8081, NodePort: 30081},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckPortName: "health",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				for _, p := range [][2]int{{80, 8080}, {8081, 30081}} {
+					opts := hcloud.LoadBalancerAddServiceOpts{
+						Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+						ListenPort:      hcloud.Ptr(p[0]),
+						DestinationPort: hcloud.Ptr(p[1]),
+						HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+							Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+							Port:     hcloud.Ptr(30081),
+						},
+					}
+					action := tt.fx.MockAddService(opts, tt.initialLB, nil)
+					tt.fx.MockWatchProgress(action, nil)
+				}
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "use health check node port for external traffic policy local",
+			service: &corev1.Service{
+				Spec: corev1.ServiceSpec{
+					Ports:                 []corev1.ServicePort{{Port: 80, NodePort: 8080}},
+					ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyLocal,
+					HealthCheckNodePort:   32000,
+				},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+				Services: []hcloud.LoadBalancerService{
+					{ListenPort: 80, DestinationPort: 8080},
+				},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				opts := hcloud.LoadBalancerUpdateServiceOpts{
+					Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+					DestinationPort: hcloud.Ptr(8080),
+					HealthCheck: &hcloud.LoadBalancerUpdateServiceOptsHealthCheck{
+						Protocol: hcloud.LoadBalancerServiceProtocolHTTP,
+						Port:     hcloud.Ptr(32000),
+						HTTP: &hcloud.LoadBalancerUpdateServiceOptsHealthCheckHTTP{
+							Path: hcloud.Ptr("/healthz"),
+						},
+					},
+				}
+				action := tt.fx.MockUpdateService(opts, tt.initialLB, 80, nil)
+				tt.fx.MockWatchProgress(action, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+			},
+		},
+		{
+			name: "health check annotations override external traffic policy local",
+			service: &corev1.Service{
+				Spec: corev1.ServiceSpec{
+					Ports:                 []corev1.ServicePort{{Port: 80, NodePort: 8080}},
+					ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyLocal,
+					HealthCheckNodePort:   32000,
+				},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckPort: 8081,
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				opts := hcloud.LoadBalancerAddServiceOpts{
+					Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+					ListenPort:      hcloud.Ptr(80),
+					DestinationPort: hcloud.Ptr(8080),
+					HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+						Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+						Port:     hcloud.Ptr(8081),
+					},
+				}
+				action := tt.fx.MockAddService(opts, tt.initialLB, nil)
+				tt.fx.MockWatchProgress(action, nil)
 			},
 			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
-				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
 				assert.NoError(t, err)
 				assert.True(t, changed)
 			},
-			defaults: hcops.LoadBalancerDefaults{DisableIPv6: true},
 		},
 		{
-			name: "enable use of private network via default",
-			defaults: hcops.LoadBalancerDefaults{
-				// Make sure the annotation overrides the default
-				UsePrivateIP: true,
-				DisableIPv6:  true,
-			},
-			k8sNodes: []*corev1.Node{
-				{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
-				{Spec: corev1.NodeSpec{ProviderID: "hcloud://2"}},
+			name: "reset health check for external traffic policy cluster",
+			service: &corev1.Service{
+				Spec: corev1.ServiceSpec{
+					Ports:                 []corev1.ServicePort{{Port: 80, NodePort: 8080}},
+					ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyCluster,
+				},
 			},
 			initialLB: &hcloud.LoadBalancer{
-				ID: 3,
+				ID: 4,
+				Services: []hcloud.LoadBalancerService{
+					{
+						ListenPort:      80,
+						DestinationPort: 8080,
+						HealthCheck: hcloud.LoadBalancerServiceHealthCheck{
+							Protocol: hcloud.LoadBalancerServiceProtocolHTTP,
+							Port:     32000,
+						},
+					},
+				},
 			},
 			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
-				tt.fx.LBOps.NetworkID = 4711
-
-				opts := hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 1}, UsePrivateIP: hcloud.Ptr(true)}
-				action := tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
-				tt.fx.MockWatchProgress(action, nil)
-
-				opts = hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 2}, UsePrivateIP: hcloud.Ptr(true)}
-				action = tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
+				opts := hcloud.LoadBalancerUpdateServiceOpts{
+					Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+					DestinationPort: hcloud.Ptr(8080),
+					HealthCheck: &hcloud.LoadBalancerUpdateServiceOptsHealthCheck{
+						Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+						Port:     hcloud.Ptr(8080),
+					},
+				}
+				action := tt.fx.MockUpdateService(opts, tt.initialLB, 80, nil)
 				tt.fx.MockWatchProgress(action, nil)
-
-				tt.fx.MockListRobotServers(nil, nil)
 			},
 			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
-				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
 				assert.NoError(t, err)
 				assert.True(t, changed)
 			},
 		},
 		{
-			name: "enable use of private network via annotation",
-			defaults: hcops.LoadBalancerDefaults{
-				// Make sure the annotation overrides the default
-				UsePrivateIP: false,
-				DisableIPv6:  true,
+			name: "fail on unknown health check port name",
+			servicePorts: []corev1.ServicePort{
+				{Name: "http", Port: 80, NodePort: 8080},
 			},
-			k8sNodes: []*corev1.Node{
-				{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
-				{Spec: corev1.NodeSpec{ProviderID: "hcloud://2"}},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckPortName: "health",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.ErrorContains(t, err, `has no port named "health"`)
+			},
+		},
+		{
+			name: "fail on health check port and port name",
+			servicePorts: []corev1.ServicePort{
+				{Name: "http", Port: 80, NodePort: 8080},
 			},
 			serviceAnnotations: map[annotation.Name]interface{}{
-				annotation.LBUsePrivateIP: "true",
+				annotation.LBSvcHealthCheckPort:     8080,
+				annotation.LBSvcHealthCheckPortName: "http",
 			},
 			initialLB: &hcloud.LoadBalancer{
-				ID: 3,
+				ID: 4,
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.ErrorContains(t, err, "are mutually exclusive")
+			},
+		},
+		{
+			name: "add service with health check on destination port",
+			servicePorts: []corev1.ServicePort{
+				{Name: "http", Port: 80, NodePort: 30080},
+				{Name: "health", Port: 10254, NodePort: 30254},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckDestinationPort: 10254,
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
 			},
 			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
-				tt.fx.LBOps.NetworkID = 4711
-
-				opts := hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 1}, UsePrivateIP: hcloud.Ptr(true)}
-				action := tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
-				tt.fx.MockWatchProgress(action, nil)
-
-				opts = hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 2}, UsePrivateIP: hcloud.Ptr(true)}
-				action = tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
-				tt.fx.MockWatchProgress(action, nil)
-
-				tt.fx.MockListRobotServers(nil, nil)
+				for _, p := range [][2]int{{80, 30080}, {10254, 30254}} {
+					opts := hcloud.LoadBalancerAddServiceOpts{
+						Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+						ListenPort:      hcloud.Ptr(p[0]),
+						DestinationPort: hcloud.Ptr(p[1]),
+						HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+							Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+							Port:     hcloud.Ptr(30254),
+						},
+					}
+					action := tt.fx.MockAddService(opts, tt.initialLB, nil)
+					tt.fx.MockWatchProgress(action, nil)
+				}
 			},
 			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
-				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
 				assert.NoError(t, err)
 				assert.True(t, changed)
 			},
 		},
 		{
-			name: "disable use of private network via annotation",
-			defaults: hcops.LoadBalancerDefaults{
-				// Make sure the annotation overrides the default
-				UsePrivateIP: true,
-				DisableIPv6:  true,
+			name: "fail on health check destination port not exposed by service",
+			servicePorts: []corev1.ServicePort{
+				{Name: "http", Port: 80, NodePort: 30080},
 			},
-			k8sNodes: []*corev1.Node{
-				{Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHealthCheckDestinationPort: 10254,
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.ErrorContains(t, err, "health-check-destination-port: service")
+				assert.ErrorContains(t, err, "has no port 10254")
+			},
+		},
+		{
+			name: "fail on health check destination port and port",
+			servicePorts: []corev1.ServicePort{
+				{Name: "http", Port: 80, NodePort: 30080},
 			},
 			serviceAnnotations: map[annotation.Name]interface{}{
-				annotation.LBUsePrivateIP: "false",
+				annotation.LBSvcHealthCheckPort:            30080,
+				annotation.LBSvcHealthCheckDestinationPort: 80,
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.ErrorContains(t, err, "are mutually exclusive")
+			},
+		},
+		{
+			name: "forward listen ports to named ports",
+			servicePorts: []corev1.ServicePort{
+				{Name: "http", Port: 80, NodePort: 30080},
+				{Name: "https", Port: 443, NodePort: 30443},
+				{Name: "http-proxy", Port: 8080, NodePort: 31080},
+				{Name: "https-proxy", Port: 8443, NodePort: 31443},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcDestinationPortNames: "80=http-proxy, 443=https-proxy",
+				annotation.LBSvcProxyProtocol:        true,
 			},
 			initialLB: &hcloud.LoadBalancer{
 				ID: 4,
-				Targets: []hcloud.LoadBalancerTarget{
-					{
-						Type:         hcloud.LoadBalancerTargetTypeServer,
-						Server:       &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 1}},
-						UsePrivateIP: true,
-					},
-				},
 			},
 			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
-				action := tt.fx.MockRemoveServerTarget(tt.initialLB, &hcloud.Server{ID: 1}, nil)
-				tt.fx.MockWatchProgress(action, nil)
-
-				opts := hcloud.LoadBalancerAddServerTargetOpts{
-					Server:       &hcloud.Server{ID: 1},
-					UsePrivateIP: hcloud.Ptr(false),
+				for _, p := range [][2]int{{80, 31080}, {443, 31443}, {8080, 31080}, {8443, 31443}} {
+					opts := hcloud.LoadBalancerAddServiceOpts{
+						Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+						ListenPort:      hcloud.Ptr(p[0]),
+						DestinationPort: hcloud.Ptr(p[1]),
+						Proxyprotocol:   hcloud.Ptr(true),
+						HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+							Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+							Port:     hcloud.Ptr(p[1]),
+						},
+					}
+					action := tt.fx.MockAddService(opts, tt.initialLB, nil)
+					tt.fx.MockWatchProgress(action, nil)
 				}
-				action = tt.fx.MockAddServerTarget(tt.initialLB, opts, nil)
-				tt.fx.MockWatchProgress(action, nil)
-
-				tt.fx.MockListRobotServers(nil, nil)
 			},
 			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
-				changed, err := tt.fx.LBOps.ReconcileHCLBTargets(tt.fx.Ctx, tt.initialLB, tt.service, tt.k8sNodes)
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
 				assert.NoError(t, err)
 				assert.True(t, changed)
 			},
 		},
-	}
-
-	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.name, tt.run)
-	}
-}
-
-func TestLoadBalancerOps_ReconcileHCLBServices(t *testing.T) {
-	tests := []LBReconcilementTestCase{
 		{
-			name: "add services to hc Load Balancer",
+			name: "fail on unknown destination port name",
 			servicePorts: []corev1.ServicePort{
-				{Port: 80, NodePort: 8080},
-				{Port: 443, NodePort: 8443},
+				{Name: "http", Port: 80, NodePort: 30080},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcDestinationPortNames: "80=http-proxy",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.ErrorContains(t, err, `has no port named "http-proxy"`)
+			},
+		},
+		{
+			name: "fail on destination port name of unknown port",
+			servicePorts: []corev1.ServicePort{
+				{Name: "http", Port: 80, NodePort: 30080},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcDestinationPortNames: "443=http",
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.ErrorContains(t, err, "has no port 443")
+			},
+		},
+		{
+			name: "skip port with unsupported protocol",
+			servicePorts: []corev1.ServicePort{
+				{Name: "dns-tcp", Port: 53, NodePort: 30053, Protocol: corev1.ProtocolTCP},
+				{Name: "dns-udp", Port: 53, NodePort: 30053, Protocol: corev1.ProtocolUDP},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSkipUnsupportedPorts: true,
 			},
 			initialLB: &hcloud.LoadBalancer{
 				ID: 4,
@@ -1375,32 +3044,41 @@ func TestLoadBalancerOps_ReconcileHCLBServices(t *testing.T) {
 			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
 				opts := hcloud.LoadBalancerAddServiceOpts{
 					Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
-					ListenPort:      hcloud.Ptr(80),
-					DestinationPort: hcloud.Ptr(8080),
+					ListenPort:      hcloud.Ptr(53),
+					DestinationPort: hcloud.Ptr(30053),
 					HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
 						Protocol: hcloud.LoadBalancerServiceProtocolTCP,
-						Port:     hcloud.Ptr(8080),
+						Port:     hcloud.Ptr(30053),
 					},
 				}
 				action := tt.fx.MockAddService(opts, tt.initialLB, nil)
 				tt.fx.MockWatchProgress(action, nil)
-
-				opts = hcloud.LoadBalancerAddServiceOpts{
-					Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
-					ListenPort:      hcloud.Ptr(443),
-					DestinationPort: hcloud.Ptr(8443),
-					HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
-						Protocol: hcloud.LoadBalancerServiceProtocolTCP,
-						Port:     hcloud.Ptr(8443),
-					},
-				}
-				action = tt.fx.MockAddService(opts, tt.initialLB, nil)
-				tt.fx.MockWatchProgress(action, nil)
 			},
 			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
 				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
 				assert.NoError(t, err)
 				assert.True(t, changed)
+				tt.fx.LBClient.AssertNumberOfCalls(t, "AddService", 1)
+				if assert.Len(t, tt.fx.Recorder.Events, 1) {
+					assert.Contains(t, <-tt.fx.Recorder.Events, "UnsupportedPortSkipped")
+				}
+			},
+		},
+		{
+			name: "fail on port with unsupported protocol",
+			servicePorts: []corev1.ServicePort{
+				{Port: 80, NodePort: 8080},
+				{Port: 53, NodePort: 30053, Protocol: corev1.ProtocolUDP},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID: 4,
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				_, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.EqualError(t, err, "hcops/LoadBalancerOps.ReconcileHCLBServices: port 53: UDP: "+
+					"protocol not supported by Hetzner Cloud Load Balancers, "+
+					"set load-balancer.hetzner.cloud/skip-unsupported-ports to skip the port")
+				tt.fx.LBClient.AssertNotCalled(t, "AddService", mock.Anything, mock.Anything, mock.Anything)
 			},
 		},
 		{
@@ -1476,6 +3154,71 @@ func TestLoadBalancerOps_ReconcileHCLBServices(t *testing.T) {
 				assert.True(t, changed)
 			},
 		},
+		{
+			name: "update rotated TLS certificate referenced by name",
+			servicePorts: []corev1.ServicePort{
+				{Port: 443, NodePort: 8443},
+			},
+			initialLB: &hcloud.LoadBalancer{
+				ID:   10,
+				Name: "rotated-cert-lb",
+				Services: []hcloud.LoadBalancerService{
+					{
+						ListenPort: 443,
+						HTTP: hcloud.LoadBalancerServiceHTTP{
+							Certificates: []*hcloud.Certificate{{ID: 1}},
+						},
+					},
+				},
+			},
+			serviceAnnotations: map[annotation.Name]interface{}{
+				annotation.LBSvcHTTPCertificates: []string{"some-cert"},
+			},
+			mock: func(t *testing.T, tt *LBReconcilementTestCase) {
+				updateOpts := func(certID int64) hcloud.LoadBalancerUpdateServiceOpts {
+					return hcloud.LoadBalancerUpdateServiceOpts{
+						Protocol:        hcloud.LoadBalancerServiceProtocolTCP,
+						DestinationPort: hcloud.Ptr(8443),
+						HTTP: &hcloud.LoadBalancerUpdateServiceOptsHTTP{
+							Certificates: []*hcloud.Certificate{{ID: certID}},
+						},
+						HealthCheck: &hcloud.LoadBalancerUpdateServiceOptsHealthCheck{
+							Protocol: hcloud.LoadBalancerServiceProtocolTCP,
+							Port:     hcloud.Ptr(8443),
+						},
+					}
+				}
+
+				// The certificate is rotated between the reconciles.
+				tt.fx.CertClient.
+					On("Get", mock.Anything, "some-cert").
+					Return(&hcloud.Certificate{ID: 1}, nil, nil).
+					Once()
+				tt.fx.CertClient.
+					On("Get", mock.Anything, "some-cert").
+					Return(&hcloud.Certificate{ID: 2}, nil, nil).
+					Once()
+				action := tt.fx.MockUpdateService(updateOpts(1), tt.initialLB, 443, nil)
+				tt.fx.MockWatchProgress(action, nil)
+				action = tt.fx.MockUpdateService(updateOpts(2), tt.initialLB, 443, nil)
+				tt.fx.MockWatchProgress(action, nil)
+			},
+			perform: func(t *testing.T, tt *LBReconcilementTestCase) {
+				changed, err := tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+				assert.Empty(t, tt.fx.Recorder.Events)
+
+				changed, err = tt.fx.LBOps.ReconcileHCLBServices(tt.fx.Ctx, tt.initialLB, tt.service)
+				assert.NoError(t, err)
+				assert.True(t, changed)
+				if assert.Len(t, tt.fx.Recorder.Events, 1) {
+					event := <-tt.fx.Recorder.Events
+					assert.Contains(t, event, "LoadBalancerCertificatesChanged")
+					assert.Contains(t, event, "port 443 of load balancer rotated-cert-lb uses certificates [2] instead of [1]")
+				}
+			},
+		},
 		{
 			name:         "create managed certificate",
 			servicePorts: []corev1.ServicePort{{Port: 443, NodePort: 8443}},
@@ -1630,3 +3373,28 @@ func TestLoadBalancerOps_ReconcileHCLBServices(t *testing.T) {
 		t.Run(tt.name, tt.run)
 	}
 }
+
+func TestSourceRanges(t *testing.T) {
+	svc := &corev1.Service{
+		Spec: corev1.ServiceSpec{LoadBalancerSourceRanges: []string{"10.0.0.0/8"}},
+	}
+	ranges, err := hcops.SourceRanges(svc)
+	assert.NoError(t, err)
+	assert.Equal(t, []*net.IPNet{{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}}, ranges)
+
+	// The annotation takes precedence over the spec.
+	err = annotation.LBSourceRanges.AnnotateService(svc, "192.168.0.0/16")
+	assert.NoError(t, err)
+	ranges, err = hcops.SourceRanges(svc)
+	assert.NoError(t, err)
+	assert.Equal(t, []*net.IPNet{{IP: net.IP{192, 168, 0, 0}, Mask: net.CIDRMask(16, 32)}}, ranges)
+
+	ranges, err = hcops.SourceRanges(&corev1.Service{})
+	assert.NoError(t, err)
+	assert.Empty(t, ranges)
+
+	_, err = hcops.SourceRanges(&corev1.Service{
+		Spec: corev1.ServiceSpec{LoadBalancerSourceRanges: []string{"invalid"}},
+	})
+	assert.EqualError(t, err, "spec.loadBalancerSourceRanges: invalid CIDR address: invalid")
+}
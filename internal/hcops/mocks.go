@@ -23,6 +23,13 @@ func (m *MockLoadBalancerOps) GetByID(ctx context.Context, id int64) (*hcloud.Lo
 	return mocks.GetLoadBalancerPtr(args, 0), args.Error(1)
 }
 
+func (m *MockLoadBalancerOps) GetForAdoption(
+	ctx context.Context, id int64, svc *corev1.Service,
+) (*hcloud.LoadBalancer, error) {
+	args := m.Called(ctx, id, svc)
+	return mocks.GetLoadBalancerPtr(args, 0), args.Error(1)
+}
+
 func (m *MockLoadBalancerOps) Create(
 	ctx context.Context, lbName string, service *corev1.Service,
 ) (*hcloud.LoadBalancer, error) {
@@ -35,6 +42,13 @@ func (m *MockLoadBalancerOps) Delete(ctx context.Context, lb *hcloud.LoadBalance
 	return args.Error(0)
 }
 
+func (m *MockLoadBalancerOps) RestoreLabels(
+	ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service,
+) (bool, error) {
+	args := m.Called(ctx, lb, svc)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockLoadBalancerOps) ReconcileHCLB(
 	ctx context.Context, lb *hcloud.LoadBalancer, svc *corev1.Service,
 ) (bool, error) {
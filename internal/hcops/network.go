@@ -2,6 +2,7 @@ package hcops
 
 import (
 	"context"
+	"sync/atomic"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 )
@@ -9,3 +10,31 @@ import (
 type HCloudNetworkClient interface {
 	GetByID(ctx context.Context, id int64) (*hcloud.Network, *hcloud.Response, error)
 }
+
+// NetworkRef holds the ID of the network of the cluster. It is shared by all
+// users of the network, so that they switch to the new network at once if
+// the network configured by name was deleted and created again. A nil
+// *NetworkRef holds no network.
+type NetworkRef struct {
+	id atomic.Int64
+}
+
+// NewNetworkRef returns a NetworkRef holding id.
+func NewNetworkRef(id int64) *NetworkRef {
+	r := &NetworkRef{}
+	r.id.Store(id)
+	return r
+}
+
+// ID returns the ID of the network, or 0 if there is none.
+func (r *NetworkRef) ID() int64 {
+	if r == nil {
+		return 0
+	}
+	return r.id.Load()
+}
+
+// Set replaces the ID of the network.
+func (r *NetworkRef) Set(id int64) {
+	r.id.Store(id)
+}
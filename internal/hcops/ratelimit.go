@@ -85,8 +85,17 @@ func TimeOfNextPossibleAPICall() time.Time {
 	return handler.timeOfNextPossibleAPICall()
 }
 
+// IsRobotRateLimitError reports whether err was caused by exceeding the rate
+// limit of the Robot API.
+func IsRobotRateLimitError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return IsRobotError(err, models.ErrorCodeRateLimitExceeded) || strings.Contains(err.Error(), "server responded with status code 403")
+}
+
 func HandleRateLimitExceededError(err error, obj runtime.Object) {
-	if models.IsError(err, models.ErrorCodeRateLimitExceeded) || strings.Contains(err.Error(), "server responded with status code 403") {
+	if IsRobotRateLimitError(err) {
 		recorder.Event(obj, "Warning", "RobotRateLimitExceeded", "exceeded Hetzner Robot API rate limit")
 		SetRateLimit()
 	}
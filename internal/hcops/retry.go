@@ -0,0 +1,255 @@
+package hcops
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	"k8s.io/klog/v2"
+)
+
+// RetryOpts configures the retries of Retry.
+type RetryOpts struct {
+	// MaxRetries is the maximum number of retries after the first call.
+	MaxRetries int
+
+	// BackoffFunc returns the delay before a retry. It should be the backoff
+	// of the hcloud-go client, configured with hcloud.WithBackoffFunc, so
+	// that both retry with the same delays.
+	BackoffFunc hcloud.BackoffFunc
+}
+
+// DefaultRetryOpts are the retry options of mutating Hetzner Cloud API calls.
+// They match the default retry options of the hcloud-go client.
+var DefaultRetryOpts = RetryOpts{
+	MaxRetries: 5,
+	BackoffFunc: hcloud.ExponentialBackoffWithOpts(hcloud.ExponentialBackoffOpts{
+		Base:       time.Second,
+		Multiplier: 2,
+		Cap:        time.Minute,
+		Jitter:     true,
+	}),
+}
+
+// Retry calls f until it succeeds or returns an error which is not
+// transient, see IsTransient. Errors which the hcloud-go client retries
+// itself are not retried again. Retry returns the last error of f if all
+// retries failed or ctx is done.
+func Retry(ctx context.Context, op string, opts RetryOpts, f func() error) error {
+	return retry(ctx, op, opts, IsTransient, f)
+}
+
+// retry calls f until it succeeds or returns an error for which transient
+// returns false, see Retry.
+func retry(ctx context.Context, op string, opts RetryOpts, transient func(error) bool, f func() error) error {
+	for retries := 0; ; retries++ {
+		err := f()
+		if err == nil || !transient(err) {
+			return err
+		}
+		if retries >= opts.MaxRetries {
+			return fmt.Errorf("giving up after %d attempts: %w", retries+1, err)
+		}
+
+		delay := opts.BackoffFunc(retries)
+		klog.InfoS("retry due to transient error",
+			"op", op, "attempt", retries+1, "delay", fmt.Sprintf("%v", delay), "err", fmt.Sprintf("%v", err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// NewRetryingLoadBalancerClient returns c with its mutating calls retried
+// after transient errors, see Retry. Create is not retried, a retry could
+// create a second Load Balancer if the failed request was processed anyway.
+// Delete and AttachToNetwork are retried by their callers. Locked servers are
+// not retried when adding or removing targets: ReconcileHCLBTargets skips
+// them right away and retries them with the next reconcile, instead of
+// stalling the reconcile of all other targets.
+func NewRetryingLoadBalancerClient(c HCloudLoadBalancerClient, opts RetryOpts) HCloudLoadBalancerClient {
+	return &retryingLoadBalancerClient{HCloudLoadBalancerClient: c, opts: opts}
+}
+
+type retryingLoadBalancerClient struct {
+	HCloudLoadBalancerClient
+	opts RetryOpts
+}
+
+// retryAction retries f, which starts an action, with the options of c.
+func (c *retryingLoadBalancerClient) retryAction(
+	ctx context.Context, op string, f func() (*hcloud.Action, *hcloud.Response, error),
+) (*hcloud.Action, *hcloud.Response, error) {
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	var (
+		action *hcloud.Action
+		resp   *hcloud.Response
+	)
+	err := Retry(ctx, op, c.opts, func() error {
+		var err error
+		action, resp, err = f()
+		return err
+	})
+	return action, resp, err
+}
+
+// retryTargetAction retries f, which adds or removes a target, like
+// retryAction, but returns locked errors right away.
+func (c *retryingLoadBalancerClient) retryTargetAction(
+	ctx context.Context, op string, f func() (*hcloud.Action, *hcloud.Response, error),
+) (*hcloud.Action, *hcloud.Response, error) {
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	var (
+		action *hcloud.Action
+		resp   *hcloud.Response
+	)
+	err := retry(ctx, op, c.opts, isTransientNotLocked, func() error {
+		var err error
+		action, resp, err = f()
+		return err
+	})
+	return action, resp, err
+}
+
+// isTransientNotLocked reports whether err is transient, see IsTransient,
+// but not caused by a locked resource.
+func isTransientNotLocked(err error) bool {
+	return IsTransient(err) && !hcloud.IsError(err, hcloud.ErrorCodeLocked)
+}
+
+func (c *retryingLoadBalancerClient) Update(
+	ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerUpdateOpts,
+) (*hcloud.LoadBalancer, *hcloud.Response, error) {
+	const op = "hcops/retryingLoadBalancerClient.Update"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	var (
+		updated *hcloud.LoadBalancer
+		resp    *hcloud.Response
+	)
+	err := Retry(ctx, op, c.opts, func() error {
+		var err error
+		updated, resp, err = c.HCloudLoadBalancerClient.Update(ctx, lb, opts)
+		return err
+	})
+	return updated, resp, err
+}
+
+func (c *retryingLoadBalancerClient) AddService(
+	ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerAddServiceOpts,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.AddService", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.AddService(ctx, lb, opts)
+	})
+}
+
+func (c *retryingLoadBalancerClient) UpdateService(
+	ctx context.Context, lb *hcloud.LoadBalancer, listenPort int, opts hcloud.LoadBalancerUpdateServiceOpts,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.UpdateService", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.UpdateService(ctx, lb, listenPort, opts)
+	})
+}
+
+func (c *retryingLoadBalancerClient) DeleteService(
+	ctx context.Context, lb *hcloud.LoadBalancer, listenPort int,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.DeleteService", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.DeleteService(ctx, lb, listenPort)
+	})
+}
+
+func (c *retryingLoadBalancerClient) ChangeAlgorithm(
+	ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerChangeAlgorithmOpts,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.ChangeAlgorithm", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.ChangeAlgorithm(ctx, lb, opts)
+	})
+}
+
+func (c *retryingLoadBalancerClient) ChangeType(
+	ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerChangeTypeOpts,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.ChangeType", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.ChangeType(ctx, lb, opts)
+	})
+}
+
+func (c *retryingLoadBalancerClient) ChangeDNSPtr(
+	ctx context.Context, lb *hcloud.LoadBalancer, ip string, ptr *string,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.ChangeDNSPtr", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.ChangeDNSPtr(ctx, lb, ip, ptr)
+	})
+}
+
+func (c *retryingLoadBalancerClient) ChangeProtection(
+	ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerChangeProtectionOpts,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.ChangeProtection", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.ChangeProtection(ctx, lb, opts)
+	})
+}
+
+func (c *retryingLoadBalancerClient) AddServerTarget(
+	ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerAddServerTargetOpts,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryTargetAction(ctx, "hcops/retryingLoadBalancerClient.AddServerTarget", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.AddServerTarget(ctx, lb, opts)
+	})
+}
+
+func (c *retryingLoadBalancerClient) RemoveServerTarget(
+	ctx context.Context, lb *hcloud.LoadBalancer, server *hcloud.Server,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryTargetAction(ctx, "hcops/retryingLoadBalancerClient.RemoveServerTarget", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.RemoveServerTarget(ctx, lb, server)
+	})
+}
+
+func (c *retryingLoadBalancerClient) AddIPTarget(
+	ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerAddIPTargetOpts,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.AddIPTarget", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.AddIPTarget(ctx, lb, opts)
+	})
+}
+
+func (c *retryingLoadBalancerClient) RemoveIPTarget(
+	ctx context.Context, lb *hcloud.LoadBalancer, ip net.IP,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryTargetAction(ctx, "hcops/retryingLoadBalancerClient.RemoveIPTarget", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.RemoveIPTarget(ctx, lb, ip)
+	})
+}
+
+func (c *retryingLoadBalancerClient) DetachFromNetwork(
+	ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerDetachFromNetworkOpts,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.DetachFromNetwork", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.DetachFromNetwork(ctx, lb, opts)
+	})
+}
+
+func (c *retryingLoadBalancerClient) EnablePublicInterface(
+	ctx context.Context, lb *hcloud.LoadBalancer,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.EnablePublicInterface", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.EnablePublicInterface(ctx, lb)
+	})
+}
+
+func (c *retryingLoadBalancerClient) DisablePublicInterface(
+	ctx context.Context, lb *hcloud.LoadBalancer,
+) (*hcloud.Action, *hcloud.Response, error) {
+	return c.retryAction(ctx, "hcops/retryingLoadBalancerClient.DisablePublicInterface", func() (*hcloud.Action, *hcloud.Response, error) {
+		return c.HCloudLoadBalancerClient.DisablePublicInterface(ctx, lb)
+	})
+}
@@ -0,0 +1,190 @@
+package hcops
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/mocks"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	opts := RetryOpts{MaxRetries: 2, BackoffFunc: hcloud.ConstantBackoff(time.Millisecond)}
+	locked := hcloud.Error{Code: hcloud.ErrorCodeLocked, Message: "locked"}
+
+	t.Run("retry then success", func(t *testing.T) {
+		attempts := 0
+		err := Retry(ctx, "test", opts, func() error {
+			attempts++
+			if attempts < 3 {
+				return locked
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("retry exhaustion", func(t *testing.T) {
+		attempts := 0
+		err := Retry(ctx, "test", opts, func() error {
+			attempts++
+			return locked
+		})
+		assert.EqualError(t, err, "giving up after 3 attempts: locked (locked)")
+		assert.ErrorIs(t, err, locked)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		var backoffs []int
+		opts := RetryOpts{MaxRetries: 2, BackoffFunc: func(retries int) time.Duration {
+			backoffs = append(backoffs, retries)
+			return 0
+		}}
+		_ = Retry(ctx, "test", opts, func() error { return locked })
+		assert.Equal(t, []int{0, 1}, backoffs)
+	})
+
+	t.Run("no retry of permanent errors", func(t *testing.T) {
+		attempts := 0
+		invalid := hcloud.Error{Code: hcloud.ErrorCodeInvalidInput, Message: "invalid input"}
+		err := Retry(ctx, "test", opts, func() error {
+			attempts++
+			return invalid
+		})
+		assert.Equal(t, invalid, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("no retry of errors retried by the client", func(t *testing.T) {
+		attempts := 0
+		conflict := hcloud.Error{Code: hcloud.ErrorCodeConflict, Message: "conflict"}
+		err := Retry(ctx, "test", opts, func() error {
+			attempts++
+			return conflict
+		})
+		assert.Equal(t, conflict, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		attempts := 0
+		err := Retry(ctx, "test", RetryOpts{MaxRetries: 2, BackoffFunc: hcloud.ConstantBackoff(time.Hour)}, func() error {
+			attempts++
+			return locked
+		})
+		assert.Equal(t, locked, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("server errors", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Content-Type", "application/json")
+			if requests < 3 {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(schema.ErrorResponse{Error: schema.Error{Code: "unknown_error", Message: "failed"}})
+				return
+			}
+			json.NewEncoder(w).Encode(schema.NetworkGetResponse{Network: schema.Network{ID: 1}})
+		}))
+		defer server.Close()
+		client := hcloud.NewClient(hcloud.WithEndpoint(server.URL), hcloud.WithToken("token"))
+
+		var network *hcloud.Network
+		err := Retry(ctx, "test", opts, func() error {
+			var err error
+			network, _, err = client.Network.GetByID(ctx, 1)
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), network.ID)
+		assert.Equal(t, 3, requests)
+	})
+}
+
+func TestRetryingLoadBalancerClient(t *testing.T) {
+	ctx := context.Background()
+	opts := RetryOpts{MaxRetries: 2, BackoffFunc: hcloud.ConstantBackoff(time.Millisecond)}
+	locked := hcloud.Error{Code: hcloud.ErrorCodeLocked, Message: "locked"}
+	lb := &hcloud.LoadBalancer{ID: 1}
+
+	t.Run("retry of mutating calls", func(t *testing.T) {
+		lbClient := &mocks.LoadBalancerClient{}
+		lbClient.Test(t)
+		serviceOpts := hcloud.LoadBalancerAddServiceOpts{Protocol: hcloud.LoadBalancerServiceProtocolTCP}
+		action := &hcloud.Action{ID: 3}
+		lbClient.On("AddService", ctx, lb, serviceOpts).Return(nil, nil, locked).Once()
+		lbClient.On("AddService", ctx, lb, serviceOpts).Return(action, nil, nil).Once()
+
+		a, _, err := NewRetryingLoadBalancerClient(lbClient, opts).AddService(ctx, lb, serviceOpts)
+		require.NoError(t, err)
+		assert.Equal(t, action, a)
+		lbClient.AssertExpectations(t)
+	})
+
+	t.Run("no retry of locked targets", func(t *testing.T) {
+		// Transient errors of targets are retried, but locked servers are
+		// skipped by ReconcileHCLBTargets right away.
+		fx := NewLoadBalancerOpsFixture(t)
+		fx.LBOps.LBClient = NewRetryingLoadBalancerClient(fx.LBClient, opts)
+		maintenance := hcloud.Error{Code: hcloud.ErrorCodeMaintenance, Message: "maintenance"}
+		lb := &hcloud.LoadBalancer{
+			ID: 1,
+			Targets: []hcloud.LoadBalancerTarget{
+				{
+					Type:   hcloud.LoadBalancerTargetTypeServer,
+					Server: &hcloud.LoadBalancerTargetServer{Server: &hcloud.Server{ID: 3}},
+				},
+			},
+		}
+		nodes := []*corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://1"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: corev1.NodeSpec{ProviderID: "hcloud://2"}},
+		}
+
+		targetOpts := hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 1}, UsePrivateIP: hcloud.Ptr(false)}
+		action := &hcloud.Action{ID: 4}
+		fx.LBClient.On("AddServerTarget", fx.Ctx, lb, targetOpts).Return(nil, nil, maintenance).Once()
+		fx.LBClient.On("AddServerTarget", fx.Ctx, lb, targetOpts).Return(action, nil, nil).Once()
+		fx.MockWatchProgress(action, nil)
+
+		targetOpts = hcloud.LoadBalancerAddServerTargetOpts{Server: &hcloud.Server{ID: 2}, UsePrivateIP: hcloud.Ptr(false)}
+		fx.LBClient.On("AddServerTarget", fx.Ctx, lb, targetOpts).Return(nil, nil, locked).Once()
+		fx.LBClient.On("RemoveServerTarget", fx.Ctx, lb, &hcloud.Server{ID: 3}).Return(nil, nil, locked).Once()
+		fx.MockListRobotServers(nil, nil)
+
+		changed, err := fx.LBOps.ReconcileHCLBTargets(fx.Ctx, lb, &corev1.Service{}, nodes)
+		assert.ErrorIs(t, err, ErrTargetsLocked)
+		assert.ErrorContains(t, err, "targets locked: 3, node2")
+		assert.True(t, changed)
+		fx.LBClient.AssertNumberOfCalls(t, "AddServerTarget", 3)
+		fx.LBClient.AssertNumberOfCalls(t, "RemoveServerTarget", 1)
+		fx.AssertExpectations()
+	})
+
+	t.Run("no retry of create", func(t *testing.T) {
+		lbClient := &mocks.LoadBalancerClient{}
+		lbClient.Test(t)
+		createOpts := hcloud.LoadBalancerCreateOpts{Name: "lb"}
+		lbClient.On("Create", ctx, createOpts).Return(hcloud.LoadBalancerCreateResult{}, nil, locked).Once()
+
+		_, _, err := NewRetryingLoadBalancerClient(lbClient, opts).Create(ctx, createOpts)
+		assert.Equal(t, locked, err)
+		lbClient.AssertNumberOfCalls(t, "Create", 1)
+	})
+}
@@ -0,0 +1,85 @@
+package hcops
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/syself/hrobot-go/models"
+)
+
+// errInvalidIPv6Offset is returned if an offset does not select an address
+// within the IPv6 subnet of a dedicated server.
+var errInvalidIPv6Offset = errors.New("invalid IPv6 offset")
+
+// robotIPv6PrefixLength is the prefix length of IPv6 subnets of dedicated
+// servers which are returned without a prefix length.
+const robotIPv6PrefixLength = 64
+
+// RobotServerIPv6 returns the IPv6 address of a dedicated server, which is
+// the first address of its IPv6 subnet, e.g. 2a01:f48:111:4221::1 for the
+// subnet 2a01:f48:111:4221::. It returns an empty string if the server has
+// no IPv6 subnet, and an error if the subnet is malformed.
+func RobotServerIPv6(server *models.Server) (string, error) {
+	return RobotServerIPv6WithOffset(server, nil)
+}
+
+// RobotServerIPv6WithOffset returns the address at offset within the IPv6
+// subnet of a dedicated server, e.g. 2a01:f48:111:4221::2 for the offset ::2
+// and the subnet 2a01:f48:111:4221::/64. A nil offset selects the first
+// address of the subnet.
+//
+// It returns an empty string if the server has no IPv6 subnet, and an error
+// if the subnet is malformed or the offset is not within the subnet.
+func RobotServerIPv6WithOffset(server *models.Server, offset net.IP) (string, error) {
+	if server.ServerIPv6Net == "" {
+		return "", nil
+	}
+	subnet, prefix, hasPrefix := strings.Cut(server.ServerIPv6Net, "/")
+	ip := net.ParseIP(subnet)
+	if ip == nil || ip.To4() != nil {
+		return "", fmt.Errorf("dedicated server %d: invalid IPv6 subnet %q", server.ServerNumber, server.ServerIPv6Net)
+	}
+	ones := robotIPv6PrefixLength
+	if hasPrefix {
+		var err error
+		ones, err = strconv.Atoi(prefix)
+		if err != nil || ones < 0 || ones > 8*net.IPv6len {
+			return "", fmt.Errorf("dedicated server %d: invalid IPv6 subnet %q", server.ServerNumber, server.ServerIPv6Net)
+		}
+	}
+	if offset == nil {
+		offset = net.IPv6loopback
+	}
+	if err := validateIPv6Offset(offset, ones); err != nil {
+		return "", fmt.Errorf("dedicated server %d: IPv6 subnet %q: %w", server.ServerNumber, server.ServerIPv6Net, err)
+	}
+
+	mask := net.CIDRMask(ones, 8*net.IPv6len)
+	ip = ip.To16()
+	result := make(net.IP, net.IPv6len)
+	for i := range result {
+		result[i] = ip[i]&mask[i] | offset[i]
+	}
+	return result.String(), nil
+}
+
+// validateIPv6Offset checks that offset is a non-zero address within a
+// subnet with the prefix length ones.
+func validateIPv6Offset(offset net.IP, ones int) error {
+	if len(offset) != net.IPv6len || offset.To4() != nil {
+		return fmt.Errorf("%w %s: not an IPv6 address", errInvalidIPv6Offset, offset)
+	}
+	if offset.Equal(net.IPv6unspecified) {
+		return fmt.Errorf("%w %s: selects the subnet address", errInvalidIPv6Offset, offset)
+	}
+	mask := net.CIDRMask(ones, 8*net.IPv6len)
+	for i := range offset {
+		if offset[i]&mask[i] != 0 {
+			return fmt.Errorf("%w %s: not within a /%d subnet", errInvalidIPv6Offset, offset, ones)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package hcops_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/hcops"
+	"github.com/syself/hrobot-go/models"
+)
+
+func TestRobotServerIPv6(t *testing.T) {
+	tests := []struct {
+		subnet   string
+		expected string
+		err      string
+	}{
+		{subnet: "2a01:f48:111:4221::", expected: "2a01:f48:111:4221::1"},
+		{subnet: "2a01:f48:111:4221::/64", expected: "2a01:f48:111:4221::1"},
+		{subnet: ""},
+		{subnet: "invalid", err: `dedicated server 3: invalid IPv6 subnet "invalid"`},
+		{subnet: "1.2.3.4", err: `dedicated server 3: invalid IPv6 subnet "1.2.3.4"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subnet, func(t *testing.T) {
+			ip, err := hcops.RobotServerIPv6(&models.Server{ServerNumber: 3, ServerIPv6Net: tt.subnet})
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, ip)
+		})
+	}
+}
+
+func TestRobotServerIPv6WithOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		subnet   string
+		offset   string
+		expected string
+		err      string
+	}{
+		{name: "default", subnet: "2a01:f48:111:4221::/64", expected: "2a01:f48:111:4221::1"},
+		{name: "address", subnet: "2a01:f48:111:4221::/64", offset: "::2", expected: "2a01:f48:111:4221::2"},
+		{name: "without prefix", subnet: "2a01:f48:111:4221::", offset: "::ff:1", expected: "2a01:f48:111:4221::ff:1"},
+		{name: "other /64", subnet: "2a01:f48:111:4200::/56", offset: "0:0:0:21::1", expected: "2a01:f48:111:4221::1"},
+		{
+			name:   "outside of subnet",
+			subnet: "2a01:f48:111:4221::/64",
+			offset: "0:0:0:1::1",
+			err:    `dedicated server 3: IPv6 subnet "2a01:f48:111:4221::/64": invalid IPv6 offset ::1:0:0:0:1: not within a /64 subnet`,
+		},
+		{
+			name:   "subnet address",
+			subnet: "2a01:f48:111:4221::/64",
+			offset: "::",
+			err:    `dedicated server 3: IPv6 subnet "2a01:f48:111:4221::/64": invalid IPv6 offset ::: selects the subnet address`,
+		},
+		{
+			name:   "IPv4 offset",
+			subnet: "2a01:f48:111:4221::/64",
+			offset: "0.0.0.1",
+			err:    `dedicated server 3: IPv6 subnet "2a01:f48:111:4221::/64": invalid IPv6 offset 0.0.0.1: not an IPv6 address`,
+		},
+		{name: "invalid prefix", subnet: "2a01:f48:111:4221::/129", err: `dedicated server 3: invalid IPv6 subnet "2a01:f48:111:4221::/129"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var offset net.IP
+			if tt.offset != "" {
+				offset = net.ParseIP(tt.offset)
+			}
+			ip, err := hcops.RobotServerIPv6WithOffset(&models.Server{ServerNumber: 3, ServerIPv6Net: tt.subnet}, offset)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, ip)
+		})
+	}
+}
@@ -120,6 +120,18 @@ func (c *AllServersCache) getCache(getSrv func() (*hcloud.Server, bool)) (*hclou
 			}
 			c.byPrivIP[n.IP.String()] = srv
 		}
+		// Alias IPs may be used as gateway of routes as well. They never
+		// replace the primary IP of another server.
+		for _, n := range srv.PrivateNet {
+			if c.Network != nil && n.Network.ID != c.Network.ID {
+				continue
+			}
+			for _, ip := range n.Aliases {
+				if _, ok := c.byPrivIP[ip.String()]; !ok {
+					c.byPrivIP[ip.String()] = srv
+				}
+			}
+		}
 
 		// Index servers by their names.
 		c.byName[srv.Name] = srv
@@ -242,6 +242,45 @@ func TestAllServersCache_DuplicatePrivateIP(t *testing.T) {
 	runAllServersCacheTests(t, "DuplicatePrivateIP", tmpl, cacheOps)
 }
 
+func TestAllServersCache_AliasIP(t *testing.T) {
+	network := &hcloud.Network{ID: 12345}
+	srv := &hcloud.Server{
+		ID:   101010,
+		Name: "cluster-node",
+		PrivateNet: []hcloud.ServerPrivateNet{
+			{
+				IP:      net.ParseIP("10.0.0.4"),
+				Aliases: []net.IP{net.ParseIP("10.0.0.5")},
+				Network: network,
+			},
+		},
+	}
+	other := &hcloud.Server{
+		ID:   101011,
+		Name: "other-node",
+		PrivateNet: []hcloud.ServerPrivateNet{
+			{
+				IP:      net.ParseIP("10.0.0.6"),
+				Aliases: []net.IP{net.ParseIP("10.0.0.4")},
+				Network: network,
+			},
+		},
+	}
+
+	serverClient := mocks.NewServerClient(t)
+	serverClient.On("All", mock.Anything).Return([]*hcloud.Server{other, srv}, nil)
+	cache := &hcops.AllServersCache{LoadFunc: serverClient.All, Network: network}
+
+	actual, err := cache.ByPrivateIP(net.ParseIP("10.0.0.5"))
+	assert.NoError(t, err)
+	assert.Equal(t, srv, actual)
+
+	// The alias IP of another server does not replace a primary IP.
+	actual, err = cache.ByPrivateIP(net.ParseIP("10.0.0.4"))
+	assert.NoError(t, err)
+	assert.Equal(t, srv, actual)
+}
+
 type allServersCacheOp func(c *hcops.AllServersCache) (*hcloud.Server, error)
 
 func newAllServersCacheOps(t *testing.T, srv *hcloud.Server) map[string]allServersCacheOp {
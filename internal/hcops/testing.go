@@ -9,6 +9,7 @@ import (
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/mocks"
 	"github.com/syself/hrobot-go/models"
+	"k8s.io/client-go/tools/record"
 )
 
 type LoadBalancerOpsFixture struct {
@@ -20,7 +21,8 @@ type LoadBalancerOpsFixture struct {
 	NetworkClient *mocks.NetworkClient
 	RobotClient   *mocks.RobotClient
 
-	LBOps *LoadBalancerOps
+	LBOps    *LoadBalancerOps
+	Recorder *record.FakeRecorder
 
 	T *testing.T
 }
@@ -33,6 +35,7 @@ func NewLoadBalancerOpsFixture(t *testing.T) *LoadBalancerOpsFixture {
 		CertClient:    &mocks.CertificateClient{},
 		NetworkClient: &mocks.NetworkClient{},
 		RobotClient:   &mocks.RobotClient{},
+		Recorder:      record.NewFakeRecorder(100),
 		T:             t,
 	}
 
@@ -48,6 +51,7 @@ func NewLoadBalancerOpsFixture(t *testing.T) *LoadBalancerOpsFixture {
 		ActionClient:  fx.ActionClient,
 		NetworkClient: fx.NetworkClient,
 		RobotClient:   fx.RobotClient,
+		Recorder:      fx.Recorder,
 	}
 
 	return fx
@@ -18,6 +18,9 @@ package metrics
 
 import (
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -29,6 +32,135 @@ var OperationCalled = prometheus.NewCounterVec(prometheus.CounterOpts{
 	Help: "The total number of operation was called",
 }, []string{"op"})
 
+// RobotCacheRequests counts requests to the robot cache by result, which is
+// either "hit" if the request was served from the cache, "miss" if the
+// cache had to be refreshed or "stale" if the timed out cache was served
+// because the rate limit of the Robot API was exceeded.
+var RobotCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cloud_controller_manager_robot_cache_requests_total",
+	Help: "The total number of requests to the robot cache",
+}, []string{"result"})
+
+// RobotCacheRefreshes counts refreshes of the robot cache by result, which is
+// either "success" or "error".
+var RobotCacheRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cloud_controller_manager_robot_cache_refreshes_total",
+	Help: "The total number of refreshes of the robot cache",
+}, []string{"result"})
+
+// InstanceMetadataFallbacks counts the lookups of instance metadata which
+// failed with a transient error and were answered with the last known
+// metadata of the node.
+var InstanceMetadataFallbacks = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "cloud_controller_manager_instance_metadata_fallbacks_total",
+	Help: "The total number of instance metadata lookups answered with stale metadata",
+})
+
+// InstanceMetadataCacheHits counts the lookups of instance metadata which
+// were answered from the metadata cache without requesting the server.
+var InstanceMetadataCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "cloud_controller_manager_instance_metadata_cache_hits_total",
+	Help: "The total number of instance metadata lookups answered from the cache",
+})
+
+// AmbiguousServerNames counts the lookups of nodes by name which matched
+// more than one server and failed instead of picking one of them.
+var AmbiguousServerNames = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "cloud_controller_manager_ambiguous_server_names_total",
+	Help: "The total number of node lookups by name which matched more than one server",
+})
+
+// LoadBalancerOpenConnections, LoadBalancerConnectionsPerSecond,
+// LoadBalancerRequestsPerSecond and LoadBalancerBandwidth expose the metrics
+// of the managed Load Balancers, as reported by the Hetzner Cloud API. They
+// are only set if the Load Balancer metrics exporter is enabled.
+var (
+	LoadBalancerOpenConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloud_controller_manager_load_balancer_open_connections",
+		Help: "The number of open connections of the load balancer",
+	}, []string{"load_balancer", "service"})
+	LoadBalancerConnectionsPerSecond = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloud_controller_manager_load_balancer_connections_per_second",
+		Help: "The number of new connections per second of the load balancer",
+	}, []string{"load_balancer", "service"})
+	LoadBalancerRequestsPerSecond = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloud_controller_manager_load_balancer_requests_per_second",
+		Help: "The number of HTTP requests per second of the load balancer",
+	}, []string{"load_balancer", "service"})
+	LoadBalancerBandwidth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloud_controller_manager_load_balancer_bandwidth_bytes_per_second",
+		Help: "The bandwidth of the load balancer in bytes per second, by direction",
+	}, []string{"load_balancer", "service", "direction"})
+)
+
+// LoadBalancerMetricsScrapes counts the fetches of Load Balancer metrics from
+// the Hetzner Cloud API by result, which is either "success" or "error".
+var LoadBalancerMetricsScrapes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cloud_controller_manager_load_balancer_metrics_scrapes_total",
+	Help: "The total number of fetches of load balancer metrics",
+}, []string{"result"})
+
+// CredentialFileLastModified is the modification time of the credential
+// files, as seen by the last read of their content, in seconds since the
+// epoch. A rotated secret which is not picked up keeps its old time.
+var CredentialFileLastModified = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "cloud_controller_manager_credential_file_last_modified_seconds",
+	Help: "The modification time of the credential file when it was last read",
+}, []string{"file"})
+
+// HCloudAPIInFlightRequests, HCloudAPIRequests and HCloudAPIRequestDuration
+// instrument the requests to the Hetzner Cloud API, like the instrumentation
+// of hcloud-go. They are used instead of it if the instrumentation of
+// hcloud-go can not be used, see InstrumentHCloudAPI.
+var (
+	HCloudAPIInFlightRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hcloud_api_in_flight_requests",
+		Help: "A gauge of in-flight requests to the hcloud api.",
+	})
+	HCloudAPIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hcloud_api_requests_total",
+		Help: "A counter for requests to the hcloud api per endpoint.",
+	}, []string{"code", "method", "api_endpoint"})
+	HCloudAPIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hcloud_api_request_duration_seconds",
+		Help:    "A histogram of request latencies to the hcloud api .",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+// InstrumentHCloudAPI returns next with its requests to the Hetzner Cloud API
+// recorded in the metrics of hcloud-go. The instrumentation of hcloud-go
+// always sends the requests with http.DefaultTransport, it can not be used
+// with a custom transport.
+func InstrumentHCloudAPI(next http.RoundTripper) http.RoundTripper {
+	for _, c := range []prometheus.Collector{HCloudAPIInFlightRequests, HCloudAPIRequests, HCloudAPIRequestDuration} {
+		// Clients created before already registered the metrics.
+		_ = registry.Register(c)
+	}
+	endpoint := promhttp.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(r)
+		if err == nil {
+			HCloudAPIRequests.WithLabelValues(
+				strconv.Itoa(resp.StatusCode), strings.ToLower(resp.Request.Method), apiEndpointLabel(resp.Request.URL.Path),
+			).Inc()
+		}
+		return resp, err
+	})
+	return promhttp.InstrumentRoundTripperInFlight(HCloudAPIInFlightRequests,
+		promhttp.InstrumentRoundTripperDuration(HCloudAPIRequestDuration, endpoint))
+}
+
+var apiEndpointLabelRegexp = regexp.MustCompile("[^a-z/_]+")
+
+// apiEndpointLabel returns the path of a Hetzner Cloud API request without
+// IDs and API version, e.g. /volumes/actions/attach for
+// /v1/volumes/1234/actions/attach.
+func apiEndpointLabel(path string) string {
+	path = apiEndpointLabelRegexp.ReplaceAllString(strings.ToLower(path), "")
+	path = strings.ReplaceAll(path, "//", "/")
+	return strings.Replace(path, "/v/", "/", 1)
+}
+
 var registry = prometheus.NewRegistry()
 
 func GetRegistry() *prometheus.Registry {
@@ -39,6 +171,17 @@ func Serve(address string) {
 	klog.Info("Starting metrics server at ", address)
 
 	registry.MustRegister(OperationCalled)
+	registry.MustRegister(RobotCacheRequests)
+	registry.MustRegister(RobotCacheRefreshes)
+	registry.MustRegister(InstanceMetadataFallbacks)
+	registry.MustRegister(InstanceMetadataCacheHits)
+	registry.MustRegister(AmbiguousServerNames)
+	registry.MustRegister(LoadBalancerOpenConnections)
+	registry.MustRegister(LoadBalancerConnectionsPerSecond)
+	registry.MustRegister(LoadBalancerRequestsPerSecond)
+	registry.MustRegister(LoadBalancerBandwidth)
+	registry.MustRegister(LoadBalancerMetricsScrapes)
+	registry.MustRegister(CredentialFileLastModified)
 
 	gatherers := prometheus.Gatherers{
 		prometheus.DefaultGatherer,
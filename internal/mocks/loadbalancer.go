@@ -64,6 +64,13 @@ func (m *LoadBalancerClient) ChangeAlgorithm(
 	return getActionPtr(args, 0), getResponsePtr(args, 1), args.Error(2)
 }
 
+func (m *LoadBalancerClient) ChangeProtection(
+	ctx context.Context, lb *hcloud.LoadBalancer, opts hcloud.LoadBalancerChangeProtectionOpts,
+) (*hcloud.Action, *hcloud.Response, error) {
+	args := m.Called(ctx, lb, opts)
+	return getActionPtr(args, 0), getResponsePtr(args, 1), args.Error(2)
+}
+
 func (m *LoadBalancerClient) ChangeDNSPtr(
 	ctx context.Context, lb *hcloud.LoadBalancer, ip string, ptr *string,
 ) (*hcloud.Action, *hcloud.Response, error) {
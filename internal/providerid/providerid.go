@@ -0,0 +1,67 @@
+// Package providerid parses the provider IDs of Kubernetes nodes.
+package providerid
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// PrefixHCloud prefixes the provider IDs of Hetzner Cloud servers, and of
+	// robot servers in the default format.
+	PrefixHCloud = "hcloud://"
+
+	// PrefixHRobot prefixes the provider IDs of robot servers in the hrobot
+	// format.
+	PrefixHRobot = "hrobot://"
+
+	// HostNamePrefixRobot prefixes the server IDs of robot servers in the
+	// default format.
+	HostNamePrefixRobot = "bm-"
+)
+
+// ToServerID returns the server ID of providerID and whether it belongs to a
+// Hetzner Cloud server rather than a robot server. If additionalPrefix is not
+// empty, it is accepted in place of PrefixHCloud.
+func ToServerID(providerID, additionalPrefix string) (id int64, isHCloudServer bool, err error) {
+	const op = "providerid/ToServerID"
+	metrics.OperationCalled.WithLabelValues(op).Inc()
+
+	if additionalPrefix != "" && strings.HasPrefix(providerID, additionalPrefix) {
+		providerID = PrefixHCloud + strings.TrimPrefix(providerID, additionalPrefix)
+	}
+
+	prefixRobot := PrefixHCloud + HostNamePrefixRobot
+
+	if !strings.HasPrefix(providerID, PrefixHCloud) && !strings.HasPrefix(providerID, PrefixHRobot) {
+		klog.Infof("%s: make sure your cluster configured for an external cloud provider", op)
+		return 0, false, fmt.Errorf("%s: missing prefix %s, %s or %s: %s", op, PrefixHCloud, prefixRobot, PrefixHRobot, providerID)
+	}
+
+	isHCloudServer = true
+	var idString string
+	switch {
+	case strings.HasPrefix(providerID, prefixRobot):
+		isHCloudServer = false
+		idString = strings.TrimPrefix(providerID, prefixRobot)
+	case strings.HasPrefix(providerID, PrefixHRobot):
+		isHCloudServer = false
+		idString = strings.TrimPrefix(providerID, PrefixHRobot)
+	default:
+		idString = strings.TrimPrefix(providerID, PrefixHCloud)
+	}
+
+	if idString == "" {
+		return 0, false, fmt.Errorf("%s: missing serverID: %s", op, providerID)
+	}
+
+	id, err = strconv.ParseInt(idString, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: invalid serverID: %s", op, providerID)
+	}
+	return id, isHCloudServer, nil
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/syself/hetzner-cloud-controller-manager/internal/credentials"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
 	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/util"
 	hrobot "github.com/syself/hrobot-go"
@@ -20,12 +22,15 @@ const (
 	cacheTimeoutENVVar  = "CACHE_TIMEOUT"
 )
 
-var _ robotclient.Client = &cacheRobotClient{}
+var _ robotclient.CachingClient = &cacheRobotClient{}
 
 type cacheRobotClient struct {
 	robotClient hrobot.RobotClient
 	timeout     time.Duration
 
+	// mu guards the cache, which is drained by credential reloads while
+	// it is in use.
+	mu         sync.Mutex
 	lastUpdate time.Time
 
 	// cache
@@ -34,7 +39,11 @@ type cacheRobotClient struct {
 }
 
 // NewCachedRobotClient creates a new robot client with caching enabled.
-// rootDir: root directory for reading credentials from file.
+// If the credentials directory contains additional robot credential sets, the
+// returned client implements robotclient.CredentialSetClient and uses each
+// set for its servers.
+// rootDir: root directory for reading credentials from file. ROBOT_USER_FILE
+// and ROBOT_PASSWORD_FILE override the files of the robot credentials.
 // httpClient: http client to use for the robot client.
 // baseURL: base URL for the robot client. Optional, leave empty for default.
 // Returns nil and no error if the robot client could not be created, because
@@ -56,8 +65,11 @@ func NewCachedRobotClient(rootDir string, httpClient *http.Client, baseURL strin
 
 	credentialsDir := credentials.GetDirectory(rootDir)
 	_, err = os.Stat(credentialsDir)
-	var robotUser, robotPassword string
-	if err != nil {
+	var (
+		robotUser, robotPassword string
+		sets                     []credentials.RobotCredentialSet
+	)
+	if err != nil && !credentials.RobotCredentialFilesConfigured() {
 		klog.V(1).Infof("reading Hetzner Robot credentials from file failed. %q does not exist", credentialsDir)
 		robotUser = os.Getenv(robotUserNameENVVar)
 		robotPassword = os.Getenv(robotPasswordENVVar)
@@ -68,40 +80,48 @@ func NewCachedRobotClient(rootDir string, httpClient *http.Client, baseURL strin
 			return nil, nil
 		}
 	} else {
+		dirExists := err == nil
 		robotUser, robotPassword, err = credentials.GetInitialRobotCredentials(credentialsDir)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
+		if dirExists {
+			sets, err = credentials.GetInitialRobotCredentialSets(credentialsDir)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
 	}
-	c := hrobot.NewBasicAuthClientWithCustomHttpClient(robotUser, robotPassword, httpClient)
-	if baseURL != "" {
-		c.SetBaseURL(baseURL)
+
+	newClient := func(username, password string) *cacheRobotClient {
+		c := hrobot.NewBasicAuthClientWithCustomHttpClient(username, password, httpClient)
+		if baseURL != "" {
+			c.SetBaseURL(baseURL)
+		}
+		return &cacheRobotClient{robotClient: c, timeout: cacheTimeout}
 	}
 
-	handler := &cacheRobotClient{}
-	handler.timeout = cacheTimeout
-	handler.robotClient = c
-	return handler, nil
+	handler := newClient(robotUser, robotPassword)
+	if len(sets) == 0 {
+		return handler, nil
+	}
+
+	multi := &multiRobotClient{defaultClient: handler}
+	for _, set := range sets {
+		multi.sets = append(multi.sets, newCredentialSet(set, newClient(set.Username, set.Password)))
+	}
+	klog.Infof("using %d additional Hetzner Robot credential sets", len(sets))
+	return multi, nil
 }
 
 func (c *cacheRobotClient) ServerGet(id int) (*models.Server, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.shouldSync() {
-		list, err := c.robotClient.ServerGetList()
-		if err != nil {
+		if err := c.refresh(); err != nil {
 			return nil, err
 		}
-
-		// populate list
-		c.l = list
-
-		// remove all entries from map and populate it freshly
-		c.m = make(map[int]*models.Server)
-		for i, server := range list {
-			c.m[server.ServerNumber] = &list[i]
-		}
-
-		// set time of last update
-		c.lastUpdate = time.Now()
 	}
 
 	server, found := c.m[id]
@@ -114,46 +134,84 @@ func (c *cacheRobotClient) ServerGet(id int) (*models.Server, error) {
 }
 
 func (c *cacheRobotClient) ServerGetList() ([]models.Server, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.shouldSync() {
-		list, err := c.robotClient.ServerGetList()
-		if err != nil {
-			return list, err
+		if err := c.refresh(); err != nil {
+			return nil, err
 		}
+	}
 
-		// populate list
-		c.l = list
+	return c.l, nil
+}
 
-		// remove all entries from map and populate it freshly
-		c.m = make(map[int]*models.Server)
-		for i, server := range list {
-			c.m[server.ServerNumber] = &list[i]
-		}
+// CachedServerGetList returns the servers of the last successful refresh,
+// even if the cache timed out, e.g. to answer requests while the rate limit of
+// the Robot API is exceeded.
+func (c *cacheRobotClient) CachedServerGetList() ([]models.Server, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		// set time of last update
-		c.lastUpdate = time.Now()
+	if c.lastUpdate.IsZero() {
+		return nil, false
 	}
+	return c.l, true
+}
 
-	return c.l, nil
+// refresh replaces the cached servers with the current list of the Robot
+// API.
+func (c *cacheRobotClient) refresh() error {
+	list, err := c.robotClient.ServerGetList()
+	if err != nil {
+		metrics.RobotCacheRefreshes.WithLabelValues("error").Inc()
+		return err
+	}
+	metrics.RobotCacheRefreshes.WithLabelValues("success").Inc()
+
+	// populate list
+	c.l = list
+
+	// remove all entries from map and populate it freshly
+	c.m = make(map[int]*models.Server)
+	for i, server := range list {
+		c.m[server.ServerNumber] = &list[i]
+	}
+
+	// set time of last update
+	c.lastUpdate = time.Now()
+	return nil
 }
 
 func (c *cacheRobotClient) shouldSync() bool {
 	// map is nil means we have no cached value yet
 	if c.m == nil {
 		c.m = make(map[int]*models.Server)
+		metrics.RobotCacheRequests.WithLabelValues("miss").Inc()
 		return true
 	}
 	if time.Now().After(c.lastUpdate.Add(c.timeout)) {
+		metrics.RobotCacheRequests.WithLabelValues("miss").Inc()
 		return true
 	}
+	metrics.RobotCacheRequests.WithLabelValues("hit").Inc()
 	return false
 }
 
+// SetCredentials updates the credentials of the client and drains the cache.
+// The servers visible to the new credentials may differ, e.g. if they belong
+// to another account, so the next request lists the servers again.
 func (c *cacheRobotClient) SetCredentials(username, password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	err := c.robotClient.SetCredentials(username, password)
 	if err != nil {
 		return err
 	}
-	// The credentials have been updated, so we need to invalidate the cache.
+	c.l = nil
 	c.m = nil
+	c.lastUpdate = time.Time{}
+	klog.V(1).Info("robot credentials changed, drained robot server cache")
 	return nil
 }
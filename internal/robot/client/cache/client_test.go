@@ -8,11 +8,16 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	"github.com/syself/hetzner-cloud-controller-manager/internal/credentials"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/metrics"
+	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
+	hrobot "github.com/syself/hrobot-go"
 	"github.com/syself/hrobot-go/models"
 )
 
@@ -42,7 +47,9 @@ func Test_updateRobotCredentials(t *testing.T) {
 
 	wantAuth := base64.StdEncoding.EncodeToString([]byte("my-robot-user:my-robot-password"))
 
+	var requests atomic.Int32
 	mux.HandleFunc("/robot/server", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
 		header := r.Header.Get("Authorization")
 		require.Equal(t, "Basic "+wantAuth, header)
 		fmt.Println(header)
@@ -62,11 +69,17 @@ func Test_updateRobotCredentials(t *testing.T) {
 	robotClient, err := NewCachedRobotClient(rootDir, httpClient, server.URL+"/robot")
 	require.NoError(t, err)
 	require.NotNil(t, robotClient)
-	err = credentials.Watch(credentials.GetDirectory(rootDir), nil, robotClient)
+	err = credentials.Watch(credentials.GetDirectory(rootDir), nil, robotClient, 0)
 	require.NoError(t, err)
 	servers, err := robotClient.ServerGetList()
 	require.NoError(t, err)
 	require.Len(t, servers, 1)
+	require.Equal(t, int32(1), requests.Load())
+
+	// Served from the cache.
+	_, err = robotClient.ServerGetList()
+	require.NoError(t, err)
+	require.Equal(t, int32(1), requests.Load())
 
 	oldCount := credentials.GetRobotReloadCounter()
 	err = writeCredentials(rootDir, "user2", "password2")
@@ -83,30 +96,35 @@ func Test_updateRobotCredentials(t *testing.T) {
 		time.Sleep(time.Millisecond * 100)
 	}
 
+	// The reload drained the cache, the servers are listed again with the
+	// new credentials.
 	wantAuth = base64.StdEncoding.EncodeToString([]byte("user2:password2"))
 	servers, err = robotClient.ServerGetList()
 	require.NoError(t, err)
 	require.Len(t, servers, 1)
+	require.Equal(t, int32(2), requests.Load())
 }
 
 func writeCredentials(rootDir, user, password string) error {
-	credentialsDir := credentials.GetDirectory(rootDir)
-	newDir := filepath.Join(credentialsDir, "..dataNew")
+	return writeSecret(credentials.GetDirectory(rootDir), map[string]string{
+		"robot-user":     user,
+		"robot-password": password,
+	})
+}
+
+// writeSecret updates the files in dir like Kubernetes updates a mounted
+// secret, by replacing the ..data directory.
+func writeSecret(dir string, files map[string]string) error {
+	newDir := filepath.Join(dir, "..dataNew")
 	if err := os.MkdirAll(newDir, 0o700); err != nil {
 		return err
 	}
-	err := os.WriteFile(filepath.Join(newDir, "robot-user"),
-		[]byte(user), 0o600)
-	if err != nil {
-		return err
-	}
-
-	err = os.WriteFile(filepath.Join(newDir, "robot-password"),
-		[]byte(password), 0o600)
-	if err != nil {
-		return err
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(newDir, name), []byte(content), 0o600); err != nil {
+			return err
+		}
 	}
-	targetDir := filepath.Join(credentialsDir, "..data")
+	targetDir := filepath.Join(dir, "..data")
 	if err := os.RemoveAll(targetDir); err != nil {
 		return err
 	}
@@ -115,3 +133,207 @@ func writeCredentials(rootDir, user, password string) error {
 	}
 	return nil
 }
+
+func Test_robotCredentialFiles(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	os.Unsetenv(robotUserNameENVVar)
+	os.Unsetenv(robotPasswordENVVar)
+
+	// The credentials directory does not exist, the robot credentials are
+	// mounted elsewhere.
+	rootDir := t.TempDir()
+	secretDir := filepath.Join(t.TempDir(), "robot")
+	require.NoError(t, os.MkdirAll(secretDir, 0o755))
+	require.NoError(t, os.Symlink("..data/user", filepath.Join(secretDir, "user")))
+	require.NoError(t, os.Symlink("..data/password", filepath.Join(secretDir, "password")))
+	require.NoError(t, writeSecret(secretDir, map[string]string{"user": "custom-user", "password": "custom-password"}))
+	t.Setenv("ROBOT_USER_FILE", filepath.Join(secretDir, "user"))
+	t.Setenv("ROBOT_PASSWORD_FILE", filepath.Join(secretDir, "password"))
+
+	var auth atomic.Value
+	mux.HandleFunc("/robot/server", func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode([]models.ServerResponse{
+			{Server: models.Server{ServerIP: "123.123.123.12", ServerNumber: 321, Name: "bm-server1"}},
+		})
+	})
+
+	robotClient, err := NewCachedRobotClient(rootDir, server.Client(), server.URL+"/robot")
+	require.NoError(t, err)
+	require.NotNil(t, robotClient)
+	require.NoError(t, credentials.Watch(credentials.GetDirectory(rootDir), nil, robotClient, 0))
+
+	_, err = robotClient.ServerGetList()
+	require.NoError(t, err)
+	require.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("custom-user:custom-password")), auth.Load())
+
+	oldCount := credentials.GetRobotReloadCounter()
+	require.NoError(t, writeSecret(secretDir, map[string]string{"user": "user2", "password": "password2"}))
+	require.Eventually(t, func() bool {
+		return credentials.GetRobotReloadCounter() > oldCount
+	}, 3*time.Second, 100*time.Millisecond)
+
+	_, err = robotClient.ServerGetList()
+	require.NoError(t, err)
+	require.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("user2:password2")), auth.Load())
+}
+
+func Test_cacheMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/robot/server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]models.ServerResponse{
+			{Server: models.Server{ServerNumber: 321, Name: "bm-server1"}},
+		})
+	})
+
+	robotClient := hrobot.NewBasicAuthClientWithCustomHttpClient("user", "password", server.Client())
+	robotClient.SetBaseURL(server.URL + "/robot")
+	c := &cacheRobotClient{robotClient: robotClient, timeout: time.Minute}
+
+	hits := testutil.ToFloat64(metrics.RobotCacheRequests.WithLabelValues("hit"))
+	misses := testutil.ToFloat64(metrics.RobotCacheRequests.WithLabelValues("miss"))
+	refreshes := testutil.ToFloat64(metrics.RobotCacheRefreshes.WithLabelValues("success"))
+
+	// The first request fills the cache, the second one is served from it.
+	_, err := c.ServerGetList()
+	require.NoError(t, err)
+	_, err = c.ServerGet(321)
+	require.NoError(t, err)
+
+	require.Equal(t, hits+1, testutil.ToFloat64(metrics.RobotCacheRequests.WithLabelValues("hit")))
+	require.Equal(t, misses+1, testutil.ToFloat64(metrics.RobotCacheRequests.WithLabelValues("miss")))
+	require.Equal(t, refreshes+1, testutil.ToFloat64(metrics.RobotCacheRefreshes.WithLabelValues("success")))
+}
+
+func Test_cachedServerGetList(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var rateLimited atomic.Bool
+	mux.HandleFunc("/robot/server", func(w http.ResponseWriter, r *http.Request) {
+		if rateLimited.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: models.Error{Code: models.ErrorCodeRateLimitExceeded}})
+			return
+		}
+		json.NewEncoder(w).Encode([]models.ServerResponse{
+			{Server: models.Server{ServerNumber: 321, Name: "bm-server1"}},
+		})
+	})
+
+	robotClient := hrobot.NewBasicAuthClientWithCustomHttpClient("user", "password", server.Client())
+	robotClient.SetBaseURL(server.URL + "/robot")
+	c := &cacheRobotClient{robotClient: robotClient, timeout: time.Minute}
+
+	// Nothing is cached before the first refresh.
+	_, ok := c.CachedServerGetList()
+	require.False(t, ok)
+
+	_, err := c.ServerGetList()
+	require.NoError(t, err)
+
+	// The timed out cache is kept if the refresh is rate limited.
+	c.lastUpdate = time.Now().Add(-2 * time.Minute)
+	rateLimited.Store(true)
+	_, err = c.ServerGetList()
+	require.Error(t, err)
+
+	servers, ok := c.CachedServerGetList()
+	require.True(t, ok)
+	require.Len(t, servers, 1)
+	require.Equal(t, "bm-server1", servers[0].Name)
+}
+
+func Test_credentialSets(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	rootDir := t.TempDir()
+	credentialsDir := credentials.GetDirectory(rootDir)
+	require.NoError(t, os.MkdirAll(credentialsDir, 0o755))
+	for name, v := range map[string]string{
+		"robot-user":             "default-user",
+		"robot-password":         "default-password",
+		"robot-user-pool-a":      "pool-a-user",
+		"robot-password-pool-a":  "pool-a-password",
+		"robot-servers-pool-a":   "42, 43",
+		"robot-servers-ignored":  "44",
+		"robot-password-ignored": "no user",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(credentialsDir, name), []byte(v), 0o600))
+	}
+
+	basicAuth := func(user, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+	servers := map[string][]models.ServerResponse{
+		basicAuth("default-user", "default-password"): {
+			{Server: models.Server{ServerNumber: 321, Name: "bm-default"}},
+			{Server: models.Server{ServerNumber: 43, Name: "bm-visible-to-both"}},
+		},
+		basicAuth("pool-a-user", "pool-a-password"): {
+			{Server: models.Server{ServerNumber: 42, Name: "bm-pool-a"}},
+			{Server: models.Server{ServerNumber: 43, Name: "bm-visible-to-both"}},
+		},
+		basicAuth("pool-a-user", "new-password"): {
+			{Server: models.Server{ServerNumber: 42, Name: "bm-pool-a-new"}},
+		},
+	}
+	mux.HandleFunc("/robot/server", func(w http.ResponseWriter, r *http.Request) {
+		list, ok := servers[r.Header.Get("Authorization")]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: models.Error{Code: models.ErrorCodeUnauthorized}})
+			return
+		}
+		json.NewEncoder(w).Encode(list)
+	})
+
+	robotClient, err := NewCachedRobotClient(rootDir, server.Client(), server.URL+"/robot")
+	require.NoError(t, err)
+	setClient, ok := robotClient.(robotclient.CredentialSetClient)
+	require.True(t, ok)
+	require.Equal(t, []string{"pool-a"}, setClient.CredentialSets())
+
+	s, err := robotClient.ServerGet(42)
+	require.NoError(t, err)
+	require.Equal(t, "bm-pool-a", s.Name)
+	s, err = robotClient.ServerGet(321)
+	require.NoError(t, err)
+	require.Equal(t, "bm-default", s.Name)
+
+	list, err := robotClient.ServerGetList()
+	require.NoError(t, err)
+	var names []string
+	for _, s := range list {
+		names = append(names, s.Name)
+	}
+	require.ElementsMatch(t, []string{"bm-default", "bm-pool-a", "bm-visible-to-both"}, names)
+
+	// The credentials of a set are reloaded independently.
+	require.NoError(t, credentials.Watch(credentialsDir, nil, robotClient, 0))
+	oldCount := credentials.GetRobotReloadCounter()
+	require.NoError(t, os.WriteFile(filepath.Join(credentialsDir, "robot-password-pool-a"), []byte("new-password"), 0o600))
+	start := time.Now()
+	for credentials.GetRobotReloadCounter() == oldCount {
+		if time.Since(start) > time.Second*3 {
+			t.Fatal("timeout waiting for reload")
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	s, err = robotClient.ServerGet(42)
+	require.NoError(t, err)
+	require.Equal(t, "bm-pool-a-new", s.Name)
+	s, err = robotClient.ServerGet(321)
+	require.NoError(t, err)
+	require.Equal(t, "bm-default", s.Name)
+}
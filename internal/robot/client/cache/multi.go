@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/syself/hetzner-cloud-controller-manager/internal/credentials"
+	robotclient "github.com/syself/hetzner-cloud-controller-manager/internal/robot/client"
+	"github.com/syself/hrobot-go/models"
+)
+
+var (
+	_ robotclient.CredentialSetClient = &multiRobotClient{}
+	_ robotclient.CachingClient       = &multiRobotClient{}
+)
+
+// multiRobotClient routes requests to the robot credential set a server
+// belongs to. Servers which are not part of any set use the default
+// credentials.
+type multiRobotClient struct {
+	defaultClient *cacheRobotClient
+	sets          []*credentialSet
+}
+
+type credentialSet struct {
+	name    string
+	servers map[int]bool
+	client  *cacheRobotClient
+}
+
+func newCredentialSet(set credentials.RobotCredentialSet, client *cacheRobotClient) *credentialSet {
+	servers := make(map[int]bool, len(set.Servers))
+	for _, id := range set.Servers {
+		servers[id] = true
+	}
+	return &credentialSet{name: set.Name, servers: servers, client: client}
+}
+
+func (c *multiRobotClient) ServerGet(id int) (*models.Server, error) {
+	if set := c.setOf(id); set != nil {
+		server, err := set.client.ServerGet(id)
+		if err != nil {
+			return nil, fmt.Errorf("robot credential set %q: %w", set.name, err)
+		}
+		return server, nil
+	}
+	return c.defaultClient.ServerGet(id)
+}
+
+// ServerGetList returns the servers of all credential sets. Each set only
+// contributes the servers it is configured for, so a server visible to
+// several accounts is returned once.
+func (c *multiRobotClient) ServerGetList() ([]models.Server, error) {
+	list, err := c.defaultClient.ServerGetList()
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []models.Server
+	for _, server := range list {
+		if c.setOf(server.ServerNumber) == nil {
+			servers = append(servers, server)
+		}
+	}
+	for _, set := range c.sets {
+		list, err := set.client.ServerGetList()
+		if err != nil {
+			return nil, fmt.Errorf("robot credential set %q: %w", set.name, err)
+		}
+		for _, server := range list {
+			if set.servers[server.ServerNumber] {
+				servers = append(servers, server)
+			}
+		}
+	}
+	return servers, nil
+}
+
+// CachedServerGetList returns the cached servers of all credential sets like
+// ServerGetList, and false unless the servers of every set are cached.
+func (c *multiRobotClient) CachedServerGetList() ([]models.Server, bool) {
+	list, ok := c.defaultClient.CachedServerGetList()
+	if !ok {
+		return nil, false
+	}
+
+	var servers []models.Server
+	for _, server := range list {
+		if c.setOf(server.ServerNumber) == nil {
+			servers = append(servers, server)
+		}
+	}
+	for _, set := range c.sets {
+		list, ok := set.client.CachedServerGetList()
+		if !ok {
+			return nil, false
+		}
+		for _, server := range list {
+			if set.servers[server.ServerNumber] {
+				servers = append(servers, server)
+			}
+		}
+	}
+	return servers, true
+}
+
+func (c *multiRobotClient) setOf(id int) *credentialSet {
+	for _, set := range c.sets {
+		if set.servers[id] {
+			return set
+		}
+	}
+	return nil
+}
+
+func (c *multiRobotClient) SetCredentials(username, password string) error {
+	return c.defaultClient.SetCredentials(username, password)
+}
+
+func (c *multiRobotClient) CredentialSets() []string {
+	names := make([]string, 0, len(c.sets))
+	for _, set := range c.sets {
+		names = append(names, set.name)
+	}
+	return names
+}
+
+func (c *multiRobotClient) SetCredentialSet(name, username, password string) error {
+	for _, set := range c.sets {
+		if set.name == name {
+			return set.client.SetCredentials(username, password)
+		}
+	}
+	return fmt.Errorf("unknown robot credential set %q", name)
+}
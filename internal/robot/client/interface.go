@@ -7,3 +7,25 @@ type Client interface {
 	ServerGetList() ([]models.Server, error)
 	SetCredentials(username, password string) error
 }
+
+// CredentialSetClient is a Client which uses additional sets of credentials
+// for some of the servers. SetCredentials updates the default credentials.
+type CredentialSetClient interface {
+	Client
+
+	// CredentialSets returns the names of the additional credential sets.
+	CredentialSets() []string
+
+	// SetCredentialSet updates the credentials of the set name.
+	SetCredentialSet(name, username, password string) error
+}
+
+// CachingClient is a Client which caches the servers of the Robot API.
+type CachingClient interface {
+	Client
+
+	// CachedServerGetList returns the cached servers without requesting the
+	// Robot API, and false if no servers are cached. The servers may be
+	// stale.
+	CachedServerGetList() ([]models.Server, bool)
+}
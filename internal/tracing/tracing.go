@@ -0,0 +1,101 @@
+// Package tracing creates OpenTelemetry spans for the reconciliation of Load
+// Balancers and nodes. Tracing is disabled until Setup or SetTracerProvider
+// is called. Until then Start returns the context unchanged and a no-op span.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	instrumentationName = "github.com/syself/hetzner-cloud-controller-manager"
+	serviceName         = "hcloud-cloud-controller-manager"
+)
+
+var enabled atomic.Bool
+
+// Setup installs a tracer provider exporting spans via OTLP/gRPC. The
+// exporter and the resource are configured with the standard OTEL_*
+// environment variables, e.g. OTEL_EXPORTER_OTLP_ENDPOINT and
+// OTEL_SERVICE_NAME.
+func Setup(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create trace exporter: %w", err)
+	}
+	res, err := resource.Merge(
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create trace resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	klog.Info("OpenTelemetry tracing enabled")
+	return tp.Shutdown, nil
+}
+
+// SetTracerProvider enables tracing with tp as global tracer provider. A nil
+// tp disables tracing again.
+func SetTracerProvider(tp trace.TracerProvider) {
+	if tp == nil {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		enabled.Store(false)
+		return
+	}
+	otel.SetTracerProvider(tp)
+	enabled.Store(true)
+}
+
+// Start starts a span named op. If tracing is disabled, ctx is returned
+// unchanged together with a no-op span.
+func Start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !enabled.Load() {
+		return ctx, noop.Span{}
+	}
+	return otel.Tracer(instrumentationName).Start(ctx, op, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, and ends span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Service returns the attributes identifying svc.
+func Service(svc *corev1.Service) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("k8s.namespace.name", svc.Namespace),
+		attribute.String("k8s.service.name", svc.Name),
+		attribute.String("k8s.service.uid", string(svc.UID)),
+	}
+}
+
+// Node returns the attributes identifying node.
+func Node(node *corev1.Node) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("k8s.node.name", node.Name),
+		attribute.String("k8s.node.provider_id", node.Spec.ProviderID),
+	}
+}
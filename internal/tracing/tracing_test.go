@@ -0,0 +1,38 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syself/hetzner-cloud-controller-manager/internal/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStartDisabled(t *testing.T) {
+	ctx := context.Background()
+	spanCtx, span := tracing.Start(ctx, "op")
+	assert.Equal(t, ctx, spanCtx)
+	assert.False(t, span.IsRecording())
+	tracing.End(span, errors.New("test error"))
+}
+
+func TestStartEnabled(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer tracing.SetTracerProvider(nil)
+
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	_, child := tracing.Start(ctx, "child")
+	tracing.End(child, nil)
+	tracing.End(parent, nil)
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "child", spans[0].Name)
+		assert.Equal(t, trace.SpanFromContext(ctx).SpanContext().SpanID(), spans[0].Parent.SpanID())
+	}
+}